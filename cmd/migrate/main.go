@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"save-message/internal/config"
+	"save-message/internal/database"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: migrate [-db path|url] <command>
+
+Commands:
+  status   list the schema migrations and whether each has been applied
+  up       apply every pending migration
+
+The database defaults to DATABASE_URL, then DB_PATH, from the environment or .env.
+`
+
+func main() {
+	_ = godotenv.Load()
+
+	defaultPath := os.Getenv("DATABASE_URL")
+	if defaultPath == "" {
+		defaultPath = os.Getenv("DB_PATH")
+	}
+	if defaultPath == "" {
+		defaultPath = config.DefaultDatabasePath
+	}
+	dbPath := flag.String("db", defaultPath, "path to the SQLite database, or a postgres:// URL")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := database.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch flag.Arg(0) {
+	case "status":
+		err = printStatus(db)
+	case "up":
+		err = migrate(db)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+func printStatus(db *database.Database) error {
+	states, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, state := range states {
+		applied := "pending"
+		if state.Applied {
+			applied = state.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, applied)
+	}
+	return w.Flush()
+}
+
+func migrate(db *database.Database) error {
+	ran, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+	if ran == 0 {
+		fmt.Println("Schema is up to date")
+	} else {
+		fmt.Printf("Applied %d migration(s)\n", ran)
+	}
+	return printStatus(db)
+}
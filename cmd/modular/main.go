@@ -1,13 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
-	"strings"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"save-message/internal/setup"
-
-	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 func main() {
@@ -24,32 +24,16 @@ func main() {
 	}
 	defer botInstance.Cleanup()
 
-	// Start polling for updates
-	var offset int64 = 0
-	for {
-		updates, err := botInstance.Bot.GetUpdates(&gotgbot.GetUpdatesOpts{
-			Offset:  offset,
-			Timeout: 10,
-		})
-		if err != nil {
-			if !strings.Contains(err.Error(), "context deadline exceeded") {
-				log.Printf("GetUpdates error: %v", err)
-			}
-			time.Sleep(2 * time.Second)
-			continue
-		}
+	// SIGINT/SIGTERM stop receiving updates; the deferred Cleanup then drains in-flight work
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		for _, update := range updates {
-			// Always increment offset for each update to prevent infinite loops
-			if update.UpdateId >= offset {
-				offset = update.UpdateId + 1
-			}
+	// Start the update workers and background jobs such as scheduled deletions
+	botInstance.StartWorkers(ctx)
 
-			// Route update to appropriate handler
-			err := botInstance.Dispatcher.HandleUpdate(&update)
-			if err != nil {
-				log.Printf("Error handling update: %v", err)
-			}
-		}
+	// Receive updates by long polling or webhook, as configured by UPDATE_MODE
+	if err := botInstance.Updates.Run(ctx); err != nil {
+		log.Printf("Update source stopped: %v", err)
 	}
+	log.Printf("Shutting down")
 }
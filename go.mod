@@ -8,6 +8,7 @@ toolchain go1.24.2
 require (
 	github.com/PaulSonOfLars/gotgbot/v2 v2.0.0-rc.20
 	github.com/joho/godotenv v1.4.0
+	github.com/lib/pq v1.9.0
 	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/stretchr/testify v1.10.0
 	go.uber.org/zap v1.27.0
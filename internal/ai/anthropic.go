@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// anthropicVersion is the messages API version the client speaks
+const anthropicVersion = "2023-06-01"
+
+// suggestionTool is the tool the model is made to call, so its answer follows suggestionSchema
+const suggestionTool = "suggest_topics"
+
+// AnthropicClient calls an Anthropic-style messages API
+type AnthropicClient struct {
+	config     Config
+	httpClient interfaces.HTTPClient
+}
+
+// newAnthropicProvider builds messages API clients
+func newAnthropicProvider(cfg Config, client interfaces.HTTPClient) (OpenAIClientInterface, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("AI provider %q needs an API key", cfg.Provider)
+	}
+	return &AnthropicClient{config: cfg, httpClient: client}, nil
+}
+
+var _ OpenAIClientInterface = (*AnthropicClient)(nil)
+
+// SuggestFolders sends a message to the model and returns suggested folder names
+func (c *AnthropicClient) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	logutils.Info("SuggestFolders: entry", "provider", c.config.Provider, "model", c.config.Model)
+	requestBody := map[string]interface{}{
+		"model":  c.config.Model,
+		"system": systemPrompt,
+		"messages": []map[string]string{
+			{"role": "user", "content": buildPrompt(message, existingFolders, opts)},
+		},
+		"max_tokens": c.config.MaxTokens,
+		"tools": []map[string]interface{}{{
+			"name":         suggestionTool,
+			"description":  "Record the suggested topics for the message",
+			"input_schema": suggestionSchema,
+		}},
+		"tool_choice": map[string]string{"type": "tool", "name": suggestionTool},
+	}
+	if c.config.Temperature != nil {
+		requestBody["temperature"] = *c.config.Temperature
+	}
+	headers := map[string]string{
+		"x-api-key":         c.config.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+
+	var result struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+	}
+	if err := postJSON(ctx, c.httpClient, c.config.Provider, c.config.BaseURL+"/messages", headers, requestBody, &result); err != nil {
+		logutils.Error("SuggestFolders: messages request failed", err, "provider", c.config.Provider, "kind", KindOf(err).String())
+		return nil, err
+	}
+
+	// The answer is the tool call's input; servers that ignore tools answer in text
+	var reply string
+	var text strings.Builder
+	for _, block := range result.Content {
+		switch block.Type {
+		case "tool_use":
+			if reply == "" {
+				reply = string(block.Input)
+			}
+		case "text":
+			text.WriteString(block.Text)
+		}
+	}
+	if reply == "" {
+		reply = text.String()
+	}
+	if reply == "" {
+		logutils.Error("SuggestFolders: No answer returned", nil, "provider", c.config.Provider)
+		return nil, &Error{Provider: c.config.Provider, Kind: ErrorKindBadResponse, Message: "no answer returned"}
+	}
+
+	suggestions, err := parseSuggestions(reply, existingFolders, opts)
+	if err != nil {
+		logutils.Error("SuggestFolders: unusable reply", err, "provider", c.config.Provider, "reply", reply)
+		return nil, &Error{Provider: c.config.Provider, Kind: ErrorKindBadResponse, Err: err}
+	}
+	logutils.Success("SuggestFolders: exit", "suggestion_count", len(suggestions))
+	return suggestions, nil
+}
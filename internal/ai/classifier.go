@@ -0,0 +1,137 @@
+package ai
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+)
+
+// Example is a text filed under a topic, for the classifier to learn from
+type Example struct {
+	Topic string
+	Text  string
+}
+
+// Classifier is a multinomial naive Bayes model of which topic a text belongs in. It runs
+// in process, so it suggests topics without sending the text anywhere.
+type Classifier struct {
+	topics     []string
+	examples   []float64            // examples filed under each topic
+	counts     []map[string]float64 // how often each word occurs in each topic
+	words      []float64            // words seen in each topic
+	vocabulary map[string]bool
+	total      float64 // examples across all topics
+}
+
+// NewClassifier trains a classifier on examples for topics, matched ignoring case. Examples
+// filed elsewhere are skipped. Each topic's name counts as nameWeight examples of its own
+// words, so topics nothing was saved in yet can still be suggested.
+func NewClassifier(topics []string, examples []Example, nameWeight int) *Classifier {
+	c := &Classifier{vocabulary: map[string]bool{}}
+	index := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		key := strings.ToLower(strings.TrimSpace(topic))
+		if key == "" || key == "general" {
+			continue
+		}
+		if _, ok := index[key]; ok {
+			continue
+		}
+		index[key] = len(c.topics)
+		c.topics = append(c.topics, topic)
+		c.examples = append(c.examples, 0)
+		c.counts = append(c.counts, map[string]float64{})
+		c.words = append(c.words, 0)
+		c.learn(len(c.topics)-1, topic, float64(nameWeight))
+	}
+	for _, example := range examples {
+		i, ok := index[strings.ToLower(strings.TrimSpace(example.Topic))]
+		if !ok {
+			continue
+		}
+		c.examples[i]++
+		c.total++
+		c.learn(i, example.Text, 1)
+	}
+	return c
+}
+
+// learn counts the words of text in topic i, weight times
+func (c *Classifier) learn(i int, text string, weight float64) {
+	for _, word := range tokenize(text) {
+		c.counts[i][word] += weight
+		c.words[i] += weight
+		c.vocabulary[word] = true
+	}
+}
+
+// Classify returns up to count topics text likely belongs in, most probable first, with the
+// probability as confidence. Topics no likelier than chance are left out, and so is every
+// topic when text shares no word with what the classifier learned. A count of 0 means
+// config.DefaultSuggestionCount.
+func (c *Classifier) Classify(text string, count int) []interfaces.Suggestion {
+	if count <= 0 {
+		count = config.DefaultSuggestionCount
+	}
+	var known []string
+	for _, word := range tokenize(text) {
+		if c.vocabulary[word] {
+			known = append(known, word)
+		}
+	}
+	if len(known) == 0 || len(c.topics) == 0 {
+		return nil
+	}
+
+	// Log-probabilities with add-one smoothing, so unseen words do not rule a topic out
+	vocabulary := float64(len(c.vocabulary))
+	scores := make([]float64, len(c.topics))
+	best := math.Inf(-1)
+	for i := range c.topics {
+		score := math.Log((c.examples[i] + 1) / (c.total + float64(len(c.topics))))
+		for _, word := range known {
+			score += math.Log((c.counts[i][word] + 1) / (c.words[i] + vocabulary))
+		}
+		scores[i] = score
+		best = math.Max(best, score)
+	}
+	var sum float64
+	for i := range scores {
+		scores[i] = math.Exp(scores[i] - best)
+		sum += scores[i]
+	}
+
+	chance := 1 / float64(len(c.topics))
+	var suggestions []interfaces.Suggestion
+	for i, topic := range c.topics {
+		probability := scores[i] / sum
+		if probability <= chance && len(c.topics) > 1 {
+			continue
+		}
+		suggestions = append(suggestions, interfaces.Suggestion{Name: topic, Existing: true, Confidence: probability})
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Confidence > suggestions[j].Confidence })
+	if len(suggestions) > count {
+		suggestions = suggestions[:count]
+	}
+	return suggestions
+}
+
+// tokenize splits text into lower-case words of letters and digits, skipping single characters
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		if utf8.RuneCountInString(field) > 1 {
+			words = append(words, field)
+		}
+	}
+	return words
+}
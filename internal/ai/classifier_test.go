@@ -0,0 +1,41 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifier(t *testing.T) {
+	topics := []string{"General", "Recipes", "Work", "Travel"}
+	examples := []Example{
+		{Topic: "recipes", Text: "Chocolate cake: flour, sugar, eggs and butter"},
+		{Topic: "Recipes", Text: "Pancakes need flour, milk and eggs"},
+		{Topic: "Work", Text: "Standup moved to 10, review the quarterly report"},
+		{Topic: "Work", Text: "Send the report to the client before Friday"},
+		{Topic: "Deleted topic", Text: "flour flour flour"},
+	}
+	c := NewClassifier(topics, examples, 3)
+
+	got := c.Classify("Grandma's cake needs more eggs and sugar", 3)
+	require.NotEmpty(t, got)
+	assert.Equal(t, "Recipes", got[0].Name, "names are spelled as the topic list has them")
+	assert.True(t, got[0].Existing)
+	assert.Greater(t, got[0].Confidence, 0.5)
+	for _, s := range got {
+		assert.NotEqual(t, "General", s.Name)
+	}
+
+	got = c.Classify("Flight to Lisbon: travel checklist", 3)
+	require.NotEmpty(t, got)
+	assert.Equal(t, "Travel", got[0].Name, "a topic's name is enough to be suggested")
+
+	assert.Len(t, c.Classify("report on the cake budget", 1), 1, "count caps the suggestions")
+	assert.Empty(t, c.Classify("qwerty zxcvb", 3), "nothing is suggested for words never seen")
+	assert.Empty(t, NewClassifier(nil, examples, 3).Classify("cake", 3), "nothing is suggested without topics")
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"café", "crème", "brûlée", "42", "шоколад"}, tokenize("Café: crème-brûlée a 42 Шоколад!"))
+}
@@ -0,0 +1,180 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// Default embedding models of the built-in providers
+const (
+	DefaultOpenAIEmbeddingModel = "text-embedding-3-small"
+	DefaultOllamaEmbeddingModel = "nomic-embed-text"
+)
+
+// Embedder turns texts into vectors, one per text in the same order
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model names the embedding model: vectors of different models do not compare
+	Model() string
+}
+
+// EmbedderFactory builds an embedder for cfg, which already has the provider's defaults applied.
+// Only BaseURL, APIKey and Model of cfg apply to embeddings.
+type EmbedderFactory func(cfg Config, client interfaces.HTTPClient) (Embedder, error)
+
+type embeddingProvider struct {
+	defaults Config
+	factory  EmbedderFactory
+}
+
+var (
+	embeddingProvidersMu sync.RWMutex
+	embeddingProviders   = map[string]embeddingProvider{}
+)
+
+func init() {
+	RegisterEmbeddingProvider(ProviderOpenAI, Config{BaseURL: DefaultOpenAIBaseURL, Model: DefaultOpenAIEmbeddingModel}, newEmbeddingsProvider(true))
+	RegisterEmbeddingProvider(ProviderOpenAICompatible, Config{}, newEmbeddingsProvider(false))
+	RegisterEmbeddingProvider(ProviderOllama, Config{BaseURL: DefaultOllamaBaseURL, Model: DefaultOllamaEmbeddingModel}, newEmbeddingsProvider(false))
+	RegisterEmbeddingProvider(ProviderLlamaCpp, Config{BaseURL: DefaultLlamaCppBaseURL}, newEmbeddingsProvider(false))
+}
+
+// RegisterEmbeddingProvider makes an embeddings endpoint available to NewEmbedder under name,
+// replacing any provider of that name. defaults fill in what a Config leaves empty.
+func RegisterEmbeddingProvider(name string, defaults Config, factory EmbedderFactory) {
+	embeddingProvidersMu.Lock()
+	defer embeddingProvidersMu.Unlock()
+	embeddingProviders[strings.ToLower(name)] = embeddingProvider{defaults: defaults, factory: factory}
+}
+
+// EmbeddingProviders lists the registered embedding provider names
+func EmbeddingProviders() []string {
+	embeddingProvidersMu.RLock()
+	defer embeddingProvidersMu.RUnlock()
+	names := make([]string, 0, len(embeddingProviders))
+	for name := range embeddingProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEmbedder builds an embedder for cfg.Provider, OpenAI when it is empty
+func NewEmbedder(cfg Config, client interfaces.HTTPClient) (Embedder, error) {
+	name := strings.ToLower(cfg.Provider)
+	if name == "" {
+		name = ProviderOpenAI
+	}
+	embeddingProvidersMu.RLock()
+	p, ok := embeddingProviders[name]
+	embeddingProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown embeddings provider %q, want one of %s", cfg.Provider, strings.Join(EmbeddingProviders(), ", "))
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	cfg.Provider = name
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = p.defaults.BaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Model == "" {
+		cfg.Model = p.defaults.Model
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("embeddings provider %q needs a base URL", name)
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("embeddings provider %q needs a model", name)
+	}
+	return p.factory(cfg, client)
+}
+
+// EmbeddingsClient calls an embeddings API in OpenAI's format, which Ollama, llama.cpp and most
+// OpenAI-compatible servers also speak
+type EmbeddingsClient struct {
+	config     Config
+	httpClient interfaces.HTTPClient
+}
+
+var _ Embedder = (*EmbeddingsClient)(nil)
+
+// newEmbeddingsProvider builds embeddings clients; OpenAI itself needs a key
+func newEmbeddingsProvider(needsKey bool) EmbedderFactory {
+	return func(cfg Config, client interfaces.HTTPClient) (Embedder, error) {
+		if needsKey && cfg.APIKey == "" {
+			return nil, fmt.Errorf("embeddings provider %q needs an API key", cfg.Provider)
+		}
+		return &EmbeddingsClient{config: cfg, httpClient: client}, nil
+	}
+}
+
+// Model names the embedding model
+func (c *EmbeddingsClient) Model() string {
+	return c.config.Model
+}
+
+// Embed returns the embedding of each text
+func (c *EmbeddingsClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	logutils.Info("Embed: entry", "provider", c.config.Provider, "model", c.config.Model, "texts", len(texts))
+	headers := map[string]string{}
+	if c.config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + c.config.APIKey
+	}
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"model": c.config.Model, "input": texts}
+	if err := postJSON(ctx, c.httpClient, c.config.Provider, c.config.BaseURL+"/embeddings", headers, body, &result); err != nil {
+		logutils.Error("Embed: embeddings request failed", err, "provider", c.config.Provider, "kind", KindOf(err).String())
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(vectors) || len(item.Embedding) == 0 {
+			continue
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			err := &Error{Provider: c.config.Provider, Kind: ErrorKindBadResponse, Message: fmt.Sprintf("no embedding for input %d of %d", i, len(texts))}
+			logutils.Error("Embed: incomplete response", err, "provider", c.config.Provider)
+			return nil, err
+		}
+	}
+	logutils.Success("Embed: exit", "provider", c.config.Provider, "texts", len(texts))
+	return vectors, nil
+}
+
+// Cosine is the cosine similarity of a and b, from -1 to 1; 0 when either is zero or their
+// lengths differ
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	_, err := NewEmbedder(Config{Provider: ProviderOpenAI}, nil)
+	assert.Error(t, err, "OpenAI needs a key")
+	_, err = NewEmbedder(Config{Provider: ProviderOpenAICompatible, BaseURL: "http://embed:8000/v1"}, nil)
+	assert.Error(t, err, "a model is needed when the provider has no default")
+	_, err = NewEmbedder(Config{Provider: "word2vec"}, nil)
+	assert.Error(t, err)
+
+	embedder, err := NewEmbedder(Config{Provider: "Ollama"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOllamaEmbeddingModel, embedder.Model())
+}
+
+func TestEmbeddingsClient_Embed(t *testing.T) {
+	httpClient, req, body := recordingHTTPClient(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0.5]}]}`)
+	embedder, err := NewEmbedder(Config{Provider: ProviderOpenAI, APIKey: "sk-test", BaseURL: "https://proxy.example/v1/"}, httpClient)
+	require.NoError(t, err)
+
+	vectors, err := embedder.Embed(context.Background(), []string{"cake", "invoice"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0.5}, {0, 1}}, vectors, "vectors come back in the order of the texts")
+	assert.Equal(t, "https://proxy.example/v1/embeddings", req.URL.String())
+	assert.Equal(t, "Bearer sk-test", req.Header.Get("Authorization"))
+	assert.Equal(t, DefaultOpenAIEmbeddingModel, body["model"])
+	assert.Equal(t, []interface{}{"cake", "invoice"}, body["input"])
+
+	short, _, _ := recordingHTTPClient(`{"data":[{"index":0,"embedding":[1,0]}]}`)
+	embedder, err = NewEmbedder(Config{Provider: ProviderOllama}, short)
+	require.NoError(t, err)
+	_, err = embedder.Embed(context.Background(), []string{"cake", "invoice"})
+	assert.Equal(t, ErrorKindBadResponse, KindOf(err), "a missing vector is a bad response")
+
+	unauthorized := &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(strings.NewReader(`{"error":{"message":"bad key"}}`))}, nil
+	}}
+	embedder, err = NewEmbedder(Config{Provider: ProviderOpenAI, APIKey: "sk-old"}, unauthorized)
+	require.NoError(t, err)
+	_, err = embedder.Embed(context.Background(), []string{"cake"})
+	assert.Equal(t, ErrorKindAuth, KindOf(err))
+}
+
+func TestCosine(t *testing.T) {
+	assert.InDelta(t, 1, Cosine([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0, Cosine([]float32{1, 0}, []float32{0, 3}), 1e-9)
+	assert.InDelta(t, -1, Cosine([]float32{1, 1}, []float32{-1, -1}), 1e-9)
+	assert.Zero(t, Cosine([]float32{0, 0}, []float32{1, 1}))
+	assert.Zero(t, Cosine([]float32{1}, []float32{1, 1}), "vectors of different models do not compare")
+}
@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies provider failures by what can be done about them
+type ErrorKind int
+
+const (
+	ErrorKindUnknown     ErrorKind = iota
+	ErrorKindAuth                  // the key is missing, wrong or not allowed to use the model
+	ErrorKindQuota                 // the account is out of credit
+	ErrorKindRateLimited           // too many requests for now
+	ErrorKindOverloaded            // the provider is failing or overloaded
+	ErrorKindUnreachable           // the request never got an answer: network failure or timeout
+	ErrorKindBadResponse           // an answer came back but holds no usable suggestions
+)
+
+// String returns a short name for the kind, used in logs
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindAuth:
+		return "auth"
+	case ErrorKindQuota:
+		return "quota"
+	case ErrorKindRateLimited:
+		return "rate_limited"
+	case ErrorKindOverloaded:
+		return "overloaded"
+	case ErrorKindUnreachable:
+		return "unreachable"
+	case ErrorKindBadResponse:
+		return "bad_response"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a failed suggestion call
+type Error struct {
+	Provider   string
+	Kind       ErrorKind
+	StatusCode int           // HTTP status, 0 when no answer came back
+	Message    string        // the provider's own description, when it gave one
+	RetryAfter time.Duration // how long the provider asked us to wait, set on 429 and 503
+	Err        error         // underlying cause, if any
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", e.Provider, e.Kind)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " [%d]", e.StatusCode)
+	}
+	if e.Message != "" {
+		b.WriteString(" " + e.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// AsError extracts an *Error from an error chain
+func AsError(err error) (*Error, bool) {
+	var aiErr *Error
+	if errors.As(err, &aiErr) {
+		return aiErr, true
+	}
+	return nil, false
+}
+
+// KindOf returns the ErrorKind of err, or ErrorKindUnknown for nil and foreign errors
+func KindOf(err error) ErrorKind {
+	if aiErr, ok := AsError(err); ok {
+		return aiErr.Kind
+	}
+	return ErrorKindUnknown
+}
+
+// IsTransient reports whether the same call may succeed if tried again shortly
+func IsTransient(err error) bool {
+	switch KindOf(err) {
+	case ErrorKindRateLimited, ErrorKindOverloaded, ErrorKindUnreachable:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusError classifies a non-2xx answer from the status, the provider's error body and
+// the Retry-After header. OpenAI and Anthropic both answer {"error": {"type", "message"}},
+// OpenAI adding a code.
+func statusError(provider string, resp *http.Response, body []byte) *Error {
+	var envelope struct {
+		Error struct {
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+			Message string          `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+	aiErr := &Error{Provider: provider, StatusCode: resp.StatusCode, Message: envelope.Error.Message}
+	if aiErr.Message == "" {
+		aiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		aiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	detail := strings.ToLower(envelope.Error.Type + " " + string(envelope.Error.Code) + " " + envelope.Error.Message)
+	switch {
+	case strings.Contains(detail, "insufficient_quota"), strings.Contains(detail, "credit balance"), resp.StatusCode == http.StatusPaymentRequired:
+		aiErr.Kind = ErrorKindQuota
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		aiErr.Kind = ErrorKindAuth
+	case resp.StatusCode == http.StatusTooManyRequests:
+		aiErr.Kind = ErrorKindRateLimited
+	case resp.StatusCode >= 500: // 529 is Anthropic's "overloaded"
+		aiErr.Kind = ErrorKindOverloaded
+	default:
+		aiErr.Kind = ErrorKindUnknown
+	}
+	return aiErr
+}
@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		retryAfter string
+		want       ErrorKind
+		wantWait   time.Duration
+	}{
+		{"bad key", 401, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, "", ErrorKindAuth, 0},
+		{"model not allowed", 403, `{"error":{"type":"permission_error","message":"not allowed"}}`, "", ErrorKindAuth, 0},
+		{"openai out of credit", 429, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`, "", ErrorKindQuota, 0},
+		{"anthropic out of credit", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"Your credit balance is too low"}}`, "", ErrorKindQuota, 0},
+		{"rate limited", 429, `{"error":{"type":"rate_limit_error","message":"slow down"}}`, "7", ErrorKindRateLimited, 7 * time.Second},
+		{"server error", 500, `oops`, "", ErrorKindOverloaded, 0},
+		{"anthropic overloaded", 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "", ErrorKindOverloaded, 0},
+		{"bad request", 400, `{"error":{"message":"unknown parameter"}}`, "", ErrorKindUnknown, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			err := statusError("openai", resp, []byte(tt.body))
+			assert.Equal(t, tt.want, err.Kind)
+			assert.Equal(t, tt.wantWait, err.RetryAfter)
+			assert.Equal(t, tt.status, err.StatusCode)
+		})
+	}
+}
+
+func TestKindOf_WrappedAndForeignErrors(t *testing.T) {
+	aiErr := &Error{Provider: "openai", Kind: ErrorKindRateLimited, StatusCode: 429, Message: "slow down"}
+
+	assert.Equal(t, ErrorKindRateLimited, KindOf(fmt.Errorf("suggesting: %w", aiErr)))
+	assert.True(t, IsTransient(aiErr))
+	assert.False(t, IsTransient(&Error{Kind: ErrorKindAuth}))
+	assert.Equal(t, ErrorKindUnknown, KindOf(errors.New("rate limited")))
+	assert.Equal(t, ErrorKindUnknown, KindOf(nil))
+	assert.Equal(t, "openai: rate_limited [429] slow down", aiErr.Error())
+
+	cause := errors.New("connection refused")
+	assert.ErrorIs(t, &Error{Provider: "ollama", Kind: ErrorKindUnreachable, Err: cause}, cause)
+}
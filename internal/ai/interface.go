@@ -1,8 +1,12 @@
 package ai
 
-import "context"
+import (
+	"context"
+
+	"save-message/internal/interfaces"
+)
 
 // OpenAIClientInterface defines the interface for OpenAI client operations
 type OpenAIClientInterface interface {
-	SuggestFolders(ctx context.Context, message string, existingFolders []string) ([]string, error)
+	SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error)
 }
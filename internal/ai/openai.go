@@ -3,59 +3,68 @@ package ai
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 
 	"save-message/internal/interfaces"
 	"save-message/internal/logutils"
 )
 
-// OpenAIClient implements OpenAI API calls
+// OpenAIClient calls a chat completions API: OpenAI itself, or any server speaking the same
+// protocol such as Ollama or llama.cpp
 type OpenAIClient struct {
-	apiKey     string
+	config     Config
 	httpClient interfaces.HTTPClient
 }
 
-// NewOpenAIClient creates a new OpenAI client
+// NewOpenAIClient creates a new OpenAI client with the default model
 func NewOpenAIClient(apiKey string, client interfaces.HTTPClient) *OpenAIClient {
 	return &OpenAIClient{
-		apiKey:     apiKey,
+		config:     Config{Provider: ProviderOpenAI, BaseURL: DefaultOpenAIBaseURL, APIKey: apiKey, Model: DefaultOpenAIModel, MaxTokens: DefaultMaxTokens},
 		httpClient: client,
 	}
 }
 
-// SuggestFolders sends a message to OpenAI and returns suggested folder names
-func (c *OpenAIClient) SuggestFolders(ctx context.Context, message string, existingFolders []string) ([]string, error) {
-	logutils.Info("SuggestFolders: entry")
-	prompt := buildPrompt(message, existingFolders)
+// newChatCompletionsProvider builds chat completions clients; OpenAI itself needs a key
+func newChatCompletionsProvider(needsKey bool) ProviderFactory {
+	return func(cfg Config, client interfaces.HTTPClient) (OpenAIClientInterface, error) {
+		if needsKey && cfg.APIKey == "" {
+			return nil, fmt.Errorf("AI provider %q needs an API key", cfg.Provider)
+		}
+		return &OpenAIClient{config: cfg, httpClient: client}, nil
+	}
+}
+
+var _ OpenAIClientInterface = (*OpenAIClient)(nil)
+
+// SuggestFolders sends a message to the model and returns suggested folder names
+func (c *OpenAIClient) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	logutils.Info("SuggestFolders: entry", "provider", c.config.Provider, "model", c.config.Model)
+	prompt := buildPrompt(message, existingFolders, opts)
 	requestBody := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
+		"model": c.config.Model,
 		"messages": []map[string]string{
-			{"role": "system", "content": "You are an assistant that helps organize messages into folders (topics) for a Telegram user."},
+			{"role": "system", "content": systemPrompt},
 			{"role": "user", "content": prompt},
 		},
-		"max_tokens": 64,
+		"max_tokens": c.config.MaxTokens,
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "topic_suggestions",
+				"strict": true,
+				"schema": suggestionSchema,
+			},
+		},
 	}
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		logutils.Error("SuggestFolders: error creating request", err)
-		return nil, fmt.Errorf("error creating request: %w", err)
+	if c.config.Temperature != nil {
+		requestBody["temperature"] = *c.config.Temperature
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		logutils.Error("SuggestFolders: error sending request to OpenAI", err)
-		return nil, fmt.Errorf("error sending request to OpenAI: %w", err)
+	// Local servers usually run without a key
+	headers := map[string]string{}
+	if c.config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + c.config.APIKey
 	}
-	defer resp.Body.Close()
-	respBody, _ := io.ReadAll(resp.Body)
 
 	var result struct {
 		Choices []struct {
@@ -64,25 +73,41 @@ func (c *OpenAIClient) SuggestFolders(ctx context.Context, message string, exist
 			} `json:"message"`
 		} `json:"choices"`
 	}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		logutils.Error("SuggestFolders: OpenAI response decode error", err)
-		return nil, fmt.Errorf("OpenAI response decode error: %w", err)
+	if err := postJSON(ctx, c.httpClient, c.config.Provider, c.config.BaseURL+"/chat/completions", headers, requestBody, &result); err != nil {
+		logutils.Error("SuggestFolders: chat completions request failed", err, "provider", c.config.Provider, "kind", KindOf(err).String())
+		return nil, err
 	}
 	if len(result.Choices) == 0 {
-		logutils.Error("SuggestFolders: No choices returned from OpenAI", nil)
-		return nil, fmt.Errorf("No choices returned from OpenAI")
+		logutils.Error("SuggestFolders: No choices returned", nil, "provider", c.config.Provider)
+		return nil, &Error{Provider: c.config.Provider, Kind: ErrorKindBadResponse, Message: "no choices returned"}
 	}
 
-	folders := parseFolders(result.Choices[0].Message.Content)
-	logutils.Success("SuggestFolders: exit", "suggestion_count", len(folders))
-	return folders, nil
+	suggestions, err := parseSuggestions(result.Choices[0].Message.Content, existingFolders, opts)
+	if err != nil {
+		logutils.Error("SuggestFolders: unusable reply", err, "provider", c.config.Provider, "reply", result.Choices[0].Message.Content)
+		return nil, &Error{Provider: c.config.Provider, Kind: ErrorKindBadResponse, Err: err}
+	}
+	logutils.Success("SuggestFolders: exit", "suggestion_count", len(suggestions))
+	return suggestions, nil
 }
 
-// buildPrompt creates the prompt for OpenAI
-func buildPrompt(message string, existingFolders []string) string {
+// answerFormat tells the model how to answer, for providers that cannot enforce the schema
+const answerFormat = `Answer only with JSON like {"suggestions": [{"name": "Recipes", "existing": true, "confidence": 0.9, "reason": "a cooking recipe"}]}: ` +
+	`existing tells whether the name is one of the existing topics, confidence runs from 0 to 1, and reason is a few words.`
+
+// buildPrompt creates the prompt for the model
+func buildPrompt(message string, existingFolders []string, opts interfaces.SuggestionOptions) string {
 	prompt := "Given the following message: '" + message + "'\n"
+	count := "2-3"
+	if opts.Count > 0 {
+		count = fmt.Sprintf("%d", opts.Count)
+	}
 
-	if len(existingFolders) > 0 {
+	if len(existingFolders) > 0 && opts.NewNamesOnly {
+		prompt += "Existing topics: " + fmt.Sprintf("%v", existingFolders) + "\n"
+		prompt += "None of the existing topics fits this message.\n"
+		prompt += "Suggest " + count + " NEW topic names for it, different from every existing topic. Never suggest 'General' as it's the default topic."
+	} else if len(existingFolders) > 0 {
 		prompt += "Existing topics: " + fmt.Sprintf("%v", existingFolders) + "\n"
 		prompt += "IMPORTANT RULES:\n"
 		prompt += "1. ALWAYS check if any existing topics are relevant to this message FIRST\n"
@@ -90,15 +115,19 @@ func buildPrompt(message string, existingFolders []string) string {
 		prompt += "3. Only suggest NEW topics if NO existing topics are relevant\n"
 		prompt += "4. Never suggest 'General' as it's the default topic\n"
 		prompt += "5. Prioritize existing topics over new ones when both are relevant\n"
-		prompt += "Suggest 2-3 relevant topics for this message. Return only a comma-separated list of topic names."
+		prompt += "Suggest " + count + " relevant topics for this message."
 	} else {
-		prompt += "Suggest 2-3 relevant topic names for this message. Never suggest 'General' as it's the default topic. Return only a comma-separated list of topic names."
+		prompt += "Suggest " + count + " relevant topic names for this message. Never suggest 'General' as it's the default topic."
+	}
+	prompt += "\n" + answerFormat
+	if opts.Language != "" {
+		prompt += "\nWrite new topic names in the language with code '" + opts.Language + "'; keep existing topic names exactly as they are."
 	}
 
 	return prompt
 }
 
-// parseFolders parses a comma-separated list of folder names from the OpenAI response
+// parseFolders parses a comma-separated list of folder names from the model's response
 func parseFolders(response string) []string {
 	var folders []string
 	for _, f := range bytes.Split([]byte(response), []byte{','}) {
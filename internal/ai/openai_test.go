@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 
+	"save-message/internal/interfaces"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -74,7 +76,7 @@ func TestBuildPrompt(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildPrompt(tt.message, tt.existingFolders)
+			result := buildPrompt(tt.message, tt.existingFolders, interfaces.SuggestionOptions{})
 
 			for _, expected := range tt.expectedContains {
 				assert.Contains(t, result, expected)
@@ -182,7 +184,7 @@ func TestBuildPrompt_EdgeCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildPrompt(tt.message, tt.existingFolders)
+			result := buildPrompt(tt.message, tt.existingFolders, interfaces.SuggestionOptions{})
 
 			// Check that the message is included
 			assert.Contains(t, result, tt.message)
@@ -232,3 +234,19 @@ func TestParseFolders_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildPrompt_Options(t *testing.T) {
+	result := buildPrompt("flight to Rome", []string{"Travel"}, interfaces.SuggestionOptions{Count: 4, Language: "de"})
+
+	assert.Contains(t, result, "Suggest 4 relevant topics")
+	assert.Contains(t, result, "language with code 'de'")
+	assert.NotContains(t, result, "2-3")
+}
+
+func TestBuildPrompt_NewNamesOnly(t *testing.T) {
+	result := buildPrompt("flight to Rome", []string{"Work"}, interfaces.SuggestionOptions{Count: 2, NewNamesOnly: true})
+
+	assert.Contains(t, result, "Existing topics: [Work]")
+	assert.Contains(t, result, "Suggest 2 NEW topic names")
+	assert.NotContains(t, result, "include it in your suggestions")
+}
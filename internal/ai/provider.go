@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"save-message/internal/interfaces"
+)
+
+// Providers the registry knows out of the box
+const (
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible" // any server speaking the chat completions API
+	ProviderOllama           = "ollama"
+	ProviderLlamaCpp         = "llamacpp"
+	ProviderAnthropic        = "anthropic"
+)
+
+// Default endpoints and models of the built-in providers
+const (
+	DefaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	DefaultOpenAIModel      = "gpt-4o-mini" // the cheapest model with structured outputs
+	DefaultOllamaBaseURL    = "http://localhost:11434/v1"
+	DefaultLlamaCppBaseURL  = "http://localhost:8080/v1"
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	DefaultAnthropicModel   = "claude-3-5-haiku-latest"
+	DefaultMaxTokens        = 300 // room for a reason with each suggestion
+)
+
+// systemPrompt tells every model what it is for
+const systemPrompt = "You are an assistant that helps organize messages into folders (topics) for a Telegram user."
+
+// Config chooses a provider and how it is called. Empty fields take the provider's defaults.
+type Config struct {
+	Provider    string
+	BaseURL     string // API root, e.g. https://api.openai.com/v1
+	APIKey      string // may be empty for local servers
+	Model       string
+	Temperature *float64 // nil leaves it to the provider
+	MaxTokens   int
+}
+
+// ProviderFactory builds a client for cfg, which already has the provider's defaults applied
+type ProviderFactory func(cfg Config, client interfaces.HTTPClient) (OpenAIClientInterface, error)
+
+type provider struct {
+	defaults Config
+	factory  ProviderFactory
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]provider{}
+)
+
+func init() {
+	RegisterProvider(ProviderOpenAI, Config{BaseURL: DefaultOpenAIBaseURL, Model: DefaultOpenAIModel, MaxTokens: DefaultMaxTokens}, newChatCompletionsProvider(true))
+	RegisterProvider(ProviderOpenAICompatible, Config{MaxTokens: DefaultMaxTokens}, newChatCompletionsProvider(false))
+	RegisterProvider(ProviderOllama, Config{BaseURL: DefaultOllamaBaseURL, MaxTokens: DefaultMaxTokens}, newChatCompletionsProvider(false))
+	RegisterProvider(ProviderLlamaCpp, Config{BaseURL: DefaultLlamaCppBaseURL, MaxTokens: DefaultMaxTokens}, newChatCompletionsProvider(false))
+	RegisterProvider(ProviderAnthropic, Config{BaseURL: DefaultAnthropicBaseURL, Model: DefaultAnthropicModel, MaxTokens: DefaultMaxTokens}, newAnthropicProvider)
+}
+
+// RegisterProvider makes a provider available to NewClient under name, replacing any
+// provider of that name. defaults fill in what a Config leaves empty.
+func RegisterProvider(name string, defaults Config, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[strings.ToLower(name)] = provider{defaults: defaults, factory: factory}
+}
+
+// Providers lists the registered provider names
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewClient builds a client for cfg.Provider, OpenAI when it is empty
+func NewClient(cfg Config, client interfaces.HTTPClient) (OpenAIClientInterface, error) {
+	name := strings.ToLower(cfg.Provider)
+	if name == "" {
+		name = ProviderOpenAI
+	}
+	providersMu.RLock()
+	p, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown AI provider %q, want one of %s", cfg.Provider, strings.Join(Providers(), ", "))
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	cfg.Provider = name
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = p.defaults.BaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Model == "" {
+		cfg.Model = p.defaults.Model
+	}
+	if cfg.Temperature == nil {
+		cfg.Temperature = p.defaults.Temperature
+	}
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = p.defaults.MaxTokens
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("AI provider %q needs a base URL", name)
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("AI provider %q needs a model", name)
+	}
+	return p.factory(cfg, client)
+}
+
+// postJSON sends body as JSON to url and decodes the JSON reply into out. Failures come
+// back as an *Error saying what went wrong.
+func postJSON(ctx context.Context, client interfaces.HTTPClient, provider, url string, headers map[string]string, body, out interface{}) error {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &Error{Provider: provider, Kind: ErrorKindUnreachable, Err: err}
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &Error{Provider: provider, Kind: ErrorKindUnreachable, StatusCode: resp.StatusCode, Err: fmt.Errorf("reading response: %w", err)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(provider, resp, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &Error{Provider: provider, Kind: ErrorKindBadResponse, StatusCode: resp.StatusCode, Err: fmt.Errorf("decoding response: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"save-message/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHTTPClient answers every request with reply and keeps the last request and its body
+func recordingHTTPClient(reply string) (*MockHTTPClient, *http.Request, map[string]interface{}) {
+	var last http.Request
+	body := map[string]interface{}{}
+	client := &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		last = *req
+		data, _ := io.ReadAll(req.Body)
+		_ = json.Unmarshal(data, &body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply))}, nil
+	}}
+	return client, &last, body
+}
+
+func TestNewClient_Defaults(t *testing.T) {
+	client, err := NewClient(Config{APIKey: "key"}, &MockHTTPClient{})
+	require.NoError(t, err)
+	openAI, ok := client.(*OpenAIClient)
+	require.True(t, ok, "OpenAI is the default provider")
+	assert.Equal(t, DefaultOpenAIBaseURL, openAI.config.BaseURL)
+	assert.Equal(t, DefaultOpenAIModel, openAI.config.Model)
+	assert.Equal(t, DefaultMaxTokens, openAI.config.MaxTokens)
+
+	client, err = NewClient(Config{Provider: "Ollama", Model: "llama3"}, &MockHTTPClient{})
+	require.NoError(t, err, "local servers need no key")
+	assert.Equal(t, DefaultOllamaBaseURL, client.(*OpenAIClient).config.BaseURL)
+
+	client, err = NewClient(Config{Provider: ProviderAnthropic, APIKey: "key", BaseURL: "https://proxy.example/v1/"}, &MockHTTPClient{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://proxy.example/v1", client.(*AnthropicClient).config.BaseURL)
+}
+
+func TestNewClient_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"unknown provider", Config{Provider: "carrier-pigeon"}},
+		{"openai without a key", Config{Provider: ProviderOpenAI}},
+		{"anthropic without a key", Config{Provider: ProviderAnthropic}},
+		{"compatible server without a model", Config{Provider: ProviderOpenAICompatible, BaseURL: "http://gpu-box:8000/v1"}},
+		{"compatible server without a base URL", Config{Provider: ProviderOpenAICompatible, Model: "qwen2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.cfg, &MockHTTPClient{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	var got Config
+	RegisterProvider("echo", Config{BaseURL: "http://echo", Model: "echo-1"}, func(cfg Config, client interfaces.HTTPClient) (OpenAIClientInterface, error) {
+		got = cfg
+		return NewOpenAIClient("", client), nil
+	})
+	defer func() {
+		providersMu.Lock()
+		delete(providers, "echo")
+		providersMu.Unlock()
+	}()
+
+	assert.Contains(t, Providers(), "echo")
+	_, err := NewClient(Config{Provider: "echo", MaxTokens: 10}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Config{Provider: "echo", BaseURL: "http://echo", Model: "echo-1", MaxTokens: 10}, got)
+}
+
+func TestOpenAIClient_LocalServer(t *testing.T) {
+	httpClient, req, body := recordingHTTPClient(`{"choices":[{"message":{"content":` +
+		`"{\"suggestions\":[{\"name\":\"Travel\",\"existing\":false,\"confidence\":0.4,\"reason\":\"a trip\"},` +
+		`{\"name\":\"recipes\",\"existing\":true,\"confidence\":0.9,\"reason\":\"a dish\"}]}"}}]}`)
+	temperature := 0.2
+	client, err := NewClient(Config{Provider: ProviderLlamaCpp, Model: "mistral-7b", Temperature: &temperature, MaxTokens: 32}, httpClient)
+	require.NoError(t, err)
+
+	suggestions, err := client.SuggestFolders(context.Background(), "pasta carbonara", []string{"Recipes"}, interfaces.SuggestionOptions{Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []interfaces.Suggestion{
+		{Name: "Recipes", Existing: true, Confidence: 0.9, Reason: "a dish"},
+		{Name: "Travel", Confidence: 0.4, Reason: "a trip"},
+	}, suggestions)
+
+	assert.Equal(t, DefaultLlamaCppBaseURL+"/chat/completions", req.URL.String())
+	assert.Empty(t, req.Header.Get("Authorization"), "no key, no Authorization header")
+	assert.Equal(t, "mistral-7b", body["model"])
+	assert.Equal(t, 0.2, body["temperature"])
+	assert.Equal(t, float64(32), body["max_tokens"])
+	responseFormat, _ := body["response_format"].(map[string]interface{})
+	assert.Equal(t, "json_schema", responseFormat["type"], "the reply is asked to follow the schema")
+}
+
+func TestAnthropicClient_SuggestFolders(t *testing.T) {
+	httpClient, req, body := recordingHTTPClient(`{"content":[{"type":"tool_use","name":"suggest_topics",` +
+		`"input":{"suggestions":[{"name":"Recipes","existing":false,"confidence":0.8,"reason":"a dish"}]}}]}`)
+	client, err := NewClient(Config{Provider: ProviderAnthropic, APIKey: "secret"}, httpClient)
+	require.NoError(t, err)
+
+	suggestions, err := client.SuggestFolders(context.Background(), "pasta carbonara", nil, interfaces.SuggestionOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []interfaces.Suggestion{{Name: "Recipes", Confidence: 0.8, Reason: "a dish"}}, suggestions)
+
+	assert.Equal(t, DefaultAnthropicBaseURL+"/messages", req.URL.String())
+	assert.Equal(t, "secret", req.Header.Get("x-api-key"))
+	assert.Equal(t, anthropicVersion, req.Header.Get("anthropic-version"))
+	assert.Equal(t, DefaultAnthropicModel, body["model"])
+	assert.Equal(t, systemPrompt, body["system"])
+	assert.NotContains(t, body, "temperature", "left to the provider unless configured")
+	assert.Equal(t, map[string]interface{}{"type": "tool", "name": suggestionTool}, body["tool_choice"], "the model must answer through the schema")
+
+	httpClient, _, _ = recordingHTTPClient(`{"content":[]}`)
+	client, err = NewClient(Config{Provider: ProviderAnthropic, APIKey: "secret"}, httpClient)
+	require.NoError(t, err)
+	_, err = client.SuggestFolders(context.Background(), "pasta", nil, interfaces.SuggestionOptions{})
+	assert.Error(t, err, "a reply without text is an error")
+}
+
+func TestOpenAIClient_StatusCodes(t *testing.T) {
+	client := NewOpenAIClient("bad-key", &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(`{"error":{"message":"Incorrect API key provided","code":"invalid_api_key"}}`)),
+		}, nil
+	}})
+
+	_, err := client.SuggestFolders(context.Background(), "pasta", nil, interfaces.SuggestionOptions{})
+	aiErr, ok := AsError(err)
+	require.True(t, ok)
+	assert.Equal(t, ErrorKindAuth, aiErr.Kind)
+	assert.Equal(t, "Incorrect API key provided", aiErr.Message)
+
+	client = NewOpenAIClient("key", &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"choices":[]}`))}, nil
+	}})
+	_, err = client.SuggestFolders(context.Background(), "pasta", nil, interfaces.SuggestionOptions{})
+	assert.Equal(t, ErrorKindBadResponse, KindOf(err))
+}
@@ -0,0 +1,168 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// ResilienceConfig holds the retry, deadline and circuit breaker policy of a ResilientClient
+type ResilienceConfig struct {
+	CallTimeout      time.Duration // deadline for a whole call, retries included; 0 for none
+	MaxRetries       int           // retries for transient failures
+	RetryBackoff     time.Duration // base delay, doubled per attempt and jittered
+	MaxBackoff       time.Duration
+	BreakerThreshold int           // failed calls in a row that open the circuit; 0 never opens it
+	BreakerCooldown  time.Duration // how long the circuit stays open before a trial call
+}
+
+// DefaultResilienceConfig returns the policy used unless configured otherwise
+func DefaultResilienceConfig() ResilienceConfig {
+	return ResilienceConfig{
+		CallTimeout:      config.DefaultAICallTimeout,
+		MaxRetries:       config.DefaultAIMaxRetries,
+		RetryBackoff:     config.DefaultAIRetryBackoff,
+		MaxBackoff:       config.DefaultAIMaxRetryBackoff,
+		BreakerThreshold: config.DefaultAIBreakerThreshold,
+		BreakerCooldown:  config.DefaultAIBreakerCooldown,
+	}
+}
+
+// ResilientClient wraps a provider client with jittered retries of transient failures, a
+// deadline per call and a circuit breaker. While the circuit is open calls fail at once with
+// interfaces.ErrAIUnavailable; after the cooldown one trial call decides whether it closes.
+type ResilientClient struct {
+	client OpenAIClientInterface
+	cfg    ResilienceConfig
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	failures  int       // failed calls in a row
+	openUntil time.Time // zero while the circuit is closed
+	probing   bool      // a trial call is in flight
+}
+
+// NewResilientClient wraps client with the given policy
+func NewResilientClient(client OpenAIClientInterface, cfg ResilienceConfig) *ResilientClient {
+	return &ResilientClient{client: client, cfg: cfg, now: time.Now, sleep: sleepContext}
+}
+
+var _ OpenAIClientInterface = (*ResilientClient)(nil)
+var _ interfaces.AIAvailabilityInterface = (*ResilientClient)(nil)
+
+// SuggestFolders asks the wrapped client, retrying transient failures within the deadline
+func (rc *ResilientClient) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	if !rc.acquire() {
+		logutils.Warn("ResilientClient: circuit open, skipping the provider")
+		return nil, interfaces.ErrAIUnavailable
+	}
+
+	if rc.cfg.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rc.cfg.CallTimeout)
+		defer cancel()
+	}
+
+	var suggestions []interfaces.Suggestion
+	var err error
+	for attempt := 0; ; attempt++ {
+		suggestions, err = rc.client.SuggestFolders(ctx, message, existingFolders, opts)
+		if err == nil || !IsTransient(err) || attempt >= rc.cfg.MaxRetries {
+			break
+		}
+		wait := rc.backoff(attempt + 1)
+		if aiErr, ok := AsError(err); ok && aiErr.RetryAfter > wait {
+			wait = aiErr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			break // the answer would come too late to matter
+		}
+		logutils.Warn("ResilientClient: transient failure, retrying", "attempt", attempt+1, "kind", KindOf(err).String(), "backoff", wait.String(), "error", err.Error())
+		if rc.sleep(ctx, wait) != nil {
+			break
+		}
+	}
+
+	rc.record(err)
+	return suggestions, err
+}
+
+// Available reports whether a call would reach the provider rather than fail at once
+func (rc *ResilientClient) Available() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.openUntil.IsZero() || (!rc.now().Before(rc.openUntil) && !rc.probing)
+}
+
+// acquire lets a call through a closed circuit, or one trial call through an open circuit
+// whose cooldown has passed
+func (rc *ResilientClient) acquire() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.openUntil.IsZero() {
+		return true
+	}
+	if rc.now().Before(rc.openUntil) || rc.probing {
+		return false
+	}
+	rc.probing = true
+	return true
+}
+
+// record counts the outcome of a call towards the breaker. A reply that made no sense still
+// shows the provider is up; a call the caller gave up on shows nothing either way.
+func (rc *ResilientClient) record(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	wasProbe := rc.probing
+	rc.probing = false
+
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || KindOf(err) == ErrorKindBadResponse {
+		if !rc.openUntil.IsZero() {
+			logutils.Success("ResilientClient: circuit closed")
+		}
+		rc.failures = 0
+		rc.openUntil = time.Time{}
+		return
+	}
+
+	rc.failures++
+	if wasProbe || (rc.cfg.BreakerThreshold > 0 && rc.failures >= rc.cfg.BreakerThreshold) {
+		rc.openUntil = rc.now().Add(rc.cfg.BreakerCooldown)
+		logutils.Warn("ResilientClient: circuit open", "failures", rc.failures, "kind", KindOf(err).String(), "until", rc.openUntil.Format(time.RFC3339))
+	}
+}
+
+// backoff returns the jittered exponential delay for the given attempt
+func (rc *ResilientClient) backoff(attempt int) time.Duration {
+	d := rc.cfg.RetryBackoff << (attempt - 1)
+	if rc.cfg.MaxBackoff > 0 && (d > rc.cfg.MaxBackoff || d <= 0) {
+		d = rc.cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
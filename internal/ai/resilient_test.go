@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"save-message/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedClient answers with its errors in turn, then succeeds
+type scriptedClient struct {
+	errs  []error
+	calls int
+}
+
+func (s *scriptedClient) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return []interfaces.Suggestion{{Name: "Recipes"}}, nil
+}
+
+// newTestResilientClient runs on a fake clock and records the waits instead of sleeping
+func newTestResilientClient(client OpenAIClientInterface, cfg ResilienceConfig) (*ResilientClient, *time.Time, *[]time.Duration) {
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	rc := NewResilientClient(client, cfg)
+	rc.now = func() time.Time { return clock }
+	rc.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return rc, &clock, &waits
+}
+
+func TestResilientClient_Retries(t *testing.T) {
+	cfg := ResilienceConfig{MaxRetries: 2, RetryBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	ctx := context.Background()
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		client := &scriptedClient{errs: []error{
+			&Error{Kind: ErrorKindOverloaded, StatusCode: 503},
+			&Error{Kind: ErrorKindRateLimited, StatusCode: 429, RetryAfter: 3 * time.Second},
+		}}
+		rc, _, waits := newTestResilientClient(client, cfg)
+
+		suggestions, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		require.NoError(t, err)
+		assert.Len(t, suggestions, 1)
+		assert.Equal(t, 3, client.calls)
+		require.Len(t, *waits, 2)
+		assert.GreaterOrEqual(t, (*waits)[0], 50*time.Millisecond, "jittered around the base backoff")
+		assert.LessOrEqual(t, (*waits)[0], 100*time.Millisecond)
+		assert.Equal(t, 3*time.Second, (*waits)[1], "the provider's Retry-After wins over a shorter backoff")
+	})
+
+	t.Run("other failures are not", func(t *testing.T) {
+		client := &scriptedClient{errs: []error{&Error{Kind: ErrorKindAuth, StatusCode: 401}}}
+		rc, _, _ := newTestResilientClient(client, cfg)
+
+		_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		assert.Equal(t, ErrorKindAuth, KindOf(err))
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("retries stop at the limit", func(t *testing.T) {
+		overloaded := &Error{Kind: ErrorKindOverloaded}
+		client := &scriptedClient{errs: []error{overloaded, overloaded, overloaded, overloaded}}
+		rc, _, _ := newTestResilientClient(client, cfg)
+
+		_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		assert.Equal(t, ErrorKindOverloaded, KindOf(err))
+		assert.Equal(t, 3, client.calls)
+	})
+
+	t.Run("no retry that would end past the deadline", func(t *testing.T) {
+		client := &scriptedClient{errs: []error{&Error{Kind: ErrorKindRateLimited, RetryAfter: time.Minute}}}
+		rc, _, waits := newTestResilientClient(client, ResilienceConfig{CallTimeout: time.Second, MaxRetries: 2})
+
+		_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		assert.Equal(t, ErrorKindRateLimited, KindOf(err))
+		assert.Equal(t, 1, client.calls)
+		assert.Empty(t, *waits)
+	})
+}
+
+func TestResilientClient_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	down := &Error{Kind: ErrorKindUnreachable}
+	client := &scriptedClient{errs: []error{down, down, down}}
+	rc, clock, _ := newTestResilientClient(client, ResilienceConfig{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		assert.Equal(t, ErrorKindUnreachable, KindOf(err))
+	}
+	assert.False(t, rc.Available())
+
+	_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+	assert.ErrorIs(t, err, interfaces.ErrAIUnavailable, "an open circuit fails at once")
+	assert.Equal(t, 2, client.calls)
+
+	// After the cooldown one trial call goes through; it fails, so the circuit opens again
+	*clock = clock.Add(time.Minute)
+	assert.True(t, rc.Available())
+	_, err = rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+	assert.Equal(t, ErrorKindUnreachable, KindOf(err))
+	assert.False(t, rc.Available())
+
+	// The next trial succeeds and closes it
+	*clock = clock.Add(time.Minute)
+	_, err = rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+	assert.NoError(t, err)
+	assert.True(t, rc.Available())
+	assert.Equal(t, 4, client.calls)
+}
+
+func TestResilientClient_BadResponsesAndCancellations(t *testing.T) {
+	ctx := context.Background()
+	client := &scriptedClient{errs: []error{
+		&Error{Kind: ErrorKindBadResponse},
+		&Error{Kind: ErrorKindUnreachable, Err: context.Canceled},
+		&Error{Kind: ErrorKindBadResponse},
+	}}
+	rc, _, _ := newTestResilientClient(client, ResilienceConfig{BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		_, err := rc.SuggestFolders(ctx, "pasta", nil, interfaces.SuggestionOptions{})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, interfaces.ErrAIUnavailable))
+	}
+	assert.True(t, rc.Available(), "neither says the provider is down")
+}
@@ -0,0 +1,190 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+)
+
+// maxReasonLength caps the reason kept for a suggestion, in characters
+const maxReasonLength = 200
+
+// errNoSuggestions is returned when a reply holds neither JSON nor a list of names
+var errNoSuggestions = errors.New("no suggestions in response")
+
+// suggestionSchema is the JSON schema replies are asked to follow
+var suggestionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"suggestions": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name":       map[string]interface{}{"type": "string", "description": "topic name"},
+					"existing":   map[string]interface{}{"type": "boolean", "description": "whether name is one of the existing topics"},
+					"confidence": map[string]interface{}{"type": "number", "description": "from 0 to 1"},
+					"reason":     map[string]interface{}{"type": "string", "description": "a few words on why the message belongs there"},
+				},
+				"required":             []string{"name", "existing", "confidence", "reason"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"suggestions"},
+	"additionalProperties": false,
+}
+
+// rawSuggestion is a suggestion as the model wrote it. The existing flag is not read:
+// whether a name is an existing topic is decided against the topic list itself.
+type rawSuggestion struct {
+	Name       string          `json:"name"`
+	Confidence json.RawMessage `json:"confidence"`
+	Reason     string          `json:"reason"`
+}
+
+// listMarker matches numbering and bullets models put in front of names
+var listMarker = regexp.MustCompile(`^(?:\d+[.):]|[-*•])\s*`)
+
+// parseSuggestions turns a reply into suggestions, most confident first. A reply that is not
+// the JSON asked for is repaired where possible: JSON wrapped in prose or code fences is dug
+// out, and a plain list of names is taken as suggestions of unknown confidence.
+func parseSuggestions(reply string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	raw, ok := decodeSuggestions(reply)
+	if !ok {
+		for _, name := range parseFolders(strings.ReplaceAll(reply, "\n", ",")) {
+			raw = append(raw, rawSuggestion{Name: name})
+		}
+		if len(raw) == 0 {
+			return nil, errNoSuggestions
+		}
+	}
+	return validateSuggestions(raw, existingFolders, opts), nil
+}
+
+// decodeSuggestions finds the JSON in reply: the object asked for, or a bare array of
+// suggestions or names
+func decodeSuggestions(reply string) ([]rawSuggestion, bool) {
+	reply = strings.TrimSpace(reply)
+	candidates := []string{reply}
+	if start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}"); start >= 0 && end > start {
+		candidates = append(candidates, reply[start:end+1])
+	}
+	if start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]"); start >= 0 && end > start {
+		candidates = append(candidates, reply[start:end+1])
+	}
+
+	for _, candidate := range candidates {
+		var object struct {
+			Suggestions []json.RawMessage `json:"suggestions"`
+		}
+		if err := json.Unmarshal([]byte(candidate), &object); err == nil && object.Suggestions != nil {
+			return decodeItems(object.Suggestions)
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(candidate), &items); err == nil {
+			return decodeItems(items)
+		}
+	}
+	return nil, false
+}
+
+// decodeItems reads suggestion objects, taking plain strings as names
+func decodeItems(items []json.RawMessage) ([]rawSuggestion, bool) {
+	suggestions := make([]rawSuggestion, 0, len(items))
+	for _, item := range items {
+		var suggestion rawSuggestion
+		if err := json.Unmarshal(item, &suggestion.Name); err == nil {
+			suggestions = append(suggestions, suggestion)
+			continue
+		}
+		if err := json.Unmarshal(item, &suggestion); err != nil {
+			return nil, false
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, true
+}
+
+// validateSuggestions cleans up names, drops what cannot be a topic, spells existing topics
+// as they are, and orders by confidence
+func validateSuggestions(raw []rawSuggestion, existingFolders []string, opts interfaces.SuggestionOptions) []interfaces.Suggestion {
+	existing := make(map[string]string, len(existingFolders))
+	for _, folder := range existingFolders {
+		existing[strings.ToLower(folder)] = folder
+	}
+
+	seen := map[string]bool{}
+	var suggestions []interfaces.Suggestion
+	for _, r := range raw {
+		name := cleanName(r.Name)
+		key := strings.ToLower(name)
+		if name == "" || key == "general" || seen[key] || utf8.RuneCountInString(name) > config.MaxTopicNameLength {
+			continue
+		}
+		seen[key] = true
+
+		suggestion := interfaces.Suggestion{
+			Name:       name,
+			Confidence: parseConfidence(r.Confidence),
+			Reason:     truncate(strings.TrimSpace(r.Reason), maxReasonLength),
+		}
+		if folder, ok := existing[key]; ok {
+			suggestion.Name = folder
+			suggestion.Existing = true
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	if opts.Count > 0 && len(suggestions) > opts.Count {
+		suggestions = suggestions[:opts.Count]
+	}
+	return suggestions
+}
+
+// cleanName strips list markers, quotes and extra spaces from a name
+func cleanName(name string) string {
+	name = strings.TrimSpace(name)
+	name = listMarker.ReplaceAllString(name, "")
+	name = strings.Trim(name, "\"'`“”‘’«»* ")
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// parseConfidence reads a confidence written as a number or a string, as a fraction or a
+// percentage, and clamps it to [0, 1]. Anything unreadable counts as 0.
+func parseConfidence(raw json.RawMessage) float64 {
+	text := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	percent := strings.HasSuffix(text, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+	if err != nil {
+		return 0
+	}
+	if percent || value > 1 {
+		value /= 100
+	}
+	switch {
+	case value < 0:
+		return 0
+	case value > 1:
+		return 1
+	}
+	return value
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"save-message/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSuggestions(t *testing.T) {
+	existing := []string{"Work", "Recipes"}
+	tests := []struct {
+		name  string
+		reply string
+		opts  interfaces.SuggestionOptions
+		want  []interfaces.Suggestion
+	}{
+		{
+			name:  "schema reply, ordered by confidence",
+			reply: `{"suggestions":[{"name":"Italy","existing":false,"confidence":0.3,"reason":"a place"},{"name":"Recipes","existing":true,"confidence":0.95,"reason":"a dish"}]}`,
+			want: []interfaces.Suggestion{
+				{Name: "Recipes", Existing: true, Confidence: 0.95, Reason: "a dish"},
+				{Name: "Italy", Confidence: 0.3, Reason: "a place"},
+			},
+		},
+		{
+			name:  "JSON in a code fence after some prose",
+			reply: "Sure! Here you go:\n```json\n{\"suggestions\":[{\"name\":\"work\",\"existing\":false,\"confidence\":\"80%\",\"reason\":\"\"}]}\n```",
+			want:  []interfaces.Suggestion{{Name: "Work", Existing: true, Confidence: 0.8}},
+		},
+		{
+			name:  "bare array of names",
+			reply: `["1. Travel", "\"Photos\""]`,
+			want:  []interfaces.Suggestion{{Name: "Travel"}, {Name: "Photos"}},
+		},
+		{
+			name:  "numbered free text",
+			reply: "1. Work, 2. Personal\n3. 'Shopping'",
+			want:  []interfaces.Suggestion{{Name: "Work", Existing: true}, {Name: "Personal"}, {Name: "Shopping"}},
+		},
+		{
+			name:  "General, duplicates, blanks and overlong names are dropped",
+			reply: `{"suggestions":[{"name":"General","confidence":1},{"name":" "},{"name":"Travel","confidence":0.5},{"name":"travel","confidence":0.9},{"name":"` + strings.Repeat("x", 129) + `"}]}`,
+			want:  []interfaces.Suggestion{{Name: "Travel", Confidence: 0.5}},
+		},
+		{
+			name:  "confidence clamped and limited to the count",
+			reply: `{"suggestions":[{"name":"A","confidence":-2},{"name":"B","confidence":250},{"name":"C","confidence":0.5}]}`,
+			opts:  interfaces.SuggestionOptions{Count: 2},
+			want:  []interfaces.Suggestion{{Name: "B", Confidence: 1}, {Name: "C", Confidence: 0.5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSuggestions(tt.reply, existing, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSuggestions_Unusable(t *testing.T) {
+	_, err := parseSuggestions("  \n ", nil, interfaces.SuggestionOptions{})
+	assert.ErrorIs(t, err, errNoSuggestions)
+
+	got, err := parseSuggestions(`{"suggestions":[]}`, nil, interfaces.SuggestionOptions{})
+	assert.NoError(t, err, "an empty list is a valid answer")
+	assert.Empty(t, got)
+}
+
+func TestParseConfidence(t *testing.T) {
+	assert.Equal(t, 0.7, parseConfidence([]byte(`0.7`)))
+	assert.Equal(t, 0.7, parseConfidence([]byte(`"0.7"`)))
+	assert.Equal(t, 0.7, parseConfidence([]byte(`70`)))
+	assert.Equal(t, 0.07, parseConfidence([]byte(`"7%"`)))
+	assert.Equal(t, 0.0, parseConfidence([]byte(`"high"`)))
+	assert.Equal(t, 0.0, parseConfidence(nil))
+}
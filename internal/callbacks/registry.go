@@ -0,0 +1,68 @@
+package callbacks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+)
+
+// TokenPrefix starts every issued token, keeping tokens apart from the static menu callback data
+const TokenPrefix = "t:"
+
+// tokenBytes of randomness encode to 12 characters, far below Telegram's 64-byte callback_data limit
+const tokenBytes = 9
+
+// stateNamespace is where tokens live in the state store
+const stateNamespace = "callback_token"
+
+// Registry keeps issued callback tokens in a state store, so buttons resolve after a restart
+// when the store is persistent.
+type Registry struct {
+	store interfaces.StateStoreInterface
+	TTL   time.Duration
+}
+
+var _ interfaces.CallbackRegistryInterface = (*Registry)(nil)
+
+// NewRegistry creates a callback registry whose tokens live as long as button state
+func NewRegistry(store interfaces.StateStoreInterface) *Registry {
+	return &Registry{store: store, TTL: config.DefaultButtonStateTTL}
+}
+
+// Issue stores callback under a new random token and returns the token as callback data
+func (r *Registry) Issue(ctx context.Context, callback interfaces.Callback) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if err := r.store.Set(ctx, stateNamespace, token, callback, r.TTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Resolve looks up the callback behind data
+func (r *Registry) Resolve(ctx context.Context, data string) (interfaces.Callback, bool, error) {
+	var callback interfaces.Callback
+	if !strings.HasPrefix(data, TokenPrefix) {
+		return callback, false, nil
+	}
+	found, err := r.store.Get(ctx, stateNamespace, data, &callback)
+	if err != nil || !found {
+		return interfaces.Callback{}, false, err
+	}
+	return callback, true, nil
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,44 @@
+package callbacks
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_IssueAndResolve(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry(state.NewMemoryStore())
+
+	longName := strings.Repeat("Домашние рецепты 🍰 ", 6) // well over 64 bytes
+	want := interfaces.Callback{Action: interfaces.CallbackSelectTopic, ChatID: -1001, MessageID: 1043, TopicName: longName}
+	token, err := registry.Issue(ctx, want)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(token), 64, "callback data must fit Telegram's limit")
+
+	got, found, err := registry.Resolve(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, want, got)
+
+	other, err := registry.Issue(ctx, want)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other, "every button gets its own token")
+}
+
+func TestRegistry_ResolveUnknown(t *testing.T) {
+	ctx := context.Background()
+	registry := NewRegistry(state.NewMemoryStore())
+
+	for _, data := range []string{"", "Work_123", "create_topic_menu", TokenPrefix + "missing"} {
+		_, found, err := registry.Resolve(ctx, data)
+		assert.NoError(t, err, data)
+		assert.False(t, found, data)
+	}
+}
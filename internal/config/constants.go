@@ -14,6 +14,9 @@ const (
 • Simply send any message and the bot will suggest relevant folders
 • Click on a suggested folder to save your message there
 • Use "📁 Show All Topics" to browse all existing topics
+• Use /search to find saved messages, e.g. /search cake topic:Recipes type:photo after:2024-01-01
+• Use /settings to change auto-delete, confirmations, AI suggestions and their language; admins can turn on privacy mode there, keeping messages away from the AI provider
+• Admins can manage topics with /renametopic, /closetopic, /reopentopic, /deletetopic and /mergetopic
 
 **Important:** ⚠️ **Don't create topics manually in Save message group!** Let the bot create them automatically when you save messages. This ensures proper organization and prevents confusion.
 
@@ -21,21 +24,23 @@ const (
 • The bot uses AI to suggest relevant folders
 • Existing topics show with 📁 icon, new ones with ➕
 • Messages are automatically cleaned from General topic after saving
-• Success messages auto-delete after 1 minute`
+• Success messages auto-delete after 1 minute by default`
 
 	// Error messages
-	ErrorMessageNotFound     = "❌ Error: Message not found. Please try again."
-	ErrorMessageFailed       = "❌ Failed to get topics. Please try again."
-	ErrorMessageNoTopics     = "📁 No topics found yet. Send a message to create your first topic!"
-	ErrorMessageCreateFailed = "❌ Failed to create topic. Please try again."
-	ErrorMessageUnknown      = "❓ Unknown action. Please try again."
+	ErrorMessageNotFound        = "❌ Error: Message not found. Please try again."
+	ErrorMessageFailed          = "❌ Failed to get topics. Please try again."
+	ErrorMessageNoTopics        = "📁 No topics found yet. Send a message to create your first topic!"
+	ErrorMessageCreateFailed    = "❌ Failed to create topic. Please try again."
+	ErrorMessageUnknown         = "❓ Unknown action. Please try again."
+	ErrorMessageSaveFailed      = "❌ Failed to save message to topic."
+	ErrorMessageNotEnoughRights = "❌ I don't have enough rights to do that. Please make me an admin with \"Manage Topics\" and \"Delete Messages\" permissions."
 
 	// Success messages
 	SuccessMessageRetry = "🔄 Retrying... Please send your message again."
 	SuccessMessageSaved = "✅ Message saved to topic: "
 
 	// Warning messages
-	WarningNonGeneralTopic = "⚠️ **Please send messages only in the General topic!**\n\nThis message will be removed automatically in 1 minute."
+	WarningNonGeneralTopic = "⚠️ **Please send messages only in the General topic!**\n\nThis message will be removed automatically in %s."
 
 	// UI elements
 	ButtonTextCreateNewTopic    = "📝 Create New Topic"
@@ -43,6 +48,11 @@ const (
 	ButtonTextBackToSuggestions = "⬅️ Back to Suggestions"
 	ButtonTextTryAgain          = "🔄 Try Again"
 	ButtonTextOk                = "Ok"
+	ButtonTextCancel            = "✖️ Cancel"
+	ButtonTextPreviousPage      = "⬅️ Previous"
+	ButtonTextNextPage          = "Next ➡️"
+	ButtonTextDeleteTopic       = "🗑 Delete"
+	ButtonTextSettingsDone      = "✔️ Done"
 
 	// Menu messages
 	BotMenuMessage             = "🤖 **Bot Menu**\n\nWhat would you like to do?"
@@ -51,10 +61,66 @@ const (
 	ChooseFromAllTopicsMessage = "Choose from all existing topics:"
 
 	// Topic creation messages
-	TopicNamePrompt          = "📝 Please enter the name for your new topic:"
-	TopicNameEmptyError      = "❌ Topic name cannot be empty. Please try again."
-	TopicNameExistsError     = "❌ A topic with this name already exists. Please choose a different name."
-	TopicCreationMenuMessage = "📝 **Create New Topic**\n\nPlease send the name of the topic you want to create:"
+	TopicNamePrompt          = "📝 Please enter the name for your new topic (or /cancel):"
+	TopicNameEmptyError      = "❌ Topic name cannot be empty. Please try again or /cancel."
+	TopicNameTooLongError    = "❌ Topic names can be at most 128 characters. Please try a shorter one or /cancel."
+	TopicNameExistsError     = "❌ A topic with this name already exists. Please choose a different name or /cancel."
+	TopicCreationMenuMessage = "📝 **Create New Topic**\n\nPlease send the name of the topic you want to create, or /cancel:"
+	TopicNameCancelled       = "✖️ Topic creation cancelled."
+	TopicNameTimedOut        = "⌛ Topic creation timed out."
+	NothingToCancelMessage   = "There is nothing to cancel."
+	MaxTopicNameLength       = 128 // characters, Telegram's limit for forum topic names
+
+	// Search messages
+	SearchUsageMessage = "🔎 Usage: /search <words> [topic:<name>] [type:<type>] [before:YYYY-MM-DD] [after:YYYY-MM-DD]\n\nQuote names with spaces, e.g. topic:\"My Recipes\"."
+	SearchNoResults    = "🔎 No saved messages match your search."
+	SearchResultsTitle = "🔎 Found %d saved message(s), page %d of %d:"
+	SearchFailed       = "❌ Search failed. Please try again."
+	SearchBadFilter    = "❌ %s\n\n"
+
+	// Topic management messages
+	RenameTopicUsage       = "Usage: /renametopic \"Old name\" \"New name\"\n\nInside a topic, /renametopic \"New name\" renames that topic."
+	CloseTopicUsage        = "Usage: /closetopic <name>, or /closetopic inside the topic."
+	ReopenTopicUsage       = "Usage: /reopentopic <name>, or /reopentopic inside the topic."
+	DeleteTopicUsage       = "Usage: /deletetopic <name>, or /deletetopic inside the topic."
+	MergeTopicUsage        = "Usage: /mergetopic \"From\" \"Into\"\n\nCopies the saved messages of the first topic into the second, then closes the first."
+	TopicCommandNotAllowed = "❌ Only admins who can manage topics can do that."
+	TopicCommandFailed     = "❌ Telegram did not accept that change. Please try again."
+	TopicCommandNotFound   = "❌ There is no topic called \"%s\"."
+	TopicNameTaken         = "❌ There is already a topic called \"%s\"."
+	TopicNameTooLong       = "❌ Topic names can be at most 128 characters."
+	TopicRenamed           = "✅ Renamed \"%s\" to \"%s\"."
+	TopicClosed            = "✅ Closed \"%s\"."
+	TopicAlreadyClosed     = "\"%s\" is already closed."
+	TopicReopened          = "✅ Reopened \"%s\"."
+	TopicNotClosed         = "\"%s\" is not closed."
+	DeleteTopicConfirm     = "🗑 Delete \"%s\" and every message in it? This cannot be undone."
+	TopicDeleted           = "✅ Deleted \"%s\"."
+	TopicKept              = "Kept \"%s\"."
+	MergeSameTopic         = "❌ Pick two different topics to merge."
+	MergeIntoClosedTopic   = "❌ \"%s\" is closed. Reopen it with /reopentopic first."
+	TopicMerged            = "✅ Copied %d saved message(s) from \"%s\" into \"%s\" and closed \"%s\"."
+	TopicMergeIncomplete   = "⚠️ Copied %d of %d saved message(s) from \"%s\" into \"%s\", so \"%s\" is still open. Run the command again to copy the rest."
+	TopicMergeProgress     = "⏳ Copying saved messages from \"%s\" into \"%s\": %d of %d done…"
+	TopicMergeRunning      = "⏳ \"%s\" is part of a merge that is still running. Wait for it to finish."
+
+	// Settings menu; each button shows the current value and moves to the next choice
+	SettingsMenuMessage            = "⚙️ **Your settings in this chat**\n\nTap a setting to change it."
+	SettingsFailed                 = "❌ Could not change your settings. Please try again."
+	SettingsButtonAutoDelete       = "🧹 Remove saved originals: %s"
+	SettingsButtonAutoDeleteDelay  = "⏱ Remove after: %s"
+	SettingsButtonConfirmation     = "✅ Confirmations: %s"
+	SettingsButtonConfirmationTime = "⏳ Confirmations stay: %s"
+	SettingsButtonAI               = "🤖 AI suggestions: %s"
+	SettingsButtonSuggestionCount  = "🔢 Suggestions: %d"
+	SettingsButtonLanguage         = "🌐 Topic name language: %s"
+	SettingsButtonPrivacy          = "🔒 Privacy mode (whole chat): %s"
+	SettingsPrivacyAdminsOnly      = "🔒 Only admins who can manage topics can change privacy mode."
+	SettingsValueOn                = "on"
+	SettingsValueOff               = "off"
+	SettingsConfirmationTimed      = "removed later"
+	SettingsConfirmationKept       = "kept"
+	SettingsConfirmationOff        = "not sent"
 
 	// Topic list messages
 	TopicsListHeader          = "📁 **Your Topics:**\n"
@@ -64,14 +130,10 @@ const (
 	AIProcessingMessage = "🤔 Thinking..."
 	AIFailedMessage     = "Sorry, I couldn't suggest folders right now."
 
-	// Callback data prefixes
-	CallbackPrefixCreateNewFolder           = "create_new_folder_"
-	CallbackPrefixRetry                     = "retry_"
-	CallbackPrefixShowAllTopics             = "show_all_topics_"
-	CallbackPrefixBackToSuggestions         = "back_to_suggestions_"
-	CallbackPrefixDetectMessageOnOtherTopic = "detectMessageOnOtherTopic_ok_"
-	CallbackDataCreateTopicMenu             = "create_topic_menu"
-	CallbackDataShowAllTopicsMenu           = "show_all_topics_menu"
+	// Callback data of static menu buttons; all other buttons carry registry tokens
+	CallbackDataShowHelp          = "show_help"
+	CallbackDataCreateTopicMenu   = "create_topic_menu"
+	CallbackDataShowAllTopicsMenu = "show_all_topics_menu"
 
 	// Bot usernames (for mention detection)
 	BotUsername1 = "@savemessagbot"
@@ -81,8 +143,80 @@ const (
 	DefaultDatabasePath           = "bot.db"
 	DefaultPollingTimeout         = 10
 	DefaultRetryDelay             = 2 * time.Second
-	DefaultWarningAutoDeleteDelay = 60 * time.Second
 	DefaultMessageAutoDeleteDelay = 1 * time.Second
+	DefaultTelegramAPIURL         = "https://api.telegram.org"
+	DefaultTelegramRequestTimeout = 15 * time.Second
+	DefaultWebhookListenAddr      = ":8080"
+	DefaultShutdownTimeout        = 20 * time.Second // how long shutdown waits for in-flight work
+
+	// Update ingestion modes (UPDATE_MODE)
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+
+	// Update processing: chats are handled in parallel, each chat's updates in order
+	DefaultUpdateWorkers       = 8
+	DefaultUpdateQueueSize     = 256 // updates waiting for a worker before ingestion is held back
+	DefaultUpdateStatsInterval = 1 * time.Minute
+
+	// Outbound Bot API limits (see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this)
+	DefaultTelegramGlobalRate        = 30 // requests per second across all chats
+	DefaultTelegramChatRatePerMinute = 20 // messages per minute sent into one group
+	DefaultTelegramChatBurst         = 5
+	DefaultTelegramMaxRetries        = 3
+	DefaultTelegramRetryBackoff      = 500 * time.Millisecond
+	DefaultTelegramMaxRetryBackoff   = 10 * time.Second
+	DefaultTelegramMaxFloodRetries   = 5               // 429s retried before a call gives up
+	DefaultTelegramBucketPruneEvery  = 1 * time.Minute // how often idle per-chat limits are dropped
+
+	// Scheduled deletions
+	DefaultDeletionPollInterval = 1 * time.Second  // how often the worker looks for due deletions
+	DefaultDeletionRetryDelay   = 30 * time.Second // first retry delay, grows linearly per attempt
+	DefaultDeletionMaxAttempts  = 5
+	DefaultDeletionBatchSize    = 50
+
+	// /mergetopic copies in the background and updates its progress message every so many saves
+	DefaultMergeProgressEvery = 25
+
+	// Interaction state lifetimes
+	DefaultButtonStateTTL     = 48 * time.Hour // how long suggestion buttons keep working
+	DefaultRecentlyMovedTTL   = 10 * time.Minute
+	DefaultStatePurgeInterval = 10 * time.Minute
+
+	// Conversations (multi-step prompts such as typing a topic name)
+	DefaultConversationTimeout       = 5 * time.Minute  // how long the bot waits for the user's reply
+	DefaultConversationRetention     = 24 * time.Hour   // how long a timed-out conversation waits for the sweeper
+	DefaultConversationSweepInterval = 15 * time.Second // how often timed-out conversations are acted on
+
+	// AI suggestion calls
+	DefaultAICallTimeout      = 20 * time.Second // the longest a user waits for suggestions, retries included
+	DefaultAIMaxRetries       = 2
+	DefaultAIRetryBackoff     = 500 * time.Millisecond
+	DefaultAIMaxRetryBackoff  = 5 * time.Second
+	DefaultAIBreakerThreshold = 5               // failed calls in a row that open the circuit
+	DefaultAIBreakerCooldown  = 1 * time.Minute // how long an open circuit skips the provider
+
+	// Local classifier, used in privacy mode and when the AI provider fails
+	LocalClassifierHistory    = 2000 // most recent saves of the chat it learns from
+	LocalClassifierNameWeight = 3    // a topic's name counts as this many saves of its words
+
+	// Topic embeddings
+	DefaultEmbeddingTimeout        = 10 * time.Second
+	DefaultEmbeddingMatchThreshold = 0.5 // cosine similarity from which a topic is close enough to skip the completion
+
+	// User settings until a user changes them with /settings
+	DefaultAutoDelete        = true
+	DefaultConfirmationDelay = 1 * time.Minute // also how long warnings stay
+	DefaultAIEnabled         = true
+	DefaultSuggestionCount   = 3
+	DefaultLanguage          = "en"
+
+	// Chat settings until an admin changes them with /settings
+	DefaultPrivacyMode = false
+
+	// Saved-message index
+	SavedMessageSnippetLength = 200 // characters of text or caption kept per save
+	SearchPageSize            = 5
+	SearchHitLabelLength      = 60 // characters of a search hit's button text
 
 	// Icons
 	IconFolder    = "📁"
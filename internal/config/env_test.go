@@ -86,13 +86,13 @@ func TestConstants(t *testing.T) {
 	assert.NotEmpty(t, TopicNamePrompt)
 	assert.NotEmpty(t, TopicsListHeader)
 	assert.NotEmpty(t, AIProcessingMessage)
-	assert.NotEmpty(t, CallbackPrefixCreateNewFolder)
+	assert.NotEmpty(t, CallbackDataShowHelp)
 	assert.NotEmpty(t, BotUsername1)
 	assert.NotEmpty(t, BotUsername2)
 	assert.NotEmpty(t, DefaultDatabasePath)
 	assert.Greater(t, DefaultPollingTimeout, 0)
 	assert.Greater(t, DefaultRetryDelay, time.Duration(0))
-	assert.Greater(t, DefaultWarningAutoDeleteDelay, time.Duration(0))
+	assert.Greater(t, DefaultConfirmationDelay, time.Duration(0))
 	assert.Greater(t, DefaultMessageAutoDeleteDelay, time.Duration(0))
 	assert.NotEmpty(t, IconFolder)
 	assert.NotEmpty(t, IconNewFolder)
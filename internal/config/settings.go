@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+// Choices the /settings menu cycles through
+var (
+	AutoDeleteDelayChoices   = []time.Duration{1 * time.Second, 10 * time.Second, 1 * time.Minute, 5 * time.Minute}
+	ConfirmationDelayChoices = []time.Duration{10 * time.Second, 1 * time.Minute, 5 * time.Minute}
+	SuggestionCountChoices   = []int{1, 2, 3, 4, 5}
+	LanguageChoices          = []string{"en", "es", "de", "fr", "ru", "fa"}
+)
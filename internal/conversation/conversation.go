@@ -0,0 +1,193 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// stateNamespace is where conversations live in the state store
+const stateNamespace = "conversation"
+
+// Key identifies a conversation. A user has at most one per chat, so a prompt
+// in one group never captures messages the same user sends elsewhere.
+type Key struct {
+	ChatID int64
+	UserID int64
+}
+
+func (k Key) String() string {
+	return strconv.FormatInt(k.ChatID, 10) + ":" + strconv.FormatInt(k.UserID, 10)
+}
+
+func parseKey(s string) (Key, error) {
+	chat, user, ok := strings.Cut(s, ":")
+	if !ok {
+		return Key{}, fmt.Errorf("malformed conversation key %q", s)
+	}
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return Key{}, err
+	}
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{ChatID: chatID, UserID: userID}, nil
+}
+
+// Conversation is a user's unfinished multi-step exchange with the bot in one chat
+type Conversation struct {
+	Key      Key             `json:"key"`
+	Step     string          `json:"step"`           // what the bot is waiting for
+	Data     json.RawMessage `json:"data,omitempty"` // step-specific context
+	Deadline time.Time       `json:"deadline"`       // the conversation times out after this
+}
+
+// Decode unpacks the step-specific context into dest
+func (c Conversation) Decode(dest interface{}) error {
+	if len(c.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.Data, dest)
+}
+
+// Manager keeps conversations in a state store. A conversation is active until its
+// deadline; after that it is kept (up to Retention) until the sweeper claims it, so
+// a timeout is still acted on when it falls during a restart.
+type Manager struct {
+	store interfaces.StateStoreInterface
+
+	Timeout   time.Duration
+	Retention time.Duration
+
+	now func() time.Time
+}
+
+// NewManager creates a conversation manager with the default timeout
+func NewManager(store interfaces.StateStoreInterface) *Manager {
+	return &Manager{
+		store:     store,
+		Timeout:   config.DefaultConversationTimeout,
+		Retention: config.DefaultConversationRetention,
+		now:       time.Now,
+	}
+}
+
+// Start begins step for key with data as its context, replacing any conversation key had.
+// The deadline is Timeout from now, so starting again also restarts the clock.
+func (m *Manager) Start(ctx context.Context, key Key, step string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return m.put(ctx, Conversation{Key: key, Step: step, Data: raw, Deadline: m.now().Add(m.Timeout)})
+}
+
+// Active returns key's conversation if it has not timed out
+func (m *Manager) Active(ctx context.Context, key Key) (Conversation, bool, error) {
+	var conv Conversation
+	found, err := m.store.Get(ctx, stateNamespace, key.String(), &conv)
+	if err != nil || !found || !m.now().Before(conv.Deadline) {
+		return Conversation{}, false, err
+	}
+	return conv, true, nil
+}
+
+// Take ends key's active conversation and returns it. Of several concurrent callers
+// only one receives it. A timed-out conversation is left for the sweeper.
+func (m *Manager) Take(ctx context.Context, key Key) (Conversation, bool, error) {
+	var conv Conversation
+	found, err := m.store.Take(ctx, stateNamespace, key.String(), &conv)
+	if err != nil || !found {
+		return Conversation{}, false, err
+	}
+	if !m.now().Before(conv.Deadline) {
+		return Conversation{}, false, m.put(ctx, conv)
+	}
+	return conv, true, nil
+}
+
+// TakeExpired claims every conversation whose deadline has passed. Running conversations are
+// only read, and an expired one is deleted only if it was not restarted since, so the sweep
+// never hides or overwrites a conversation it does not claim.
+func (m *Manager) TakeExpired(ctx context.Context) ([]Conversation, error) {
+	keys, err := m.store.Keys(ctx, stateNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Conversation
+	for _, raw := range keys {
+		key, err := parseKey(raw)
+		if err != nil {
+			logutils.Warn("Conversation: skipping malformed key", "key", raw, "error", err.Error())
+			continue
+		}
+		// Kept as stored, so the delete below matches it exactly
+		var data json.RawMessage
+		found, err := m.store.Get(ctx, stateNamespace, key.String(), &data)
+		if err != nil {
+			return expired, err
+		}
+		if !found {
+			continue // finished meanwhile
+		}
+		var conv Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			logutils.Warn("Conversation: skipping undecodable conversation", "key", key.String(), "error", err.Error())
+			continue
+		}
+		if m.now().Before(conv.Deadline) {
+			continue // still running
+		}
+		taken, err := m.store.DeleteIf(ctx, stateNamespace, key.String(), data)
+		if err != nil {
+			return expired, err
+		}
+		if taken {
+			expired = append(expired, conv)
+		}
+	}
+	return expired, nil
+}
+
+// Run hands every timed-out conversation to onTimeout, checking each interval until ctx ends
+func (m *Manager) Run(ctx context.Context, interval time.Duration, onTimeout func(ctx context.Context, conv Conversation)) {
+	logutils.Info("Conversation: sweeper started", "interval", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logutils.Info("Conversation: sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := m.TakeExpired(ctx)
+		if err != nil {
+			logutils.Error("Conversation: TakeExpiredError", err)
+		}
+		for _, conv := range expired {
+			logutils.Info("Conversation: timed out", "chatID", conv.Key.ChatID, "userID", conv.Key.UserID, "step", conv.Step)
+			onTimeout(ctx, conv)
+		}
+	}
+}
+
+func (m *Manager) put(ctx context.Context, conv Conversation) error {
+	ttl := conv.Deadline.Sub(m.now()) + m.Retention
+	if ttl <= 0 {
+		return nil // past retention; let it go
+	}
+	return m.store.Set(ctx, stateNamespace, conv.Key.String(), conv, ttl)
+}
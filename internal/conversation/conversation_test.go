@@ -0,0 +1,235 @@
+package conversation
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type prompt struct {
+	MessageID int64
+}
+
+func newManagers(t *testing.T) map[string]*Manager {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return map[string]*Manager{
+		"memory": NewManager(state.NewMemoryStore()),
+		"sqlite": NewManager(state.NewDatabaseStore(db)),
+	}
+}
+
+func TestManager_ScopedPerChatAndUser(t *testing.T) {
+	for name, m := range newManagers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := Key{ChatID: -100, UserID: 7}
+			require.NoError(t, m.Start(ctx, key, "topic_name", prompt{MessageID: 42}))
+
+			conv, ok, err := m.Active(ctx, key)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, "topic_name", conv.Step)
+			var got prompt
+			require.NoError(t, conv.Decode(&got))
+			assert.Equal(t, int64(42), got.MessageID)
+
+			for _, other := range []Key{{ChatID: -200, UserID: 7}, {ChatID: -100, UserID: 8}} {
+				_, ok, err := m.Active(ctx, other)
+				require.NoError(t, err)
+				assert.False(t, ok, "%v has no conversation", other)
+			}
+
+			_, ok, err = m.Take(ctx, key)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			_, ok, _ = m.Active(ctx, key)
+			assert.False(t, ok, "taking ends the conversation")
+		})
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	for name, m := range newManagers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			m.now = func() time.Time { return now }
+			late, fresh := Key{ChatID: 1, UserID: 1}, Key{ChatID: 1, UserID: 2}
+			require.NoError(t, m.Start(ctx, late, "topic_name", nil))
+			now = now.Add(m.Timeout / 2)
+			require.NoError(t, m.Start(ctx, fresh, "topic_name", nil))
+
+			now = now.Add(m.Timeout/2 + time.Second)
+			_, ok, err := m.Active(ctx, late)
+			require.NoError(t, err)
+			assert.False(t, ok, "a timed-out conversation is not active")
+			_, ok, err = m.Take(ctx, late)
+			require.NoError(t, err)
+			assert.False(t, ok, "a late reply cannot take a timed-out conversation")
+
+			expired, err := m.TakeExpired(ctx)
+			require.NoError(t, err)
+			require.Len(t, expired, 1, "the timed-out conversation is left for the sweeper")
+			assert.Equal(t, late, expired[0].Key)
+
+			expired, err = m.TakeExpired(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, expired, "each timeout is claimed once")
+			_, ok, _ = m.Active(ctx, fresh)
+			assert.True(t, ok, "running conversations are untouched by the sweep")
+		})
+	}
+}
+
+func TestManager_RestartResetsDeadline(t *testing.T) {
+	m := NewManager(state.NewMemoryStore())
+	ctx := context.Background()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	key := Key{ChatID: 1, UserID: 1}
+
+	require.NoError(t, m.Start(ctx, key, "topic_name", nil))
+	now = now.Add(m.Timeout - time.Second)
+	require.NoError(t, m.Start(ctx, key, "topic_name", nil))
+	now = now.Add(2 * time.Second)
+
+	_, ok, err := m.Active(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestManager_TakeIsExclusive(t *testing.T) {
+	for name, m := range newManagers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := Key{ChatID: 1, UserID: 1}
+			require.NoError(t, m.Start(ctx, key, "topic_name", nil))
+
+			var wg sync.WaitGroup
+			var taken int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, ok, err := m.Take(ctx, key); err == nil && ok {
+						atomic.AddInt32(&taken, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(1), taken)
+		})
+	}
+}
+
+func TestManager_RunHandsOverTimeouts(t *testing.T) {
+	var store interfaces.StateStoreInterface = state.NewMemoryStore()
+	m := NewManager(store)
+	m.Timeout = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, m.Start(ctx, Key{ChatID: 1, UserID: 1}, "topic_name", nil))
+
+	timedOut := make(chan Conversation, 1)
+	go m.Run(ctx, time.Millisecond, func(ctx context.Context, conv Conversation) {
+		timedOut <- conv
+	})
+
+	select {
+	case conv := <-timedOut:
+		assert.Equal(t, "topic_name", conv.Step)
+	case <-time.After(time.Second):
+		t.Fatal("timeout was not handed over")
+	}
+}
+
+// restartingStore restarts a conversation right after the sweeper read it, as a user would
+type restartingStore struct {
+	interfaces.StateStoreInterface
+	afterGet func()
+}
+
+func (s *restartingStore) Get(ctx context.Context, namespace, key string, dest interface{}) (bool, error) {
+	found, err := s.StateStoreInterface.Get(ctx, namespace, key, dest)
+	if s.afterGet != nil {
+		afterGet := s.afterGet
+		s.afterGet = nil
+		afterGet()
+	}
+	return found, err
+}
+
+func TestManager_TakeExpiredSparesRestartedConversation(t *testing.T) {
+	store := &restartingStore{StateStoreInterface: state.NewMemoryStore()}
+	m := NewManager(store)
+	ctx := context.Background()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	key := Key{ChatID: 1, UserID: 1}
+	require.NoError(t, m.Start(ctx, key, "topic_name", nil))
+
+	now = now.Add(m.Timeout + time.Second)
+	store.afterGet = func() { require.NoError(t, m.Start(ctx, key, "topic_name", prompt{MessageID: 2})) }
+	expired, err := m.TakeExpired(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, expired, "the conversation was restarted after the sweep read it")
+
+	conv, ok, err := m.Active(ctx, key)
+	require.NoError(t, err)
+	require.True(t, ok, "the restarted conversation survives the sweep")
+	var got prompt
+	require.NoError(t, conv.Decode(&got))
+	assert.Equal(t, int64(2), got.MessageID)
+}
+
+func TestManager_SweepLeavesRunningConversations(t *testing.T) {
+	for name, m := range newManagers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			running := Key{ChatID: 1, UserID: 1}
+			require.NoError(t, m.Start(ctx, running, "topic_name", nil))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 200; i++ {
+					if _, err := m.TakeExpired(ctx); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+
+			restarted := Key{ChatID: 1, UserID: 2}
+			for i := int64(0); ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				_, ok, err := m.Active(ctx, running)
+				require.NoError(t, err)
+				require.True(t, ok, "a sweep hid a running conversation")
+
+				require.NoError(t, m.Start(ctx, restarted, "topic_name", prompt{MessageID: i}))
+				conv, ok, err := m.Take(ctx, restarted)
+				require.NoError(t, err)
+				require.True(t, ok, "a sweep took or hid a conversation just started")
+				var got prompt
+				require.NoError(t, conv.Decode(&got))
+				require.Equal(t, i, got.MessageID, "a sweep put back a stale conversation")
+			}
+		})
+	}
+}
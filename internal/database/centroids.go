@@ -0,0 +1,76 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// TopicCentroid is the mean embedding of the messages saved in a topic
+type TopicCentroid struct {
+	ChatID    int64
+	TopicName string
+	Model     string // embedding model the vector came from; vectors of different models do not compare
+	Vector    []float32
+	Saves     int // messages averaged; 0 while only the topic's name was embedded
+}
+
+// TopicCentroids returns a chat's topic centroids made with model
+func (d *Database) TopicCentroids(chatID int64, model string) ([]TopicCentroid, error) {
+	rows, err := d.db.Query(`
+		SELECT topic_name, vector, saves FROM topic_centroids WHERE chat_id = ? AND model = ? ORDER BY topic_name
+	`, chatID, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var centroids []TopicCentroid
+	for rows.Next() {
+		c := TopicCentroid{ChatID: chatID, Model: model}
+		var vector []byte
+		if err := rows.Scan(&c.TopicName, &vector, &c.Saves); err != nil {
+			return nil, err
+		}
+		if c.Vector, err = decodeVector(vector); err != nil {
+			return nil, fmt.Errorf("centroid of topic %q: %w", c.TopicName, err)
+		}
+		centroids = append(centroids, c)
+	}
+	return centroids, rows.Err()
+}
+
+// SaveTopicCentroid stores a topic's centroid, replacing the earlier one whatever its model
+func (d *Database) SaveTopicCentroid(c TopicCentroid) error {
+	_, err := d.db.Exec(`
+		INSERT INTO topic_centroids (chat_id, topic_name, model, vector, saves, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(chat_id, topic_name) DO UPDATE SET
+			model = excluded.model,
+			vector = excluded.vector,
+			saves = excluded.saves,
+			updated_at = excluded.updated_at
+	`, c.ChatID, c.TopicName, c.Model, encodeVector(c.Vector), c.Saves)
+	return err
+}
+
+// encodeVector writes v as little-endian float32s
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+// decodeVector reads the little-endian float32s encodeVector wrote
+func decodeVector(b []byte) ([]float32, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("vector of %d bytes is not float32s", len(b))
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v, nil
+}
@@ -0,0 +1,573 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The conformance suite checks behaviour every DatabaseInterface implementation must
+// share. Each backend runs all of it: SQLite on disk and in memory always, Postgres
+// when TEST_POSTGRES_DSN names a server the tests may wipe.
+
+// openBackend returns an empty database for one conformance test
+type openBackend func(t *testing.T) DatabaseInterface
+
+func TestConformance_SQLite(t *testing.T) {
+	runConformance(t, func(t *testing.T) DatabaseInterface {
+		db, err := NewDatabase(filepath.Join(t.TempDir(), "bot.db"))
+		if err != nil {
+			t.Fatalf("NewDatabase() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestConformance_InMemory(t *testing.T) {
+	runConformance(t, func(t *testing.T) DatabaseInterface {
+		db, err := NewDatabase(":memory:")
+		if err != nil {
+			t.Fatalf("NewDatabase() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestConformance_Postgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	runConformance(t, func(t *testing.T) DatabaseInterface {
+		db, err := NewDatabase(dsn)
+		if err != nil {
+			t.Fatalf("NewDatabase() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		_, err = db.db.Exec(`TRUNCATE users, user_chats, topics, bot_state, scheduled_deletions, interaction_state,
+			saved_messages, user_settings, chat_settings, topic_centroids RESTART IDENTITY`)
+		if err != nil {
+			t.Fatalf("TRUNCATE error = %v", err)
+		}
+		return db
+	})
+}
+
+func runConformance(t *testing.T, open openBackend) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, db DatabaseInterface)
+	}{
+		{"Users", conformUsers},
+		{"Topics", conformTopics},
+		{"TopicRename", conformTopicRename},
+		{"UpdateOffset", conformUpdateOffset},
+		{"Deletions", conformDeletions},
+		{"State", conformState},
+		{"SavedMessages", conformSavedMessages},
+		{"Search", conformSearch},
+		{"Settings", conformSettings},
+		{"ChatSettings", conformChatSettings},
+		{"TopicCentroids", conformTopicCentroids},
+		{"BotScope", conformBotScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+func conformUsers(t *testing.T, db DatabaseInterface) {
+	if _, err := db.GetUser(1); err != sql.ErrNoRows {
+		t.Fatalf("GetUser() unknown user error = %v, want sql.ErrNoRows", err)
+	}
+	firstSeen := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if err := db.UpsertUser(User{ID: 1, Username: "ann", FirstName: "Ann", LastName: "Lee", LanguageCode: "en"}, -100, firstSeen); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	lastSeen := firstSeen.Add(time.Hour)
+	if err := db.UpsertUser(User{ID: 1, Username: "ann_l", FirstName: "Ann", LastName: "Lee-Smith", LanguageCode: "de"}, -200, lastSeen); err != nil {
+		t.Fatalf("UpsertUser() update error = %v", err)
+	}
+	if err := db.UpsertUser(User{ID: 1, Username: "ann_l", FirstName: "Ann", LastName: "Lee-Smith", LanguageCode: "de"}, 0, lastSeen); err != nil {
+		t.Fatalf("UpsertUser() without a chat error = %v", err)
+	}
+
+	user, err := db.GetUser(1)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user.Username != "ann_l" || user.LastName != "Lee-Smith" || user.LanguageCode != "de" {
+		t.Errorf("GetUser() = %+v, want the updated names and language", user)
+	}
+	if !user.CreatedAt.Equal(firstSeen) || !user.LastSeen.Equal(lastSeen) {
+		t.Errorf("GetUser() seen %v to %v, want %v to %v", user.CreatedAt, user.LastSeen, firstSeen, lastSeen)
+	}
+	if len(user.Chats) != 2 || user.Chats[0].ChatID != -200 || user.Chats[1].ChatID != -100 {
+		t.Fatalf("GetUser() chats = %+v, want -200 then -100", user.Chats)
+	}
+	if !user.Chats[1].FirstSeen.Equal(firstSeen) || !user.Chats[1].LastSeen.Equal(firstSeen) {
+		t.Errorf("GetUser() chat -100 = %+v, seen only at %v", user.Chats[1], firstSeen)
+	}
+}
+
+func conformTopics(t *testing.T, db DatabaseInterface) {
+	const chatID = -1001234567890
+	if err := db.AddTopic(chatID, "Work", 5, 7); err != nil {
+		t.Fatalf("AddTopic() error = %v", err)
+	}
+	if err := db.AddTopic(chatID, "Work", 6, 7); err != nil {
+		t.Fatalf("AddTopic() again error = %v", err)
+	}
+	if err := db.AddTopic(chatID, "Books", 8, 7); err != nil {
+		t.Fatalf("AddTopic() error = %v", err)
+	}
+	topics, err := db.GetTopicsByChat(chatID)
+	if err != nil {
+		t.Fatalf("GetTopicsByChat() error = %v", err)
+	}
+	if len(topics) != 2 || topics[0].Name != "Books" || topics[1].Name != "Work" || topics[1].MessageThreadId != 6 {
+		t.Fatalf("GetTopicsByChat() = %+v, want Books and Work (thread 6) by name", topics)
+	}
+	if exists, err := db.TopicExists(chatID, "Work"); err != nil || !exists {
+		t.Errorf("TopicExists(Work) = %v, %v, want true", exists, err)
+	}
+	if exists, err := db.TopicExists(chatID, "Music"); err != nil || exists {
+		t.Errorf("TopicExists(Music) = %v, %v, want false", exists, err)
+	}
+
+	err = db.SaveForumTopic(Topic{ChatID: chatID, Name: "Work", MessageThreadId: 9, IconColor: 0x6FB9F0, IconCustomEmojiID: "123"})
+	if err != nil {
+		t.Fatalf("SaveForumTopic() error = %v", err)
+	}
+	if _, err := db.GetTopicByThread(chatID, 6); err != sql.ErrNoRows {
+		t.Errorf("GetTopicByThread() stale thread error = %v, want sql.ErrNoRows", err)
+	}
+	if err := db.SetTopicClosed(chatID, 9, true); err != nil {
+		t.Fatalf("SetTopicClosed() error = %v", err)
+	}
+	if err := db.SetTopicIcon(chatID, 9, "456"); err != nil {
+		t.Fatalf("SetTopicIcon() error = %v", err)
+	}
+	topic, err := db.GetTopicByThread(chatID, 9)
+	if err != nil {
+		t.Fatalf("GetTopicByThread() error = %v", err)
+	}
+	if topic.Name != "Work" || topic.IconColor != 0x6FB9F0 || topic.IconCustomEmojiID != "456" || !topic.IsClosed {
+		t.Errorf("GetTopicByThread() = %+v", topic)
+	}
+
+	if err := db.DeleteTopic(chatID, 9); err != nil {
+		t.Fatalf("DeleteTopic() error = %v", err)
+	}
+	if exists, _ := db.TopicExists(chatID, "Work"); exists {
+		t.Error("TopicExists() after DeleteTopic = true")
+	}
+}
+
+func conformTopicRename(t *testing.T, db DatabaseInterface) {
+	if err := db.AddTopic(1, "Food", 5, 7); err != nil {
+		t.Fatalf("AddTopic() error = %v", err)
+	}
+	if _, err := db.RecordSavedMessage(SavedMessage{ChatID: 1, ThreadID: 5, TopicName: "Food", ContentType: "text",
+		SentAt: time.Now(), SavedAt: time.Now()}); err != nil {
+		t.Fatalf("RecordSavedMessage() error = %v", err)
+	}
+	if err := db.RenameTopic(1, 5, "Recipes"); err != nil {
+		t.Fatalf("RenameTopic() error = %v", err)
+	}
+	if err := db.RenameTopic(1, 6, "Unknown before"); err != nil {
+		t.Fatalf("RenameTopic() unknown thread error = %v", err)
+	}
+	topics, err := db.GetTopicsByChat(1)
+	if err != nil {
+		t.Fatalf("GetTopicsByChat() error = %v", err)
+	}
+	if len(topics) != 2 || topics[0].Name != "Recipes" || topics[1].Name != "Unknown before" {
+		t.Errorf("GetTopicsByChat() = %+v, want the renamed and the newly registered topic", topics)
+	}
+	saved, err := db.SavedMessagesByThread(1, 5)
+	if err != nil || len(saved) != 1 || saved[0].TopicName != "Recipes" {
+		t.Errorf("SavedMessagesByThread() = %+v, %v, want the save under the new name", saved, err)
+	}
+}
+
+func conformUpdateOffset(t *testing.T, db DatabaseInterface) {
+	if offset, err := db.GetUpdateOffset(); err != nil || offset != 0 {
+		t.Fatalf("GetUpdateOffset() before any save = %d, %v, want 0", offset, err)
+	}
+	for _, want := range []int64{42, 5000000000} {
+		if err := db.SaveUpdateOffset(want); err != nil {
+			t.Fatalf("SaveUpdateOffset() error = %v", err)
+		}
+		if offset, err := db.GetUpdateOffset(); err != nil || offset != want {
+			t.Errorf("GetUpdateOffset() = %d, %v, want %d", offset, err, want)
+		}
+	}
+}
+
+func conformDeletions(t *testing.T, db DatabaseInterface) {
+	now := time.UnixMilli(1700000000000)
+	due, err := db.ScheduleDeletion(1, 10, now.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleDeletion() error = %v", err)
+	}
+	later, err := db.ScheduleDeletion(1, 11, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ScheduleDeletion() error = %v", err)
+	}
+	if due == later {
+		t.Fatalf("ScheduleDeletion() returned the same ID %d twice", due)
+	}
+
+	jobs, err := db.DueDeletions(now, 10)
+	if err != nil {
+		t.Fatalf("DueDeletions() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != due || jobs[0].MessageID != 10 || !jobs[0].ExecuteAt.Equal(now.Add(-time.Second)) {
+		t.Fatalf("DueDeletions() = %+v, want only message 10", jobs)
+	}
+
+	if err := db.RetryDeletion(due, now.Add(time.Minute), "Too Many Requests"); err != nil {
+		t.Fatalf("RetryDeletion() error = %v", err)
+	}
+	jobs, _ = db.DueDeletions(now.Add(time.Minute), 10)
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError != "Too Many Requests" {
+		t.Fatalf("DueDeletions() after retry = %+v", jobs)
+	}
+	if err := db.CompleteDeletion(due); err != nil {
+		t.Fatalf("CompleteDeletion() error = %v", err)
+	}
+	if err := db.FailDeletion(later, "message can't be deleted"); err != nil {
+		t.Fatalf("FailDeletion() error = %v", err)
+	}
+	if jobs, _ := db.DueDeletions(now.Add(2*time.Hour), 10); len(jobs) != 0 {
+		t.Errorf("DueDeletions() after done and failed = %+v, want none", jobs)
+	}
+}
+
+func conformState(t *testing.T, db DatabaseInterface) {
+	now := time.UnixMilli(1700000000000)
+	if err := db.PutState("cb", "a", "1", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutState() error = %v", err)
+	}
+	if err := db.PutState("cb", "a", "2", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutState() replace error = %v", err)
+	}
+	if err := db.PutState("cb", "old", "x", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("PutState() error = %v", err)
+	}
+	if value, ok, err := db.GetState("cb", "a", now); err != nil || !ok || value != "2" {
+		t.Errorf("GetState() = %q, %v, %v, want the replaced value", value, ok, err)
+	}
+	if _, ok, _ := db.GetState("cb", "old", now); ok {
+		t.Error("GetState() returned an expired value")
+	}
+	if keys, err := db.StateKeys("cb", now); err != nil || !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("StateKeys() = %v, %v, want [a]", keys, err)
+	}
+
+	if value, ok, err := db.TakeState("cb", "a", now); err != nil || !ok || value != "2" {
+		t.Errorf("TakeState() = %q, %v, %v", value, ok, err)
+	}
+	if _, ok, _ := db.TakeState("cb", "a", now); ok {
+		t.Error("TakeState() handed out a value twice")
+	}
+
+	if err := db.PutState("cb", "c", "4", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutState() error = %v", err)
+	}
+	if deleted, err := db.DeleteStateIf("cb", "c", "3"); err != nil || deleted {
+		t.Errorf("DeleteStateIf() with a stale value = %v, %v, want false", deleted, err)
+	}
+	if deleted, err := db.DeleteStateIf("cb", "c", "4"); err != nil || !deleted {
+		t.Errorf("DeleteStateIf() = %v, %v, want true", deleted, err)
+	}
+	if _, ok, _ := db.GetState("cb", "c", now); ok {
+		t.Error("GetState() after DeleteStateIf found the value")
+	}
+
+	if err := db.PutState("cb", "b", "3", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutState() error = %v", err)
+	}
+	if err := db.DeleteState("cb", "b"); err != nil {
+		t.Fatalf("DeleteState() error = %v", err)
+	}
+	if _, ok, _ := db.GetState("cb", "b", now); ok {
+		t.Error("GetState() after DeleteState found the value")
+	}
+	if purged, err := db.PurgeExpiredState(now); err != nil || purged != 1 {
+		t.Errorf("PurgeExpiredState() = %d, %v, want 1", purged, err)
+	}
+}
+
+func conformSavedMessages(t *testing.T, db DatabaseInterface) {
+	savedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	first, err := db.RecordSavedMessage(SavedMessage{ChatID: 1, UserID: 7, OriginalMessageID: 100, ThreadID: 5,
+		SavedMessageID: 200, TopicName: "Food", ContentType: "photo", Snippet: "Cake", Text: "Cake recipe",
+		FileID: "file", SentAt: savedAt.Add(-time.Hour), SavedAt: savedAt})
+	if err != nil {
+		t.Fatalf("RecordSavedMessage() error = %v", err)
+	}
+	second, err := db.RecordSavedMessage(SavedMessage{ChatID: 1, ThreadID: 5, TopicName: "Food", ContentType: "text",
+		SentAt: savedAt, SavedAt: savedAt.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("RecordSavedMessage() error = %v", err)
+	}
+	if first == second {
+		t.Fatalf("RecordSavedMessage() returned the same ID %d twice", first)
+	}
+
+	saved, err := db.SavedMessagesByChat(1, 10)
+	if err != nil {
+		t.Fatalf("SavedMessagesByChat() error = %v", err)
+	}
+	if len(saved) != 2 || saved[0].ID != second {
+		t.Fatalf("SavedMessagesByChat() = %+v, want both, newest first", saved)
+	}
+	got := saved[1]
+	if got.UserID != 7 || got.OriginalMessageID != 100 || got.SavedMessageID != 200 || got.ContentType != "photo" ||
+		got.Snippet != "Cake" || got.Text != "Cake recipe" || got.FileID != "file" ||
+		!got.SentAt.Equal(savedAt.Add(-time.Hour)) || !got.SavedAt.Equal(savedAt) {
+		t.Errorf("SavedMessagesByChat() returned %+v", got)
+	}
+
+	if err := db.MoveSavedMessage(first, 6, "Desserts", 300); err != nil {
+		t.Fatalf("MoveSavedMessage() error = %v", err)
+	}
+	moved, err := db.SavedMessagesByThread(1, 6)
+	if err != nil || len(moved) != 1 || moved[0].TopicName != "Desserts" || moved[0].SavedMessageID != 300 {
+		t.Errorf("SavedMessagesByThread() after move = %+v, %v", moved, err)
+	}
+	if err := db.DeleteTopic(1, 6); err != nil {
+		t.Fatalf("DeleteTopic() error = %v", err)
+	}
+	if saved, _ := db.SavedMessagesByChat(1, 10); len(saved) != 1 {
+		t.Errorf("SavedMessagesByChat() after DeleteTopic = %d saves, want 1", len(saved))
+	}
+}
+
+func conformSearch(t *testing.T, db DatabaseInterface) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, m := range []SavedMessage{
+		{TopicName: "Recipes", ContentType: "text", Text: "Chocolate cake with cherries"},
+		{TopicName: "Recipes", ContentType: "photo", Text: "Lemon cake"},
+		{TopicName: "Work", ContentType: "text", Text: "Quarterly report"},
+		{TopicName: "Recipes", ContentType: "text", Text: "100% rye bread"},
+	} {
+		m.ChatID, m.SentAt, m.SavedAt = 1, base, base.Add(time.Duration(i)*time.Hour)
+		if _, err := db.RecordSavedMessage(m); err != nil {
+			t.Fatalf("RecordSavedMessage() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query SavedMessageQuery
+		want  []string
+	}{
+		{name: "every save, newest first", query: SavedMessageQuery{}, want: []string{"100% rye bread", "Quarterly report", "Lemon cake", "Chocolate cake with cherries"}},
+		{name: "all words, any case", query: SavedMessageQuery{Words: []string{"CAKE", "chocolate"}}, want: []string{"Chocolate cake with cherries"}},
+		{name: "topic ignores case", query: SavedMessageQuery{TopicName: "work"}, want: []string{"Quarterly report"}},
+		{name: "content type", query: SavedMessageQuery{ContentType: "photo"}, want: []string{"Lemon cake"}},
+		{name: "saved window", query: SavedMessageQuery{After: base.Add(time.Hour), Before: base.Add(3 * time.Hour)}, want: []string{"Quarterly report", "Lemon cake"}},
+		{name: "page", query: SavedMessageQuery{Offset: 1, Limit: 2}, want: []string{"Quarterly report", "Lemon cake"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			q.ChatID = 1
+			if q.Limit == 0 {
+				q.Limit = 10
+			}
+			saved, total, err := db.SearchSavedMessages(q)
+			if err != nil {
+				t.Fatalf("SearchSavedMessages() error = %v", err)
+			}
+			var texts []string
+			for _, m := range saved {
+				texts = append(texts, m.Text)
+			}
+			if !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("SearchSavedMessages() = %q, want %q", texts, tt.want)
+			}
+			if tt.query.Limit == 0 && total != len(tt.want) {
+				t.Errorf("SearchSavedMessages() total = %d, want %d", total, len(tt.want))
+			}
+		})
+	}
+}
+
+func conformSettings(t *testing.T, db DatabaseInterface) {
+	if _, err := db.GetSettings(7, 1); err != sql.ErrNoRows {
+		t.Fatalf("GetSettings() before any save error = %v, want sql.ErrNoRows", err)
+	}
+	want := Settings{UserID: 7, ChatID: 1, AutoDelete: true, AutoDeleteDelay: 10 * time.Second, ConfirmationStyle: "kept",
+		ConfirmationDelay: time.Minute, AIEnabled: false, SuggestionCount: 4, Language: "de"}
+	if err := db.SaveSettings(want); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+	want.AIEnabled = true
+	if err := db.SaveSettings(want); err != nil {
+		t.Fatalf("SaveSettings() replace error = %v", err)
+	}
+	got, err := db.GetSettings(7, 1)
+	if err != nil {
+		t.Fatalf("GetSettings() error = %v", err)
+	}
+	if *got != want {
+		t.Errorf("GetSettings() = %+v, want %+v", *got, want)
+	}
+}
+
+func conformChatSettings(t *testing.T, db DatabaseInterface) {
+	if _, err := db.GetChatSettings(1); err != sql.ErrNoRows {
+		t.Fatalf("GetChatSettings() before any save error = %v, want sql.ErrNoRows", err)
+	}
+	if err := db.SaveChatSettings(ChatSettings{ChatID: 1, PrivacyMode: true}); err != nil {
+		t.Fatalf("SaveChatSettings() error = %v", err)
+	}
+	got, err := db.GetChatSettings(1)
+	if err != nil {
+		t.Fatalf("GetChatSettings() error = %v", err)
+	}
+	if !got.PrivacyMode {
+		t.Errorf("GetChatSettings() = %+v, want privacy mode on", *got)
+	}
+	if err := db.SaveChatSettings(ChatSettings{ChatID: 1, PrivacyMode: false}); err != nil {
+		t.Fatalf("SaveChatSettings() replace error = %v", err)
+	}
+	if got, err = db.GetChatSettings(1); err != nil || got.PrivacyMode {
+		t.Errorf("GetChatSettings() after turning privacy off = %+v, %v", got, err)
+	}
+	if _, err := db.GetChatSettings(2); err != sql.ErrNoRows {
+		t.Errorf("GetChatSettings() of another chat error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func conformTopicCentroids(t *testing.T, db DatabaseInterface) {
+	if err := db.AddTopic(1, "Food", 5, 7); err != nil {
+		t.Fatalf("AddTopic() error = %v", err)
+	}
+	for _, c := range []TopicCentroid{
+		{ChatID: 1, TopicName: "Food", Model: "small", Vector: []float32{0.5, -1, 3e-8}, Saves: 0},
+		{ChatID: 1, TopicName: "Food", Model: "small", Vector: []float32{0.25, -0.5, 1}, Saves: 2},
+		{ChatID: 1, TopicName: "Work", Model: "large", Vector: []float32{1}, Saves: 1},
+		{ChatID: 2, TopicName: "Food", Model: "small", Vector: []float32{1, 1, 1}, Saves: 9},
+	} {
+		if err := db.SaveTopicCentroid(c); err != nil {
+			t.Fatalf("SaveTopicCentroid(%+v) error = %v", c, err)
+		}
+	}
+	got, err := db.TopicCentroids(1, "small")
+	if err != nil {
+		t.Fatalf("TopicCentroids() error = %v", err)
+	}
+	want := TopicCentroid{ChatID: 1, TopicName: "Food", Model: "small", Vector: []float32{0.25, -0.5, 1}, Saves: 2}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("TopicCentroids() = %+v, want only %+v", got, want)
+	}
+
+	if err := db.RenameTopic(1, 5, "Recipes"); err != nil {
+		t.Fatalf("RenameTopic() error = %v", err)
+	}
+	if got, _ := db.TopicCentroids(1, "small"); len(got) != 1 || got[0].TopicName != "Recipes" {
+		t.Errorf("TopicCentroids() after rename = %+v, want the centroid under the new name", got)
+	}
+	if err := db.DeleteTopic(1, 5); err != nil {
+		t.Fatalf("DeleteTopic() error = %v", err)
+	}
+	if got, _ := db.TopicCentroids(1, "small"); len(got) != 0 {
+		t.Errorf("TopicCentroids() after DeleteTopic = %+v, want none", got)
+	}
+	if got, _ := db.TopicCentroids(2, "small"); len(got) != 1 {
+		t.Errorf("TopicCentroids() of another chat = %+v, want it untouched", got)
+	}
+}
+
+// conformBotScope runs two bots on one database: neither sees the other's offset,
+// deletions or interaction state
+func conformBotScope(t *testing.T, db DatabaseInterface) {
+	shared := db.(*Database)
+	now := time.UnixMilli(1700000000000)
+
+	// State saved before it was kept per bot goes to whichever bot claims it first
+	if err := shared.SaveUpdateOffset(7); err != nil {
+		t.Fatalf("SaveUpdateOffset() error = %v", err)
+	}
+	if _, err := shared.ScheduleDeletion(1, 9, now.Add(-time.Second)); err != nil {
+		t.Fatalf("ScheduleDeletion() error = %v", err)
+	}
+	if err := shared.PutState("cb", "old", "0", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PutState() error = %v", err)
+	}
+
+	first, second := shared.ForBot(111), shared.ForBot(222)
+	if err := first.ClaimUnscopedState(); err != nil {
+		t.Fatalf("ClaimUnscopedState() error = %v", err)
+	}
+	if err := second.ClaimUnscopedState(); err != nil {
+		t.Fatalf("ClaimUnscopedState() second bot error = %v", err)
+	}
+	if offset, _ := first.GetUpdateOffset(); offset != 7 {
+		t.Errorf("GetUpdateOffset() after claiming = %d, want 7", offset)
+	}
+	if value, ok, _ := first.GetState("cb", "old", now); !ok || value != "0" {
+		t.Errorf("GetState() after claiming = %q, %v, want the unscoped value", value, ok)
+	}
+	if offset, _ := second.GetUpdateOffset(); offset != 0 {
+		t.Errorf("GetUpdateOffset() of the bot that claimed second = %d, want 0", offset)
+	}
+
+	if err := first.SaveUpdateOffset(100); err != nil {
+		t.Fatalf("SaveUpdateOffset() error = %v", err)
+	}
+	if err := second.SaveUpdateOffset(200); err != nil {
+		t.Fatalf("SaveUpdateOffset() error = %v", err)
+	}
+	if offset, _ := first.GetUpdateOffset(); offset != 100 {
+		t.Errorf("GetUpdateOffset() = %d, want 100: the other bot overwrote it", offset)
+	}
+
+	theirs, err := second.ScheduleDeletion(2, 20, now.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleDeletion() error = %v", err)
+	}
+	jobs, err := first.DueDeletions(now, 10)
+	if err != nil {
+		t.Fatalf("DueDeletions() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].MessageID != 9 {
+		t.Fatalf("DueDeletions() = %+v, want only the claimed message 9", jobs)
+	}
+	if err := first.CompleteDeletion(theirs); err != nil {
+		t.Fatalf("CompleteDeletion() error = %v", err)
+	}
+	if jobs, _ := second.DueDeletions(now, 10); len(jobs) != 1 || jobs[0].ID != theirs {
+		t.Errorf("DueDeletions() = %+v, want message 20 still pending for its own bot", jobs)
+	}
+
+	for bot, value := range map[*Database]string{first: "1", second: "2"} {
+		if err := bot.PutState("cb", "a", value, now.Add(time.Minute)); err != nil {
+			t.Fatalf("PutState() error = %v", err)
+		}
+	}
+	if value, ok, _ := first.TakeState("cb", "a", now); !ok || value != "1" {
+		t.Errorf("TakeState() = %q, %v, want the bot's own value", value, ok)
+	}
+	if keys, _ := second.StateKeys("cb", now); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("StateKeys() = %v, want [a] untouched by the other bot", keys)
+	}
+	if purged, _ := first.PurgeExpiredState(now.Add(time.Hour)); purged != 1 {
+		t.Errorf("PurgeExpiredState() = %d, want only the bot's own expired value", purged)
+	}
+	if _, ok, _ := second.GetState("cb", "a", now); !ok {
+		t.Error("GetState() lost a value the other bot purged")
+	}
+}
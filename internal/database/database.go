@@ -3,107 +3,201 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Database stores the bot's data in SQLite or Postgres, whichever its DSN selects.
+// The update offset, scheduled deletions and interaction state belong to one bot: they
+// are kept under the bot ID set by ForBot, so bots sharing a database never see each other's.
 type Database struct {
-	db *sql.DB
+	db    *conn
+	botID int64
 }
 
+// User is someone who sent the bot an update
 type User struct {
+	ID           int64
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	CreatedAt    time.Time // first seen
+	LastSeen     time.Time
+	Chats        []UserChat // most recently used first; filled by GetUser
+}
+
+// UserChat is a chat a user has used the bot in
+type UserChat struct {
+	ChatID    int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Scheduled deletion statuses
+const (
+	DeletionPending = "pending"
+	DeletionDone    = "done"
+	DeletionFailed  = "failed"
+)
+
+// ScheduledDeletion is a message the bot has promised to delete at ExecuteAt
+type ScheduledDeletion struct {
 	ID        int64
-	Username  string
-	FirstName string
-	LastName  string
-	CreatedAt time.Time
+	ChatID    int64
+	MessageID int64
+	ExecuteAt time.Time
+	Attempts  int
+	LastError string
+	Status    string
+}
+
+// SavedMessage records one message saved into a topic and where its copy ended up
+type SavedMessage struct {
+	ID                int64
+	ChatID            int64
+	UserID            int64 // who saved it
+	OriginalMessageID int64
+	ThreadID          int64
+	SavedMessageID    int64 // the copy inside the topic
+	TopicName         string
+	ContentType       string
+	Snippet           string // start of the text or caption
+	Text              string // the whole text or caption, for search
+	FileID            string // the attached file, if any
+	SentAt            time.Time
+	SavedAt           time.Time
+}
+
+// Settings is one user's preferences in one chat
+type Settings struct {
+	UserID            int64
+	ChatID            int64
+	AutoDelete        bool // remove the original message from General once saved
+	AutoDeleteDelay   time.Duration
+	ConfirmationStyle string
+	ConfirmationDelay time.Duration // how long timed confirmations and warnings stay
+	AIEnabled         bool
+	SuggestionCount   int
+	Language          string
+}
+
+// ChatSettings is the preferences every user in one chat shares
+type ChatSettings struct {
+	ChatID      int64
+	PrivacyMode bool // message text is never sent to the AI provider
 }
 
 type Topic struct {
-	ID              int
-	ChatID          int64
-	Name            string
-	MessageThreadId int64
-	CreatedBy       int64
-	CreatedAt       time.Time
+	ID                int
+	ChatID            int64
+	Name              string
+	MessageThreadId   int64
+	CreatedBy         int64
+	IconColor         int64
+	IconCustomEmojiID string
+	IsClosed          bool
+	CreatedAt         time.Time
 }
 
-func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// NewDatabase opens the database at dsn and brings its schema up to date. The DSN is a
+// SQLite file path (or :memory:) or a postgres:// URL.
+func NewDatabase(dsn string) (*Database, error) {
+	d, err := Open(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, err
 	}
-
-	// Create tables if they don't exist
-	if err := createTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+	if _, err := d.Migrate(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
-
-	return &Database{db: db}, nil
+	if err := d.db.dialect.prepare(d); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to prepare search index: %v", err)
+	}
+	return d, nil
 }
 
-func createTables(db *sql.DB) error {
-	// Create users table
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY,
-			username TEXT,
-			first_name TEXT,
-			last_name TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+// Open opens the database at dsn without touching its schema
+func Open(dsn string) (*Database, error) {
+	driver, err := DriverFor(dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Create topics table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS topics (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			chat_id INTEGER NOT NULL,
-			name TEXT NOT NULL,
-			message_thread_id INTEGER,
-			created_by INTEGER,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(chat_id, name)
-		)
-	`)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
-
-	return nil
+	if dsn == ":memory:" {
+		// Every connection to :memory: is a separate empty database
+		db.SetMaxOpenConns(1)
+	}
+	return &Database{db: &conn{DB: db, dialect: dialectFor(driver)}}, nil
 }
 
-// UpsertUser adds or updates a user
-func (d *Database) UpsertUser(userID int64, username, firstName, lastName string) error {
-	_, err := d.db.Exec(`
-		INSERT OR REPLACE INTO users (id, username, first_name, last_name, created_at)
-		VALUES (?, ?, ?, ?, COALESCE((SELECT created_at FROM users WHERE id = ?), CURRENT_TIMESTAMP))
-	`, userID, username, firstName, lastName, userID)
-	return err
+// UpsertUser records that u was seen at seenAt in chatID, keeping their names and language
+// current. A chatID of 0 records the user alone.
+func (d *Database) UpsertUser(u User, chatID int64, seenAt time.Time) error {
+	seenAt = seenAt.UTC()
+	return d.withTx(func(tx *txConn) error {
+		_, err := tx.Exec(`
+			INSERT INTO users (id, username, first_name, last_name, language_code, created_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				username = excluded.username, first_name = excluded.first_name, last_name = excluded.last_name,
+				language_code = excluded.language_code, last_seen_at = excluded.last_seen_at
+		`, u.ID, u.Username, u.FirstName, u.LastName, u.LanguageCode, seenAt, seenAt)
+		if err != nil || chatID == 0 {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_chats (user_id, chat_id, first_seen_at, last_seen_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, chat_id) DO UPDATE SET last_seen_at = excluded.last_seen_at
+		`, u.ID, chatID, seenAt, seenAt)
+		return err
+	})
 }
 
-// GetUser retrieves a user by ID
+// GetUser retrieves a user by ID along with the chats they used the bot in.
+// It returns sql.ErrNoRows when the user was never seen.
 func (d *Database) GetUser(userID int64) (*User, error) {
 	var user User
+	var lastSeen sql.NullTime
 	err := d.db.QueryRow(`
-		SELECT id, username, first_name, last_name, created_at
+		SELECT id, COALESCE(username, ''), COALESCE(first_name, ''), COALESCE(last_name, ''), language_code, created_at, last_seen_at
 		FROM users WHERE id = ?
-	`, userID).Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.CreatedAt)
+	`, userID).Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.LanguageCode, &user.CreatedAt, &lastSeen)
+	if err != nil {
+		return nil, err
+	}
+	user.LastSeen = lastSeen.Time
+
+	rows, err := d.db.Query(`
+		SELECT chat_id, first_seen_at, last_seen_at FROM user_chats WHERE user_id = ? ORDER BY last_seen_at DESC, chat_id
+	`, userID)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	defer rows.Close()
+	for rows.Next() {
+		var chat UserChat
+		if err := rows.Scan(&chat.ChatID, &chat.FirstSeen, &chat.LastSeen); err != nil {
+			return nil, err
+		}
+		user.Chats = append(user.Chats, chat)
+	}
+	return &user, rows.Err()
 }
 
 // AddTopic adds a new topic
 func (d *Database) AddTopic(chatID int64, name string, messageThreadId int64, createdBy int64) error {
 	_, err := d.db.Exec(`
-		INSERT OR IGNORE INTO topics (chat_id, name, message_thread_id, created_by)
+		INSERT INTO topics (chat_id, name, message_thread_id, created_by)
 		VALUES (?, ?, ?, ?)
+		ON CONFLICT(chat_id, name) DO UPDATE SET message_thread_id = excluded.message_thread_id
 	`, chatID, name, messageThreadId, createdBy)
 	return err
 }
@@ -111,7 +205,7 @@ func (d *Database) AddTopic(chatID int64, name string, messageThreadId int64, cr
 // GetTopicsByChat retrieves all topics for a chat
 func (d *Database) GetTopicsByChat(chatID int64) ([]Topic, error) {
 	rows, err := d.db.Query(`
-		SELECT id, chat_id, name, message_thread_id, created_by, created_at
+		SELECT `+topicColumns+`
 		FROM topics WHERE chat_id = ?
 		ORDER BY name
 	`, chatID)
@@ -122,16 +216,134 @@ func (d *Database) GetTopicsByChat(chatID int64) ([]Topic, error) {
 
 	var topics []Topic
 	for rows.Next() {
-		var topic Topic
-		err := rows.Scan(&topic.ID, &topic.ChatID, &topic.Name, &topic.MessageThreadId, &topic.CreatedBy, &topic.CreatedAt)
+		topic, err := scanTopic(rows)
 		if err != nil {
 			return nil, err
 		}
-		topics = append(topics, topic)
+		topics = append(topics, *topic)
 	}
 	return topics, nil
 }
 
+// GetTopicByThread retrieves the topic registered for a forum thread.
+// It returns sql.ErrNoRows when the thread is unknown.
+func (d *Database) GetTopicByThread(chatID int64, messageThreadId int64) (*Topic, error) {
+	row := d.db.QueryRow(`
+		SELECT `+topicColumns+`
+		FROM topics WHERE chat_id = ? AND message_thread_id = ?
+	`, chatID, messageThreadId)
+	return scanTopic(row)
+}
+
+// SaveForumTopic records a topic by its thread, replacing whatever was known about that
+// thread and dropping a stale row that still holds the same name for another thread
+func (d *Database) SaveForumTopic(topic Topic) error {
+	return d.withTx(func(tx *txConn) error {
+		if err := releaseTopicName(tx, topic.ChatID, topic.Name, topic.MessageThreadId); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`
+			UPDATE topics SET name = ?, icon_color = ?, icon_custom_emoji_id = ?, is_closed = ?
+			WHERE chat_id = ? AND message_thread_id = ?
+		`, topic.Name, topic.IconColor, topic.IconCustomEmojiID, topic.IsClosed, topic.ChatID, topic.MessageThreadId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO topics (chat_id, name, message_thread_id, created_by, icon_color, icon_custom_emoji_id, is_closed)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, topic.ChatID, topic.Name, topic.MessageThreadId, topic.CreatedBy, topic.IconColor, topic.IconCustomEmojiID, topic.IsClosed)
+		return err
+	})
+}
+
+// RenameTopic changes the name of the topic in a thread, registering the thread if it is unknown.
+// Saves indexed in the thread take the new name too.
+func (d *Database) RenameTopic(chatID int64, messageThreadId int64, name string) error {
+	return d.withTx(func(tx *txConn) error {
+		if err := releaseTopicName(tx, chatID, name, messageThreadId); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			UPDATE saved_messages SET topic_name = ? WHERE chat_id = ? AND thread_id = ?
+		`, name, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		// The topic's centroid follows it to the new name
+		_, err = tx.Exec(`
+			DELETE FROM topic_centroids WHERE chat_id = ? AND topic_name = ?
+				AND topic_name <> (SELECT name FROM topics WHERE chat_id = ? AND message_thread_id = ?)
+		`, chatID, name, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE topic_centroids SET topic_name = ?
+			WHERE chat_id = ? AND topic_name = (SELECT name FROM topics WHERE chat_id = ? AND message_thread_id = ?)
+		`, name, chatID, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(`
+			UPDATE topics SET name = ? WHERE chat_id = ? AND message_thread_id = ?
+		`, name, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO topics (chat_id, name, message_thread_id, created_by) VALUES (?, ?, ?, 0)
+		`, chatID, name, messageThreadId)
+		return err
+	})
+}
+
+// SetTopicIcon updates the custom emoji icon of a known topic
+func (d *Database) SetTopicIcon(chatID int64, messageThreadId int64, iconCustomEmojiID string) error {
+	_, err := d.db.Exec(`
+		UPDATE topics SET icon_custom_emoji_id = ? WHERE chat_id = ? AND message_thread_id = ?
+	`, iconCustomEmojiID, chatID, messageThreadId)
+	return err
+}
+
+// SetTopicClosed marks a known topic as closed or reopened
+func (d *Database) SetTopicClosed(chatID int64, messageThreadId int64, closed bool) error {
+	_, err := d.db.Exec(`
+		UPDATE topics SET is_closed = ? WHERE chat_id = ? AND message_thread_id = ?
+	`, closed, chatID, messageThreadId)
+	return err
+}
+
+// DeleteTopic forgets the topic in a thread along with the saves indexed in it,
+// whose copies went with the topic
+func (d *Database) DeleteTopic(chatID int64, messageThreadId int64) error {
+	return d.withTx(func(tx *txConn) error {
+		_, err := tx.Exec(`
+			DELETE FROM saved_messages WHERE chat_id = ? AND thread_id = ?
+		`, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			DELETE FROM topic_centroids WHERE chat_id = ?
+				AND topic_name IN (SELECT name FROM topics WHERE chat_id = ? AND message_thread_id = ?)
+		`, chatID, chatID, messageThreadId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			DELETE FROM topics WHERE chat_id = ? AND message_thread_id = ?
+		`, chatID, messageThreadId)
+		return err
+	})
+}
+
 // TopicExists checks if a topic exists in a chat
 func (d *Database) TopicExists(chatID int64, name string) (bool, error) {
 	var exists int
@@ -147,6 +359,384 @@ func (d *Database) TopicExists(chatID int64, name string) (bool, error) {
 	return true, nil
 }
 
+// ForBot returns the database as seen by the bot with user ID botID. It shares the
+// connection with d, so closing either closes both.
+func (d *Database) ForBot(botID int64) *Database {
+	return &Database{db: d.db, botID: botID}
+}
+
+// ClaimUnscopedState hands the per-bot state stored before it was kept per bot to this bot.
+// Whichever bot starts first after the upgrade takes it; rows this bot already has win.
+func (d *Database) ClaimUnscopedState() error {
+	if d.botID == 0 {
+		return nil
+	}
+	return d.withTx(func(tx *txConn) error {
+		if _, err := tx.Exec(`
+			UPDATE bot_state SET bot_id = ? WHERE bot_id = 0
+			AND key NOT IN (SELECT key FROM bot_state WHERE bot_id = ?)
+		`, d.botID, d.botID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE interaction_state SET bot_id = ? WHERE bot_id = 0
+			AND NOT EXISTS (SELECT 1 FROM interaction_state s
+				WHERE s.bot_id = ? AND s.namespace = interaction_state.namespace AND s.key = interaction_state.key)
+		`, d.botID, d.botID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE scheduled_deletions SET bot_id = ? WHERE bot_id = 0`, d.botID)
+		return err
+	})
+}
+
+// updateOffsetKey is the bot_state key of the next getUpdates offset
+const updateOffsetKey = "update_offset"
+
+// GetUpdateOffset returns the saved getUpdates offset, 0 when none was saved yet
+func (d *Database) GetUpdateOffset() (int64, error) {
+	var offset int64
+	err := d.db.QueryRow(`SELECT CAST(value AS BIGINT) FROM bot_state WHERE bot_id = ? AND key = ?`, d.botID, updateOffsetKey).Scan(&offset)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return offset, err
+}
+
+// SaveUpdateOffset stores the getUpdates offset to resume from after a restart
+func (d *Database) SaveUpdateOffset(offset int64) error {
+	_, err := d.db.Exec(`
+		INSERT INTO bot_state (bot_id, key, value, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(bot_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, d.botID, updateOffsetKey, strconv.FormatInt(offset, 10))
+	return err
+}
+
+// ScheduleDeletion records that a message must be deleted at executeAt
+func (d *Database) ScheduleDeletion(chatID int64, messageID int64, executeAt time.Time) (int64, error) {
+	var id int64
+	err := d.db.QueryRow(`
+		INSERT INTO scheduled_deletions (bot_id, chat_id, message_id, execute_at) VALUES (?, ?, ?, ?) RETURNING id
+	`, d.botID, chatID, messageID, executeAt.UnixMilli()).Scan(&id)
+	return id, err
+}
+
+// DueDeletions returns up to limit pending deletions whose time has come, oldest first
+func (d *Database) DueDeletions(now time.Time, limit int) ([]ScheduledDeletion, error) {
+	rows, err := d.db.Query(`
+		SELECT id, chat_id, message_id, execute_at, attempts, last_error, status
+		FROM scheduled_deletions
+		WHERE bot_id = ? AND status = ? AND execute_at <= ?
+		ORDER BY execute_at, id
+		LIMIT ?
+	`, d.botID, DeletionPending, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledDeletion
+	for rows.Next() {
+		var job ScheduledDeletion
+		var executeAt int64
+		if err := rows.Scan(&job.ID, &job.ChatID, &job.MessageID, &executeAt, &job.Attempts, &job.LastError, &job.Status); err != nil {
+			return nil, err
+		}
+		job.ExecuteAt = time.UnixMilli(executeAt)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CompleteDeletion marks a deletion as done
+func (d *Database) CompleteDeletion(id int64) error {
+	_, err := d.db.Exec(`UPDATE scheduled_deletions SET status = ? WHERE bot_id = ? AND id = ?`, DeletionDone, d.botID, id)
+	return err
+}
+
+// RetryDeletion records a failed attempt and reschedules the deletion for nextAttempt
+func (d *Database) RetryDeletion(id int64, nextAttempt time.Time, lastError string) error {
+	_, err := d.db.Exec(`
+		UPDATE scheduled_deletions SET attempts = attempts + 1, execute_at = ?, last_error = ? WHERE bot_id = ? AND id = ?
+	`, nextAttempt.UnixMilli(), lastError, d.botID, id)
+	return err
+}
+
+// FailDeletion gives up on a deletion, keeping the last error for inspection
+func (d *Database) FailDeletion(id int64, lastError string) error {
+	_, err := d.db.Exec(`
+		UPDATE scheduled_deletions SET attempts = attempts + 1, status = ?, last_error = ? WHERE bot_id = ? AND id = ?
+	`, DeletionFailed, lastError, d.botID, id)
+	return err
+}
+
+// PutState stores value under namespace/key until expiresAt, replacing any earlier value
+func (d *Database) PutState(namespace, key, value string, expiresAt time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO interaction_state (bot_id, namespace, key, value, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(bot_id, namespace, key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+	`, d.botID, namespace, key, value, expiresAt.UnixMilli())
+	return err
+}
+
+// GetState returns the value under namespace/key if it has not expired by now
+func (d *Database) GetState(namespace, key string, now time.Time) (string, bool, error) {
+	var value string
+	err := d.db.QueryRow(`
+		SELECT value FROM interaction_state WHERE bot_id = ? AND namespace = ? AND key = ? AND expires_at > ?
+	`, d.botID, namespace, key, now.UnixMilli()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// TakeState deletes the value under namespace/key and returns it if it had not expired by now.
+// The delete is a single statement, so concurrent callers cannot both receive the value.
+func (d *Database) TakeState(namespace, key string, now time.Time) (string, bool, error) {
+	var value string
+	var expiresAt int64
+	err := d.db.QueryRow(`
+		DELETE FROM interaction_state WHERE bot_id = ? AND namespace = ? AND key = ? RETURNING value, expires_at
+	`, d.botID, namespace, key).Scan(&value, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if expiresAt <= now.UnixMilli() {
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// DeleteStateIf deletes the value under namespace/key only if it still is value, and reports
+// whether it did. A value replaced meanwhile is left alone.
+func (d *Database) DeleteStateIf(namespace, key, value string) (bool, error) {
+	res, err := d.db.Exec(`
+		DELETE FROM interaction_state WHERE bot_id = ? AND namespace = ? AND key = ? AND value = ?
+	`, d.botID, namespace, key, value)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteState removes the value under namespace/key
+func (d *Database) DeleteState(namespace, key string) error {
+	_, err := d.db.Exec(`DELETE FROM interaction_state WHERE bot_id = ? AND namespace = ? AND key = ?`, d.botID, namespace, key)
+	return err
+}
+
+// StateKeys lists the keys in namespace whose values have not expired by now
+func (d *Database) StateKeys(namespace string, now time.Time) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT key FROM interaction_state WHERE bot_id = ? AND namespace = ? AND expires_at > ?
+	`, d.botID, namespace, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// PurgeExpiredState deletes every value of this bot that expired by now and reports how many went
+func (d *Database) PurgeExpiredState(now time.Time) (int64, error) {
+	res, err := d.db.Exec(`DELETE FROM interaction_state WHERE bot_id = ? AND expires_at <= ?`, d.botID, now.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecordSavedMessage adds a save to the index and returns its ID
+func (d *Database) RecordSavedMessage(m SavedMessage) (int64, error) {
+	var id int64
+	err := d.db.QueryRow(`
+		INSERT INTO saved_messages (chat_id, user_id, original_message_id, thread_id, saved_message_id,
+			topic_name, content_type, snippet, text, file_id, sent_at, saved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, m.ChatID, m.UserID, m.OriginalMessageID, m.ThreadID, m.SavedMessageID,
+		m.TopicName, m.ContentType, m.Snippet, m.Text, m.FileID, m.SentAt.UTC(), m.SavedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+// SavedMessagesByChat returns up to limit of a chat's saves, newest first
+func (d *Database) SavedMessagesByChat(chatID int64, limit int) ([]SavedMessage, error) {
+	rows, err := d.db.Query(`
+		SELECT `+savedMessageColumns+` FROM saved_messages WHERE chat_id = ? ORDER BY saved_at DESC, id DESC LIMIT ?
+	`, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saved []SavedMessage
+	for rows.Next() {
+		m, err := scanSavedMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, *m)
+	}
+	return saved, rows.Err()
+}
+
+// SavedMessagesByThread returns the saves indexed in a topic, oldest first
+func (d *Database) SavedMessagesByThread(chatID int64, threadID int64) ([]SavedMessage, error) {
+	rows, err := d.db.Query(`
+		SELECT `+savedMessageColumns+` FROM saved_messages WHERE chat_id = ? AND thread_id = ? ORDER BY saved_at, id
+	`, chatID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saved []SavedMessage
+	for rows.Next() {
+		m, err := scanSavedMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, *m)
+	}
+	return saved, rows.Err()
+}
+
+// MoveSavedMessage points an indexed save at its new copy in another topic
+func (d *Database) MoveSavedMessage(id int64, threadID int64, topicName string, savedMessageID int64) error {
+	_, err := d.db.Exec(`
+		UPDATE saved_messages SET thread_id = ?, topic_name = ?, saved_message_id = ? WHERE id = ?
+	`, threadID, topicName, savedMessageID, id)
+	return err
+}
+
+// GetSettings returns a user's settings in a chat, or sql.ErrNoRows if they never changed any
+func (d *Database) GetSettings(userID int64, chatID int64) (*Settings, error) {
+	s := Settings{UserID: userID, ChatID: chatID}
+	var autoDeleteDelay, confirmationDelay int64
+	err := d.db.QueryRow(`
+		SELECT auto_delete, auto_delete_delay_ms, confirmation_style, confirmation_delay_ms, ai_enabled, suggestion_count, language
+		FROM user_settings WHERE user_id = ? AND chat_id = ?
+	`, userID, chatID).Scan(&s.AutoDelete, &autoDeleteDelay, &s.ConfirmationStyle, &confirmationDelay, &s.AIEnabled, &s.SuggestionCount, &s.Language)
+	if err != nil {
+		return nil, err
+	}
+	s.AutoDeleteDelay = time.Duration(autoDeleteDelay) * time.Millisecond
+	s.ConfirmationDelay = time.Duration(confirmationDelay) * time.Millisecond
+	return &s, nil
+}
+
+// SaveSettings stores a user's settings in a chat, replacing earlier ones
+func (d *Database) SaveSettings(s Settings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, chat_id, auto_delete, auto_delete_delay_ms, confirmation_style, confirmation_delay_ms, ai_enabled, suggestion_count, language, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, chat_id) DO UPDATE SET
+			auto_delete = excluded.auto_delete,
+			auto_delete_delay_ms = excluded.auto_delete_delay_ms,
+			confirmation_style = excluded.confirmation_style,
+			confirmation_delay_ms = excluded.confirmation_delay_ms,
+			ai_enabled = excluded.ai_enabled,
+			suggestion_count = excluded.suggestion_count,
+			language = excluded.language,
+			updated_at = excluded.updated_at
+	`, s.UserID, s.ChatID, s.AutoDelete, s.AutoDeleteDelay.Milliseconds(), s.ConfirmationStyle, s.ConfirmationDelay.Milliseconds(),
+		s.AIEnabled, s.SuggestionCount, s.Language)
+	return err
+}
+
+// GetChatSettings returns a chat's settings, or sql.ErrNoRows if its admins never changed any
+func (d *Database) GetChatSettings(chatID int64) (*ChatSettings, error) {
+	s := ChatSettings{ChatID: chatID}
+	err := d.db.QueryRow(`SELECT privacy_mode FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&s.PrivacyMode)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveChatSettings stores a chat's settings, replacing earlier ones
+func (d *Database) SaveChatSettings(s ChatSettings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO chat_settings (chat_id, privacy_mode, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			privacy_mode = excluded.privacy_mode,
+			updated_at = excluded.updated_at
+	`, s.ChatID, s.PrivacyMode)
+	return err
+}
+
+// topicColumns is the column list scanTopic expects
+const topicColumns = `id, chat_id, name, message_thread_id, created_by, icon_color, icon_custom_emoji_id, is_closed, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTopic(row rowScanner) (*Topic, error) {
+	var topic Topic
+	var threadID, createdBy sql.NullInt64
+	err := row.Scan(&topic.ID, &topic.ChatID, &topic.Name, &threadID, &createdBy,
+		&topic.IconColor, &topic.IconCustomEmojiID, &topic.IsClosed, &topic.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	topic.MessageThreadId = threadID.Int64
+	topic.CreatedBy = createdBy.Int64
+	return &topic, nil
+}
+
+// savedMessageColumns is the column list scanSavedMessage expects
+const savedMessageColumns = `id, chat_id, user_id, original_message_id, thread_id, saved_message_id,
+	topic_name, content_type, snippet, text, file_id, sent_at, saved_at`
+
+func scanSavedMessage(row rowScanner) (*SavedMessage, error) {
+	var m SavedMessage
+	err := row.Scan(&m.ID, &m.ChatID, &m.UserID, &m.OriginalMessageID, &m.ThreadID, &m.SavedMessageID,
+		&m.TopicName, &m.ContentType, &m.Snippet, &m.Text, &m.FileID, &m.SentAt, &m.SavedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// releaseTopicName removes a row that holds name for a different thread.
+// Telegram is the source of truth, so such a row can only be stale.
+func releaseTopicName(tx *txConn, chatID int64, name string, messageThreadId int64) error {
+	_, err := tx.Exec(`
+		DELETE FROM topics WHERE chat_id = ? AND name = ? AND message_thread_id IS DISTINCT FROM ?
+	`, chatID, name, messageThreadId)
+	return err
+}
+
+func (d *Database) withTx(fn func(tx *txConn) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Close closes the database connection
 func (d *Database) Close() error {
 	return d.db.Close()
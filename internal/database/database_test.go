@@ -1,8 +1,11 @@
 package database
 
 import (
+	"database/sql"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewDatabase(t *testing.T) {
@@ -83,7 +86,7 @@ func TestDatabase_UpsertUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := db.UpsertUser(tt.userID, tt.username, tt.firstName, tt.lastName)
+			err := db.UpsertUser(User{ID: tt.userID, Username: tt.username, FirstName: tt.firstName, LastName: tt.lastName}, 0, time.Now())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UpsertUser() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -100,7 +103,7 @@ func TestDatabase_GetUser(t *testing.T) {
 
 	// Insert test user
 	testUserID := int64(123456)
-	err = db.UpsertUser(testUserID, "testuser", "Test", "User")
+	err = db.UpsertUser(User{ID: testUserID, Username: "testuser", FirstName: "Test", LastName: "User"}, 0, time.Now())
 	if err != nil {
 		t.Fatalf("Failed to insert test user: %v", err)
 	}
@@ -173,7 +176,7 @@ func TestDatabase_AddTopic(t *testing.T) {
 			wantErr:         false,
 		},
 		{
-			name:            "duplicate topic (should not error due to INSERT OR IGNORE)",
+			name:            "duplicate topic updates thread ID (recreated topic)",
 			chatID:          123456,
 			topicName:       "Test Topic",
 			messageThreadID: 3,
@@ -190,6 +193,16 @@ func TestDatabase_AddTopic(t *testing.T) {
 			}
 		})
 	}
+
+	topics, err := db.GetTopicsByChat(123456)
+	if err != nil {
+		t.Fatalf("GetTopicsByChat() error = %v", err)
+	}
+	for _, topic := range topics {
+		if topic.Name == "Test Topic" && topic.MessageThreadId != 3 {
+			t.Errorf("AddTopic() duplicate kept thread ID %d, want 3", topic.MessageThreadId)
+		}
+	}
 }
 
 func TestDatabase_GetTopicsByChat(t *testing.T) {
@@ -311,6 +324,234 @@ func TestDatabase_TopicExists(t *testing.T) {
 	}
 }
 
+func TestDatabase_TopicRegistry(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	chatID := int64(123456)
+	if err := db.AddTopic(chatID, "Work", 7, 0); err != nil {
+		t.Fatalf("Failed to insert stale topic: %v", err)
+	}
+
+	// A new topic took the name "Work"; the row for thread 7 is stale
+	err = db.SaveForumTopic(Topic{ChatID: chatID, Name: "Work", MessageThreadId: 10, IconColor: 7322096})
+	if err != nil {
+		t.Fatalf("SaveForumTopic() error = %v", err)
+	}
+	topic, err := db.GetTopicByThread(chatID, 10)
+	if err != nil {
+		t.Fatalf("GetTopicByThread() error = %v", err)
+	}
+	if topic.Name != "Work" || topic.IconColor != 7322096 {
+		t.Errorf("GetTopicByThread() = %+v, want Work with icon color", topic)
+	}
+	if _, err := db.GetTopicByThread(chatID, 7); err != sql.ErrNoRows {
+		t.Errorf("GetTopicByThread() stale thread error = %v, want sql.ErrNoRows", err)
+	}
+
+	tests := []struct {
+		name       string
+		apply      func() error
+		threadID   int64
+		wantName   string
+		wantIcon   string
+		wantClosed bool
+	}{
+		{
+			name:     "rename",
+			apply:    func() error { return db.RenameTopic(chatID, 10, "Projects") },
+			threadID: 10,
+			wantName: "Projects",
+		},
+		{
+			name:     "icon change",
+			apply:    func() error { return db.SetTopicIcon(chatID, 10, "5312536423851630001") },
+			threadID: 10,
+			wantName: "Projects",
+			wantIcon: "5312536423851630001",
+		},
+		{
+			name:       "close",
+			apply:      func() error { return db.SetTopicClosed(chatID, 10, true) },
+			threadID:   10,
+			wantName:   "Projects",
+			wantIcon:   "5312536423851630001",
+			wantClosed: true,
+		},
+		{
+			name:     "reopen",
+			apply:    func() error { return db.SetTopicClosed(chatID, 10, false) },
+			threadID: 10,
+			wantName: "Projects",
+			wantIcon: "5312536423851630001",
+		},
+		{
+			name:     "rename of unknown thread registers it",
+			apply:    func() error { return db.RenameTopic(chatID, 42, "Made by hand") },
+			threadID: 42,
+			wantName: "Made by hand",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.apply(); err != nil {
+				t.Fatalf("apply error = %v", err)
+			}
+			topic, err := db.GetTopicByThread(chatID, tt.threadID)
+			if err != nil {
+				t.Fatalf("GetTopicByThread() error = %v", err)
+			}
+			if topic.Name != tt.wantName || topic.IconCustomEmojiID != tt.wantIcon || topic.IsClosed != tt.wantClosed {
+				t.Errorf("GetTopicByThread() = %+v, want name %q icon %q closed %v", topic, tt.wantName, tt.wantIcon, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestNewDatabase_AddsRegistryColumnsToOldSchema(t *testing.T) {
+	path, cleanup := createTempDB(t)
+	defer cleanup()
+
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = old.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY,
+			username TEXT,
+			first_name TEXT,
+			last_name TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE topics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			message_thread_id INTEGER,
+			created_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(chat_id, name)
+		);
+		INSERT INTO topics (chat_id, name, message_thread_id, created_by) VALUES (1, 'Old', 5, 0);
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase() error = %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SetTopicClosed(1, 5, true); err != nil {
+		t.Fatalf("SetTopicClosed() error = %v", err)
+	}
+	topics, err := db.GetTopicsByChat(1)
+	if err != nil {
+		t.Fatalf("GetTopicsByChat() error = %v", err)
+	}
+	if len(topics) != 1 || topics[0].Name != "Old" || !topics[0].IsClosed {
+		t.Errorf("GetTopicsByChat() = %+v, want closed topic Old", topics)
+	}
+}
+
+func TestDatabase_UpdateOffset(t *testing.T) {
+	path, cleanup := createTempDB(t)
+	defer cleanup()
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	offset, err := db.GetUpdateOffset()
+	if err != nil || offset != 0 {
+		t.Errorf("GetUpdateOffset() on fresh database = %d, %v, want 0, nil", offset, err)
+	}
+	for _, offset := range []int64{100, 101, 987654321012} {
+		if err := db.SaveUpdateOffset(offset); err != nil {
+			t.Fatalf("SaveUpdateOffset(%d) error = %v", offset, err)
+		}
+	}
+	db.Close()
+
+	// The offset survives a restart
+	db, err = NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen test database: %v", err)
+	}
+	defer db.Close()
+	offset, err = db.GetUpdateOffset()
+	if err != nil || offset != 987654321012 {
+		t.Errorf("GetUpdateOffset() after restart = %d, %v, want 987654321012, nil", offset, err)
+	}
+}
+
+func TestDatabase_ScheduledDeletions(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	ids := map[string]int64{}
+	for name, executeAt := range map[string]time.Time{
+		"due":    now.Add(-time.Second),
+		"retry":  now.Add(-2 * time.Second),
+		"fail":   now.Add(-3 * time.Second),
+		"future": now.Add(time.Minute),
+	} {
+		id, err := db.ScheduleDeletion(123, int64(len(ids)+1), executeAt)
+		if err != nil {
+			t.Fatalf("ScheduleDeletion() error = %v", err)
+		}
+		ids[name] = id
+	}
+
+	due, err := db.DueDeletions(now, 10)
+	if err != nil {
+		t.Fatalf("DueDeletions() error = %v", err)
+	}
+	if len(due) != 3 || due[0].ID != ids["fail"] || due[2].ID != ids["due"] {
+		t.Fatalf("DueDeletions() = %+v, want fail, retry, due in execute_at order", due)
+	}
+
+	if err := db.CompleteDeletion(ids["due"]); err != nil {
+		t.Fatalf("CompleteDeletion() error = %v", err)
+	}
+	if err := db.RetryDeletion(ids["retry"], now.Add(time.Hour), "timeout"); err != nil {
+		t.Fatalf("RetryDeletion() error = %v", err)
+	}
+	if err := db.FailDeletion(ids["fail"], "message can't be deleted"); err != nil {
+		t.Fatalf("FailDeletion() error = %v", err)
+	}
+
+	if due, _ := db.DueDeletions(now, 10); len(due) != 0 {
+		t.Errorf("DueDeletions() after processing = %+v, want none", due)
+	}
+	later, _ := db.DueDeletions(now.Add(2*time.Hour), 10)
+	if len(later) != 2 || later[0].ID != ids["future"] || later[1].ID != ids["retry"] || later[1].Attempts != 1 || later[1].LastError != "timeout" {
+		t.Errorf("DueDeletions() later = %+v, want future then retried job with 1 attempt", later)
+	}
+
+	for name, want := range map[string]string{"due": DeletionDone, "fail": DeletionFailed, "retry": DeletionPending} {
+		var status string
+		if err := db.db.QueryRow(`SELECT status FROM scheduled_deletions WHERE id = ?`, ids[name]).Scan(&status); err != nil {
+			t.Fatalf("query status error = %v", err)
+		}
+		if status != want {
+			t.Errorf("status of %s = %q, want %q", name, status, want)
+		}
+	}
+}
+
 func TestDatabase_Close(t *testing.T) {
 	db, err := NewDatabase(":memory:")
 	if err != nil {
@@ -337,3 +578,219 @@ func createTempDB(t *testing.T) (string, func()) {
 
 	return tmpfile.Name(), cleanup
 }
+
+func TestSavedMessages(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	sentAt := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	first := SavedMessage{ChatID: 1, UserID: 7, OriginalMessageID: 100, ThreadID: 5, SavedMessageID: 200,
+		TopicName: "Recipes", ContentType: "photo", Snippet: "Cake", FileID: "file-1", SentAt: sentAt, SavedAt: sentAt.Add(time.Minute)}
+	second := first
+	second.OriginalMessageID, second.SavedMessageID, second.SavedAt = 101, 201, sentAt.Add(2*time.Minute)
+	other := first
+	other.ChatID = 2
+
+	for _, m := range []SavedMessage{first, second, other} {
+		if _, err := db.RecordSavedMessage(m); err != nil {
+			t.Fatalf("RecordSavedMessage() error = %v", err)
+		}
+	}
+
+	saved, err := db.SavedMessagesByChat(1, 10)
+	if err != nil {
+		t.Fatalf("SavedMessagesByChat() error = %v", err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("SavedMessagesByChat() returned %d saves, want 2", len(saved))
+	}
+	if saved[0].OriginalMessageID != 101 || saved[1].OriginalMessageID != 100 {
+		t.Errorf("SavedMessagesByChat() order = %d, %d; want newest first", saved[0].OriginalMessageID, saved[1].OriginalMessageID)
+	}
+	got := saved[1]
+	got.ID = 0
+	if !got.SentAt.Equal(first.SentAt) || !got.SavedAt.Equal(first.SavedAt) {
+		t.Errorf("timestamps = %v, %v; want %v, %v", got.SentAt, got.SavedAt, first.SentAt, first.SavedAt)
+	}
+	got.SentAt, got.SavedAt = first.SentAt, first.SavedAt
+	if got != first {
+		t.Errorf("SavedMessagesByChat() = %+v, want %+v", got, first)
+	}
+
+	saved, err = db.SavedMessagesByChat(1, 1)
+	if err != nil {
+		t.Fatalf("SavedMessagesByChat() error = %v", err)
+	}
+	if len(saved) != 1 {
+		t.Errorf("SavedMessagesByChat() with limit 1 returned %d saves", len(saved))
+	}
+}
+
+func TestSearchSavedMessages(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	saves := []SavedMessage{
+		{ChatID: 1, OriginalMessageID: 1, TopicName: "Recipes", ContentType: "text", Text: "Chocolate cake with cherries", SavedAt: day},
+		{ChatID: 1, OriginalMessageID: 2, TopicName: "Recipes", ContentType: "photo", Text: "Cake photo", SavedAt: day.AddDate(0, 0, 1)},
+		{ChatID: 1, OriginalMessageID: 3, TopicName: "Travel", ContentType: "text", Text: "Cake shop in Vienna", SavedAt: day.AddDate(0, 0, 2)},
+		{ChatID: 1, OriginalMessageID: 4, TopicName: "Travel", ContentType: "text", Text: "Train times", SavedAt: day.AddDate(0, 0, 3)},
+		{ChatID: 2, OriginalMessageID: 5, TopicName: "Recipes", ContentType: "text", Text: "Cake from another chat", SavedAt: day},
+	}
+	for _, m := range saves {
+		if _, err := db.RecordSavedMessage(m); err != nil {
+			t.Fatalf("RecordSavedMessage() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    SavedMessageQuery
+		want []int64 // original message IDs, in any order
+	}{
+		{name: "word", q: SavedMessageQuery{Words: []string{"cake"}}, want: []int64{1, 2, 3}},
+		{name: "all words must match", q: SavedMessageQuery{Words: []string{"cake", "vienna"}}, want: []int64{3}},
+		{name: "topic ignores case", q: SavedMessageQuery{Words: []string{"cake"}, TopicName: "recipes"}, want: []int64{1, 2}},
+		{name: "type", q: SavedMessageQuery{ContentType: "photo"}, want: []int64{2}},
+		{name: "after", q: SavedMessageQuery{After: day.AddDate(0, 0, 2)}, want: []int64{3, 4}},
+		{name: "before", q: SavedMessageQuery{Words: []string{"cake"}, Before: day.AddDate(0, 0, 1)}, want: []int64{1}},
+		{name: "no match", q: SavedMessageQuery{Words: []string{"pizza"}}, want: nil},
+		{name: "wildcards are literal", q: SavedMessageQuery{Words: []string{"%"}}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.q.ChatID, tt.q.Limit = 1, 10
+			saved, total, err := db.SearchSavedMessages(tt.q)
+			if err != nil {
+				t.Fatalf("SearchSavedMessages() error = %v", err)
+			}
+			got := map[int64]bool{}
+			for _, m := range saved {
+				got[m.OriginalMessageID] = true
+			}
+			want := map[int64]bool{}
+			for _, id := range tt.want {
+				want[id] = true
+			}
+			if total != len(tt.want) || len(saved) != len(tt.want) || !reflect.DeepEqual(got, want) {
+				t.Errorf("SearchSavedMessages() = %v (total %d), want %v", got, total, tt.want)
+			}
+		})
+	}
+
+	// Without words to rank by, the newest saves come first, one page at a time
+	page, total, err := db.SearchSavedMessages(SavedMessageQuery{ChatID: 1, Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("SearchSavedMessages() error = %v", err)
+	}
+	if total != 4 || len(page) != 2 || page[0].OriginalMessageID != 2 || page[1].OriginalMessageID != 1 {
+		t.Errorf("second page = %+v (total %d), want saves 2 and 1 of 4", page, total)
+	}
+}
+
+func TestTopicChangesKeepSavedMessagesInSync(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for _, topic := range []Topic{{ChatID: 1, Name: "Recipes", MessageThreadId: 5}, {ChatID: 1, Name: "Food", MessageThreadId: 6}} {
+		if err := db.SaveForumTopic(topic); err != nil {
+			t.Fatalf("SaveForumTopic() error = %v", err)
+		}
+	}
+	savedAt := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	for i, thread := range []int64{5, 5, 6} {
+		topicName := map[int64]string{5: "Recipes", 6: "Food"}[thread]
+		m := SavedMessage{ChatID: 1, OriginalMessageID: int64(100 + i), ThreadID: thread, SavedMessageID: int64(200 + i),
+			TopicName: topicName, ContentType: "text", SavedAt: savedAt.Add(time.Duration(i) * time.Minute)}
+		if _, err := db.RecordSavedMessage(m); err != nil {
+			t.Fatalf("RecordSavedMessage() error = %v", err)
+		}
+	}
+
+	if err := db.RenameTopic(1, 5, "Cooking"); err != nil {
+		t.Fatalf("RenameTopic() error = %v", err)
+	}
+	inThread, err := db.SavedMessagesByThread(1, 5)
+	if err != nil {
+		t.Fatalf("SavedMessagesByThread() error = %v", err)
+	}
+	if len(inThread) != 2 || inThread[0].OriginalMessageID != 100 || inThread[1].OriginalMessageID != 101 {
+		t.Fatalf("SavedMessagesByThread() = %+v, want saves 100 and 101, oldest first", inThread)
+	}
+	for _, m := range inThread {
+		if m.TopicName != "Cooking" {
+			t.Errorf("save %d has topic %q after the rename, want Cooking", m.OriginalMessageID, m.TopicName)
+		}
+	}
+
+	// Merging moves the first save to Food; deleting Cooking then takes only the second
+	if err := db.MoveSavedMessage(inThread[0].ID, 6, "Food", 300); err != nil {
+		t.Fatalf("MoveSavedMessage() error = %v", err)
+	}
+	if err := db.DeleteTopic(1, 5); err != nil {
+		t.Fatalf("DeleteTopic() error = %v", err)
+	}
+	if _, err := db.GetTopicByThread(1, 5); err != sql.ErrNoRows {
+		t.Errorf("GetTopicByThread() after DeleteTopic error = %v, want sql.ErrNoRows", err)
+	}
+	remaining, err := db.SavedMessagesByChat(1, 10)
+	if err != nil {
+		t.Fatalf("SavedMessagesByChat() error = %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("SavedMessagesByChat() = %+v, want the two saves in Food", remaining)
+	}
+	for _, m := range remaining {
+		if m.ThreadID != 6 || m.TopicName != "Food" {
+			t.Errorf("save %d is in %q (%d), want Food (6)", m.OriginalMessageID, m.TopicName, m.ThreadID)
+		}
+	}
+	if remaining[1].SavedMessageID != 300 {
+		t.Errorf("moved save points at copy %d, want 300", remaining[1].SavedMessageID)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	db, err := NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetSettings(7, 1); err != sql.ErrNoRows {
+		t.Fatalf("GetSettings() before any save error = %v, want sql.ErrNoRows", err)
+	}
+
+	want := Settings{UserID: 7, ChatID: 1, AutoDelete: true, AutoDeleteDelay: 10 * time.Second, ConfirmationStyle: "timed",
+		ConfirmationDelay: time.Minute, AIEnabled: true, SuggestionCount: 3, Language: "en"}
+	if err := db.SaveSettings(want); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+	want.AutoDelete = false
+	want.Language = "de"
+	if err := db.SaveSettings(want); err != nil {
+		t.Fatalf("SaveSettings() over earlier settings error = %v", err)
+	}
+
+	got, err := db.GetSettings(7, 1)
+	if err != nil {
+		t.Fatalf("GetSettings() error = %v", err)
+	}
+	if *got != want {
+		t.Errorf("GetSettings() = %+v, want %+v", *got, want)
+	}
+	if _, err := db.GetSettings(7, 2); err != sql.ErrNoRows {
+		t.Errorf("GetSettings() in another chat error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Drivers a DSN can select
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// dialect is what differs between the SQL backends. Queries are written once, with ?
+// placeholders and SQL both backends accept; the dialect covers the rest.
+type dialect struct {
+	driver     string
+	migrations string // directory of the backend's migrations in migrationFiles
+	numbered   bool   // placeholders are $1, $2, ... rather than ?
+
+	// legacyMarkers recognise a schema created before migrations were versioned
+	legacyMarkers map[int]func(tx *txConn) (bool, error)
+	// migrationLock is run first in the migration transaction so bots starting
+	// together against one server migrate one after another
+	migrationLock string
+	// prepare runs once the schema is up to date
+	prepare func(d *Database) error
+	// matchWords is how search looks for words
+	matchWords func(words []string) wordMatch
+}
+
+var sqliteDialect = dialect{
+	driver:        DriverSQLite,
+	migrations:    "migrations",
+	legacyMarkers: legacyMarkers,
+	prepare:       (*Database).prepareSearchIndex,
+	matchWords:    matchWords,
+}
+
+var postgresDialect = dialect{
+	driver:        DriverPostgres,
+	migrations:    "migrations/postgres",
+	numbered:      true,
+	migrationLock: `SELECT pg_advisory_xact_lock(7215004)`,
+	prepare:       func(d *Database) error { return nil },
+	matchWords:    matchWordsPostgres,
+}
+
+// DriverFor tells which backend a DSN selects: postgres:// and postgresql:// URLs go
+// to Postgres, file paths and file: URIs to SQLite
+func DriverFor(dsn string) (string, error) {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return DriverSQLite, nil
+	}
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return DriverPostgres, nil
+	case "file":
+		return DriverSQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported database URL scheme %q", scheme)
+	}
+}
+
+// dialectFor returns the dialect of driver
+func dialectFor(driver string) dialect {
+	if driver == DriverPostgres {
+		return postgresDialect
+	}
+	return sqliteDialect
+}
+
+// bind rewrites the ? placeholders of query into the dialect's own
+func (dl dialect) bind(query string) string {
+	if !dl.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// conn is the connection pool, running queries in the backend's dialect
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.bind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.bind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.dialect.bind(query), args...)
+}
+
+func (c *conn) Begin() (*txConn, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txConn{Tx: tx, dialect: c.dialect}, nil
+}
+
+// txConn is a transaction, running queries in the backend's dialect
+type txConn struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *txConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.bind(query), args...)
+}
+
+func (tx *txConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.bind(query), args...)
+}
+
+func (tx *txConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.bind(query), args...)
+}
+
+// matchWordsPostgres finds saves containing every word anywhere in their text, ignoring
+// case, newest first
+func matchWordsPostgres(words []string) wordMatch {
+	conditions := make([]string, len(words))
+	args := make([]interface{}, len(words))
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	for i, word := range words {
+		conditions[i] = `m.text ILIKE ? ESCAPE '\'`
+		args[i] = "%" + escaper.Replace(word) + "%"
+	}
+	return wordMatch{where: strings.Join(conditions, " AND "), args: args}
+}
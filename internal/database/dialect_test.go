@@ -0,0 +1,54 @@
+package database
+
+import "testing"
+
+func TestDriverFor(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		want    string
+		wantErr bool
+	}{
+		{dsn: "bot.db", want: DriverSQLite},
+		{dsn: ":memory:", want: DriverSQLite},
+		{dsn: "file:///var/lib/bot/bot.db", want: DriverSQLite},
+		{dsn: "postgres://bot:secret@db:5432/bots?sslmode=disable", want: DriverPostgres},
+		{dsn: "postgresql://db/bots", want: DriverPostgres},
+		{dsn: "mysql://db/bots", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DriverFor(tt.dsn)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("DriverFor(%q) = %q, %v, want %q (error %v)", tt.dsn, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDialectBind(t *testing.T) {
+	query := `SELECT 1 FROM t WHERE a = ? AND b LIKE ? ESCAPE '\' AND c = '?' AND d = ?`
+	if got := sqliteDialect.bind(query); got != query {
+		t.Errorf("sqlite bind() = %q, want the query unchanged", got)
+	}
+	want := `SELECT 1 FROM t WHERE a = $1 AND b LIKE $2 ESCAPE '\' AND c = '?' AND d = $3`
+	if got := postgresDialect.bind(query); got != want {
+		t.Errorf("postgres bind() = %q, want %q", got, want)
+	}
+}
+
+func TestPostgresMigrationsMirrorSQLite(t *testing.T) {
+	sqlite, err := migrationsIn(sqliteDialect.migrations)
+	if err != nil {
+		t.Fatalf("sqlite migrations: %v", err)
+	}
+	postgres, err := migrationsIn(postgresDialect.migrations)
+	if err != nil {
+		t.Fatalf("postgres migrations: %v", err)
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("%d postgres migrations for %d sqlite ones", len(postgres), len(sqlite))
+	}
+	for i := range sqlite {
+		if postgres[i].Name != sqlite[i].Name {
+			t.Errorf("migration %04d is %q on postgres but %q on sqlite", sqlite[i].Version, postgres[i].Name, sqlite[i].Name)
+		}
+	}
+}
@@ -1,11 +1,44 @@
 package database
 
+import "time"
+
 // DatabaseInterface defines the interface for database operations
 type DatabaseInterface interface {
-	UpsertUser(userID int64, username, firstName, lastName string) error
+	UpsertUser(u User, chatID int64, seenAt time.Time) error
 	GetUser(userID int64) (*User, error)
 	AddTopic(chatID int64, name string, messageThreadId int64, createdBy int64) error
 	GetTopicsByChat(chatID int64) ([]Topic, error)
 	TopicExists(chatID int64, name string) (bool, error)
+	GetTopicByThread(chatID int64, messageThreadId int64) (*Topic, error)
+	SaveForumTopic(topic Topic) error
+	RenameTopic(chatID int64, messageThreadId int64, name string) error
+	SetTopicIcon(chatID int64, messageThreadId int64, iconCustomEmojiID string) error
+	SetTopicClosed(chatID int64, messageThreadId int64, closed bool) error
+	DeleteTopic(chatID int64, messageThreadId int64) error
+	GetUpdateOffset() (int64, error)
+	SaveUpdateOffset(offset int64) error
+	ScheduleDeletion(chatID int64, messageID int64, executeAt time.Time) (int64, error)
+	DueDeletions(now time.Time, limit int) ([]ScheduledDeletion, error)
+	CompleteDeletion(id int64) error
+	RetryDeletion(id int64, nextAttempt time.Time, lastError string) error
+	FailDeletion(id int64, lastError string) error
+	PutState(namespace, key, value string, expiresAt time.Time) error
+	GetState(namespace, key string, now time.Time) (string, bool, error)
+	TakeState(namespace, key string, now time.Time) (string, bool, error)
+	DeleteStateIf(namespace, key, value string) (bool, error)
+	DeleteState(namespace, key string) error
+	StateKeys(namespace string, now time.Time) ([]string, error)
+	PurgeExpiredState(now time.Time) (int64, error)
+	RecordSavedMessage(m SavedMessage) (int64, error)
+	SavedMessagesByChat(chatID int64, limit int) ([]SavedMessage, error)
+	SearchSavedMessages(q SavedMessageQuery) ([]SavedMessage, int, error)
+	SavedMessagesByThread(chatID int64, threadID int64) ([]SavedMessage, error)
+	MoveSavedMessage(id int64, threadID int64, topicName string, savedMessageID int64) error
+	GetSettings(userID int64, chatID int64) (*Settings, error)
+	SaveSettings(s Settings) error
+	GetChatSettings(chatID int64) (*ChatSettings, error)
+	SaveChatSettings(s ChatSettings) error
+	TopicCentroids(chatID int64, model string) ([]TopicCentroid, error)
+	SaveTopicCentroid(c TopicCentroid) error
 	Close() error
 }
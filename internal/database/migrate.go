@@ -0,0 +1,233 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/NNNN_name.sql and are applied in version order. A
+// migration, once released, is never edited: schema changes go into a new file.
+//
+// Postgres has its own files in migrations/postgres, one for each SQLite migration
+// with the same version, so a version means the same schema on either backend.
+//
+//go:embed migrations/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one step of the schema's history
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState tells whether a migration has been applied to a database
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// legacyMarkers recognise the schema of databases created before migrations were
+// versioned: each reports whether the objects its migration creates already exist.
+var legacyMarkers = map[int]func(tx *txConn) (bool, error){
+	1: func(tx *txConn) (bool, error) { return tablesExist(tx, "users", "topics") },
+	2: func(tx *txConn) (bool, error) { return columnExists(tx, "topics", "is_closed") },
+	3: func(tx *txConn) (bool, error) { return tablesExist(tx, "bot_state") },
+	4: func(tx *txConn) (bool, error) { return tablesExist(tx, "scheduled_deletions") },
+	5: func(tx *txConn) (bool, error) { return tablesExist(tx, "interaction_state") },
+}
+
+// Migrations returns the SQLite migrations built into the binary, oldest first
+func Migrations() ([]Migration, error) {
+	return migrationsIn(sqliteDialect.migrations)
+}
+
+// migrationsIn returns the migrations in dir, oldest first
+func migrationsIn(dir string) ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.sql", name)
+		}
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: label, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies every pending migration in one transaction and returns how many ran.
+// If any of them fails, the schema is left as it was.
+func (d *Database) Migrate() (int, error) {
+	migrations, err := migrationsIn(d.db.dialect.migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	err = d.withTx(func(tx *txConn) error {
+		if tx.dialect.migrationLock != "" {
+			if _, err := tx.Exec(tx.dialect.migrationLock); err != nil {
+				return err
+			}
+		}
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			if applied, err = adoptLegacySchema(tx, migrations); err != nil {
+				return err
+			}
+		}
+		for version := range applied {
+			if version > len(migrations) {
+				return fmt.Errorf("database schema is at version %d but this binary knows only %d", version, len(migrations))
+			}
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if _, err := tx.Exec(m.SQL); err != nil {
+				return fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+			}
+			if err := recordMigration(tx, m); err != nil {
+				return err
+			}
+			ran++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ran, nil
+}
+
+// MigrationStatus lists the built-in migrations and whether each has been applied
+func (d *Database) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := migrationsIn(d.db.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied map[int]time.Time
+	err = d.withTx(func(tx *txConn) error {
+		applied, err = appliedMigrations(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+	return states, nil
+}
+
+// appliedMigrations returns when each recorded migration was applied, creating the
+// schema_version table on first use
+func appliedMigrations(tx *txConn) (map[int]time.Time, error) {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// adoptLegacySchema records the migrations whose objects a database created before
+// versioning already has, so only the missing steps run. Only SQLite predates versioning.
+func adoptLegacySchema(tx *txConn, migrations []Migration) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	for _, m := range migrations {
+		marker, ok := tx.dialect.legacyMarkers[m.Version]
+		if !ok {
+			break
+		}
+		present, err := marker(tx)
+		if err != nil {
+			return nil, err
+		}
+		if !present {
+			break
+		}
+		if err := recordMigration(tx, m); err != nil {
+			return nil, err
+		}
+		applied[m.Version] = time.Now()
+	}
+	return applied, nil
+}
+
+func recordMigration(tx *txConn, m Migration) error {
+	_, err := tx.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.Version, m.Name)
+	return err
+}
+
+func tablesExist(tx *txConn, tables ...string) (bool, error) {
+	for _, table := range tables {
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+		if err != nil || count == 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func columnExists(tx *txConn, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
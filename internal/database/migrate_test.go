@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// baselineSchema is the schema of the first release, before any table was added
+const baselineSchema = `
+	CREATE TABLE users (
+		id INTEGER PRIMARY KEY,
+		username TEXT,
+		first_name TEXT,
+		last_name TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE topics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		message_thread_id INTEGER,
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(chat_id, name)
+	);
+	INSERT INTO users (id, username) VALUES (7, 'alice');
+	INSERT INTO topics (chat_id, name, message_thread_id, created_by) VALUES (1, 'Old', 5, 7);
+`
+
+// unversionedSchema is what startup created before migrations were versioned
+const unversionedSchema = baselineSchema + `
+	CREATE TABLE bot_state (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE scheduled_deletions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		execute_at INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_scheduled_deletions_due ON scheduled_deletions (status, execute_at);
+	CREATE TABLE interaction_state (
+		namespace TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (namespace, key)
+	);
+	CREATE INDEX idx_interaction_state_expires ON interaction_state (expires_at);
+	ALTER TABLE topics ADD COLUMN icon_color INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE topics ADD COLUMN icon_custom_emoji_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE topics ADD COLUMN is_closed INTEGER NOT NULL DEFAULT 0;
+	INSERT INTO bot_state (key, value) VALUES ('update_offset', '42');
+`
+
+// openWithSchema creates a database file holding schema and opens it with NewDatabase
+func openWithSchema(t *testing.T, schema string) *Database {
+	t.Helper()
+	path, cleanup := createTempDB(t)
+	t.Cleanup(cleanup)
+
+	if schema != "" {
+		old, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		_, err = old.Exec(schema)
+		old.Close()
+		if err != nil {
+			t.Fatalf("Failed to create old schema: %v", err)
+		}
+	}
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// describeSchema lists every table's columns and indexes in a comparable form
+func describeSchema(t *testing.T, db *Database) []string {
+	t.Helper()
+	var schema []string
+	query := func(q string, args ...interface{}) [][]string {
+		rows, err := db.db.Query(q, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		defer rows.Close()
+		columns, _ := rows.Columns()
+		var result [][]string
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatalf("%s: %v", q, err)
+			}
+			row := make([]string, len(values))
+			for i, v := range values {
+				row[i] = v.String
+			}
+			result = append(result, row)
+		}
+		return result
+	}
+
+	for _, table := range query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`) {
+		name := table[0]
+		for _, column := range query(`SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, name) {
+			schema = append(schema, fmt.Sprintf("%s column %s", name, strings.Join(column, " ")))
+		}
+		for _, index := range query(`SELECT name, "unique", origin FROM pragma_index_list(?) ORDER BY name`, name) {
+			var columns []string
+			for _, column := range query(`SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index[0]) {
+				columns = append(columns, column[0])
+			}
+			// Automatic indexes are named by creation order, so only their shape counts
+			label := index[0]
+			if strings.HasPrefix(label, "sqlite_autoindex_") {
+				label = "auto"
+			}
+			schema = append(schema, fmt.Sprintf("%s index %s unique=%s origin=%s (%s)", name, label, index[1], index[2], strings.Join(columns, ", ")))
+		}
+	}
+	return schema
+}
+
+func TestMigrate_UpgradedDatabasesMatchFreshOne(t *testing.T) {
+	fresh := describeSchema(t, openWithSchema(t, ""))
+
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: "first release", schema: baselineSchema},
+		{name: "before versioned migrations", schema: unversionedSchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openWithSchema(t, tt.schema)
+			if got := describeSchema(t, db); !reflect.DeepEqual(got, fresh) {
+				t.Errorf("upgraded schema differs from a fresh one:\n got: %q\nwant: %q", got, fresh)
+			}
+
+			states, err := db.MigrationStatus()
+			if err != nil {
+				t.Fatalf("MigrationStatus() error = %v", err)
+			}
+			for _, state := range states {
+				if !state.Applied {
+					t.Errorf("migration %04d_%s not recorded as applied", state.Version, state.Name)
+				}
+			}
+
+			topics, err := db.GetTopicsByChat(1)
+			if err != nil {
+				t.Fatalf("GetTopicsByChat() error = %v", err)
+			}
+			if len(topics) != 1 || topics[0].Name != "Old" || topics[0].CreatedBy != 7 {
+				t.Errorf("GetTopicsByChat() = %+v, want the old topic kept", topics)
+			}
+		})
+	}
+}
+
+func TestMigrate_IsIdempotent(t *testing.T) {
+	db := openWithSchema(t, "")
+
+	ran, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("Migrate() ran %d migrations on an up-to-date database, want 0", ran)
+	}
+}
+
+func TestMigrate_FromEmptyDatabase(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	states, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus() error = %v", err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if len(states) != len(migrations) || len(migrations) == 0 {
+		t.Fatalf("MigrationStatus() = %d entries, want %d", len(states), len(migrations))
+	}
+	for _, state := range states {
+		if state.Applied {
+			t.Errorf("migration %04d_%s reported applied on an empty database", state.Version, state.Name)
+		}
+	}
+
+	ran, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if ran != len(migrations) {
+		t.Errorf("Migrate() ran %d migrations, want %d", ran, len(migrations))
+	}
+}
+
+func TestMigrate_RollsBackFailedMigration(t *testing.T) {
+	// Rewound to version 3, migration 4 runs again and then 5 fails on its existing table
+	db := openWithSchema(t, "")
+	if _, err := db.db.Exec(`DELETE FROM schema_version WHERE version >= 4; DROP TABLE scheduled_deletions`); err != nil {
+		t.Fatalf("Failed to rewind schema: %v", err)
+	}
+
+	if _, err := db.Migrate(); err == nil {
+		t.Fatal("Migrate() error = nil, want interaction_state to already exist")
+	}
+	exists, err := tablesExistInDB(db, "scheduled_deletions")
+	if err != nil {
+		t.Fatalf("tablesExist() error = %v", err)
+	}
+	if exists {
+		t.Error("a failed migration left part of its changes behind")
+	}
+}
+
+func TestMigrate_RejectsNewerSchema(t *testing.T) {
+	db := openWithSchema(t, "")
+	if _, err := db.db.Exec(`INSERT INTO schema_version (version, name) VALUES (9999, 'future')`); err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	if _, err := db.Migrate(); err == nil {
+		t.Error("Migrate() error = nil, want an error for a schema newer than the binary")
+	}
+}
+
+func tablesExistInDB(db *Database, tables ...string) (bool, error) {
+	var exists bool
+	err := db.withTx(func(tx *txConn) error {
+		var err error
+		exists, err = tablesExist(tx, tables...)
+		return err
+	})
+	return exists, err
+}
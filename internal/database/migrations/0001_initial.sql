@@ -0,0 +1,18 @@
+-- Users and the forum topics the bot knows about
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	username TEXT,
+	first_name TEXT,
+	last_name TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE topics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	message_thread_id INTEGER,
+	created_by INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(chat_id, name)
+);
@@ -0,0 +1,13 @@
+-- Delayed message deletions; execute_at is unix milliseconds so due jobs compare numerically
+CREATE TABLE scheduled_deletions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	execute_at INTEGER NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_scheduled_deletions_due ON scheduled_deletions (status, execute_at);
@@ -0,0 +1,18 @@
+-- Every message the bot saved into a topic and where its copy ended up
+CREATE TABLE saved_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	original_message_id INTEGER NOT NULL,
+	thread_id INTEGER NOT NULL,
+	saved_message_id INTEGER NOT NULL,
+	topic_name TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	snippet TEXT NOT NULL DEFAULT '',
+	file_id TEXT NOT NULL DEFAULT '',
+	sent_at DATETIME NOT NULL,
+	saved_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_saved_messages_chat ON saved_messages (chat_id, saved_at);
+CREATE INDEX idx_saved_messages_thread ON saved_messages (chat_id, thread_id);
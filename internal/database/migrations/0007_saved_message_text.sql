@@ -0,0 +1,4 @@
+-- The full text or caption of each save, which search looks through
+ALTER TABLE saved_messages ADD COLUMN text TEXT NOT NULL DEFAULT '';
+
+UPDATE saved_messages SET text = snippet;
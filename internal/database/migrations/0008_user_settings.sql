@@ -0,0 +1,14 @@
+-- Per-user, per-chat preferences changed through /settings; missing rows mean the defaults
+CREATE TABLE user_settings (
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	auto_delete INTEGER NOT NULL,
+	auto_delete_delay_ms INTEGER NOT NULL,
+	confirmation_style TEXT NOT NULL,
+	confirmation_delay_ms INTEGER NOT NULL,
+	ai_enabled INTEGER NOT NULL,
+	suggestion_count INTEGER NOT NULL,
+	language TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, chat_id)
+);
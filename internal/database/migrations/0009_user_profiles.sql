@@ -0,0 +1,16 @@
+-- What the bot knows about everyone who sends it updates, and the chats they use it in.
+-- users.created_at is when a user was first seen.
+ALTER TABLE users ADD COLUMN language_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME;
+
+UPDATE users SET last_seen_at = created_at;
+
+CREATE TABLE user_chats (
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	first_seen_at DATETIME NOT NULL,
+	last_seen_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, chat_id)
+);
+
+CREATE INDEX idx_user_chats_chat ON user_chats (chat_id);
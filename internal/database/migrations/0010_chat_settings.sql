@@ -0,0 +1,6 @@
+-- Preferences that apply to everyone in a chat, changed by its admins; missing rows mean the defaults
+CREATE TABLE chat_settings (
+	chat_id INTEGER PRIMARY KEY,
+	privacy_mode INTEGER NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,29 @@
+-- Per-bot state is keyed by the bot's user ID, so several bots can share one database.
+-- Rows from before carry bot_id 0 until a bot claims them (Database.ClaimUnscopedState).
+CREATE TABLE bot_state_scoped (
+	bot_id INTEGER NOT NULL DEFAULT 0,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (bot_id, key)
+);
+INSERT INTO bot_state_scoped (key, value, updated_at) SELECT key, value, updated_at FROM bot_state;
+DROP TABLE bot_state;
+ALTER TABLE bot_state_scoped RENAME TO bot_state;
+
+CREATE TABLE interaction_state_scoped (
+	bot_id INTEGER NOT NULL DEFAULT 0,
+	namespace TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (bot_id, namespace, key)
+);
+INSERT INTO interaction_state_scoped (namespace, key, value, expires_at) SELECT namespace, key, value, expires_at FROM interaction_state;
+DROP TABLE interaction_state;
+ALTER TABLE interaction_state_scoped RENAME TO interaction_state;
+CREATE INDEX idx_interaction_state_expires ON interaction_state (expires_at);
+
+ALTER TABLE scheduled_deletions ADD COLUMN bot_id INTEGER NOT NULL DEFAULT 0;
+DROP INDEX idx_scheduled_deletions_due;
+CREATE INDEX idx_scheduled_deletions_due ON scheduled_deletions (bot_id, status, execute_at);
@@ -0,0 +1,18 @@
+-- Users and the forum topics the bot knows about
+CREATE TABLE users (
+	id BIGINT PRIMARY KEY,
+	username TEXT,
+	first_name TEXT,
+	last_name TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE topics (
+	id SERIAL PRIMARY KEY,
+	chat_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	message_thread_id BIGINT,
+	created_by BIGINT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(chat_id, name)
+);
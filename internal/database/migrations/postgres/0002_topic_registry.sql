@@ -0,0 +1,4 @@
+-- Topic details kept current from forum service messages
+ALTER TABLE topics ADD COLUMN icon_color BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE topics ADD COLUMN icon_custom_emoji_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE topics ADD COLUMN is_closed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+-- Small key/value facts that must survive restarts, such as the update offset
+CREATE TABLE bot_state (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+-- Short-lived handler state such as button context; expires_at is unix milliseconds
+CREATE TABLE interaction_state (
+	namespace TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	PRIMARY KEY (namespace, key)
+);
+
+CREATE INDEX idx_interaction_state_expires ON interaction_state (expires_at);
@@ -0,0 +1,18 @@
+-- Every message the bot saved into a topic and where its copy ended up
+CREATE TABLE saved_messages (
+	id BIGSERIAL PRIMARY KEY,
+	chat_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	original_message_id BIGINT NOT NULL,
+	thread_id BIGINT NOT NULL,
+	saved_message_id BIGINT NOT NULL,
+	topic_name TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	snippet TEXT NOT NULL DEFAULT '',
+	file_id TEXT NOT NULL DEFAULT '',
+	sent_at TIMESTAMPTZ NOT NULL,
+	saved_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_saved_messages_chat ON saved_messages (chat_id, saved_at);
+CREATE INDEX idx_saved_messages_thread ON saved_messages (chat_id, thread_id);
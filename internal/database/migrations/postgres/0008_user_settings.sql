@@ -0,0 +1,14 @@
+-- Per-user, per-chat preferences changed through /settings; missing rows mean the defaults
+CREATE TABLE user_settings (
+	user_id BIGINT NOT NULL,
+	chat_id BIGINT NOT NULL,
+	auto_delete BOOLEAN NOT NULL,
+	auto_delete_delay_ms BIGINT NOT NULL,
+	confirmation_style TEXT NOT NULL,
+	confirmation_delay_ms BIGINT NOT NULL,
+	ai_enabled BOOLEAN NOT NULL,
+	suggestion_count INTEGER NOT NULL,
+	language TEXT NOT NULL,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, chat_id)
+);
@@ -0,0 +1,6 @@
+-- Preferences that apply to everyone in a chat, changed by its admins; missing rows mean the defaults
+CREATE TABLE chat_settings (
+	chat_id BIGINT PRIMARY KEY,
+	privacy_mode BOOLEAN NOT NULL,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
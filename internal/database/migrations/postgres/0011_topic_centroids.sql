@@ -0,0 +1,12 @@
+-- Mean embedding of each topic's saved messages, to rank topics by how close a new message is.
+-- vector holds little-endian float32s; saves is how many messages were averaged, 0 while the
+-- topic is known only by the embedding of its name.
+CREATE TABLE topic_centroids (
+	chat_id BIGINT NOT NULL,
+	topic_name TEXT NOT NULL,
+	model TEXT NOT NULL,
+	vector BYTEA NOT NULL,
+	saves INTEGER NOT NULL,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (chat_id, topic_name)
+);
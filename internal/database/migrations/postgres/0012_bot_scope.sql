@@ -0,0 +1,11 @@
+-- Per-bot state is keyed by the bot's user ID, so several bots can share one database.
+-- Rows from before carry bot_id 0 until a bot claims them (Database.ClaimUnscopedState).
+ALTER TABLE bot_state ADD COLUMN bot_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE bot_state DROP CONSTRAINT bot_state_pkey, ADD PRIMARY KEY (bot_id, key);
+
+ALTER TABLE interaction_state ADD COLUMN bot_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE interaction_state DROP CONSTRAINT interaction_state_pkey, ADD PRIMARY KEY (bot_id, namespace, key);
+
+ALTER TABLE scheduled_deletions ADD COLUMN bot_id BIGINT NOT NULL DEFAULT 0;
+DROP INDEX idx_scheduled_deletions_due;
+CREATE INDEX idx_scheduled_deletions_due ON scheduled_deletions (bot_id, status, execute_at);
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// SavedMessageQuery selects saved messages of one chat. Zero fields do not filter.
+type SavedMessageQuery struct {
+	ChatID      int64
+	Words       []string // must all appear in the text or caption
+	TopicName   string   // case-insensitive
+	ContentType string
+	Before      time.Time // saved before
+	After       time.Time // saved at or after
+	Offset      int
+	Limit       int
+}
+
+// SearchSavedMessages returns one page of the saves matching q and how many match in all.
+// With words to look for, the best matches come first; otherwise the newest.
+func (d *Database) SearchSavedMessages(q SavedMessageQuery) ([]SavedMessage, int, error) {
+	from := "saved_messages m"
+	where := []string{"m.chat_id = ?"}
+	args := []interface{}{q.ChatID}
+	order := "m.saved_at DESC, m.id DESC"
+
+	if q.TopicName != "" {
+		where = append(where, "LOWER(m.topic_name) = LOWER(CAST(? AS TEXT))")
+		args = append(args, q.TopicName)
+	}
+	if q.ContentType != "" {
+		where = append(where, "m.content_type = ?")
+		args = append(args, q.ContentType)
+	}
+	if !q.Before.IsZero() {
+		where = append(where, "m.saved_at < ?")
+		args = append(args, q.Before.UTC())
+	}
+	if !q.After.IsZero() {
+		where = append(where, "m.saved_at >= ?")
+		args = append(args, q.After.UTC())
+	}
+	if len(q.Words) > 0 {
+		match := d.db.dialect.matchWords(q.Words)
+		if match.join != "" {
+			from += " " + match.join
+		}
+		where = append(where, match.where)
+		args = append(args, match.args...)
+		if match.order != "" {
+			order = match.order + ", " + order
+		}
+	}
+
+	filter := " FROM " + from + " WHERE " + strings.Join(where, " AND ")
+	var total int
+	if err := d.db.QueryRow("SELECT COUNT(*)"+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := d.db.Query("SELECT "+qualify(savedMessageColumns, "m")+filter+" ORDER BY "+order+" LIMIT ? OFFSET ?",
+		append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var saved []SavedMessage
+	for rows.Next() {
+		m, err := scanSavedMessage(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		saved = append(saved, *m)
+	}
+	return saved, total, rows.Err()
+}
+
+// wordMatch is the part of a search that looks for words; how depends on the backend
+// and, for SQLite, on whether the binary was built with FTS5
+type wordMatch struct {
+	join  string
+	where string
+	args  []interface{}
+	order string
+}
+
+// qualify prefixes every column in a comma-separated list with alias
+func qualify(columns, alias string) string {
+	parts := strings.Split(columns, ",")
+	for i, column := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(column)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,61 @@
+//go:build sqlite_fts5
+
+package database
+
+import "strings"
+
+// SearchUsesFTS5 reports whether search runs on the FTS5 index
+const SearchUsesFTS5 = true
+
+// The FTS5 index is not a migration: SQLite can only open it when built with the
+// sqlite_fts5 tag, so it is kept in step with saved_messages by triggers set up here.
+// A binary built without the tag drops the triggers, and the next FTS5 build rebuilds
+// the index from saved_messages.
+const searchIndexSQL = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS saved_messages_fts USING fts5(
+		text, content='saved_messages', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER IF NOT EXISTS saved_messages_fts_insert AFTER INSERT ON saved_messages BEGIN
+		INSERT INTO saved_messages_fts (rowid, text) VALUES (new.id, new.text);
+	END;
+	CREATE TRIGGER IF NOT EXISTS saved_messages_fts_delete AFTER DELETE ON saved_messages BEGIN
+		INSERT INTO saved_messages_fts (saved_messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+	END;
+	CREATE TRIGGER IF NOT EXISTS saved_messages_fts_update AFTER UPDATE OF text ON saved_messages BEGIN
+		INSERT INTO saved_messages_fts (saved_messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		INSERT INTO saved_messages_fts (rowid, text) VALUES (new.id, new.text);
+	END;
+`
+
+// prepareSearchIndex creates the FTS5 index, filling it if it was missing or out of step
+func (d *Database) prepareSearchIndex() error {
+	return d.withTx(func(tx *txConn) error {
+		var triggers int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'saved_messages_fts_%'`).Scan(&triggers)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(searchIndexSQL); err != nil {
+			return err
+		}
+		if triggers == 3 {
+			return nil
+		}
+		_, err = tx.Exec(`INSERT INTO saved_messages_fts (saved_messages_fts) VALUES ('rebuild')`)
+		return err
+	})
+}
+
+// matchWords finds saves containing every word, or a word starting with it, best matches first
+func matchWords(words []string) wordMatch {
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return wordMatch{
+		join:  "JOIN saved_messages_fts f ON f.rowid = m.id",
+		where: "saved_messages_fts MATCH ?",
+		args:  []interface{}{strings.Join(terms, " ")},
+		order: "f.rank",
+	}
+}
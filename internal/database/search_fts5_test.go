@@ -0,0 +1,62 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearchSavedMessages_FTS5(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	save := func(db *Database, id int64, text string) {
+		t.Helper()
+		m := SavedMessage{ChatID: 1, OriginalMessageID: id, TopicName: "Notes", ContentType: "text", Text: text, SavedAt: time.Now()}
+		if _, err := db.RecordSavedMessage(m); err != nil {
+			t.Fatalf("RecordSavedMessage() error = %v", err)
+		}
+	}
+	search := func(db *Database, words ...string) int {
+		t.Helper()
+		_, total, err := db.SearchSavedMessages(SavedMessageQuery{ChatID: 1, Words: words, Limit: 10})
+		if err != nil {
+			t.Fatalf("SearchSavedMessages(%q) error = %v", words, err)
+		}
+		return total
+	}
+
+	save(db, 1, "Crème brûlée recipe")
+	if got := search(db, "rec"); got != 1 {
+		t.Errorf("prefix search found %d, want 1", got)
+	}
+	if got := search(db, "creme"); got != 1 {
+		t.Errorf("search without diacritics found %d, want 1", got)
+	}
+	if got := search(db, `"recipe`); got != 1 {
+		t.Errorf("search with a stray quote found %d, want 1", got)
+	}
+
+	// A build without FTS5 drops the triggers and saves without indexing
+	if _, err := db.db.Exec(`DROP TRIGGER saved_messages_fts_insert`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+	save(db, 2, "Train timetable")
+	db.Close()
+
+	db, err = NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if got := search(db, "timetable"); got != 1 {
+		t.Errorf("search after reopening found %d, want the unindexed save", got)
+	}
+	if got := search(db, "recipe"); got != 1 {
+		t.Errorf("rebuilt index found %d, want 1", got)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !sqlite_fts5
+
+package database
+
+import "strings"
+
+// SearchUsesFTS5 reports whether search runs on the FTS5 index
+const SearchUsesFTS5 = false
+
+// prepareSearchIndex removes the triggers an FTS5 build leaves behind: without FTS5
+// SQLite cannot write to the index they feed, so every save would fail.
+func (d *Database) prepareSearchIndex() error {
+	_, err := d.db.Exec(`
+		DROP TRIGGER IF EXISTS saved_messages_fts_insert;
+		DROP TRIGGER IF EXISTS saved_messages_fts_delete;
+		DROP TRIGGER IF EXISTS saved_messages_fts_update;
+	`)
+	return err
+}
+
+// matchWords finds saves containing every word anywhere in their text, newest first
+func matchWords(words []string) wordMatch {
+	conditions := make([]string, len(words))
+	args := make([]interface{}, len(words))
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	for i, word := range words {
+		conditions[i] = `m.text LIKE ? ESCAPE '\'`
+		args[i] = "%" + escaper.Replace(word) + "%"
+	}
+	return wordMatch{where: strings.Join(conditions, " AND "), args: args}
+}
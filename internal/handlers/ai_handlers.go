@@ -2,56 +2,77 @@ package handlers
 
 import (
 	"context"
-	"strconv"
-	"strings"
+	"errors"
 
+	"save-message/internal/callbacks"
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
 	"save-message/internal/logutils"
+	"save-message/internal/state"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 // AIHandlers handles AI-related operations and suggestions
 type AIHandlers struct {
-	messageService       interfaces.MessageServiceInterface
-	topicService         interfaces.TopicServiceInterface
-	aiService            interfaces.AIServiceInterface
-	messageStore         map[string]*gotgbot.Message
-	keyboardMessageStore map[string]int
-	keyboardBuilder      *KeyboardBuilder
-
-	// Add reference to TopicHandlers for cross-storage
+	messageService interfaces.MessageServiceInterface
+	topicService   interfaces.TopicServiceInterface
+	aiService      interfaces.AIServiceInterface
+
+	// State and Callbacks are shared with TopicHandlers, which resolves the buttons
+	State     interfaces.StateStoreInterface
+	Callbacks interfaces.CallbackRegistryInterface
+
 	TopicHandlers *TopicHandlers
 
+	// Settings decides per user whether AI runs and how many suggestions it makes, in which
+	// language; without it the defaults apply
+	Settings interfaces.SettingsServiceInterface
+
 	// Mockable funcs for testing
-	HandleGeneralTopicMessageFunc       func(update *gotgbot.Update) error
-	HandleRetryCallbackFunc             func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleBackToSuggestionsCallbackFunc func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleGeneralTopicMessageFunc       func(ctx context.Context, update *gotgbot.Update) error
+	HandleRetryCallbackFunc             func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleBackToSuggestionsCallbackFunc func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
 }
 
 // NewAIHandlers creates a new AI handlers instance
 func NewAIHandlers(messageService interfaces.MessageServiceInterface, topicService interfaces.TopicServiceInterface, aiService interfaces.AIServiceInterface, topicHandlers *TopicHandlers) *AIHandlers {
-	return &AIHandlers{
-		messageService:       messageService,
-		topicService:         topicService,
-		aiService:            aiService,
-		messageStore:         make(map[string]*gotgbot.Message),
-		keyboardMessageStore: make(map[string]int),
-		keyboardBuilder:      NewKeyboardBuilder(),
-		TopicHandlers:        topicHandlers,
+	ah := &AIHandlers{
+		messageService: messageService,
+		topicService:   topicService,
+		aiService:      aiService,
+		TopicHandlers:  topicHandlers,
 	}
+	if topicHandlers != nil {
+		ah.State = topicHandlers.State
+		ah.Callbacks = topicHandlers.Callbacks
+		// An abandoned topic-name prompt brings the suggestions back
+		topicHandlers.RestoreSuggestions = func(ctx context.Context, originalMsg *gotgbot.Message) error {
+			return ah.HandleBackToSuggestionsCallback(ctx, &gotgbot.Update{}, originalMsg)
+		}
+	} else {
+		ah.State = state.NewMemoryStore()
+		ah.Callbacks = callbacks.NewRegistry(ah.State)
+	}
+	return ah
 }
 
 // HandleGeneralTopicMessage handles messages in General topic with AI suggestions
-func (ah *AIHandlers) HandleGeneralTopicMessage(update *gotgbot.Update) error {
+func (ah *AIHandlers) HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
 	if ah.HandleGeneralTopicMessageFunc != nil {
-		return ah.HandleGeneralTopicMessageFunc(update)
+		return ah.HandleGeneralTopicMessageFunc(ctx, update)
 	}
 	logutils.Info("HandleGeneralTopicMessage", "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
 
+	// Users who turned AI off pick a topic themselves, with nothing to wait for, and so does
+	// everyone while the AI provider is known to be down
+	settings := ah.settingsOf(ctx, update.Message)
+	if !settings.AIEnabled || !ah.aiAvailable() {
+		return ah.showManualPicker(ctx, update.Message)
+	}
+
 	// Send waiting message
-	waitingMsg, err := ah.messageService.SendMessage(update.Message.Chat.Id, config.AIProcessingMessage, &gotgbot.SendMessageOpts{
+	waitingMsg, err := ah.messageService.SendMessage(ctx, update.Message.Chat.Id, config.AIProcessingMessage, &gotgbot.SendMessageOpts{
 		MessageThreadId: update.Message.MessageThreadId,
 	})
 	if err != nil {
@@ -59,91 +80,87 @@ func (ah *AIHandlers) HandleGeneralTopicMessage(update *gotgbot.Update) error {
 		return err
 	}
 
-	// Store the waiting message ID
-	callbackData := "suggestions_" + strconv.FormatInt(update.Message.MessageId, 10)
-	ah.keyboardMessageStore[callbackData] = int(waitingMsg.MessageId)
+	// Remember the message and where its buttons will appear, for the callbacks
+	msg := update.Message
+	ah.state().rememberMessage(ctx, msg)
+	ah.state().rememberKeyboard(ctx, msg, int(waitingMsg.MessageId))
 
-	// Process AI suggestions in a goroutine
-	go func(msg *gotgbot.Message) {
-		// Get existing topics
-		topics, err := ah.topicService.GetForumTopics(msg.Chat.Id)
-		if err != nil {
-			logutils.Error("HandleGeneralTopicMessage: GetForumTopicsError", err, "chatID", msg.Chat.Id)
-			ah.handleAIError(msg, waitingMsg)
-			return
-		}
-
-		// Get AI suggestions
-		ctx := context.Background()
-		suggestions, err := ah.aiService.SuggestFolders(ctx, msg.Text, ah.getTopicNames(topics))
-		if err != nil {
-			logutils.Error("HandleGeneralTopicMessage: SuggestFoldersError", err, "chatID", msg.Chat.Id)
-			ah.handleAIError(msg, waitingMsg)
-			return
-		}
-
-		logutils.Info("HandleGeneralTopicMessage: AI suggestions", "suggestions", suggestions)
+	// Suggestions are computed in line: the executor runs each chat on its own worker,
+	// so a slow AI call holds up only this chat, and its later updates stay in order.
+	// Failures are shown with a retry button, so they do not fail the update.
+	topics, err := ah.topicService.GetForumTopics(ctx, msg.Chat.Id)
+	if err != nil {
+		logutils.Error("HandleGeneralTopicMessage: GetForumTopicsError", err, "chatID", msg.Chat.Id)
+		ah.handleAIError(ctx, msg, waitingMsg)
+		return nil
+	}
 
-		// Build keyboard
-		keyboard, err := ah.keyboardBuilder.BuildSuggestionKeyboard(msg, suggestions, topics)
-		if err != nil {
-			logutils.Error("HandleGeneralTopicMessage: BuildSuggestionKeyboardError", err, "chatID", msg.Chat.Id)
-			ah.handleAIError(msg, waitingMsg)
-			return
-		}
+	// Get AI suggestions
+	suggestions, err := ah.aiService.SuggestFolders(ctx, msg.Text, ah.getTopicNames(topics), suggestionOptions(settings))
+	if errors.Is(err, interfaces.ErrAIUnavailable) {
+		// The provider went down meanwhile: offer the topics without suggestions
+		logutils.Warn("HandleGeneralTopicMessage: AI unavailable, showing the manual picker", "chatID", msg.Chat.Id)
+		suggestions, err = nil, nil
+	}
+	if err != nil {
+		logutils.Error("HandleGeneralTopicMessage: SuggestFoldersError", err, "chatID", msg.Chat.Id)
+		ah.handleAIError(ctx, msg, waitingMsg)
+		return nil
+	}
 
-		// Store message references for all suggestion buttons
-		ah.storeMessageReferences(msg, suggestions, topics)
+	logutils.Info("HandleGeneralTopicMessage: AI suggestions", "suggestions", suggestions)
 
-		// Also store in TopicHandlers.messageStore for callback lookup
-		if ah.TopicHandlers != nil {
-			for _, folder := range suggestions {
-				callbackData := strings.TrimSpace(folder) + "_" + strconv.FormatInt(msg.MessageId, 10)
-				ah.TopicHandlers.MessageStore[callbackData] = msg
-			}
-			// Also store for create new topic button
-			createCallbackData := config.CallbackPrefixCreateNewFolder + strconv.FormatInt(msg.MessageId, 10)
-			ah.TopicHandlers.MessageStore[createCallbackData] = msg
-		}
+	// Build keyboard
+	keyboard, err := ah.keyboards().BuildSuggestionKeyboard(ctx, msg, suggestions, topics)
+	if err != nil {
+		logutils.Error("HandleGeneralTopicMessage: BuildSuggestionKeyboardError", err, "chatID", msg.Chat.Id)
+		ah.handleAIError(ctx, msg, waitingMsg)
+		return nil
+	}
 
-		// Update the waiting message with suggestions
-		logutils.Info("HandleGeneralTopicMessage: Updating waiting message", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId, "text", config.ChooseFolderMessage)
-		_, err = ah.messageService.EditMessageText(msg.Chat.Id, int64(waitingMsg.MessageId), config.ChooseFolderMessage, &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: *keyboard,
+	// Update the waiting message with suggestions
+	logutils.Info("HandleGeneralTopicMessage: Updating waiting message", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId, "text", config.ChooseFolderMessage)
+	_, err = ah.messageService.EditMessageText(ctx, msg.Chat.Id, int64(waitingMsg.MessageId), config.ChooseFolderMessage, &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: *keyboard,
+	})
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("HandleGeneralTopicMessage: EditMessageTextError", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
+		// If update fails, send the keyboard as a new message
+		newMsg, sendErr := ah.messageService.SendMessage(ctx, msg.Chat.Id, config.ChooseFolderMessage, &gotgbot.SendMessageOpts{
+			MessageThreadId: msg.MessageThreadId,
+			ReplyMarkup:     *keyboard,
 		})
-		if err != nil {
-			logutils.Error("HandleGeneralTopicMessage: EditMessageTextError", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
-			// If update fails, try to find the message by searching through all stored keyboard messages
-			ah.tryUpdateExistingMessage(msg, keyboard)
-			// Only delete the waitingMsg if the edit failed (i.e., a new message will be sent)
-			if waitingMsg != nil {
-				logutils.Info("HandleGeneralTopicMessage: Attempting to delete 'Thinking...' message after edit failure", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId, "text", waitingMsg.Text)
-				err := ah.messageService.DeleteMessage(msg.Chat.Id, int(waitingMsg.MessageId))
-				if err != nil {
-					logutils.Error("HandleGeneralTopicMessage: Failed to delete 'Thinking...' message", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
-				} else {
-					logutils.Success("HandleGeneralTopicMessage: Deleted 'Thinking...' message", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
-				}
-			}
+		if sendErr != nil {
+			logutils.Error("HandleGeneralTopicMessage: SendMessageError", sendErr, "chatID", msg.Chat.Id)
 		} else {
-			logutils.Success("HandleGeneralTopicMessage: Successfully updated waiting message with keyboard", "chatID", msg.Chat.Id)
-			// Store keyboard message ID for all suggestion buttons
-			ah.storeKeyboardMessageIDs(msg, suggestions, topics, int(waitingMsg.MessageId))
-			// Do NOT delete the message if edit succeeded
+			ah.state().rememberKeyboard(ctx, msg, int(newMsg.MessageId))
+		}
+		// Only delete the waitingMsg if the edit failed (i.e., a new message was sent)
+		if waitingMsg != nil {
+			logutils.Info("HandleGeneralTopicMessage: Attempting to delete 'Thinking...' message after edit failure", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId, "text", waitingMsg.Text)
+			err := ignoreMessageAlreadyDeleted(ah.messageService.DeleteMessage(ctx, msg.Chat.Id, int(waitingMsg.MessageId)))
+			if err != nil {
+				logutils.Error("HandleGeneralTopicMessage: Failed to delete 'Thinking...' message", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
+			} else {
+				logutils.Success("HandleGeneralTopicMessage: Deleted 'Thinking...' message", "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
+			}
 		}
-	}(update.Message)
+	} else {
+		logutils.Success("HandleGeneralTopicMessage: Successfully updated waiting message with keyboard", "chatID", msg.Chat.Id)
+		// Do NOT delete the message if edit succeeded
+	}
 
 	return nil
 }
 
 // HandleRetryCallback handles retry button clicks
-func (ah *AIHandlers) HandleRetryCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (ah *AIHandlers) HandleRetryCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if ah.HandleRetryCallbackFunc != nil {
-		return ah.HandleRetryCallbackFunc(update, originalMsg)
+		return ah.HandleRetryCallbackFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleRetryCallback", "chatID", originalMsg.Chat.Id)
 
-	_, err := ah.messageService.SendMessage(originalMsg.Chat.Id, config.SuccessMessageRetry, &gotgbot.SendMessageOpts{
+	_, err := ah.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.SuccessMessageRetry, &gotgbot.SendMessageOpts{
 		MessageThreadId: originalMsg.MessageThreadId,
 	})
 	if err != nil {
@@ -156,17 +173,17 @@ func (ah *AIHandlers) HandleRetryCallback(update *gotgbot.Update, originalMsg *g
 }
 
 // HandleBackToSuggestionsCallback handles back to suggestions button
-func (ah *AIHandlers) HandleBackToSuggestionsCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (ah *AIHandlers) HandleBackToSuggestionsCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if ah.HandleBackToSuggestionsCallbackFunc != nil {
-		return ah.HandleBackToSuggestionsCallbackFunc(update, originalMsg)
+		return ah.HandleBackToSuggestionsCallbackFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleBackToSuggestionsCallback", "chatID", originalMsg.Chat.Id)
 
 	// Get existing topics
-	topics, err := ah.topicService.GetForumTopics(originalMsg.Chat.Id)
+	topics, err := ah.topicService.GetForumTopics(ctx, originalMsg.Chat.Id)
 	if err != nil {
 		logutils.Error("HandleBackToSuggestionsCallback: GetForumTopicsError", err, "chatID", originalMsg.Chat.Id)
-		_, sendErr := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
+		_, sendErr := ah.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
 			MessageThreadId: originalMsg.MessageThreadId,
 		})
 		if sendErr != nil {
@@ -175,71 +192,43 @@ func (ah *AIHandlers) HandleBackToSuggestionsCallback(update *gotgbot.Update, or
 		return err
 	}
 
-	// Get AI suggestions again
-	ctx := context.Background()
-	suggestions, err := ah.aiService.SuggestFolders(ctx, originalMsg.Text, ah.getTopicNames(topics))
-	if err != nil {
-		logutils.Error("HandleBackToSuggestionsCallback: SuggestFoldersError", err, "chatID", originalMsg.Chat.Id)
-		ah.handleAIError(originalMsg, nil)
-		return err
+	// Get AI suggestions again, unless the user turned AI off
+	var suggestions []interfaces.Suggestion
+	if settings := ah.settingsOf(ctx, originalMsg); settings.AIEnabled && ah.aiAvailable() {
+		suggestions, err = ah.aiService.SuggestFolders(ctx, originalMsg.Text, ah.getTopicNames(topics), suggestionOptions(settings))
+		if errors.Is(err, interfaces.ErrAIUnavailable) {
+			logutils.Warn("HandleBackToSuggestionsCallback: AI unavailable, showing the manual picker", "chatID", originalMsg.Chat.Id)
+			suggestions, err = nil, nil
+		}
+		if err != nil {
+			logutils.Error("HandleBackToSuggestionsCallback: SuggestFoldersError", err, "chatID", originalMsg.Chat.Id)
+			ah.handleAIError(ctx, originalMsg, nil)
+			return err
+		}
 	}
 
 	// Build keyboard
-	keyboard, err := ah.keyboardBuilder.BuildSuggestionKeyboard(originalMsg, suggestions, topics)
+	keyboard, err := ah.keyboards().BuildSuggestionKeyboard(ctx, originalMsg, suggestions, topics)
 	if err != nil {
 		logutils.Error("HandleBackToSuggestionsCallback: BuildSuggestionKeyboardError", err, "chatID", originalMsg.Chat.Id)
 		return err
 	}
 
-	// Store message references for all suggestion buttons
-	ah.storeMessageReferences(originalMsg, suggestions, topics)
-
-	// Try to update existing message or send new one
-	callbackData := "suggestions_" + strconv.FormatInt(originalMsg.MessageId, 10)
-	if keyboardMsgId, exists := ah.keyboardMessageStore[callbackData]; exists {
-		_, err = ah.messageService.EditMessageText(originalMsg.Chat.Id, int64(keyboardMsgId), config.ChooseFolderMessage, &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: *keyboard,
-		})
-		if err != nil {
-			logutils.Error("HandleBackToSuggestionsCallback: EditMessageTextError", err, "chatID", originalMsg.Chat.Id, "messageID", keyboardMsgId)
-			// If update fails, send new message
-			newMsg, err := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFolderMessage, &gotgbot.SendMessageOpts{
-				MessageThreadId: originalMsg.MessageThreadId,
-				ReplyMarkup:     *keyboard,
-			})
-			if err != nil {
-				logutils.Error("HandleBackToSuggestionsCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-			} else {
-				ah.storeKeyboardMessageIDs(originalMsg, suggestions, topics, int(newMsg.MessageId))
-			}
-		} else {
-			ah.storeKeyboardMessageIDs(originalMsg, suggestions, topics, keyboardMsgId)
-		}
-	} else {
-		// Send new message with suggestions
-		newMsg, err := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFolderMessage, &gotgbot.SendMessageOpts{
-			MessageThreadId: originalMsg.MessageThreadId,
-			ReplyMarkup:     *keyboard,
-		})
-		if err != nil {
-			logutils.Error("HandleBackToSuggestionsCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-		} else {
-			ah.storeKeyboardMessageIDs(originalMsg, suggestions, topics, int(newMsg.MessageId))
-		}
-	}
+	ah.state().rememberMessage(ctx, originalMsg)
+	ah.showKeyboard(ctx, "HandleBackToSuggestionsCallback", originalMsg, config.ChooseFolderMessage, keyboard)
 
 	logutils.Success("HandleBackToSuggestionsCallback", "chatID", originalMsg.Chat.Id)
 	return nil
 }
 
 // HandleShowExistingFolders handles the 'Choose from existing folders' button
-func (ah *AIHandlers) HandleShowExistingFolders(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (ah *AIHandlers) HandleShowExistingFolders(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	logutils.Info("HandleShowExistingFolders", "chatID", originalMsg.Chat.Id)
 
-	topics, err := ah.topicService.GetForumTopics(originalMsg.Chat.Id)
+	topics, err := ah.topicService.GetForumTopics(ctx, originalMsg.Chat.Id)
 	if err != nil {
 		logutils.Error("HandleShowExistingFolders: GetForumTopicsError", err, "chatID", originalMsg.Chat.Id)
-		_, sendErr := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
+		_, sendErr := ah.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
 			MessageThreadId: originalMsg.MessageThreadId,
 		})
 		if sendErr != nil {
@@ -248,86 +237,53 @@ func (ah *AIHandlers) HandleShowExistingFolders(update *gotgbot.Update, original
 		return err
 	}
 
-	keyboard, err := ah.keyboardBuilder.BuildAllTopicsKeyboard(originalMsg, topics)
+	keyboard, err := ah.keyboards().BuildAllTopicsKeyboard(ctx, originalMsg, topics)
 	if err != nil {
 		logutils.Error("HandleShowExistingFolders: BuildAllTopicsKeyboardError", err, "chatID", originalMsg.Chat.Id)
 		return err
 	}
 
-	// Store message references for all topic buttons and back button
-	for _, topic := range topics {
-		callbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-		ah.messageStore[callbackData] = originalMsg
-		if ah.TopicHandlers != nil {
-			ah.TopicHandlers.MessageStore[callbackData] = originalMsg
-		}
-	}
-	backCallbackData := config.CallbackPrefixBackToSuggestions + strconv.FormatInt(originalMsg.MessageId, 10)
-	ah.messageStore[backCallbackData] = originalMsg
-	if ah.TopicHandlers != nil {
-		ah.TopicHandlers.MessageStore[backCallbackData] = originalMsg
-	}
+	ah.state().rememberMessage(ctx, originalMsg)
+	ah.showKeyboard(ctx, "HandleShowExistingFolders", originalMsg, config.ChooseFromAllTopicsMessage, keyboard)
 
-	// Try to update existing message or send new one
-	callbackData := "show_existing_folders_" + strconv.FormatInt(originalMsg.MessageId, 10)
-	if keyboardMsgId, exists := ah.keyboardMessageStore[callbackData]; exists {
-		_, err = ah.messageService.EditMessageText(originalMsg.Chat.Id, int64(keyboardMsgId), config.ChooseFromAllTopicsMessage, &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: *keyboard,
-		})
-		if err != nil {
-			logutils.Error("HandleShowExistingFolders: EditMessageTextError", err, "chatID", originalMsg.Chat.Id, "messageID", keyboardMsgId)
-			// If update fails, send new message
-			newMsg, err := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFromAllTopicsMessage, &gotgbot.SendMessageOpts{
-				MessageThreadId: originalMsg.MessageThreadId,
-				ReplyMarkup:     *keyboard,
-			})
-			if err != nil {
-				logutils.Error("HandleShowExistingFolders: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-			} else {
-				ah.keyboardMessageStore[callbackData] = int(newMsg.MessageId)
-				if ah.TopicHandlers != nil {
-					for _, topic := range topics {
-						cb := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-						ah.TopicHandlers.KeyboardMessageStore[cb] = int(newMsg.MessageId)
-					}
-					ah.TopicHandlers.KeyboardMessageStore[backCallbackData] = int(newMsg.MessageId)
-				}
-			}
-		} else {
-			ah.keyboardMessageStore[callbackData] = keyboardMsgId
-			if ah.TopicHandlers != nil {
-				for _, topic := range topics {
-					cb := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-					ah.TopicHandlers.KeyboardMessageStore[cb] = keyboardMsgId
-				}
-				ah.TopicHandlers.KeyboardMessageStore[backCallbackData] = keyboardMsgId
-			}
-		}
-	} else {
-		// Send new message with topics
-		newMsg, err := ah.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFromAllTopicsMessage, &gotgbot.SendMessageOpts{
-			MessageThreadId: originalMsg.MessageThreadId,
-			ReplyMarkup:     *keyboard,
+	logutils.Success("HandleShowExistingFolders", "chatID", originalMsg.Chat.Id)
+	return nil
+}
+
+// showManualPicker offers the topic buttons without AI suggestions
+func (ah *AIHandlers) showManualPicker(ctx context.Context, msg *gotgbot.Message) error {
+	topics, err := ah.topicService.GetForumTopics(ctx, msg.Chat.Id)
+	if err != nil {
+		logutils.Error("showManualPicker: GetForumTopicsError", err, "chatID", msg.Chat.Id)
+		_, sendErr := ah.messageService.SendMessage(ctx, msg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
+			MessageThreadId: msg.MessageThreadId,
 		})
-		if err != nil {
-			logutils.Error("HandleShowExistingFolders: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-		} else {
-			ah.keyboardMessageStore[callbackData] = int(newMsg.MessageId)
-			if ah.TopicHandlers != nil {
-				for _, topic := range topics {
-					cb := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-					ah.TopicHandlers.KeyboardMessageStore[cb] = int(newMsg.MessageId)
-				}
-				ah.TopicHandlers.KeyboardMessageStore[backCallbackData] = int(newMsg.MessageId)
-			}
+		if sendErr != nil {
+			logutils.Error("showManualPicker: SendMessageError", sendErr, "chatID", msg.Chat.Id)
 		}
+		return err
 	}
 
-	logutils.Success("HandleShowExistingFolders", "chatID", originalMsg.Chat.Id)
+	keyboard, err := ah.keyboards().BuildSuggestionKeyboard(ctx, msg, nil, topics)
+	if err != nil {
+		logutils.Error("showManualPicker: BuildSuggestionKeyboardError", err, "chatID", msg.Chat.Id)
+		return err
+	}
+
+	ah.state().rememberMessage(ctx, msg)
+	ah.showKeyboard(ctx, "showManualPicker", msg, config.ChooseFolderMessage, keyboard)
+	logutils.Success("showManualPicker", "chatID", msg.Chat.Id)
 	return nil
 }
 
 // Helper methods
+
+// aiAvailable reports whether the AI service may answer, true for services that cannot tell
+func (ah *AIHandlers) aiAvailable() bool {
+	availability, ok := ah.aiService.(interfaces.AIAvailabilityInterface)
+	return !ok || availability.Available()
+}
+
 func (ah *AIHandlers) getTopicNames(topics []interfaces.ForumTopic) []string {
 	var names []string
 	for _, topic := range topics {
@@ -336,111 +292,63 @@ func (ah *AIHandlers) getTopicNames(topics []interfaces.ForumTopic) []string {
 	return names
 }
 
-func (ah *AIHandlers) handleAIError(msg *gotgbot.Message, waitingMsg *gotgbot.Message) {
-	retryKeyboard := &gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-			{{Text: config.ButtonTextTryAgain, CallbackData: config.CallbackPrefixRetry + strconv.FormatInt(msg.MessageId, 10)}},
-		},
+func (ah *AIHandlers) handleAIError(ctx context.Context, msg *gotgbot.Message, waitingMsg *gotgbot.Message) {
+	if waitingMsg == nil {
+		return
 	}
-
-	if waitingMsg != nil {
-		_, err := ah.messageService.EditMessageText(msg.Chat.Id, waitingMsg.MessageId, config.AIFailedMessage, &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: *retryKeyboard,
-		})
-		if err != nil {
-			logutils.Error("handleAIError: EditMessageTextError", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
-		}
-	}
-}
-
-func (ah *AIHandlers) storeMessageReferences(msg *gotgbot.Message, suggestions []string, topics []interfaces.ForumTopic) {
-	// Store for existing topics
-	for _, folder := range suggestions {
-		for _, topic := range topics {
-			if strings.EqualFold(topic.Name, folder) {
-				callbackData := topic.Name + "_" + strconv.FormatInt(msg.MessageId, 10)
-				ah.messageStore[callbackData] = msg
-				break
-			}
-		}
-	}
-
-	// Store for new topics
-	for _, folder := range suggestions {
-		cleanFolder := strings.TrimSpace(folder)
-		if len(cleanFolder) > 0 && len(cleanFolder) <= 50 && !strings.Contains(cleanFolder, "\n") {
-			callbackData := cleanFolder + "_" + strconv.FormatInt(msg.MessageId, 10)
-			ah.messageStore[callbackData] = msg
-		}
-	}
-
-	// Store for other buttons
-	createCallbackData := config.CallbackPrefixCreateNewFolder + strconv.FormatInt(msg.MessageId, 10)
-	ah.messageStore[createCallbackData] = msg
-
-	if len(topics) > 0 {
-		showAllCallbackData := config.CallbackPrefixShowAllTopics + strconv.FormatInt(msg.MessageId, 10)
-		ah.messageStore[showAllCallbackData] = msg
+	opts := &gotgbot.EditMessageTextOpts{}
+	if retryKeyboard, err := ah.keyboards().BuildRetryKeyboard(ctx, msg); err != nil {
+		logutils.Error("handleAIError: BuildRetryKeyboardError", err, "chatID", msg.Chat.Id)
+	} else {
+		opts.ReplyMarkup = *retryKeyboard
 	}
-
-	retryCallbackData := config.CallbackPrefixRetry + strconv.FormatInt(msg.MessageId, 10)
-	ah.messageStore[retryCallbackData] = msg
-
-	showExistingFoldersCallbackData := "show_existing_folders_" + strconv.FormatInt(msg.MessageId, 10)
-	ah.messageStore[showExistingFoldersCallbackData] = msg
-
-	// Store in TopicHandlers.MessageStore for callback lookup
-	if ah.TopicHandlers != nil {
-		ah.TopicHandlers.MessageStore[showExistingFoldersCallbackData] = msg
+	_, err := ah.messageService.EditMessageText(ctx, msg.Chat.Id, waitingMsg.MessageId, config.AIFailedMessage, opts)
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("handleAIError: EditMessageTextError", err, "chatID", msg.Chat.Id, "messageID", waitingMsg.MessageId)
 	}
 }
 
-func (ah *AIHandlers) storeKeyboardMessageIDs(msg *gotgbot.Message, suggestions []string, topics []interfaces.ForumTopic, keyboardMsgID int) {
-	// Store for existing topics
-	for _, folder := range suggestions {
-		for _, topic := range topics {
-			if strings.EqualFold(topic.Name, folder) {
-				callbackData := topic.Name + "_" + strconv.FormatInt(msg.MessageId, 10)
-				ah.keyboardMessageStore[callbackData] = keyboardMsgID
-				break
-			}
+// showKeyboard puts keyboard on the message last showing buttons for msg, or sends a new one
+func (ah *AIHandlers) showKeyboard(ctx context.Context, caller string, msg *gotgbot.Message, text string, keyboard *gotgbot.InlineKeyboardMarkup) {
+	if keyboardMsgId, exists := ah.state().keyboard(ctx, msg); exists {
+		_, err := ah.messageService.EditMessageText(ctx, msg.Chat.Id, int64(keyboardMsgId), text, &gotgbot.EditMessageTextOpts{
+			ReplyMarkup: *keyboard,
+		})
+		if err = ignoreMessageNotModified(err); err == nil {
+			return
 		}
+		logutils.Error(caller+": EditMessageTextError", err, "chatID", msg.Chat.Id, "messageID", keyboardMsgId)
 	}
 
-	// Store for new topics
-	for _, folder := range suggestions {
-		cleanFolder := strings.TrimSpace(folder)
-		if len(cleanFolder) > 0 && len(cleanFolder) <= 50 && !strings.Contains(cleanFolder, "\n") {
-			callbackData := cleanFolder + "_" + strconv.FormatInt(msg.MessageId, 10)
-			ah.keyboardMessageStore[callbackData] = keyboardMsgID
-		}
+	// If there is nothing to update or the update fails, send a new message
+	newMsg, err := ah.messageService.SendMessage(ctx, msg.Chat.Id, text, &gotgbot.SendMessageOpts{
+		MessageThreadId: msg.MessageThreadId,
+		ReplyMarkup:     *keyboard,
+	})
+	if err != nil {
+		logutils.Error(caller+": SendMessageError", err, "chatID", msg.Chat.Id)
+		return
 	}
+	ah.state().rememberKeyboard(ctx, msg, int(newMsg.MessageId))
+}
 
-	// Store for other buttons
-	createCallbackData := config.CallbackPrefixCreateNewFolder + strconv.FormatInt(msg.MessageId, 10)
-	ah.keyboardMessageStore[createCallbackData] = keyboardMsgID
-
-	if len(topics) > 0 {
-		showAllCallbackData := config.CallbackPrefixShowAllTopics + strconv.FormatInt(msg.MessageId, 10)
-		ah.keyboardMessageStore[showAllCallbackData] = keyboardMsgID
+// settingsOf returns the settings of msg's sender in its chat
+func (ah *AIHandlers) settingsOf(ctx context.Context, msg *gotgbot.Message) interfaces.UserSettings {
+	var userID int64
+	if msg.From != nil {
+		userID = msg.From.Id
 	}
+	return settingsFor(ctx, ah.Settings, msg.Chat.Id, userID)
+}
 
-	retryCallbackData := config.CallbackPrefixRetry + strconv.FormatInt(msg.MessageId, 10)
-	ah.keyboardMessageStore[retryCallbackData] = keyboardMsgID
+func suggestionOptions(settings interfaces.UserSettings) interfaces.SuggestionOptions {
+	return interfaces.SuggestionOptions{Count: settings.SuggestionCount, Language: settings.Language, ChatID: settings.ChatID}
+}
 
-	showExistingFoldersCallbackData := "show_existing_folders_" + strconv.FormatInt(msg.MessageId, 10)
-	ah.keyboardMessageStore[showExistingFoldersCallbackData] = keyboardMsgID
+func (ah *AIHandlers) state() interactionState {
+	return interactionState{store: ah.State}
 }
 
-func (ah *AIHandlers) tryUpdateExistingMessage(msg *gotgbot.Message, keyboard *gotgbot.InlineKeyboardMarkup) {
-	for storedCallback, storedMsgID := range ah.keyboardMessageStore {
-		if strings.Contains(storedCallback, strconv.FormatInt(msg.MessageId, 10)) {
-			_, updateErr := ah.messageService.EditMessageText(msg.Chat.Id, int64(storedMsgID), config.ChooseFolderMessage, &gotgbot.EditMessageTextOpts{
-				ReplyMarkup: *keyboard,
-			})
-			if updateErr == nil {
-				break
-			}
-		}
-	}
+func (ah *AIHandlers) keyboards() *KeyboardBuilder {
+	return NewKeyboardBuilder(ah.Callbacks)
 }
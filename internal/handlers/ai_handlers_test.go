@@ -4,11 +4,12 @@ import (
 	"context"
 	"os"
 	"testing"
-	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"save-message/internal/config"
 	"save-message/internal/interfaces"
 )
 
@@ -18,7 +19,7 @@ func TestAIHandlers_HandleGeneralTopicMessage_MainFlow(t *testing.T) {
 	}
 	h := NewAIHandlers(nil, nil, nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
-	if err := h.HandleGeneralTopicMessage(update); err != nil {
+	if err := h.HandleGeneralTopicMessage(context.Background(), update); err != nil {
 		t.Errorf("HandleGeneralTopicMessage returned error: %v", err)
 	}
 }
@@ -30,7 +31,7 @@ func TestAIHandlers_HandleRetryCallback_MainFlow(t *testing.T) {
 	h := NewAIHandlers(nil, nil, nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
 	msg := &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}
-	if err := h.HandleRetryCallback(update, msg); err != nil {
+	if err := h.HandleRetryCallback(context.Background(), update, msg); err != nil {
 		t.Errorf("HandleRetryCallback returned error: %v", err)
 	}
 }
@@ -42,7 +43,7 @@ func TestAIHandlers_HandleBackToSuggestionsCallback_MainFlow(t *testing.T) {
 	h := NewAIHandlers(nil, nil, nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
 	msg := &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}
-	if err := h.HandleBackToSuggestionsCallback(update, msg); err != nil {
+	if err := h.HandleBackToSuggestionsCallback(context.Background(), update, msg); err != nil {
 		t.Errorf("HandleBackToSuggestionsCallback returned error: %v", err)
 	}
 }
@@ -55,28 +56,28 @@ type fakeMessageServiceForEdit struct {
 	calledEdit   *bool
 }
 
-func (f *fakeMessageServiceForEdit) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (f *fakeMessageServiceForEdit) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	return &gotgbot.Message{Chat: gotgbot.Chat{Id: chatID}, MessageId: 123, Text: text}, nil
 }
-func (f *fakeMessageServiceForEdit) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (f *fakeMessageServiceForEdit) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
 	if f.calledEdit != nil {
 		*f.calledEdit = true
 	}
 	return &gotgbot.Message{Chat: gotgbot.Chat{Id: chatID}, MessageId: messageID, Text: text}, nil
 }
-func (f *fakeMessageServiceForEdit) DeleteMessage(chatID int64, messageID int) error {
+func (f *fakeMessageServiceForEdit) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	if f.calledDelete != nil {
 		*f.calledDelete = true
 	}
 	return nil
 }
-func (f *fakeMessageServiceForEdit) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+func (f *fakeMessageServiceForEdit) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
 	return nil
 }
-func (f *fakeMessageServiceForEdit) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (f *fakeMessageServiceForEdit) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (f *fakeMessageServiceForEdit) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (f *fakeMessageServiceForEdit) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	return nil
 }
 
@@ -86,7 +87,7 @@ func TestHandleGeneralTopicMessage_DoesNotDeleteOnEditSuccess(t *testing.T) {
 	calledDelete := false
 	calledEdit := false
 	fakeTopicService := &mockTopicService{}
-	fakeAIService := &mockAIService{suggestions: []string{"Food", "Desserts"}}
+	fakeAIService := &mockAIService{suggestions: []interfaces.Suggestion{{Name: "Food"}, {Name: "Desserts"}}}
 	ms := &fakeMessageServiceForEdit{calledDelete: &calledDelete, calledEdit: &calledEdit}
 	ah := NewAIHandlers(ms, fakeTopicService, fakeAIService, nil)
 
@@ -97,10 +98,8 @@ func TestHandleGeneralTopicMessage_DoesNotDeleteOnEditSuccess(t *testing.T) {
 	}
 	update := &gotgbot.Update{Message: msg}
 
-	err := ah.HandleGeneralTopicMessage(update)
+	err := ah.HandleGeneralTopicMessage(context.Background(), update)
 	assert.NoError(t, err)
-	// Wait for goroutine to finish
-	time.Sleep(200 * time.Millisecond)
 	assert.True(t, calledEdit, "EditMessageText should be called")
 	assert.False(t, calledDelete, "DeleteMessage should NOT be called after successful edit")
 }
@@ -111,7 +110,7 @@ type mockTopicService struct {
 	interfaces.TopicServiceInterface
 }
 
-func (m *mockTopicService) GetForumTopics(chatID int64) ([]interfaces.ForumTopic, error) {
+func (m *mockTopicService) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
 	return nil, nil
 }
 
@@ -119,9 +118,52 @@ func (m *mockTopicService) GetForumTopics(chatID int64) ([]interfaces.ForumTopic
 
 type mockAIService struct {
 	interfaces.AIServiceInterface
-	suggestions []string
+	suggestions []interfaces.Suggestion
 }
 
-func (m *mockAIService) SuggestFolders(ctx context.Context, message string, existingFolders []string) ([]string, error) {
+func (m *mockAIService) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
 	return m.suggestions, nil
 }
+
+// downAIService is an AI service whose provider is down
+type downAIService struct {
+	mockAIService
+	available bool
+	calls     int
+}
+
+func (d *downAIService) Available() bool { return d.available }
+
+func (d *downAIService) SuggestFolders(ctx context.Context, message string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	d.calls++
+	return nil, interfaces.ErrAIUnavailable
+}
+
+// While the provider is down users get the topic picker at once, never "Thinking..."
+func TestHandleGeneralTopicMessage_AIUnavailable(t *testing.T) {
+	update := &gotgbot.Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: 12345}, MessageId: 111, Text: "Ice cream"}}
+
+	t.Run("circuit known to be open", func(t *testing.T) {
+		ms := &searchMessageService{}
+		aiService := &downAIService{}
+		ah := NewAIHandlers(ms, &mockTopicService{}, aiService, nil)
+
+		require.NoError(t, ah.HandleGeneralTopicMessage(context.Background(), update))
+		assert.Zero(t, aiService.calls, "the provider is not asked")
+		assert.Equal(t, config.ChooseFolderMessage, ms.text)
+		assert.Zero(t, ms.editedID, "no waiting message to replace")
+		assert.Len(t, ms.keyboard.InlineKeyboard, 2, "create and choose buttons only")
+	})
+
+	t.Run("circuit opened during the call", func(t *testing.T) {
+		ms := &searchMessageService{}
+		aiService := &downAIService{available: true}
+		ah := NewAIHandlers(ms, &mockTopicService{}, aiService, nil)
+
+		require.NoError(t, ah.HandleGeneralTopicMessage(context.Background(), update))
+		assert.Equal(t, 1, aiService.calls)
+		assert.Equal(t, config.ChooseFolderMessage, ms.text, "the waiting message becomes the picker, not a retry prompt")
+		assert.Equal(t, int64(900), ms.editedID)
+		assert.Len(t, ms.keyboard.InlineKeyboard, 2)
+	})
+}
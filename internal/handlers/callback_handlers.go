@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"strings"
+	"context"
 
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
@@ -16,6 +16,18 @@ type CallbackHandlers struct {
 	WarningHandlers interfaces.WarningHandlersInterface
 	AIHandlers      interfaces.AIHandlersInterface
 	MessageService  interfaces.MessageServiceInterface
+
+	// Search pages through /search results; optional
+	Search interfaces.SearchHandlersInterface
+
+	// Topics confirms /deletetopic; optional
+	Topics interfaces.TopicManagementHandlersInterface
+
+	// Settings applies the /settings menu buttons; optional
+	Settings interfaces.SettingsHandlersInterface
+
+	// Callbacks resolves the tokens carried by per-message buttons
+	Callbacks interfaces.CallbackRegistryInterface
 }
 
 // TopicCreationContext stores context for topic creation
@@ -41,13 +53,13 @@ func NewCallbackHandlers(
 }
 
 // HandleCallbackQuery routes callback queries to appropriate handlers
-func (ch *CallbackHandlers) HandleCallbackQuery(update *gotgbot.Update) error {
+func (ch *CallbackHandlers) HandleCallbackQuery(ctx context.Context, update *gotgbot.Update) error {
 	callbackData := update.CallbackQuery.Data
 	chatID := update.CallbackQuery.Message.Chat.Id
 	logutils.Info("HandleCallbackQuery", "chatID", chatID, "callbackData", callbackData)
 
 	// Answer the callback query to remove the loading state
-	err := ch.MessageService.AnswerCallbackQuery(update.CallbackQuery.Id, &gotgbot.AnswerCallbackQueryOpts{
+	err := ch.MessageService.AnswerCallbackQuery(ctx, update.CallbackQuery.Id, &gotgbot.AnswerCallbackQueryOpts{
 		Text: "Processing...",
 	})
 	if err != nil {
@@ -56,10 +68,11 @@ func (ch *CallbackHandlers) HandleCallbackQuery(update *gotgbot.Update) error {
 		logutils.Success("HandleCallbackQuery: Callback query answered", "chatID", chatID, "callbackData", callbackData)
 	}
 
-	// Handle Help button callback
-	if callbackData == "show_help" {
+	// Static menu buttons carry fixed callback data and act on the menu message itself
+	switch callbackData {
+	case config.CallbackDataShowHelp:
 		logutils.Info("HandleCallbackQuery: Help button clicked", "chatID", chatID)
-		_, err := ch.MessageService.SendMessage(chatID, config.HelpMessage, &gotgbot.SendMessageOpts{
+		_, err := ch.MessageService.SendMessage(ctx, chatID, config.HelpMessage, &gotgbot.SendMessageOpts{
 			ParseMode: "Markdown",
 		})
 		if err != nil {
@@ -68,94 +81,170 @@ func (ch *CallbackHandlers) HandleCallbackQuery(update *gotgbot.Update) error {
 			logutils.Success("HandleCallbackQuery: Help message sent", "chatID", chatID)
 		}
 		// Answer the callback with a confirmation
-		err = ch.MessageService.AnswerCallbackQuery(update.CallbackQuery.Id, &gotgbot.AnswerCallbackQueryOpts{
+		err = ch.MessageService.AnswerCallbackQuery(ctx, update.CallbackQuery.Id, &gotgbot.AnswerCallbackQueryOpts{
 			Text: "Help sent!",
 		})
 		return err
+	case config.CallbackDataCreateTopicMenu:
+		logutils.Info("HandleCallbackQuery: Routing to HandleCreateTopicMenuCallback", "chatID", chatID)
+		return ch.logResult(chatID, callbackData, ch.TopicHandlers.HandleCreateTopicMenuCallback(ctx, update, menuMessage(update.CallbackQuery)))
+	case config.CallbackDataShowAllTopicsMenu:
+		logutils.Info("HandleCallbackQuery: Routing to HandleShowAllTopicsMenuCallback", "chatID", chatID)
+		return ch.logResult(chatID, callbackData, ch.TopicHandlers.HandleShowAllTopicsMenuCallback(ctx, update, menuMessage(update.CallbackQuery)))
 	}
 
-	// Special handling for warning callbacks
-	if ch.WarningHandlers.IsWarningCallback(callbackData) {
+	// Every other button carries a token issued when its keyboard was built
+	callback, found := ch.resolve(ctx, callbackData)
+	if !found {
+		logutils.Warn("HandleCallbackQuery: Unknown or expired callback", "chatID", chatID, "callbackData", callbackData)
+		ch.sendNotFound(ctx, update, chatID, callbackData)
+		return nil
+	}
+
+	// Warning confirmations only remove the warning itself
+	if callback.Action == interfaces.CallbackWarningOk {
 		logutils.Info("HandleCallbackQuery: Handling warning callback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.WarningHandlers.HandleWarningOkCallback(update)
-		if err != nil {
-			logutils.Error("HandleCallbackQuery: Error handling warning callback", err, "chatID", chatID, "callbackData", callbackData)
-		} else {
-			logutils.Success("HandleCallbackQuery: Warning callback handled", "chatID", chatID, "callbackData", callbackData)
+		return ch.logResult(chatID, callbackData, ch.WarningHandlers.HandleWarningOkCallback(ctx, update))
+	}
+
+	// Cancelling a topic-name prompt concerns whoever pressed it, not the message
+	if callback.Action == interfaces.CallbackCancelTopicName {
+		logutils.Info("HandleCallbackQuery: Routing to HandleCancelTopicNameCallback", "chatID", chatID)
+		return ch.logResult(chatID, callbackData, ch.TopicHandlers.HandleCancelTopicNameCallback(ctx, update))
+	}
+
+	// Search result pages belong to the results message, not a saved message
+	if callback.Action == interfaces.CallbackSearchPage {
+		if ch.Search == nil {
+			logutils.Warn("HandleCallbackQuery: Search is not configured", "chatID", chatID)
+			return nil
 		}
-		return err
+		logutils.Info("HandleCallbackQuery: Routing to HandleSearchPageCallback", "chatID", chatID, "page", callback.Page)
+		return ch.logResult(chatID, callbackData, ch.Search.HandleSearchPageCallback(ctx, update, callback))
+	}
+
+	// Settings buttons belong to the menu's owner, not a saved message
+	if callback.Action == interfaces.CallbackSettings {
+		if ch.Settings == nil {
+			logutils.Warn("HandleCallbackQuery: Settings are not configured", "chatID", chatID)
+			return nil
+		}
+		logutils.Info("HandleCallbackQuery: Routing to HandleSettingsCallback", "chatID", chatID, "setting", callback.Setting)
+		return ch.logResult(chatID, callbackData, ch.Settings.HandleSettingsCallback(ctx, update, callback))
+	}
+
+	// Delete confirmations belong to the topic they name, not a saved message
+	if callback.Action == interfaces.CallbackDeleteTopic || callback.Action == interfaces.CallbackKeepTopic {
+		if ch.Topics == nil {
+			logutils.Warn("HandleCallbackQuery: Topic management is not configured", "chatID", chatID)
+			return nil
+		}
+		logutils.Info("HandleCallbackQuery: Routing to HandleDeleteTopicCallback", "chatID", chatID, "threadID", callback.ThreadID)
+		return ch.logResult(chatID, callbackData, ch.Topics.HandleDeleteTopicCallback(ctx, update, callback))
 	}
 
 	// Get original message from topic handlers
-	originalMsg := ch.TopicHandlers.GetMessageByCallbackData(callbackData)
+	originalMsg := ch.TopicHandlers.GetOriginalMessage(ctx, callback.ChatID, callback.MessageID)
 	if originalMsg == nil {
-		logutils.Warn("HandleCallbackQuery: Original message not found", "chatID", chatID, "callbackData", callbackData)
-		_, err := ch.MessageService.SendMessage(update.CallbackQuery.From.Id, config.ErrorMessageNotFound, nil)
-		if err != nil {
-			logutils.Error("HandleCallbackQuery: Error sending error message", err, "chatID", chatID, "callbackData", callbackData)
-		} else {
-			logutils.Success("HandleCallbackQuery: Error message sent", "chatID", chatID, "callbackData", callbackData)
+		// The button outlived the message's state; act on the message its callback points at
+		if originalMsg = rebuildCallbackMessage(callback, update.CallbackQuery); originalMsg != nil {
+			logutils.Warn("HandleCallbackQuery: Rebuilt original message from callback", "chatID", chatID, "callbackData", callbackData, "messageID", originalMsg.MessageId)
 		}
+	}
+	if originalMsg == nil {
+		logutils.Warn("HandleCallbackQuery: Original message not found", "chatID", chatID, "callbackData", callbackData)
+		ch.sendNotFound(ctx, update, chatID, callbackData)
 		return nil
 	}
 
-	// Route to appropriate handler based on callback data
-	switch {
-	case strings.HasPrefix(callbackData, config.CallbackPrefixCreateNewFolder):
-		logutils.Info("HandleCallbackQuery: Routing to NewTopicCreationRequest", "chatID", chatID, "callbackData", callbackData)
-		err = ch.TopicHandlers.HandleNewTopicCreationRequest(update, originalMsg)
-	case strings.HasPrefix(callbackData, config.CallbackPrefixRetry):
-		logutils.Info("HandleCallbackQuery: Routing to RetryCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.AIHandlers.HandleRetryCallback(update, originalMsg)
-	case strings.HasPrefix(callbackData, "show_existing_folders_"):
-		logutils.Info("HandleCallbackQuery: Routing to ShowExistingFolders", "chatID", chatID, "callbackData", callbackData)
-		err = ch.AIHandlers.HandleShowExistingFolders(update, originalMsg)
-	case strings.HasPrefix(callbackData, config.CallbackPrefixShowAllTopics):
-		logutils.Info("HandleCallbackQuery: Routing to ShowAllTopicsCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.TopicHandlers.HandleShowAllTopicsCallback(update, originalMsg)
-	case callbackData == config.CallbackDataCreateTopicMenu:
-		logutils.Info("HandleCallbackQuery: Routing to HandleCreateTopicMenuCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.TopicHandlers.HandleCreateTopicMenuCallback(update, originalMsg)
-	case callbackData == config.CallbackDataShowAllTopicsMenu:
-		logutils.Info("HandleCallbackQuery: Routing to HandleShowAllTopicsMenuCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.TopicHandlers.HandleShowAllTopicsMenuCallback(update, originalMsg)
-	case strings.HasPrefix(callbackData, config.CallbackPrefixBackToSuggestions):
-		logutils.Info("HandleCallbackQuery: Routing to HandleBackToSuggestionsCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.AIHandlers.HandleBackToSuggestionsCallback(update, originalMsg)
+	// Route to appropriate handler based on the callback's action
+	switch callback.Action {
+	case interfaces.CallbackSelectTopic:
+		logutils.Info("HandleCallbackQuery: Routing to HandleTopicSelectionCallback", "chatID", chatID, "topicName", callback.TopicName)
+		err = ch.TopicHandlers.HandleTopicSelectionCallback(ctx, update, originalMsg, callback.TopicName)
+	case interfaces.CallbackCreateTopic:
+		logutils.Info("HandleCallbackQuery: Routing to NewTopicCreationRequest", "chatID", chatID)
+		err = ch.TopicHandlers.HandleNewTopicCreationRequest(ctx, update, originalMsg)
+	case interfaces.CallbackShowAllTopics:
+		logutils.Info("HandleCallbackQuery: Routing to ShowExistingFolders", "chatID", chatID)
+		err = ch.AIHandlers.HandleShowExistingFolders(ctx, update, originalMsg)
+	case interfaces.CallbackBackToSuggestions:
+		logutils.Info("HandleCallbackQuery: Routing to HandleBackToSuggestionsCallback", "chatID", chatID)
+		err = ch.AIHandlers.HandleBackToSuggestionsCallback(ctx, update, originalMsg)
+	case interfaces.CallbackRetry:
+		logutils.Info("HandleCallbackQuery: Routing to RetryCallback", "chatID", chatID)
+		err = ch.AIHandlers.HandleRetryCallback(ctx, update, originalMsg)
 	default:
-		logutils.Warn("HandleCallbackQuery: Routing to HandleTopicSelectionCallback", "chatID", chatID, "callbackData", callbackData)
-		err = ch.TopicHandlers.HandleTopicSelectionCallback(update, originalMsg, callbackData)
+		logutils.Warn("HandleCallbackQuery: Unknown callback action", "chatID", chatID, "action", string(callback.Action))
+		return nil
+	}
+	return ch.logResult(chatID, callbackData, err)
+}
+
+func (ch *CallbackHandlers) resolve(ctx context.Context, callbackData string) (interfaces.Callback, bool) {
+	if ch.Callbacks == nil {
+		return interfaces.Callback{}, false
+	}
+	callback, found, err := ch.Callbacks.Resolve(ctx, callbackData)
+	if err != nil {
+		logutils.Error("HandleCallbackQuery: ResolveError", err, "callbackData", callbackData)
+		return interfaces.Callback{}, false
+	}
+	return callback, found
+}
+
+func (ch *CallbackHandlers) sendNotFound(ctx context.Context, update *gotgbot.Update, chatID int64, callbackData string) {
+	_, err := ch.MessageService.SendMessage(ctx, update.CallbackQuery.From.Id, config.ErrorMessageNotFound, nil)
+	if err != nil {
+		logutils.Error("HandleCallbackQuery: Error sending error message", err, "chatID", chatID, "callbackData", callbackData)
+	} else {
+		logutils.Success("HandleCallbackQuery: Error message sent", "chatID", chatID, "callbackData", callbackData)
 	}
+}
+
+func (ch *CallbackHandlers) logResult(chatID int64, callbackData string, err error) error {
 	if err != nil {
 		logutils.Error("HandleCallbackQuery: HandlerError", err, "chatID", chatID, "callbackData", callbackData)
 	} else {
 		logutils.Success("HandleCallbackQuery", "chatID", chatID, "callbackData", callbackData)
 	}
-
 	return err
 }
 
+// menuMessage is the menu a static button was pressed on, attributed to the user who pressed it
+func menuMessage(query *gotgbot.CallbackQuery) *gotgbot.Message {
+	msg := *query.Message
+	from := query.From
+	msg.From = &from
+	return &msg
+}
+
 // IsRecentlyMovedMessage checks if message was recently moved
-func (ch *CallbackHandlers) IsRecentlyMovedMessage(messageID int64) bool {
-	return ch.TopicHandlers.IsRecentlyMovedMessage(messageID)
+func (ch *CallbackHandlers) IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool {
+	return ch.TopicHandlers.IsRecentlyMovedMessage(ctx, messageID)
 }
 
 // MarkMessageAsMoved marks message as moved
-func (ch *CallbackHandlers) MarkMessageAsMoved(messageID int64) {
-	ch.TopicHandlers.MarkMessageAsMoved(messageID)
+func (ch *CallbackHandlers) MarkMessageAsMoved(ctx context.Context, messageID int64) {
+	ch.TopicHandlers.MarkMessageAsMoved(ctx, messageID)
 }
 
 // CleanupMovedMessage cleans up moved message tracking
-func (ch *CallbackHandlers) CleanupMovedMessage(messageID int64) {
-	ch.TopicHandlers.CleanupMovedMessage(messageID)
+func (ch *CallbackHandlers) CleanupMovedMessage(ctx context.Context, messageID int64) {
+	ch.TopicHandlers.CleanupMovedMessage(ctx, messageID)
 }
 
-// IsWaitingForTopicName checks if user is waiting for topic name
-func (ch *CallbackHandlers) IsWaitingForTopicName(userID int64) bool {
-	return ch.TopicHandlers.IsWaitingForTopicName(userID)
+// IsWaitingForTopicName checks if user is waiting for topic name in chatID
+func (ch *CallbackHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	return ch.TopicHandlers.IsWaitingForTopicName(ctx, chatID, userID)
 }
 
 // HandleTopicNameEntry delegates to topic handlers
-func (ch *CallbackHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
-	return ch.TopicHandlers.HandleTopicNameEntry(update)
+func (ch *CallbackHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
+	return ch.TopicHandlers.HandleTopicNameEntry(ctx, update)
+}
+
+// HandleCancelCommand delegates to topic handlers
+func (ch *CallbackHandlers) HandleCancelCommand(ctx context.Context, update *gotgbot.Update) error {
+	return ch.TopicHandlers.HandleCancelCommand(ctx, update)
 }
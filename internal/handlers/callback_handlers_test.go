@@ -1,56 +1,199 @@
 package handlers
 
 import (
+	"context"
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
 	"save-message/internal/mocks/handlers"
 	mocks "save-message/internal/mocks/handlers"
+	"save-message/internal/state"
 	"testing"
 
+	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// routeRecorder records which handler a callback reached and with what
+type routeRecorder struct {
+	handlers.MockTopicHandlers
+	handlers.MockAIHandlers
+	handlers.MockWarningHandlers
+
+	route     string
+	topicName string
+	original  *gotgbot.Message
+	stored    *gotgbot.Message
+}
+
+func (r *routeRecorder) GetOriginalMessage(ctx context.Context, chatID, messageID int64) *gotgbot.Message {
+	return r.stored
+}
+func (r *routeRecorder) HandleTopicSelectionCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message, topicName string) error {
+	r.route, r.topicName, r.original = "select", topicName, msg
+	return nil
+}
+func (r *routeRecorder) HandleNewTopicCreationRequest(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "create", msg
+	return nil
+}
+func (r *routeRecorder) HandleCreateTopicMenuCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "create_menu", msg
+	return nil
+}
+func (r *routeRecorder) HandleShowAllTopicsMenuCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "show_all_menu", msg
+	return nil
+}
+func (r *routeRecorder) HandleShowExistingFolders(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "show_all", msg
+	return nil
+}
+func (r *routeRecorder) HandleBackToSuggestionsCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "back", msg
+	return nil
+}
+func (r *routeRecorder) HandleRetryCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	r.route, r.original = "retry", msg
+	return nil
+}
+func (r *routeRecorder) HandleWarningOkCallback(ctx context.Context, u *gotgbot.Update) error {
+	r.route = "warning"
+	return nil
+}
+func (r *routeRecorder) HandleCancelTopicNameCallback(ctx context.Context, u *gotgbot.Update) error {
+	r.route = "cancel"
+	return nil
+}
+func (r *routeRecorder) HandleTopicCommand(ctx context.Context, u *gotgbot.Update) error {
+	r.route = "topic_command"
+	return nil
+}
+func (r *routeRecorder) HandleDeleteTopicCallback(ctx context.Context, u *gotgbot.Update, callback interfaces.Callback) error {
+	r.route = string(callback.Action)
+	return nil
+}
+func (r *routeRecorder) HandleSearchCommand(ctx context.Context, u *gotgbot.Update) error {
+	r.route = "search"
+	return nil
+}
+func (r *routeRecorder) HandleSearchPageCallback(ctx context.Context, u *gotgbot.Update, callback interfaces.Callback) error {
+	r.route = "search_page"
+	return nil
+}
+func (r *routeRecorder) HandleSettingsCommand(ctx context.Context, u *gotgbot.Update) error {
+	r.route = "settings"
+	return nil
+}
+func (r *routeRecorder) HandleSettingsCallback(ctx context.Context, u *gotgbot.Update, callback interfaces.Callback) error {
+	r.route = "settings_" + callback.Setting
+	return nil
+}
+
 func TestHandleCallbackQuery(t *testing.T) {
+	original := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}, Text: "Cake"}
+	issued := func(action interfaces.CallbackAction, topicName string) interfaces.Callback {
+		return interfaces.Callback{Action: action, ChatID: 456, MessageID: 123, TopicName: topicName}
+	}
+
 	tests := []struct {
-		name            string
-		callbackData    string
-		messageInStore  bool
-		expectedHandler string // "topic", "warning", "ai"
-		wantErr         bool
+		name           string
+		callback       *interfaces.Callback // issued through the registry; nil sends raw data
+		rawData        string
+		messageInStore bool
+		wantRoute      string
+		wantTopic      string
+		wantOriginalID int64
 	}{
-		{"warning callback", "warning_123", true, "warning", false},
-		{"message not in store", "some_other_callback", false, "", false},
-		{"create new folder", "create_new_folder_123", true, "topic", false},
-		{"retry", "retry_123", true, "ai", false},
-		{"show all topics", "show_all_topics_123", true, "topic", false},
-		{"create topic menu", "create_topic_menu", true, "topic", false},
-		{"show all topics menu", "show_all_topics_menu", true, "topic", false},
-		{"back to suggestions", "back_to_suggestions_123", true, "ai", false},
-		{"topic selection", "Work_123", true, "topic", false},
+		{name: "topic selection", callback: ptr(issued(interfaces.CallbackSelectTopic, "Work_Notes")), messageInStore: true, wantRoute: "select", wantTopic: "Work_Notes", wantOriginalID: 123},
+		{name: "create new topic", callback: ptr(issued(interfaces.CallbackCreateTopic, "")), messageInStore: true, wantRoute: "create", wantOriginalID: 123},
+		{name: "show all topics", callback: ptr(issued(interfaces.CallbackShowAllTopics, "")), messageInStore: true, wantRoute: "show_all", wantOriginalID: 123},
+		{name: "back to suggestions", callback: ptr(issued(interfaces.CallbackBackToSuggestions, "")), messageInStore: true, wantRoute: "back", wantOriginalID: 123},
+		{name: "retry", callback: ptr(issued(interfaces.CallbackRetry, "")), messageInStore: true, wantRoute: "retry", wantOriginalID: 123},
+		{name: "warning ok", callback: ptr(issued(interfaces.CallbackWarningOk, "")), wantRoute: "warning"},
+		{name: "cancel topic name", callback: ptr(issued(interfaces.CallbackCancelTopicName, "")), wantRoute: "cancel"},
+		{name: "delete topic", callback: &interfaces.Callback{Action: interfaces.CallbackDeleteTopic, ChatID: 456, ThreadID: 11, TopicName: "Food"}, wantRoute: "delete_topic"},
+		{name: "keep topic", callback: &interfaces.Callback{Action: interfaces.CallbackKeepTopic, ChatID: 456, ThreadID: 11, TopicName: "Food"}, wantRoute: "keep_topic"},
+		{name: "search page", callback: &interfaces.Callback{Action: interfaces.CallbackSearchPage, ChatID: 456, Query: "cake", Page: 1}, wantRoute: "search_page"},
+		{name: "settings", callback: &interfaces.Callback{Action: interfaces.CallbackSettings, ChatID: 456, UserID: 1, Setting: "ai"}, wantRoute: "settings_ai"},
+		{name: "message not in store is rebuilt", callback: ptr(issued(interfaces.CallbackSelectTopic, "Work")), wantRoute: "select", wantTopic: "Work", wantOriginalID: 123},
+		{name: "create topic menu", rawData: config.CallbackDataCreateTopicMenu, wantRoute: "create_menu", wantOriginalID: 900},
+		{name: "show all topics menu", rawData: config.CallbackDataShowAllTopicsMenu, wantRoute: "show_all_menu", wantOriginalID: 900},
+		{name: "legacy topic data is not a selection", rawData: "Work_123"},
+		{name: "legacy prefix is not routed", rawData: "create_new_folder_123"},
+		{name: "unknown token", rawData: "t:unknown"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockMsgSvc := &mocks.MockMessageService{}
-			mockTopic := &handlers.MockTopicHandlers{}
-			mockAI := &handlers.MockAIHandlers{}
-			mockWarning := &handlers.MockWarningHandlers{}
+			ctx := context.Background()
+			registry := callbacks.NewRegistry(state.NewMemoryStore())
+			recorder := &routeRecorder{}
+			if tt.messageInStore {
+				recorder.stored = original
+			}
+			ch := NewCallbackHandlers(&mocks.MockMessageService{}, recorder, recorder, recorder)
+			ch.Callbacks = registry
+			ch.Search = recorder
+			ch.Topics = recorder
+			ch.Settings = recorder
+
+			data := tt.rawData
+			if tt.callback != nil {
+				token, err := registry.Issue(ctx, *tt.callback)
+				require.NoError(t, err)
+				data = token
+			}
+			update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+				Id:      "q",
+				From:    gotgbot.User{Id: 1},
+				Data:    data,
+				Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: 456}},
+			}}
 
-			callbackHandlers := NewCallbackHandlers(mockMsgSvc, mockTopic, mockAI, mockWarning)
-			_ = callbackHandlers // No-op for now
+			require.NoError(t, ch.HandleCallbackQuery(ctx, update))
+			assert.Equal(t, tt.wantRoute, recorder.route)
+			assert.Equal(t, tt.wantTopic, recorder.topicName)
+			if tt.wantOriginalID != 0 {
+				require.NotNil(t, recorder.original)
+				assert.Equal(t, tt.wantOriginalID, recorder.original.MessageId)
+			}
 		})
 	}
 }
 
+func TestHandleCallbackQuery_MenuActsForPresser(t *testing.T) {
+	recorder := &routeRecorder{}
+	ch := NewCallbackHandlers(&mocks.MockMessageService{}, recorder, recorder, recorder)
+	update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+		From:    gotgbot.User{Id: 42},
+		Data:    config.CallbackDataCreateTopicMenu,
+		Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: 456}, From: &gotgbot.User{Id: 7, IsBot: true}},
+	}}
+
+	require.NoError(t, ch.HandleCallbackQuery(context.Background(), update))
+	require.NotNil(t, recorder.original)
+	assert.Equal(t, int64(42), recorder.original.From.Id, "the prompt belongs to whoever pressed the button")
+	assert.Equal(t, int64(7), update.CallbackQuery.Message.From.Id, "the update itself is left untouched")
+}
+
+func ptr(callback interfaces.Callback) *interfaces.Callback {
+	return &callback
+}
+
 func TestCallbackHandlers_StateManagement(t *testing.T) {
 	mockTopicH := &handlers.MockTopicHandlers{}
 	ch := NewCallbackHandlers(nil, mockTopicH, &handlers.MockAIHandlers{}, &handlers.MockWarningHandlers{})
+	chatID := int64(-100)
 	userID := int64(123)
 	msgID := int64(456)
 
 	// Test IsWaitingForTopicName
-	assert.False(t, ch.IsWaitingForTopicName(userID))
+	assert.False(t, ch.IsWaitingForTopicName(context.Background(), chatID, userID))
 
 	// Test IsRecentlyMovedMessage
-	assert.False(t, ch.IsRecentlyMovedMessage(msgID))
-	ch.MarkMessageAsMoved(msgID)
-	ch.CleanupMovedMessage(msgID)
+	assert.False(t, ch.IsRecentlyMovedMessage(context.Background(), msgID))
+	ch.MarkMessageAsMoved(context.Background(), msgID)
+	ch.CleanupMovedMessage(context.Background(), msgID)
 }
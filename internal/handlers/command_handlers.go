@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"strings"
 
 	"save-message/internal/config"
@@ -15,12 +16,21 @@ type CommandHandlers struct {
 	MessageService interfaces.MessageServiceInterface
 	TopicService   interfaces.TopicServiceInterface
 
+	// Search answers /search; without it the command reports that search failed
+	Search interfaces.SearchHandlersInterface
+
+	// Topics answers the topic management commands; without it they report a failure
+	Topics interfaces.TopicManagementHandlersInterface
+
+	// Settings answers /settings; without it the command reports a failure
+	Settings interfaces.SettingsHandlersInterface
+
 	// Mockable funcs for testing
-	HandleStartCommandFunc    func(update *gotgbot.Update) error
-	HandleHelpCommandFunc     func(update *gotgbot.Update) error
-	HandleTopicsCommandFunc   func(update *gotgbot.Update) error
-	HandleAddTopicCommandFunc func(update *gotgbot.Update) error
-	HandleBotMentionFunc      func(update *gotgbot.Update) error
+	HandleStartCommandFunc    func(ctx context.Context, update *gotgbot.Update) error
+	HandleHelpCommandFunc     func(ctx context.Context, update *gotgbot.Update) error
+	HandleTopicsCommandFunc   func(ctx context.Context, update *gotgbot.Update) error
+	HandleAddTopicCommandFunc func(ctx context.Context, update *gotgbot.Update) error
+	HandleBotMentionFunc      func(ctx context.Context, update *gotgbot.Update) error
 }
 
 // NewCommandHandlers creates a new command handlers instance
@@ -32,16 +42,16 @@ func NewCommandHandlers(messageService interfaces.MessageServiceInterface, topic
 }
 
 // HandleStartCommand handles the /start command
-func (ch *CommandHandlers) HandleStartCommand(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleStartCommand(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("HandleStartCommand", "chatID", update.Message.Chat.Id)
 
 	keyboard := &gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-			{{Text: "Help", CallbackData: "show_help"}},
+			{{Text: "Help", CallbackData: config.CallbackDataShowHelp}},
 		},
 	}
 
-	_, err := ch.MessageService.SendMessage(update.Message.Chat.Id, config.WelcomeMessage, &gotgbot.SendMessageOpts{
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.WelcomeMessage, &gotgbot.SendMessageOpts{
 		ReplyMarkup: *keyboard,
 	})
 	if err != nil {
@@ -53,10 +63,10 @@ func (ch *CommandHandlers) HandleStartCommand(update *gotgbot.Update) error {
 }
 
 // HandleHelpCommand handles the /help command
-func (ch *CommandHandlers) HandleHelpCommand(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleHelpCommand(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("HandleHelpCommand", "chatID", update.Message.Chat.Id)
 
-	_, err := ch.MessageService.SendMessage(update.Message.Chat.Id, config.HelpMessage, &gotgbot.SendMessageOpts{
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.HelpMessage, &gotgbot.SendMessageOpts{
 		ParseMode: "Markdown",
 	})
 	if err != nil {
@@ -68,13 +78,13 @@ func (ch *CommandHandlers) HandleHelpCommand(update *gotgbot.Update) error {
 }
 
 // HandleTopicsCommand handles the /topics command
-func (ch *CommandHandlers) HandleTopicsCommand(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleTopicsCommand(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("HandleTopicsCommand", "chatID", update.Message.Chat.Id)
 
-	topics, err := ch.TopicService.GetForumTopics(update.Message.Chat.Id)
+	topics, err := ch.TopicService.GetForumTopics(ctx, update.Message.Chat.Id)
 	if err != nil {
 		logutils.Error("HandleTopicsCommand: GetForumTopicsError", err, "chatID", update.Message.Chat.Id)
-		_, sendErr := ch.MessageService.SendMessage(update.Message.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{})
+		_, sendErr := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{})
 		if sendErr != nil {
 			logutils.Error("HandleTopicsCommand: SendErrorMessageError", sendErr, "chatID", update.Message.Chat.Id)
 		}
@@ -82,7 +92,7 @@ func (ch *CommandHandlers) HandleTopicsCommand(update *gotgbot.Update) error {
 	}
 
 	if len(topics) == 0 {
-		_, err = ch.MessageService.SendMessage(update.Message.Chat.Id, config.ErrorMessageNoTopics, &gotgbot.SendMessageOpts{})
+		_, err = ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.ErrorMessageNoTopics, &gotgbot.SendMessageOpts{})
 		if err != nil {
 			logutils.Error("HandleTopicsCommand: SendErrorMessageNoTopicsError", err, "chatID", update.Message.Chat.Id)
 			return err
@@ -92,7 +102,7 @@ func (ch *CommandHandlers) HandleTopicsCommand(update *gotgbot.Update) error {
 		for _, topic := range topics {
 			topicList += "• " + topic.Name + "\n"
 		}
-		_, err = ch.MessageService.SendMessage(update.Message.Chat.Id, topicList, &gotgbot.SendMessageOpts{
+		_, err = ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, topicList, &gotgbot.SendMessageOpts{
 			ParseMode: "Markdown",
 		})
 		if err != nil {
@@ -106,7 +116,7 @@ func (ch *CommandHandlers) HandleTopicsCommand(update *gotgbot.Update) error {
 }
 
 // HandleAddTopicCommand handles the /addtopic command
-func (ch *CommandHandlers) HandleAddTopicCommand(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleAddTopicCommand(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("HandleAddTopicCommand", "chatID", update.Message.Chat.Id)
 
 	keyboard := &gotgbot.InlineKeyboardMarkup{
@@ -115,7 +125,7 @@ func (ch *CommandHandlers) HandleAddTopicCommand(update *gotgbot.Update) error {
 		},
 	}
 
-	_, err := ch.MessageService.SendMessage(update.Message.Chat.Id, config.ChooseOptionMessage, &gotgbot.SendMessageOpts{
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.ChooseOptionMessage, &gotgbot.SendMessageOpts{
 		ReplyMarkup: *keyboard,
 	})
 	if err != nil {
@@ -127,8 +137,44 @@ func (ch *CommandHandlers) HandleAddTopicCommand(update *gotgbot.Update) error {
 	return nil
 }
 
+// HandleSearchCommand handles the /search command
+func (ch *CommandHandlers) HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error {
+	if ch.Search != nil {
+		return ch.Search.HandleSearchCommand(ctx, update)
+	}
+	logutils.Warn("HandleSearchCommand: Search is not configured", "chatID", update.Message.Chat.Id)
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.SearchFailed, &gotgbot.SendMessageOpts{
+		MessageThreadId: update.Message.MessageThreadId,
+	})
+	return err
+}
+
+// HandleSettingsCommand handles the /settings command
+func (ch *CommandHandlers) HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error {
+	if ch.Settings != nil {
+		return ch.Settings.HandleSettingsCommand(ctx, update)
+	}
+	logutils.Warn("HandleSettingsCommand: Settings are not configured", "chatID", update.Message.Chat.Id)
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.SettingsFailed, &gotgbot.SendMessageOpts{
+		MessageThreadId: update.Message.MessageThreadId,
+	})
+	return err
+}
+
+// HandleTopicManagementCommand handles /renametopic, /closetopic, /reopentopic, /deletetopic and /mergetopic
+func (ch *CommandHandlers) HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error {
+	if ch.Topics != nil {
+		return ch.Topics.HandleTopicCommand(ctx, update)
+	}
+	logutils.Warn("HandleTopicManagementCommand: Topic management is not configured", "chatID", update.Message.Chat.Id)
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.TopicCommandFailed, &gotgbot.SendMessageOpts{
+		MessageThreadId: update.Message.MessageThreadId,
+	})
+	return err
+}
+
 // HandleBotMention handles when the bot is mentioned
-func (ch *CommandHandlers) HandleBotMention(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleBotMention(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("HandleBotMention", "chatID", update.Message.Chat.Id)
 
 	keyboard := &gotgbot.InlineKeyboardMarkup{
@@ -138,7 +184,7 @@ func (ch *CommandHandlers) HandleBotMention(update *gotgbot.Update) error {
 		},
 	}
 
-	_, err := ch.MessageService.SendMessage(update.Message.Chat.Id, config.BotMenuMessage, &gotgbot.SendMessageOpts{
+	_, err := ch.MessageService.SendMessage(ctx, update.Message.Chat.Id, config.BotMenuMessage, &gotgbot.SendMessageOpts{
 		ParseMode:   "Markdown",
 		ReplyMarkup: *keyboard,
 	})
@@ -157,12 +203,12 @@ func (ch *CommandHandlers) IsBotMention(messageText string) bool {
 	return strings.Contains(lowerText, config.BotUsername1) || strings.Contains(lowerText, config.BotUsername2)
 }
 
-func (ch *CommandHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
 	// Not implemented for command handlers
 	return nil
 }
 
-func (ch *CommandHandlers) HandleGeneralTopicMessage(update *gotgbot.Update) error {
+func (ch *CommandHandlers) HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
 	// Not implemented for command handlers
 	return nil
 }
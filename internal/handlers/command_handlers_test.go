@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -13,7 +14,7 @@ func TestCommandHandlers_HandleHelpCommand_MainFlow(t *testing.T) {
 	}
 	h := NewCommandHandlers(nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
-	if err := h.HandleHelpCommand(update); err != nil {
+	if err := h.HandleHelpCommand(context.Background(), update); err != nil {
 		t.Errorf("HandleHelpCommand returned error: %v", err)
 	}
 }
@@ -24,7 +25,7 @@ func TestCommandHandlers_HandleAddTopicCommand_MainFlow(t *testing.T) {
 	}
 	h := NewCommandHandlers(nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
-	if err := h.HandleAddTopicCommand(update); err != nil {
+	if err := h.HandleAddTopicCommand(context.Background(), update); err != nil {
 		t.Errorf("HandleAddTopicCommand returned error: %v", err)
 	}
 }
@@ -35,7 +36,7 @@ func TestCommandHandlers_HandleBotMention_MainFlow(t *testing.T) {
 	}
 	h := NewCommandHandlers(nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}, Text: "@bot"}}
-	if err := h.HandleBotMention(update); err != nil {
+	if err := h.HandleBotMention(context.Background(), update); err != nil {
 		t.Errorf("HandleBotMention returned error: %v", err)
 	}
 }
@@ -49,7 +50,7 @@ func TestCommandHandlers_IsBotMention_MainFlow(t *testing.T) {
 func TestCommandHandlers_HandleNonGeneralTopicMessage_MainFlow(t *testing.T) {
 	h := NewCommandHandlers(nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
-	if err := h.HandleNonGeneralTopicMessage(update); err != nil {
+	if err := h.HandleNonGeneralTopicMessage(context.Background(), update); err != nil {
 		t.Errorf("HandleNonGeneralTopicMessage returned error: %v", err)
 	}
 }
@@ -57,7 +58,7 @@ func TestCommandHandlers_HandleNonGeneralTopicMessage_MainFlow(t *testing.T) {
 func TestCommandHandlers_HandleGeneralTopicMessage_MainFlow(t *testing.T) {
 	h := NewCommandHandlers(nil, nil)
 	update := &gotgbot.Update{Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 123}}}
-	if err := h.HandleGeneralTopicMessage(update); err != nil {
+	if err := h.HandleGeneralTopicMessage(context.Background(), update); err != nil {
 		t.Errorf("HandleGeneralTopicMessage returned error: %v", err)
 	}
 }
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+)
+
+// deleteLater removes a message once delay has passed. The durable queue is preferred;
+// without one the delete runs on an in-memory timer that shutdown flushes early.
+func deleteLater(ctx context.Context, deletions interfaces.DeletionSchedulerInterface, tracker *lifecycle.Tracker, messageService interfaces.MessageServiceInterface, chatID int64, messageID int64, delay time.Duration) {
+	if deletions != nil {
+		err := deletions.ScheduleDeletion(ctx, chatID, messageID, delay)
+		if err == nil {
+			return
+		}
+		logutils.Error("deleteLater: ScheduleDeletionError, falling back to a timer", err, "chatID", chatID, "messageID", messageID)
+	}
+
+	// The delete outlives the update, so it must not inherit its cancellation
+	ctx = context.WithoutCancel(ctx)
+	tracker.After(delay, func() {
+		err := ignoreMessageAlreadyDeleted(messageService.DeleteMessage(ctx, chatID, int(messageID)))
+		if err != nil {
+			logutils.Error("deleteLater: DeleteMessageError", err, "chatID", chatID, "messageID", messageID)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// State store namespaces used by the handlers
+const (
+	stateOriginalMessage = "original_message" // chat:message ID -> message the buttons act on
+	stateKeyboardMessage = "keyboard_message" // chat:message ID -> message carrying its keyboard
+	stateRecentlyMoved   = "recently_moved"   // message ID -> true
+)
+
+// interactionState wraps a state store with the typed lookups the handlers need.
+// The store is the only state handlers share between updates. Values are copied in and
+// out of it, so no handler holds a pointer another goroutine is writing to, and the
+// store alone is responsible for synchronisation.
+// Store failures are logged and treated as a miss, so a broken store degrades to
+// "Message not found" rather than failing the whole update.
+type interactionState struct {
+	store interfaces.StateStoreInterface
+}
+
+func (s interactionState) rememberMessage(ctx context.Context, msg *gotgbot.Message) {
+	s.set(ctx, stateOriginalMessage, messageKey(msg.Chat.Id, msg.MessageId), msg, config.DefaultButtonStateTTL)
+}
+
+func (s interactionState) message(ctx context.Context, chatID, messageID int64) *gotgbot.Message {
+	var msg gotgbot.Message
+	if !s.get(ctx, stateOriginalMessage, messageKey(chatID, messageID), &msg) {
+		return nil
+	}
+	return &msg
+}
+
+func (s interactionState) rememberKeyboard(ctx context.Context, msg *gotgbot.Message, keyboardMsgID int) {
+	s.set(ctx, stateKeyboardMessage, messageKey(msg.Chat.Id, msg.MessageId), keyboardMsgID, config.DefaultButtonStateTTL)
+}
+
+func (s interactionState) keyboard(ctx context.Context, msg *gotgbot.Message) (int, bool) {
+	var keyboardMsgID int
+	ok := s.get(ctx, stateKeyboardMessage, messageKey(msg.Chat.Id, msg.MessageId), &keyboardMsgID)
+	return keyboardMsgID, ok
+}
+
+func (s interactionState) forgetKeyboard(ctx context.Context, msg *gotgbot.Message) {
+	s.delete(ctx, stateKeyboardMessage, messageKey(msg.Chat.Id, msg.MessageId))
+}
+
+func (s interactionState) markMoved(ctx context.Context, messageID int64) {
+	s.set(ctx, stateRecentlyMoved, strconv.FormatInt(messageID, 10), true, config.DefaultRecentlyMovedTTL)
+}
+
+func (s interactionState) isMoved(ctx context.Context, messageID int64) bool {
+	var moved bool
+	return s.get(ctx, stateRecentlyMoved, strconv.FormatInt(messageID, 10), &moved) && moved
+}
+
+func (s interactionState) clearMoved(ctx context.Context, messageID int64) {
+	s.delete(ctx, stateRecentlyMoved, strconv.FormatInt(messageID, 10))
+}
+
+func (s interactionState) set(ctx context.Context, namespace, key string, value interface{}, ttl time.Duration) {
+	if err := s.store.Set(ctx, namespace, key, value, ttl); err != nil {
+		logutils.Error("interactionState: SetError", err, "namespace", namespace, "key", key)
+	}
+}
+
+func (s interactionState) get(ctx context.Context, namespace, key string, dest interface{}) bool {
+	found, err := s.store.Get(ctx, namespace, key, dest)
+	if err != nil {
+		logutils.Error("interactionState: GetError", err, "namespace", namespace, "key", key)
+		return false
+	}
+	return found
+}
+
+func (s interactionState) delete(ctx context.Context, namespace, key string) {
+	if err := s.store.Delete(ctx, namespace, key); err != nil {
+		logutils.Error("interactionState: DeleteError", err, "namespace", namespace, "key", key)
+	}
+}
+
+// messageKey identifies a message across chats
+func messageKey(chatID, messageID int64) string {
+	return strconv.FormatInt(chatID, 10) + ":" + strconv.FormatInt(messageID, 10)
+}
+
+// rebuildCallbackMessage recovers the message a button acts on when its state is gone,
+// e.g. it expired or was created before state was persisted. The callback names the
+// original message and the keyboard message its thread; the text is not recoverable.
+func rebuildCallbackMessage(callback interfaces.Callback, query *gotgbot.CallbackQuery) *gotgbot.Message {
+	if query == nil || query.Message == nil || callback.MessageID == 0 {
+		return nil
+	}
+	from := query.From
+	return &gotgbot.Message{
+		MessageId:       callback.MessageID,
+		Chat:            gotgbot.Chat{Id: callback.ChatID, Type: query.Message.Chat.Type, IsForum: query.Message.Chat.IsForum},
+		MessageThreadId: query.Message.MessageThreadId,
+		From:            &from,
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"save-message/internal/conversation"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	mocks "save-message/internal/mocks/handlers"
+	"save-message/internal/state"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInteractionState_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.db")
+	ctx := context.Background()
+	originalMsg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, From: &gotgbot.User{Id: 1}, Text: "Cake"}
+
+	// Before the restart: suggestions are shown and the user starts creating a topic
+	db, err := database.NewDatabase(path)
+	require.NoError(t, err)
+	topicHandlers := NewTopicHandlers(&mocks.MockMessageService{}, &mocks.MockTopicService{})
+	topicHandlers.State = state.NewDatabaseStore(db)
+	topicHandlers.Conversations = conversation.NewManager(topicHandlers.State)
+	aiHandlers := NewAIHandlers(&mocks.MockMessageService{}, &mocks.MockTopicService{}, &mocks.MockAIService{}, topicHandlers)
+	require.NoError(t, aiHandlers.HandleBackToSuggestionsCallback(ctx, &gotgbot.Update{}, originalMsg))
+	update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{From: gotgbot.User{Id: 1}}}
+	require.NoError(t, topicHandlers.HandleNewTopicCreationRequest(ctx, update, originalMsg))
+	require.NoError(t, db.Close())
+
+	// After the restart fresh handlers find the same state
+	db, err = database.NewDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+	restarted := NewTopicHandlers(&mocks.MockMessageService{}, &mocks.MockTopicService{})
+	restarted.State = state.NewDatabaseStore(db)
+	restarted.Conversations = conversation.NewManager(restarted.State)
+
+	got := restarted.GetOriginalMessage(ctx, 789, 1043)
+	require.NotNil(t, got, "button context is rebuilt from the store")
+	assert.Equal(t, "Cake", got.Text)
+	assert.True(t, restarted.IsWaitingForTopicName(ctx, 789, 1))
+	pending, ok := restarted.takeTopicNamePrompt(ctx, conversation.Key{ChatID: 789, UserID: 1})
+	require.True(t, ok)
+	assert.Equal(t, int64(1043), pending.Original.MessageId)
+}
+
+func TestRebuildCallbackMessage(t *testing.T) {
+	keyboardMsg := &gotgbot.Message{MessageId: 1044, MessageThreadId: 3, Chat: gotgbot.Chat{Id: 789}}
+	tests := []struct {
+		name     string
+		callback interfaces.Callback
+		query    *gotgbot.CallbackQuery
+		wantID   int64
+	}{
+		{name: "topic selection", callback: interfaces.Callback{Action: interfaces.CallbackSelectTopic, ChatID: 789, MessageID: 1043, TopicName: "Work"}, query: &gotgbot.CallbackQuery{Message: keyboardMsg}, wantID: 1043},
+		{name: "back button", callback: interfaces.Callback{Action: interfaces.CallbackBackToSuggestions, ChatID: 789, MessageID: 1043}, query: &gotgbot.CallbackQuery{Message: keyboardMsg}, wantID: 1043},
+		{name: "no message", callback: interfaces.Callback{Action: interfaces.CallbackRetry, ChatID: 789}, query: &gotgbot.CallbackQuery{Message: keyboardMsg}},
+		{name: "inline message", callback: interfaces.Callback{Action: interfaces.CallbackSelectTopic, ChatID: 789, MessageID: 1043}, query: &gotgbot.CallbackQuery{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rebuildCallbackMessage(tt.callback, tt.query)
+			if tt.wantID == 0 {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.wantID, got.MessageId)
+			assert.Equal(t, int64(789), got.Chat.Id)
+			assert.Equal(t, int64(3), got.MessageThreadId)
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
-	"strconv"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
@@ -10,34 +14,65 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
-// KeyboardBuilder handles building inline keyboards
-type KeyboardBuilder struct{}
+// errNoCallbackRegistry is returned when a keyboard with per-message buttons is built without a registry
+var errNoCallbackRegistry = errors.New("no callback registry to issue button tokens")
+
+// KeyboardBuilder handles building inline keyboards. Buttons that act on a message carry
+// a short token issued by the callback registry rather than the topic name and message ID.
+type KeyboardBuilder struct {
+	callbacks interfaces.CallbackRegistryInterface
+}
 
 // NewKeyboardBuilder creates a new keyboard builder instance
-func NewKeyboardBuilder() *KeyboardBuilder {
-	return &KeyboardBuilder{}
+func NewKeyboardBuilder(callbacks interfaces.CallbackRegistryInterface) *KeyboardBuilder {
+	return &KeyboardBuilder{callbacks: callbacks}
 }
 
-// BuildSuggestionKeyboard builds keyboard for AI suggestions
-func (kb *KeyboardBuilder) BuildSuggestionKeyboard(msg *gotgbot.Message, suggestions []string, topics []interfaces.ForumTopic) (*gotgbot.InlineKeyboardMarkup, error) {
+// BuildSuggestionKeyboard builds keyboard for AI suggestions: topics ranked by embeddings come
+// first, nearest first, then the rest, most confident first. Existing topics get a folder icon
+// and new ones a plus, going by the chat's topics rather than the model.
+func (kb *KeyboardBuilder) BuildSuggestionKeyboard(ctx context.Context, msg *gotgbot.Message, suggestions []interfaces.Suggestion, topics []interfaces.ForumTopic) (*gotgbot.InlineKeyboardMarkup, error) {
 	logutils.Info("BuildSuggestionKeyboard: entry", "messageID", msg.MessageId)
+	existing := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		existing[strings.ToLower(topic.Name)] = true
+	}
+	ordered := append([]interfaces.Suggestion(nil), suggestions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		rankedI, rankedJ := ordered[i].Similarity != 0, ordered[j].Similarity != 0
+		if rankedI != rankedJ {
+			return rankedI
+		}
+		if rankedI {
+			return ordered[i].Similarity > ordered[j].Similarity
+		}
+		return ordered[i].Confidence > ordered[j].Confidence
+	})
+
 	var rows [][]gotgbot.InlineKeyboardButton
-	for _, suggestion := range suggestions {
-		rows = append(rows, []gotgbot.InlineKeyboardButton{{
-			Text:         "➕ " + suggestion,
-			CallbackData: suggestion + "_" + strconv.FormatInt(int64(msg.MessageId), 10),
-		}})
+	for _, suggestion := range ordered {
+		icon := config.IconNewFolder
+		if existing[strings.ToLower(suggestion.Name)] {
+			icon = config.IconFolder
+		}
+		button, err := kb.button(ctx, icon+" "+suggestion.Name, callbackFor(msg, interfaces.CallbackSelectTopic, suggestion.Name))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, []gotgbot.InlineKeyboardButton{button})
 	}
 	// Add create new topic button
-	rows = append(rows, []gotgbot.InlineKeyboardButton{{
-		Text:         "📝 Create New Topic",
-		CallbackData: "create_new_folder_" + strconv.FormatInt(int64(msg.MessageId), 10),
-	}})
+	createButton, err := kb.button(ctx, "📝 Create New Topic", callbackFor(msg, interfaces.CallbackCreateTopic, ""))
+	if err != nil {
+		return nil, err
+	}
+	rows = append(rows, []gotgbot.InlineKeyboardButton{createButton})
 	// Add choose from existing folders button
-	rows = append(rows, []gotgbot.InlineKeyboardButton{{
-		Text:         "➕ Choose from existing folders",
-		CallbackData: "show_existing_folders_" + strconv.FormatInt(int64(msg.MessageId), 10),
-	}})
+	showAllButton, err := kb.button(ctx, "➕ Choose from existing folders", callbackFor(msg, interfaces.CallbackShowAllTopics, ""))
+	if err != nil {
+		return nil, err
+	}
+	rows = append(rows, []gotgbot.InlineKeyboardButton{showAllButton})
 	keyboard := &gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: rows,
 	}
@@ -46,30 +81,48 @@ func (kb *KeyboardBuilder) BuildSuggestionKeyboard(msg *gotgbot.Message, suggest
 }
 
 // BuildAllTopicsKeyboard builds keyboard for showing all topics
-func (kb *KeyboardBuilder) BuildAllTopicsKeyboard(originalMsg *gotgbot.Message, topics []interfaces.ForumTopic) (*gotgbot.InlineKeyboardMarkup, error) {
+func (kb *KeyboardBuilder) BuildAllTopicsKeyboard(ctx context.Context, originalMsg *gotgbot.Message, topics []interfaces.ForumTopic) (*gotgbot.InlineKeyboardMarkup, error) {
 	logutils.Info("BuildAllTopicsKeyboard: entry", "messageID", originalMsg.MessageId)
 	var rows [][]gotgbot.InlineKeyboardButton
 
 	// Add all existing topics as buttons
 	for _, topic := range topics {
-		callbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-		rows = append(rows, []gotgbot.InlineKeyboardButton{{Text: config.IconFolder + " " + topic.Name, CallbackData: callbackData}})
+		button, err := kb.button(ctx, config.IconFolder+" "+topic.Name, callbackFor(originalMsg, interfaces.CallbackSelectTopic, topic.Name))
+		if err != nil {
+			logutils.Error("BuildAllTopicsKeyboard: exit", err, "messageID", originalMsg.MessageId)
+			return nil, err
+		}
+		rows = append(rows, []gotgbot.InlineKeyboardButton{button})
 	}
 
 	// Add back button
-	backCallbackData := config.CallbackPrefixBackToSuggestions + strconv.FormatInt(originalMsg.MessageId, 10)
-	backBtn := gotgbot.InlineKeyboardButton{Text: config.ButtonTextBackToSuggestions, CallbackData: backCallbackData}
+	backBtn, err := kb.button(ctx, config.ButtonTextBackToSuggestions, callbackFor(originalMsg, interfaces.CallbackBackToSuggestions, ""))
+	if err != nil {
+		logutils.Error("BuildAllTopicsKeyboard: exit", err, "messageID", originalMsg.MessageId)
+		return nil, err
+	}
 	rows = append(rows, []gotgbot.InlineKeyboardButton{backBtn})
 
-	result, err := func() (*gotgbot.InlineKeyboardMarkup, error) {
-		return &gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
-	}()
-	if err == nil {
-		logutils.Success("BuildAllTopicsKeyboard: exit", "messageID", originalMsg.MessageId)
-	} else {
-		logutils.Error("BuildAllTopicsKeyboard: exit", err, "messageID", originalMsg.MessageId)
+	logutils.Success("BuildAllTopicsKeyboard: exit", "messageID", originalMsg.MessageId)
+	return &gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// BuildRetryKeyboard builds keyboard offering to retry AI suggestions for msg
+func (kb *KeyboardBuilder) BuildRetryKeyboard(ctx context.Context, msg *gotgbot.Message) (*gotgbot.InlineKeyboardMarkup, error) {
+	button, err := kb.button(ctx, config.ButtonTextTryAgain, callbackFor(msg, interfaces.CallbackRetry, ""))
+	if err != nil {
+		return nil, err
+	}
+	return &gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{button}}}, nil
+}
+
+// BuildCancelKeyboard builds keyboard letting the user abandon the topic-name prompt for msg
+func (kb *KeyboardBuilder) BuildCancelKeyboard(ctx context.Context, msg *gotgbot.Message) (*gotgbot.InlineKeyboardMarkup, error) {
+	button, err := kb.button(ctx, config.ButtonTextCancel, callbackFor(msg, interfaces.CallbackCancelTopicName, ""))
+	if err != nil {
+		return nil, err
 	}
-	return result, err
+	return &gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{button}}}, nil
 }
 
 // BuildBotMenuKeyboard builds keyboard for bot menu
@@ -97,14 +150,76 @@ func (kb *KeyboardBuilder) BuildAddTopicKeyboard() *gotgbot.InlineKeyboardMarkup
 	return result
 }
 
-// BuildWarningKeyboard builds keyboard for warning messages
-func (kb *KeyboardBuilder) BuildWarningKeyboard(callbackData string) *gotgbot.InlineKeyboardMarkup {
-	logutils.Info("BuildWarningKeyboard: entry", "callbackData", callbackData)
+// BuildWarningKeyboard builds keyboard for warning messages about msg
+func (kb *KeyboardBuilder) BuildWarningKeyboard(ctx context.Context, msg *gotgbot.Message) (*gotgbot.InlineKeyboardMarkup, error) {
+	logutils.Info("BuildWarningKeyboard: entry", "messageID", msg.MessageId)
+	button, err := kb.button(ctx, config.ButtonTextOk, callbackFor(msg, interfaces.CallbackWarningOk, ""))
+	if err != nil {
+		return nil, err
+	}
 	result := &gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-			{{Text: config.ButtonTextOk, CallbackData: callbackData}},
-		},
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{button}},
+	}
+	logutils.Success("BuildWarningKeyboard: exit", "messageID", msg.MessageId)
+	return result, nil
+}
+
+// BuildSettingsKeyboard builds the /settings menu for s, one button per setting showing its value.
+// With chat, the chat-wide settings get a button too.
+func (kb *KeyboardBuilder) BuildSettingsKeyboard(ctx context.Context, s interfaces.UserSettings, chat *interfaces.ChatSettings) (*gotgbot.InlineKeyboardMarkup, error) {
+	type label struct {
+		setting string
+		text    string
+	}
+	labels := []label{
+		{settingAutoDelete, fmt.Sprintf(config.SettingsButtonAutoDelete, onOff(s.AutoDelete))},
+		{settingAutoDeleteDelay, fmt.Sprintf(config.SettingsButtonAutoDeleteDelay, formatDelay(s.AutoDeleteDelay))},
+		{settingConfirmation, fmt.Sprintf(config.SettingsButtonConfirmation, confirmationLabel(s.ConfirmationStyle))},
+		{settingConfirmationDelay, fmt.Sprintf(config.SettingsButtonConfirmationTime, formatDelay(s.ConfirmationDelay))},
+		{settingAI, fmt.Sprintf(config.SettingsButtonAI, onOff(s.AIEnabled))},
+		{settingSuggestionCount, fmt.Sprintf(config.SettingsButtonSuggestionCount, s.SuggestionCount)},
+		{settingLanguage, fmt.Sprintf(config.SettingsButtonLanguage, s.Language)},
+	}
+	if chat != nil {
+		labels = append(labels, label{settingPrivacy, fmt.Sprintf(config.SettingsButtonPrivacy, onOff(chat.PrivacyMode))})
+	}
+	labels = append(labels, label{settingsDone, config.ButtonTextSettingsDone})
+
+	rows := make([][]gotgbot.InlineKeyboardButton, 0, len(labels))
+	for _, label := range labels {
+		button, err := kb.button(ctx, label.text, interfaces.Callback{
+			Action:  interfaces.CallbackSettings,
+			ChatID:  s.ChatID,
+			UserID:  s.UserID,
+			Setting: label.setting,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, []gotgbot.InlineKeyboardButton{button})
+	}
+	return &gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// button issues a token for callback and returns a button carrying it
+func (kb *KeyboardBuilder) button(ctx context.Context, text string, callback interfaces.Callback) (gotgbot.InlineKeyboardButton, error) {
+	if kb.callbacks == nil {
+		return gotgbot.InlineKeyboardButton{}, errNoCallbackRegistry
+	}
+	token, err := kb.callbacks.Issue(ctx, callback)
+	if err != nil {
+		logutils.Error("KeyboardBuilder: IssueTokenError", err, "action", string(callback.Action), "messageID", callback.MessageID)
+		return gotgbot.InlineKeyboardButton{}, err
+	}
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: token}, nil
+}
+
+// callbackFor describes a button acting on msg
+func callbackFor(msg *gotgbot.Message, action interfaces.CallbackAction, topicName string) interfaces.Callback {
+	return interfaces.Callback{
+		Action:    action,
+		ChatID:    msg.Chat.Id,
+		MessageID: msg.MessageId,
+		TopicName: topicName,
 	}
-	logutils.Success("BuildWarningKeyboard: exit", "callbackData", callbackData)
-	return result
 }
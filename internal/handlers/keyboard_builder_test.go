@@ -1,29 +1,47 @@
 package handlers
 
 import (
-	"strconv"
+	"context"
+	"strings"
 	"testing"
 
+	"save-message/internal/callbacks"
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
+	"save-message/internal/state"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func newTestKeyboardBuilder() (*KeyboardBuilder, *callbacks.Registry) {
+	registry := callbacks.NewRegistry(state.NewMemoryStore())
+	return NewKeyboardBuilder(registry), registry
+}
+
+// resolveButton returns the callback behind a button, failing the test if it has none
+func resolveButton(t *testing.T, registry *callbacks.Registry, button gotgbot.InlineKeyboardButton) interfaces.Callback {
+	t.Helper()
+	callback, found, err := registry.Resolve(context.Background(), button.CallbackData)
+	require.NoError(t, err)
+	require.True(t, found, "button %q carries no issued token", button.Text)
+	return callback
+}
+
 func TestNewKeyboardBuilder(t *testing.T) {
-	kb := NewKeyboardBuilder()
+	kb, _ := newTestKeyboardBuilder()
 	assert.NotNil(t, kb)
 	assert.IsType(t, &KeyboardBuilder{}, kb)
 }
 
 func TestKeyboardBuilder_BuildSuggestionKeyboard(t *testing.T) {
-	builder := NewKeyboardBuilder()
+	builder, _ := newTestKeyboardBuilder()
 	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}}
 	t.Run("successful_suggestion_keyboard", func(t *testing.T) {
-		suggestions := []string{"Programming", "Development"}
+		suggestions := []interfaces.Suggestion{{Name: "Programming"}, {Name: "Development"}}
 		topics := []interfaces.ForumTopic{}
-		keyboard, err := builder.BuildSuggestionKeyboard(msg, suggestions, topics)
+		keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -56,9 +74,9 @@ func TestKeyboardBuilder_BuildSuggestionKeyboard(t *testing.T) {
 	})
 
 	t.Run("empty_suggestions", func(t *testing.T) {
-		suggestions := []string{}
+		suggestions := []interfaces.Suggestion{}
 		topics := []interfaces.ForumTopic{}
-		keyboard, err := builder.BuildSuggestionKeyboard(msg, suggestions, topics)
+		keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -79,9 +97,9 @@ func TestKeyboardBuilder_BuildSuggestionKeyboard(t *testing.T) {
 	})
 
 	t.Run("nil_suggestions", func(t *testing.T) {
-		var suggestions []string
+		var suggestions []interfaces.Suggestion
 		topics := []interfaces.ForumTopic{}
-		keyboard, err := builder.BuildSuggestionKeyboard(msg, suggestions, topics)
+		keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -102,9 +120,9 @@ func TestKeyboardBuilder_BuildSuggestionKeyboard(t *testing.T) {
 	})
 
 	t.Run("no_existing_topics", func(t *testing.T) {
-		suggestions := []string{"Programming"}
+		suggestions := []interfaces.Suggestion{{Name: "Programming"}}
 		topics := []interfaces.ForumTopic{}
-		keyboard, err := builder.BuildSuggestionKeyboard(msg, suggestions, topics)
+		keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -131,14 +149,65 @@ func TestKeyboardBuilder_BuildSuggestionKeyboard(t *testing.T) {
 	})
 }
 
+func TestBuildSuggestionKeyboard_IconsAndOrder(t *testing.T) {
+	builder, _ := newTestKeyboardBuilder()
+	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}}
+	suggestions := []interfaces.Suggestion{
+		{Name: "Italy", Confidence: 0.4},
+		{Name: "Recipes", Existing: true, Confidence: 0.9},
+		{Name: "Work", Existing: true, Confidence: 0.1}, // the model thinks so, but the chat has no such topic
+		{Name: "Travel", Confidence: 0.6},
+	}
+	topics := []interfaces.ForumTopic{{Name: "Recipes"}, {Name: "Travel"}}
+
+	keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
+	require.NoError(t, err)
+
+	var texts []string
+	for _, row := range keyboard.InlineKeyboard[:len(suggestions)] {
+		texts = append(texts, row[0].Text)
+	}
+	assert.Equal(t, []string{
+		config.IconFolder + " Recipes",
+		config.IconFolder + " Travel",
+		config.IconNewFolder + " Italy",
+		config.IconNewFolder + " Work",
+	}, texts)
+	assert.Equal(t, "Italy", suggestions[0].Name, "the caller's slice is not reordered")
+}
+
+func TestBuildSuggestionKeyboard_NearestFirst(t *testing.T) {
+	builder, _ := newTestKeyboardBuilder()
+	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}}
+	suggestions := []interfaces.Suggestion{
+		{Name: "Italy", Confidence: 0.95},
+		{Name: "Travel", Existing: true, Confidence: 0.3, Similarity: 0.3},
+		{Name: "Work", Existing: true, Confidence: 0.1, Similarity: 0.42},
+	}
+	topics := []interfaces.ForumTopic{{Name: "Work"}, {Name: "Travel"}}
+
+	keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
+	require.NoError(t, err)
+
+	var texts []string
+	for _, row := range keyboard.InlineKeyboard[:len(suggestions)] {
+		texts = append(texts, row[0].Text)
+	}
+	assert.Equal(t, []string{
+		config.IconFolder + " Work",
+		config.IconFolder + " Travel",
+		config.IconNewFolder + " Italy",
+	}, texts, "topics ranked by embeddings come before the model's new names, however confident")
+}
+
 // Regression test: ensures that the '🔄 Try Again' button is NOT present in the keyboard returned by BuildSuggestionKeyboard.
 // This prevents accidental reintroduction of the retry button in the topic suggestion UI.
 func TestBuildSuggestionKeyboard_DoesNotIncludeRetryButton(t *testing.T) {
-	builder := NewKeyboardBuilder()
+	builder, _ := newTestKeyboardBuilder()
 	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}}
-	suggestions := []string{"Topic1", "Topic2"}
+	suggestions := []interfaces.Suggestion{{Name: "Topic1"}, {Name: "Topic2"}}
 	topics := []interfaces.ForumTopic{}
-	keyboard, err := builder.BuildSuggestionKeyboard(msg, suggestions, topics)
+	keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, suggestions, topics)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -151,8 +220,36 @@ func TestBuildSuggestionKeyboard_DoesNotIncludeRetryButton(t *testing.T) {
 	}
 }
 
+func TestBuildSuggestionKeyboard_TokensResolveToActions(t *testing.T) {
+	builder, registry := newTestKeyboardBuilder()
+	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: -100456}}
+	longName := strings.Repeat("Очень длинное название темы_", 4) // underscores and >64 bytes
+	keyboard, err := builder.BuildSuggestionKeyboard(context.Background(), msg, []interfaces.Suggestion{{Name: longName}}, nil)
+	require.NoError(t, err)
+	require.Len(t, keyboard.InlineKeyboard, 3)
+
+	want := []interfaces.Callback{
+		{Action: interfaces.CallbackSelectTopic, ChatID: -100456, MessageID: 123, TopicName: longName},
+		{Action: interfaces.CallbackCreateTopic, ChatID: -100456, MessageID: 123},
+		{Action: interfaces.CallbackShowAllTopics, ChatID: -100456, MessageID: 123},
+	}
+	for i, row := range keyboard.InlineKeyboard {
+		assert.LessOrEqual(t, len(row[0].CallbackData), 64, "callback data must fit Telegram's limit")
+		assert.Equal(t, want[i], resolveButton(t, registry, row[0]))
+	}
+}
+
+func TestKeyboardBuilder_WithoutRegistry(t *testing.T) {
+	builder := NewKeyboardBuilder(nil)
+	msg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 456}}
+
+	_, err := builder.BuildSuggestionKeyboard(context.Background(), msg, []interfaces.Suggestion{{Name: "Work"}}, nil)
+	assert.ErrorIs(t, err, errNoCallbackRegistry)
+	assert.NotNil(t, builder.BuildBotMenuKeyboard(), "static menus need no registry")
+}
+
 func TestKeyboardBuilder_BuildAllTopicsKeyboard(t *testing.T) {
-	kb := NewKeyboardBuilder()
+	kb, registry := newTestKeyboardBuilder()
 
 	tests := []struct {
 		name        string
@@ -189,7 +286,7 @@ func TestKeyboardBuilder_BuildAllTopicsKeyboard(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			keyboard, err := kb.BuildAllTopicsKeyboard(tt.originalMsg, tt.topics)
+			keyboard, err := kb.BuildAllTopicsKeyboard(context.Background(), tt.originalMsg, tt.topics)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -201,41 +298,24 @@ func TestKeyboardBuilder_BuildAllTopicsKeyboard(t *testing.T) {
 			assert.NotNil(t, keyboard)
 			assert.Len(t, keyboard.InlineKeyboard, tt.expectRows)
 
-			// Check for required buttons
-			hasBackButton := false
-
-			for _, row := range keyboard.InlineKeyboard {
-				for _, button := range row {
-					if button.CallbackData == config.CallbackPrefixBackToSuggestions+strconv.FormatInt(tt.originalMsg.MessageId, 10) {
-						hasBackButton = true
-					}
-				}
-			}
-
-			assert.True(t, hasBackButton, "Should have back button")
+			// The last row goes back to the suggestions for the same message
+			back := resolveButton(t, registry, keyboard.InlineKeyboard[len(keyboard.InlineKeyboard)-1][0])
+			assert.Equal(t, interfaces.CallbackBackToSuggestions, back.Action, "Should have back button")
+			assert.Equal(t, tt.originalMsg.MessageId, back.MessageID)
 
 			// Check topic buttons
-			for _, topic := range tt.topics {
-				found := false
-				for _, row := range keyboard.InlineKeyboard {
-					for _, button := range row {
-						if button.CallbackData == topic.Name+"_"+strconv.FormatInt(tt.originalMsg.MessageId, 10) {
-							found = true
-							break
-						}
-					}
-					if found {
-						break
-					}
-				}
-				assert.True(t, found, "Should have button for topic: %s", topic.Name)
+			for i, topic := range tt.topics {
+				callback := resolveButton(t, registry, keyboard.InlineKeyboard[i][0])
+				assert.Equal(t, interfaces.CallbackSelectTopic, callback.Action)
+				assert.Equal(t, topic.Name, callback.TopicName, "Should have button for topic: %s", topic.Name)
+				assert.Equal(t, tt.originalMsg.MessageId, callback.MessageID)
 			}
 		})
 	}
 }
 
 func TestKeyboardBuilder_BuildBotMenuKeyboard(t *testing.T) {
-	kb := NewKeyboardBuilder()
+	kb, _ := newTestKeyboardBuilder()
 
 	keyboard := kb.BuildBotMenuKeyboard()
 
@@ -262,7 +342,7 @@ func TestKeyboardBuilder_BuildBotMenuKeyboard(t *testing.T) {
 }
 
 func TestKeyboardBuilder_BuildAddTopicKeyboard(t *testing.T) {
-	kb := NewKeyboardBuilder()
+	kb, _ := newTestKeyboardBuilder()
 
 	keyboard := kb.BuildAddTopicKeyboard()
 
@@ -284,24 +364,17 @@ func TestKeyboardBuilder_BuildAddTopicKeyboard(t *testing.T) {
 }
 
 func TestKeyboardBuilder_BuildWarningKeyboard(t *testing.T) {
-	kb := NewKeyboardBuilder()
+	kb, registry := newTestKeyboardBuilder()
 
-	testCallbackData := "test_callback_data"
-	keyboard := kb.BuildWarningKeyboard(testCallbackData)
+	msg := &gotgbot.Message{MessageId: 77, Chat: gotgbot.Chat{Id: 456}}
+	keyboard, err := kb.BuildWarningKeyboard(context.Background(), msg)
+	require.NoError(t, err)
 
 	assert.NotNil(t, keyboard)
 	assert.Len(t, keyboard.InlineKeyboard, 1)
 
 	// Check for required button
-	hasOkButton := false
-
-	for _, row := range keyboard.InlineKeyboard {
-		for _, button := range row {
-			if button.CallbackData == testCallbackData {
-				hasOkButton = true
-			}
-		}
-	}
-
-	assert.True(t, hasOkButton, "Should have ok button")
+	button := keyboard.InlineKeyboard[0][0]
+	assert.Equal(t, config.ButtonTextOk, button.Text)
+	assert.Equal(t, interfaces.CallbackWarningOk, resolveButton(t, registry, button).Action, "Should have ok button")
 }
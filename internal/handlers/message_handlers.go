@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"strings"
 
 	"save-message/internal/interfaces"
@@ -39,27 +40,27 @@ func NewMessageHandlers(
 }
 
 // HandleMessage routes messages to the appropriate handler based on context.
-func (mh *MessageHandlers) HandleMessage(update *gotgbot.Update) error {
+func (mh *MessageHandlers) HandleMessage(ctx context.Context, update *gotgbot.Update) error {
 	chatID := update.Message.Chat.Id
 	logutils.Info("HandleMessage", "chatID", chatID, "messageID", update.Message.MessageId)
 
 	var err error
 	switch {
-	case mh.isWaitingForTopic(update):
+	case mh.isWaitingForTopic(ctx, update):
 		logutils.Info("HandleMessage: Routing to TopicNameEntry", "chatID", chatID)
-		err = mh.TopicHandlers.HandleTopicNameEntry(update)
+		err = mh.TopicHandlers.HandleTopicNameEntry(ctx, update)
 	case mh.isCommand(update):
 		logutils.Info("HandleMessage: Routing to Command", "chatID", chatID)
-		err = mh.handleCommand(update)
+		err = mh.handleCommand(ctx, update)
 	case mh.IsBotMention(update):
 		logutils.Info("HandleMessage: Routing to BotMention", "chatID", chatID)
-		err = mh.CommandHandlers.HandleBotMention(update)
+		err = mh.CommandHandlers.HandleBotMention(ctx, update)
 	case mh.isGeneralTopicMessage(update):
 		logutils.Info("HandleMessage: Routing to GeneralTopicMessage", "chatID", chatID)
-		err = mh.AIHandlers.HandleGeneralTopicMessage(update)
+		err = mh.AIHandlers.HandleGeneralTopicMessage(ctx, update)
 	default:
 		logutils.Warn("HandleMessage: Routing to NonGeneralTopicMessage", "chatID", chatID)
-		err = mh.WarningHandlers.HandleNonGeneralTopicMessage(update)
+		err = mh.WarningHandlers.HandleNonGeneralTopicMessage(ctx, update)
 	}
 
 	if err != nil {
@@ -71,38 +72,53 @@ func (mh *MessageHandlers) HandleMessage(update *gotgbot.Update) error {
 }
 
 // HandleStartCommand delegates to command handlers
-func (mh *MessageHandlers) HandleStartCommand(update *gotgbot.Update) error {
-	return mh.CommandHandlers.HandleStartCommand(update)
+func (mh *MessageHandlers) HandleStartCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleStartCommand(ctx, update)
 }
 
 // HandleHelpCommand delegates to command handlers
-func (mh *MessageHandlers) HandleHelpCommand(update *gotgbot.Update) error {
-	return mh.CommandHandlers.HandleHelpCommand(update)
+func (mh *MessageHandlers) HandleHelpCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleHelpCommand(ctx, update)
 }
 
 // HandleTopicsCommand delegates to command handlers
-func (mh *MessageHandlers) HandleTopicsCommand(update *gotgbot.Update) error {
-	return mh.CommandHandlers.HandleTopicsCommand(update)
+func (mh *MessageHandlers) HandleTopicsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleTopicsCommand(ctx, update)
 }
 
 // HandleAddTopicCommand delegates to command handlers
-func (mh *MessageHandlers) HandleAddTopicCommand(update *gotgbot.Update) error {
-	return mh.CommandHandlers.HandleAddTopicCommand(update)
+func (mh *MessageHandlers) HandleAddTopicCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleAddTopicCommand(ctx, update)
+}
+
+// HandleSearchCommand delegates to command handlers
+func (mh *MessageHandlers) HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleSearchCommand(ctx, update)
+}
+
+// HandleSettingsCommand delegates to command handlers
+func (mh *MessageHandlers) HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleSettingsCommand(ctx, update)
+}
+
+// HandleTopicManagementCommand delegates to command handlers
+func (mh *MessageHandlers) HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleTopicManagementCommand(ctx, update)
 }
 
 // HandleBotMention delegates to command handlers
-func (mh *MessageHandlers) HandleBotMention(update *gotgbot.Update) error {
-	return mh.CommandHandlers.HandleBotMention(update)
+func (mh *MessageHandlers) HandleBotMention(ctx context.Context, update *gotgbot.Update) error {
+	return mh.CommandHandlers.HandleBotMention(ctx, update)
 }
 
 // HandleNonGeneralTopicMessage delegates to warning handlers
-func (mh *MessageHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update) error {
-	return mh.WarningHandlers.HandleNonGeneralTopicMessage(update)
+func (mh *MessageHandlers) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	return mh.WarningHandlers.HandleNonGeneralTopicMessage(ctx, update)
 }
 
 // HandleGeneralTopicMessage delegates to AI handlers
-func (mh *MessageHandlers) HandleGeneralTopicMessage(update *gotgbot.Update) error {
-	return mh.AIHandlers.HandleGeneralTopicMessage(update)
+func (mh *MessageHandlers) HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	return mh.AIHandlers.HandleGeneralTopicMessage(ctx, update)
 }
 
 // IsBotMention checks if the bot is mentioned in the message.
@@ -121,46 +137,56 @@ func (mh *MessageHandlers) IsBotMention(update *gotgbot.Update) bool {
 }
 
 // IsRecentlyMovedMessage checks if message was recently moved
-func (mh *MessageHandlers) IsRecentlyMovedMessage(messageID int64) bool {
-	return mh.TopicHandlers.IsRecentlyMovedMessage(messageID)
+func (mh *MessageHandlers) IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool {
+	return mh.TopicHandlers.IsRecentlyMovedMessage(ctx, messageID)
 }
 
 // CleanupMovedMessage cleans up moved message tracking
-func (mh *MessageHandlers) CleanupMovedMessage(messageID int64) {
-	mh.TopicHandlers.CleanupMovedMessage(messageID)
+func (mh *MessageHandlers) CleanupMovedMessage(ctx context.Context, messageID int64) {
+	mh.TopicHandlers.CleanupMovedMessage(ctx, messageID)
 }
 
-// IsWaitingForTopicName checks if user is waiting for topic name
-func (mh *MessageHandlers) IsWaitingForTopicName(userID int64) bool {
-	return mh.TopicHandlers.IsWaitingForTopicName(userID)
+// IsWaitingForTopicName checks if user is waiting for topic name in chatID
+func (mh *MessageHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	return mh.TopicHandlers.IsWaitingForTopicName(ctx, chatID, userID)
 }
 
 // HandleTopicNameEntry delegates to topic handlers
-func (mh *MessageHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
-	return mh.TopicHandlers.HandleTopicNameEntry(update)
+func (mh *MessageHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
+	return mh.TopicHandlers.HandleTopicNameEntry(ctx, update)
 }
 
-func (mh *MessageHandlers) isWaitingForTopic(update *gotgbot.Update) bool {
-	return mh.TopicHandlers.IsWaitingForTopicName(update.Message.From.Id)
+// isWaitingForTopic reports whether the message answers a topic-name prompt.
+// Commands never do, so /cancel and the others still work mid-prompt.
+func (mh *MessageHandlers) isWaitingForTopic(ctx context.Context, update *gotgbot.Update) bool {
+	return !mh.isCommand(update) && mh.TopicHandlers.IsWaitingForTopicName(ctx, update.Message.Chat.Id, update.Message.From.Id)
 }
 
 func (mh *MessageHandlers) isCommand(update *gotgbot.Update) bool {
 	return update.Message.Text != "" && update.Message.Text[0] == '/'
 }
 
-func (mh *MessageHandlers) handleCommand(update *gotgbot.Update) error {
+func (mh *MessageHandlers) handleCommand(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("handleCommand", "command", update.Message.Text)
-	switch update.Message.Text {
+	switch commandName(update.Message.Text) {
 	case "/start":
-		return mh.CommandHandlers.HandleStartCommand(update)
+		return mh.CommandHandlers.HandleStartCommand(ctx, update)
 	case "/help":
-		return mh.CommandHandlers.HandleHelpCommand(update)
+		return mh.CommandHandlers.HandleHelpCommand(ctx, update)
 	case "/topics":
-		return mh.CommandHandlers.HandleTopicsCommand(update)
+		return mh.CommandHandlers.HandleTopicsCommand(ctx, update)
 	case "/addtopic":
-		return mh.CommandHandlers.HandleAddTopicCommand(update)
+		return mh.CommandHandlers.HandleAddTopicCommand(ctx, update)
+	case "/cancel":
+		return mh.TopicHandlers.HandleCancelCommand(ctx, update)
+	case "/search":
+		return mh.CommandHandlers.HandleSearchCommand(ctx, update)
+	case "/settings":
+		return mh.CommandHandlers.HandleSettingsCommand(ctx, update)
+	case "/renametopic", "/closetopic", "/reopentopic", "/deletetopic", "/mergetopic":
+		return mh.CommandHandlers.HandleTopicManagementCommand(ctx, update)
 	default:
-		_, err := mh.MessageService.SendMessage(update.Message.Chat.Id, "Unknown command. Try /help", nil)
+		_, err := mh.MessageService.SendMessage(ctx, update.Message.Chat.Id, "Unknown command. Try /help", nil)
 		if err != nil {
 			logutils.Error("handleCommand: SendMessageError", err, "command", update.Message.Text)
 		}
@@ -168,6 +194,16 @@ func (mh *MessageHandlers) handleCommand(update *gotgbot.Update) error {
 	}
 }
 
+// commandName returns the command text starts with, without arguments or @botname
+func commandName(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	name, _, _ := strings.Cut(fields[0], "@")
+	return name
+}
+
 func (mh *MessageHandlers) isGeneralTopicMessage(update *gotgbot.Update) bool {
 	return update.Message.MessageThreadId == 0
 }
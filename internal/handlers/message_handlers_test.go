@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"save-message/internal/interfaces"
 	"testing"
 
@@ -17,23 +18,23 @@ type mockCommandHandlers struct {
 	MentionCalled  *bool
 }
 
-func (m *mockCommandHandlers) HandleStartCommand(u *gotgbot.Update) error {
+func (m *mockCommandHandlers) HandleStartCommand(ctx context.Context, u *gotgbot.Update) error {
 	*m.StartCalled = true
 	return nil
 }
-func (m *mockCommandHandlers) HandleHelpCommand(u *gotgbot.Update) error {
+func (m *mockCommandHandlers) HandleHelpCommand(ctx context.Context, u *gotgbot.Update) error {
 	*m.HelpCalled = true
 	return nil
 }
-func (m *mockCommandHandlers) HandleTopicsCommand(u *gotgbot.Update) error {
+func (m *mockCommandHandlers) HandleTopicsCommand(ctx context.Context, u *gotgbot.Update) error {
 	*m.TopicsCalled = true
 	return nil
 }
-func (m *mockCommandHandlers) HandleAddTopicCommand(u *gotgbot.Update) error {
+func (m *mockCommandHandlers) HandleAddTopicCommand(ctx context.Context, u *gotgbot.Update) error {
 	*m.AddTopicCalled = true
 	return nil
 }
-func (m *mockCommandHandlers) HandleBotMention(u *gotgbot.Update) error {
+func (m *mockCommandHandlers) HandleBotMention(ctx context.Context, u *gotgbot.Update) error {
 	*m.MentionCalled = true
 	return nil
 }
@@ -43,7 +44,7 @@ type mockWarningHandlers struct {
 	Called *bool
 }
 
-func (m *mockWarningHandlers) HandleNonGeneralTopicMessage(u *gotgbot.Update) error {
+func (m *mockWarningHandlers) HandleNonGeneralTopicMessage(ctx context.Context, u *gotgbot.Update) error {
 	*m.Called = true
 	return nil
 }
@@ -53,7 +54,7 @@ type mockAIHandlers struct {
 	Called *bool
 }
 
-func (m *mockAIHandlers) HandleGeneralTopicMessage(u *gotgbot.Update) error {
+func (m *mockAIHandlers) HandleGeneralTopicMessage(ctx context.Context, u *gotgbot.Update) error {
 	*m.Called = true
 	return nil
 }
@@ -63,11 +64,13 @@ type mockTopicHandlers struct {
 	Called *bool
 }
 
-func (m *mockTopicHandlers) HandleTopicNameEntry(u *gotgbot.Update) error {
+func (m *mockTopicHandlers) HandleTopicNameEntry(ctx context.Context, u *gotgbot.Update) error {
 	*m.Called = true
 	return nil
 }
-func (m *mockTopicHandlers) IsWaitingForTopicName(userID int64) bool { return false }
+func (m *mockTopicHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	return false
+}
 
 func TestMessageHandlersDelegation(t *testing.T) {
 	update := &gotgbot.Update{Message: &gotgbot.Message{From: &gotgbot.User{Id: 1}}}
@@ -96,42 +99,42 @@ func TestMessageHandlersDelegation(t *testing.T) {
 
 	t.Run("delegates HandleStartCommand", func(t *testing.T) {
 		startCalled = false
-		mh.HandleStartCommand(update)
+		mh.HandleStartCommand(context.Background(), update)
 		assert.True(t, startCalled)
 	})
 	t.Run("delegates HandleHelpCommand", func(t *testing.T) {
 		helpCalled = false
-		mh.HandleHelpCommand(update)
+		mh.HandleHelpCommand(context.Background(), update)
 		assert.True(t, helpCalled)
 	})
 	t.Run("delegates HandleTopicsCommand", func(t *testing.T) {
 		topicsCalled = false
-		mh.HandleTopicsCommand(update)
+		mh.HandleTopicsCommand(context.Background(), update)
 		assert.True(t, topicsCalled)
 	})
 	t.Run("delegates HandleAddTopicCommand", func(t *testing.T) {
 		addTopicCalled = false
-		mh.HandleAddTopicCommand(update)
+		mh.HandleAddTopicCommand(context.Background(), update)
 		assert.True(t, addTopicCalled)
 	})
 	t.Run("delegates HandleBotMention", func(t *testing.T) {
 		mentionCalled = false
-		mh.HandleBotMention(update)
+		mh.HandleBotMention(context.Background(), update)
 		assert.True(t, mentionCalled)
 	})
 	t.Run("delegates HandleNonGeneralTopicMessage", func(t *testing.T) {
 		warnCalled = false
-		mh.HandleNonGeneralTopicMessage(update)
+		mh.HandleNonGeneralTopicMessage(context.Background(), update)
 		assert.True(t, warnCalled)
 	})
 	t.Run("delegates HandleGeneralTopicMessage", func(t *testing.T) {
 		aiCalled = false
-		mh.HandleGeneralTopicMessage(update)
+		mh.HandleGeneralTopicMessage(context.Background(), update)
 		assert.True(t, aiCalled)
 	})
 	t.Run("delegates HandleTopicNameEntry", func(t *testing.T) {
 		topicCalled = false
-		mh.HandleTopicNameEntry(update)
+		mh.HandleTopicNameEntry(context.Background(), update)
 		assert.True(t, topicCalled)
 	})
 }
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+	"save-message/internal/state"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// searchDateLayout is the date format of the before: and after: filters
+const searchDateLayout = "2006-01-02"
+
+// SearchHandlers answers /search with pages of matching saved messages
+type SearchHandlers struct {
+	messageService interfaces.MessageServiceInterface
+	savedMessages  interfaces.SavedMessageIndexInterface
+
+	// Callbacks issues the tokens behind the page buttons
+	Callbacks interfaces.CallbackRegistryInterface
+
+	PageSize int
+}
+
+var _ interfaces.SearchHandlersInterface = (*SearchHandlers)(nil)
+
+// NewSearchHandlers creates a new search handlers instance
+func NewSearchHandlers(messageService interfaces.MessageServiceInterface, savedMessages interfaces.SavedMessageIndexInterface) *SearchHandlers {
+	return &SearchHandlers{
+		messageService: messageService,
+		savedMessages:  savedMessages,
+		Callbacks:      callbacks.NewRegistry(state.NewMemoryStore()),
+		PageSize:       config.SearchPageSize,
+	}
+}
+
+// HandleSearchCommand handles /search <words> [topic:] [type:] [before:] [after:]
+func (sh *SearchHandlers) HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error {
+	msg := update.Message
+	args := commandArgs(msg.Text)
+	logutils.Info("HandleSearchCommand", "chatID", msg.Chat.Id, "query", args)
+
+	opts := &gotgbot.SendMessageOpts{MessageThreadId: msg.MessageThreadId}
+	query, problem := parseSearchQuery(args)
+	if problem != "" {
+		return sh.reply(ctx, msg.Chat.Id, problem, opts)
+	}
+
+	text, keyboard, err := sh.resultsPage(ctx, msg.Chat.Id, args, query, 0)
+	if err != nil {
+		logutils.Error("HandleSearchCommand: SearchError", err, "chatID", msg.Chat.Id)
+		return sh.reply(ctx, msg.Chat.Id, config.SearchFailed, opts)
+	}
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+	if err := sh.reply(ctx, msg.Chat.Id, text, opts); err != nil {
+		return err
+	}
+	logutils.Success("HandleSearchCommand", "chatID", msg.Chat.Id)
+	return nil
+}
+
+// HandleSearchPageCallback shows another page of results in place of the current one
+func (sh *SearchHandlers) HandleSearchPageCallback(ctx context.Context, update *gotgbot.Update, callback interfaces.Callback) error {
+	resultsMsg := update.CallbackQuery.Message
+	logutils.Info("HandleSearchPageCallback", "chatID", callback.ChatID, "page", callback.Page)
+
+	query, problem := parseSearchQuery(callback.Query)
+	if problem != "" {
+		// The query was valid when the button was made
+		logutils.Warn("HandleSearchPageCallback: Invalid query", "chatID", callback.ChatID, "query", callback.Query)
+		return nil
+	}
+	text, keyboard, err := sh.resultsPage(ctx, callback.ChatID, callback.Query, query, callback.Page)
+	if err != nil {
+		logutils.Error("HandleSearchPageCallback: SearchError", err, "chatID", callback.ChatID)
+		return err
+	}
+
+	opts := &gotgbot.EditMessageTextOpts{}
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+	_, err = sh.messageService.EditMessageText(ctx, resultsMsg.Chat.Id, resultsMsg.MessageId, text, opts)
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("HandleSearchPageCallback: EditMessageTextError", err, "chatID", callback.ChatID)
+		return err
+	}
+	logutils.Success("HandleSearchPageCallback", "chatID", callback.ChatID, "page", callback.Page)
+	return nil
+}
+
+// resultsPage runs the search and renders page of its results. The keyboard links every
+// hit and, when there is more than one page, moves between pages.
+func (sh *SearchHandlers) resultsPage(ctx context.Context, chatID int64, args string, query interfaces.SearchQuery, page int) (string, *gotgbot.InlineKeyboardMarkup, error) {
+	pageSize := sh.PageSize
+	if pageSize < 1 {
+		pageSize = config.SearchPageSize
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	hits, total, err := sh.savedMessages.Search(ctx, chatID, query, page*pageSize, pageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return config.SearchNoResults, nil, nil
+	}
+	pages := (total + pageSize - 1) / pageSize
+
+	lines := []string{fmt.Sprintf(config.SearchResultsTitle, total, page+1, pages)}
+	var rows [][]gotgbot.InlineKeyboardButton
+	for i, hit := range hits {
+		label := fmt.Sprintf("%d. %s %s · %s", page*pageSize+i+1, config.IconFolder, hit.TopicName, hitSummary(hit))
+		lines = append(lines, label)
+		if link := messageLink(hit.ChatID, hit.ThreadID, hit.SavedMessageID); link != "" {
+			rows = append(rows, []gotgbot.InlineKeyboardButton{{Text: truncateRunes(label, config.SearchHitLabelLength), Url: link}})
+		}
+	}
+
+	var nav []gotgbot.InlineKeyboardButton
+	kb := NewKeyboardBuilder(sh.Callbacks)
+	if page > 0 {
+		button, err := kb.button(ctx, config.ButtonTextPreviousPage, searchPageCallback(chatID, args, page-1))
+		if err != nil {
+			return "", nil, err
+		}
+		nav = append(nav, button)
+	}
+	if page+1 < pages {
+		button, err := kb.button(ctx, config.ButtonTextNextPage, searchPageCallback(chatID, args, page+1))
+		if err != nil {
+			return "", nil, err
+		}
+		nav = append(nav, button)
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	text := strings.Join(lines, "\n")
+	if len(rows) == 0 {
+		return text, nil, nil
+	}
+	return text, &gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+func (sh *SearchHandlers) reply(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) error {
+	_, err := sh.messageService.SendMessage(ctx, chatID, text, opts)
+	if err != nil {
+		logutils.Error("HandleSearchCommand: SendMessageError", err, "chatID", chatID)
+	}
+	return err
+}
+
+func searchPageCallback(chatID int64, args string, page int) interfaces.Callback {
+	return interfaces.Callback{Action: interfaces.CallbackSearchPage, ChatID: chatID, Query: args, Page: page}
+}
+
+// parseSearchQuery reads /search arguments. It returns what is wrong with them, if anything,
+// as a message for the user.
+func parseSearchQuery(args string) (interfaces.SearchQuery, string) {
+	var query interfaces.SearchQuery
+	filtered := false
+	for _, token := range splitQuotedArgs(args) {
+		key, value, found := strings.Cut(token, ":")
+		key = strings.ToLower(key)
+		if !found || !isSearchFilter(key) {
+			query.Words = append(query.Words, strings.Fields(token)...)
+			continue
+		}
+		if value == "" {
+			return query, searchProblem(fmt.Sprintf("%s: needs a value.", key))
+		}
+
+		filtered = true
+		switch key {
+		case "topic":
+			query.Topic = value
+		case "type":
+			query.ContentType = strings.ToLower(value)
+			if !isContentType(query.ContentType) {
+				return query, searchProblem(fmt.Sprintf("Unknown type %q. Use one of: %s.", value, strings.Join(interfaces.ContentTypes, ", ")))
+			}
+		case "before", "after":
+			date, err := time.Parse(searchDateLayout, value)
+			if err != nil {
+				return query, searchProblem(fmt.Sprintf("%s: must be a date like %s.", key, searchDateLayout))
+			}
+			if key == "before" {
+				query.Before = date
+			} else {
+				query.After = date
+			}
+		}
+	}
+
+	if len(query.Words) == 0 && !filtered {
+		return query, config.SearchUsageMessage
+	}
+	return query, ""
+}
+
+// splitQuotedArgs splits on spaces, keeping double-quoted parts such as topic:"My Recipes" together
+func splitQuotedArgs(args string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range args {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func isSearchFilter(key string) bool {
+	switch key {
+	case "topic", "type", "before", "after":
+		return true
+	}
+	return false
+}
+
+func isContentType(contentType string) bool {
+	for _, known := range interfaces.ContentTypes {
+		if contentType == known {
+			return true
+		}
+	}
+	return false
+}
+
+func searchProblem(problem string) string {
+	return fmt.Sprintf(config.SearchBadFilter, problem) + config.SearchUsageMessage
+}
+
+// hitSummary is the snippet of a hit, or its content type when it has no text
+func hitSummary(hit interfaces.SearchHit) string {
+	snippet := strings.Join(strings.Fields(hit.Snippet), " ")
+	if snippet == "" {
+		return "[" + hit.ContentType + "]"
+	}
+	return snippet
+}
+
+// messageLink returns the t.me link to a message in a supergroup's forum topic, or ""
+// for chats such links cannot point into
+func messageLink(chatID, threadID, messageID int64) string {
+	// Supergroup IDs are -100 followed by the ID t.me links use
+	internalID := -chatID - 1000000000000
+	if internalID <= 0 {
+		return ""
+	}
+	if messageID == 0 {
+		return fmt.Sprintf("https://t.me/c/%d/%d", internalID, threadID)
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d/%d", internalID, threadID, messageID)
+}
+
+// commandArgs returns what follows the command in text
+func commandArgs(text string) string {
+	text = strings.TrimSpace(text)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[end:])
+}
+
+// truncateRunes shortens s to at most n characters, marking the cut with an ellipsis
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
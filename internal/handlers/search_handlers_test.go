@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	mocks "save-message/internal/mocks/handlers"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchMessageService records the last results message sent or edited
+type searchMessageService struct {
+	mocks.MockMessageService
+
+	text     string
+	threadID int64
+	keyboard gotgbot.InlineKeyboardMarkup
+	editedID int64
+}
+
+func (m *searchMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	m.text, m.threadID = text, opts.MessageThreadId
+	if keyboard, ok := opts.ReplyMarkup.(gotgbot.InlineKeyboardMarkup); ok {
+		m.keyboard = keyboard
+	}
+	return &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: chatID}}, nil
+}
+
+func (m *searchMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+	m.text, m.editedID, m.keyboard = text, messageID, opts.ReplyMarkup
+	return &gotgbot.Message{MessageId: messageID, Chat: gotgbot.Chat{Id: chatID}}, nil
+}
+
+// sevenHits answers every search with seven saves in the "Recipes" topic
+func sevenHits(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error) {
+	var hits []interfaces.SearchHit
+	for i := offset; i < 7 && i < offset+limit; i++ {
+		hits = append(hits, interfaces.SearchHit{
+			ChatID: chatID, ThreadID: 10, SavedMessageID: int64(100 + i),
+			TopicName: "Recipes", ContentType: interfaces.ContentText, Snippet: fmt.Sprintf("cake %d", i+1),
+		})
+	}
+	return hits, 7, nil
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        string
+		want        interfaces.SearchQuery
+		wantProblem bool
+	}{
+		{name: "words", args: "chocolate  cake", want: interfaces.SearchQuery{Words: []string{"chocolate", "cake"}}},
+		{
+			name: "quoted topic and type",
+			args: `cake topic:"My Recipes" TYPE:Photo`,
+			want: interfaces.SearchQuery{Words: []string{"cake"}, Topic: "My Recipes", ContentType: interfaces.ContentPhoto},
+		},
+		{
+			name: "dates",
+			args: "after:2024-05-01 before:2024-06-01",
+			want: interfaces.SearchQuery{
+				After:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "unknown prefix is a word", args: "http://example.com", want: interfaces.SearchQuery{Words: []string{"http://example.com"}}},
+		{name: "empty", args: "", wantProblem: true},
+		{name: "unknown type", args: "type:poem", wantProblem: true},
+		{name: "bad date", args: "before:yesterday", wantProblem: true},
+		{name: "missing value", args: "cake topic:", wantProblem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problem := parseSearchQuery(tt.args)
+			if tt.wantProblem {
+				assert.Contains(t, problem, config.SearchUsageMessage)
+				return
+			}
+			assert.Empty(t, problem)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMessageLink(t *testing.T) {
+	assert.Equal(t, "https://t.me/c/1234567890/10/42", messageLink(-1001234567890, 10, 42))
+	assert.Equal(t, "https://t.me/c/1234567890/10", messageLink(-1001234567890, 10, 0))
+	assert.Empty(t, messageLink(-123456, 10, 42), "basic groups have no message links")
+	assert.Empty(t, messageLink(123456, 0, 42), "private chats have no message links")
+}
+
+func TestHandleSearchCommand(t *testing.T) {
+	ms := &searchMessageService{}
+	var gotQuery interfaces.SearchQuery
+	index := &mocks.MockSavedMessageIndex{
+		SearchFunc: func(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error) {
+			gotQuery = query
+			return sevenHits(ctx, chatID, query, offset, limit)
+		},
+	}
+	sh := NewSearchHandlers(ms, index)
+
+	update := &gotgbot.Update{Message: &gotgbot.Message{
+		MessageId:       1,
+		MessageThreadId: 3,
+		Chat:            gotgbot.Chat{Id: -1001234567890, Type: "supergroup"},
+		Text:            "/search@save_bot cake topic:Recipes",
+	}}
+	require.NoError(t, sh.HandleSearchCommand(context.Background(), update))
+
+	assert.Equal(t, interfaces.SearchQuery{Words: []string{"cake"}, Topic: "Recipes"}, gotQuery)
+	assert.Equal(t, int64(3), ms.threadID, "results go to the thread the command came from")
+	assert.Contains(t, ms.text, fmt.Sprintf(config.SearchResultsTitle, 7, 1, 2))
+	assert.Contains(t, ms.text, "cake 5")
+	assert.NotContains(t, ms.text, "cake 6")
+
+	rows := ms.keyboard.InlineKeyboard
+	require.Len(t, rows, config.SearchPageSize+1)
+	assert.Equal(t, "https://t.me/c/1234567890/10/100", rows[0][0].Url)
+	nav := rows[len(rows)-1]
+	require.Len(t, nav, 1, "the first page has no previous button")
+	assert.Equal(t, config.ButtonTextNextPage, nav[0].Text)
+
+	callback, ok, err := sh.Callbacks.Resolve(context.Background(), nav[0].CallbackData)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, interfaces.Callback{
+		Action: interfaces.CallbackSearchPage, ChatID: -1001234567890, Query: "cake topic:Recipes", Page: 1,
+	}, callback)
+}
+
+func TestHandleSearchCommand_Problems(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		search func(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error)
+		want   string
+	}{
+		{name: "no arguments", text: "/search", want: config.SearchUsageMessage},
+		{name: "no results", text: "/search pizza", want: config.SearchNoResults},
+		{
+			name: "search fails",
+			text: "/search cake",
+			search: func(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error) {
+				return nil, 0, fmt.Errorf("database is locked")
+			},
+			want: config.SearchFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &searchMessageService{}
+			sh := NewSearchHandlers(ms, &mocks.MockSavedMessageIndex{SearchFunc: tt.search})
+			update := &gotgbot.Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001234567890}, Text: tt.text}}
+
+			require.NoError(t, sh.HandleSearchCommand(context.Background(), update))
+			assert.Equal(t, tt.want, ms.text)
+			assert.Empty(t, ms.keyboard.InlineKeyboard)
+		})
+	}
+}
+
+func TestHandleSearchPageCallback(t *testing.T) {
+	ms := &searchMessageService{}
+	sh := NewSearchHandlers(ms, &mocks.MockSavedMessageIndex{SearchFunc: sevenHits})
+
+	update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+		Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: -1001234567890}},
+	}}
+	callback := interfaces.Callback{Action: interfaces.CallbackSearchPage, ChatID: -1001234567890, Query: "cake", Page: 1}
+	require.NoError(t, sh.HandleSearchPageCallback(context.Background(), update, callback))
+
+	assert.Equal(t, int64(900), ms.editedID, "the results message is edited in place")
+	assert.Contains(t, ms.text, fmt.Sprintf(config.SearchResultsTitle, 7, 2, 2))
+	assert.Contains(t, ms.text, "6. ")
+	assert.NotContains(t, ms.text, "cake 5")
+
+	rows := ms.keyboard.InlineKeyboard
+	require.Len(t, rows, 3)
+	nav := rows[len(rows)-1]
+	require.Len(t, nav, 1, "the last page has no next button")
+	assert.Equal(t, config.ButtonTextPreviousPage, nav[0].Text)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+	"save-message/internal/state"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Settings the /settings menu buttons change
+const (
+	settingAutoDelete        = "auto_delete"
+	settingAutoDeleteDelay   = "auto_delete_delay"
+	settingConfirmation      = "confirmation"
+	settingConfirmationDelay = "confirmation_delay"
+	settingAI                = "ai"
+	settingSuggestionCount   = "suggestion_count"
+	settingLanguage          = "language"
+	settingPrivacy           = "privacy" // chat-wide, for admins
+	settingsDone             = "done"    // closes the menu
+)
+
+// confirmationStyles is the order the confirmation button cycles through
+var confirmationStyles = []string{interfaces.ConfirmationTimed, interfaces.ConfirmationKept, interfaces.ConfirmationOff}
+
+// SettingsHandlers shows the /settings menu and applies its buttons
+type SettingsHandlers struct {
+	messageService interfaces.MessageServiceInterface
+	settings       interfaces.SettingsServiceInterface
+
+	// Callbacks issues the tokens behind the menu buttons
+	Callbacks interfaces.CallbackRegistryInterface
+
+	// Chats keeps the chat-wide settings. Optional; without it the menu has no privacy mode button.
+	Chats interfaces.ChatSettingsServiceInterface
+	// Topics tells who may change chat-wide settings: those who can manage topics. Without it
+	// nobody can.
+	Topics interfaces.TopicServiceInterface
+}
+
+var _ interfaces.SettingsHandlersInterface = (*SettingsHandlers)(nil)
+
+// NewSettingsHandlers creates a new settings handlers instance
+func NewSettingsHandlers(messageService interfaces.MessageServiceInterface, settings interfaces.SettingsServiceInterface) *SettingsHandlers {
+	return &SettingsHandlers{
+		messageService: messageService,
+		settings:       settings,
+		Callbacks:      callbacks.NewRegistry(state.NewMemoryStore()),
+	}
+}
+
+// HandleSettingsCommand shows the sender's settings in this chat with buttons to change them
+func (sh *SettingsHandlers) HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error {
+	msg := update.Message
+	if msg.From == nil {
+		return nil
+	}
+	logutils.Info("HandleSettingsCommand", "chatID", msg.Chat.Id, "userID", msg.From.Id)
+
+	opts := &gotgbot.SendMessageOpts{MessageThreadId: msg.MessageThreadId}
+	settings, err := sh.settings.Get(ctx, msg.Chat.Id, msg.From.Id)
+	if err != nil {
+		return sh.reply(ctx, msg.Chat.Id, config.SettingsFailed, opts)
+	}
+	chat, err := sh.chatSettings(ctx, msg.Chat.Id)
+	if err != nil {
+		return sh.reply(ctx, msg.Chat.Id, config.SettingsFailed, opts)
+	}
+	keyboard, err := NewKeyboardBuilder(sh.Callbacks).BuildSettingsKeyboard(ctx, settings, chat)
+	if err != nil {
+		logutils.Error("HandleSettingsCommand: BuildSettingsKeyboardError", err, "chatID", msg.Chat.Id)
+		return sh.reply(ctx, msg.Chat.Id, config.SettingsFailed, opts)
+	}
+	opts.ParseMode = "Markdown"
+	opts.ReplyMarkup = *keyboard
+	if err := sh.reply(ctx, msg.Chat.Id, config.SettingsMenuMessage, opts); err != nil {
+		return err
+	}
+	logutils.Success("HandleSettingsCommand", "chatID", msg.Chat.Id, "userID", msg.From.Id)
+	return nil
+}
+
+// HandleSettingsCallback moves the pressed setting to its next choice and redraws the menu
+func (sh *SettingsHandlers) HandleSettingsCallback(ctx context.Context, update *gotgbot.Update, callback interfaces.Callback) error {
+	query := update.CallbackQuery
+	menuMsg := query.Message
+	logutils.Info("HandleSettingsCallback", "chatID", callback.ChatID, "userID", callback.UserID, "setting", callback.Setting)
+
+	// The menu is visible to the whole chat, but only changes its owner's settings
+	if query.From.Id != callback.UserID {
+		logutils.Warn("HandleSettingsCallback: Not the menu's owner", "chatID", callback.ChatID, "userID", query.From.Id, "owner", callback.UserID)
+		return nil
+	}
+
+	if callback.Setting == settingsDone {
+		err := ignoreMessageAlreadyDeleted(sh.messageService.DeleteMessage(ctx, menuMsg.Chat.Id, int(menuMsg.MessageId)))
+		if err != nil {
+			logutils.Error("HandleSettingsCallback: DeleteMessageError", err, "chatID", menuMsg.Chat.Id, "messageID", menuMsg.MessageId)
+		}
+		return err
+	}
+
+	settings, err := sh.settings.Get(ctx, callback.ChatID, callback.UserID)
+	if err != nil {
+		return err
+	}
+	chat, err := sh.chatSettings(ctx, callback.ChatID)
+	if err != nil {
+		return err
+	}
+	if callback.Setting == settingPrivacy && chat != nil {
+		allowed, err := sh.canChangeChat(ctx, callback.ChatID, query.From.Id)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			logutils.Warn("HandleSettingsCallback: Not allowed to change the chat's settings", "chatID", callback.ChatID, "userID", query.From.Id)
+			sh.notify(ctx, menuMsg, config.SettingsPrivacyAdminsOnly)
+			return nil
+		}
+		chat.PrivacyMode = !chat.PrivacyMode
+		err = sh.Chats.SaveChat(ctx, *chat)
+		if err != nil {
+			sh.notify(ctx, menuMsg, config.SettingsFailed)
+			return err
+		}
+	} else {
+		if !changeSetting(&settings, callback.Setting) {
+			logutils.Warn("HandleSettingsCallback: Unknown setting", "setting", callback.Setting)
+			return nil
+		}
+		if err := sh.settings.Save(ctx, settings); err != nil {
+			sh.notify(ctx, menuMsg, config.SettingsFailed)
+			return err
+		}
+	}
+
+	keyboard, err := NewKeyboardBuilder(sh.Callbacks).BuildSettingsKeyboard(ctx, settings, chat)
+	if err != nil {
+		logutils.Error("HandleSettingsCallback: BuildSettingsKeyboardError", err, "chatID", menuMsg.Chat.Id)
+		return err
+	}
+	_, err = sh.messageService.EditMessageText(ctx, menuMsg.Chat.Id, menuMsg.MessageId, config.SettingsMenuMessage, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "Markdown",
+		ReplyMarkup: *keyboard,
+	})
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("HandleSettingsCallback: EditMessageTextError", err, "chatID", menuMsg.Chat.Id, "messageID", menuMsg.MessageId)
+		return err
+	}
+	logutils.Success("HandleSettingsCallback", "chatID", callback.ChatID, "userID", callback.UserID, "setting", callback.Setting)
+	return nil
+}
+
+// chatSettings returns the chat-wide settings the menu shows, nil when there is no Chats service
+func (sh *SettingsHandlers) chatSettings(ctx context.Context, chatID int64) (*interfaces.ChatSettings, error) {
+	if sh.Chats == nil {
+		return nil, nil
+	}
+	chat, err := sh.Chats.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// canChangeChat reports whether the user may change the chat-wide settings
+func (sh *SettingsHandlers) canChangeChat(ctx context.Context, chatID int64, userID int64) (bool, error) {
+	if sh.Topics == nil {
+		return false, nil
+	}
+	return sh.Topics.CanManageTopics(ctx, chatID, userID)
+}
+
+// notify tells the chat, below the menu, why a button did nothing
+func (sh *SettingsHandlers) notify(ctx context.Context, menuMsg *gotgbot.Message, text string) {
+	_, err := sh.messageService.SendMessage(ctx, menuMsg.Chat.Id, text, &gotgbot.SendMessageOpts{
+		MessageThreadId: menuMsg.MessageThreadId,
+	})
+	if err != nil {
+		logutils.Error("HandleSettingsCallback: SendMessageError", err, "chatID", menuMsg.Chat.Id)
+	}
+}
+
+func (sh *SettingsHandlers) reply(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) error {
+	_, err := sh.messageService.SendMessage(ctx, chatID, text, opts)
+	if err != nil {
+		logutils.Error("HandleSettingsCommand: SendMessageError", err, "chatID", chatID)
+	}
+	return err
+}
+
+// changeSetting moves setting to its next choice, reporting false for a setting it does not know
+func changeSetting(s *interfaces.UserSettings, setting string) bool {
+	switch setting {
+	case settingAutoDelete:
+		s.AutoDelete = !s.AutoDelete
+	case settingAutoDeleteDelay:
+		s.AutoDeleteDelay = nextChoice(config.AutoDeleteDelayChoices, s.AutoDeleteDelay)
+	case settingConfirmation:
+		s.ConfirmationStyle = nextChoice(confirmationStyles, s.ConfirmationStyle)
+	case settingConfirmationDelay:
+		s.ConfirmationDelay = nextChoice(config.ConfirmationDelayChoices, s.ConfirmationDelay)
+	case settingAI:
+		s.AIEnabled = !s.AIEnabled
+	case settingSuggestionCount:
+		s.SuggestionCount = nextChoice(config.SuggestionCountChoices, s.SuggestionCount)
+	case settingLanguage:
+		s.Language = nextChoice(config.LanguageChoices, s.Language)
+	default:
+		return false
+	}
+	return true
+}
+
+// nextChoice returns the choice after current, wrapping around; a value that is not
+// among the choices moves to the first one
+func nextChoice[T comparable](choices []T, current T) T {
+	for i, choice := range choices {
+		if choice == current {
+			return choices[(i+1)%len(choices)]
+		}
+	}
+	return choices[0]
+}
+
+// settingsFor returns the user's settings in the chat. Without a settings service, or if it
+// fails, the defaults apply: settings tune what the bot does, they never stop it.
+func settingsFor(ctx context.Context, settings interfaces.SettingsServiceInterface, chatID, userID int64) interfaces.UserSettings {
+	if settings == nil {
+		return interfaces.DefaultUserSettings(chatID, userID)
+	}
+	s, err := settings.Get(ctx, chatID, userID)
+	if err != nil {
+		logutils.Error("settingsFor: GetSettingsError, using defaults", err, "chatID", chatID, "userID", userID)
+		return interfaces.DefaultUserSettings(chatID, userID)
+	}
+	return s
+}
+
+func onOff(on bool) string {
+	if on {
+		return config.SettingsValueOn
+	}
+	return config.SettingsValueOff
+}
+
+func confirmationLabel(style string) string {
+	switch style {
+	case interfaces.ConfirmationKept:
+		return config.SettingsConfirmationKept
+	case interfaces.ConfirmationOff:
+		return config.SettingsConfirmationOff
+	default:
+		return config.SettingsConfirmationTimed
+	}
+}
+
+// formatDelay writes a delay the way the menu shows it, e.g. "10 s" or "5 min"
+func formatDelay(d time.Duration) string {
+	if d >= time.Minute && d%time.Minute == 0 {
+		return fmt.Sprintf("%d min", d/time.Minute)
+	}
+	return fmt.Sprintf("%d s", d/time.Second)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	mocks "save-message/internal/mocks/handlers"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSettings keeps settings in memory, handing out the defaults for users without any
+type fakeSettings struct {
+	saved map[[2]int64]interfaces.UserSettings
+}
+
+func (f *fakeSettings) Get(ctx context.Context, chatID int64, userID int64) (interfaces.UserSettings, error) {
+	if s, ok := f.saved[[2]int64{chatID, userID}]; ok {
+		return s, nil
+	}
+	return interfaces.DefaultUserSettings(chatID, userID), nil
+}
+
+func (f *fakeSettings) Save(ctx context.Context, s interfaces.UserSettings) error {
+	if f.saved == nil {
+		f.saved = map[[2]int64]interfaces.UserSettings{}
+	}
+	f.saved[[2]int64{s.ChatID, s.UserID}] = s
+	return nil
+}
+
+// fakeChatSettings keeps chat settings in memory
+type fakeChatSettings struct {
+	saved map[int64]interfaces.ChatSettings
+}
+
+func (f *fakeChatSettings) GetChat(ctx context.Context, chatID int64) (interfaces.ChatSettings, error) {
+	if s, ok := f.saved[chatID]; ok {
+		return s, nil
+	}
+	return interfaces.ChatSettings{ChatID: chatID}, nil
+}
+
+func (f *fakeChatSettings) SaveChat(ctx context.Context, s interfaces.ChatSettings) error {
+	if f.saved == nil {
+		f.saved = map[int64]interfaces.ChatSettings{}
+	}
+	f.saved[s.ChatID] = s
+	return nil
+}
+
+func TestNextChoice(t *testing.T) {
+	assert.Equal(t, 3, nextChoice([]int{1, 2, 3}, 2))
+	assert.Equal(t, 1, nextChoice([]int{1, 2, 3}, 3), "the last choice wraps around")
+	assert.Equal(t, 1, nextChoice([]int{1, 2, 3}, 9), "an unknown value moves to the first choice")
+}
+
+func TestSettingsMenu(t *testing.T) {
+	ctx := context.Background()
+	msgSvc := &searchMessageService{}
+	settings := &fakeSettings{}
+	sh := NewSettingsHandlers(msgSvc, settings)
+
+	err := sh.HandleSettingsCommand(ctx, &gotgbot.Update{Message: &gotgbot.Message{
+		Chat: gotgbot.Chat{Id: -100}, From: &gotgbot.User{Id: 7}, MessageThreadId: 3, Text: "/settings",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, config.SettingsMenuMessage, msgSvc.text)
+	assert.Equal(t, int64(3), msgSvc.threadID)
+	require.Len(t, msgSvc.keyboard.InlineKeyboard, 8)
+	assert.Equal(t, "🤖 AI suggestions: on", msgSvc.keyboard.InlineKeyboard[4][0].Text)
+
+	press := func(row int, from int64) error {
+		callback, found, err := sh.Callbacks.Resolve(ctx, msgSvc.keyboard.InlineKeyboard[row][0].CallbackData)
+		require.NoError(t, err)
+		require.True(t, found)
+		return sh.HandleSettingsCallback(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			From:    gotgbot.User{Id: from},
+			Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: -100}},
+		}}, callback)
+	}
+
+	// Someone else pressing the menu changes nothing
+	require.NoError(t, press(4, 8))
+	assert.Empty(t, settings.saved)
+
+	require.NoError(t, press(4, 7))
+	saved := settings.saved[[2]int64{-100, 7}]
+	assert.False(t, saved.AIEnabled)
+	assert.Equal(t, int64(900), msgSvc.editedID, "the menu is redrawn in place")
+	assert.Equal(t, "🤖 AI suggestions: off", msgSvc.keyboard.InlineKeyboard[4][0].Text)
+
+	require.NoError(t, press(1, 7))
+	assert.Equal(t, 10*time.Second, settings.saved[[2]int64{-100, 7}].AutoDeleteDelay)
+	assert.Equal(t, "⏱ Remove after: 10 s", msgSvc.keyboard.InlineKeyboard[1][0].Text)
+}
+
+func TestSettingsMenu_PrivacyMode(t *testing.T) {
+	ctx := context.Background()
+	msgSvc := &searchMessageService{}
+	chats := &fakeChatSettings{}
+	topics := &managedTopics{}
+	sh := NewSettingsHandlers(msgSvc, &fakeSettings{})
+	sh.Chats = chats
+	sh.Topics = topics
+
+	err := sh.HandleSettingsCommand(ctx, &gotgbot.Update{Message: &gotgbot.Message{
+		Chat: gotgbot.Chat{Id: -100}, From: &gotgbot.User{Id: 7}, Text: "/settings",
+	}})
+	require.NoError(t, err)
+	require.Len(t, msgSvc.keyboard.InlineKeyboard, 9)
+	assert.Equal(t, "🔒 Privacy mode (whole chat): off", msgSvc.keyboard.InlineKeyboard[7][0].Text)
+
+	press := func() error {
+		callback, found, err := sh.Callbacks.Resolve(ctx, msgSvc.keyboard.InlineKeyboard[7][0].CallbackData)
+		require.NoError(t, err)
+		require.True(t, found)
+		return sh.HandleSettingsCallback(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			From:    gotgbot.User{Id: 7},
+			Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: -100}},
+		}}, callback)
+	}
+
+	// Only those who can manage topics change the whole chat's settings
+	require.NoError(t, press())
+	assert.Empty(t, chats.saved)
+	assert.Equal(t, config.SettingsPrivacyAdminsOnly, msgSvc.text)
+
+	topics.admin = true
+	require.NoError(t, press())
+	assert.True(t, chats.saved[-100].PrivacyMode)
+	assert.Equal(t, "🔒 Privacy mode (whole chat): on", msgSvc.keyboard.InlineKeyboard[7][0].Text)
+}
+
+func TestSettingsApplyToSavesAndWarnings(t *testing.T) {
+	ctx := context.Background()
+	settings := &fakeSettings{}
+	quiet := interfaces.DefaultUserSettings(789, 1)
+	quiet.AutoDelete = false
+	quiet.ConfirmationStyle = interfaces.ConfirmationOff
+	quiet.ConfirmationDelay = 5 * time.Minute
+	require.NoError(t, settings.Save(ctx, quiet))
+
+	msgSvc := &mocks.MockMessageService{}
+	deletions := &recordingDeletions{}
+	th := NewTopicHandlers(msgSvc, &mocks.MockTopicService{})
+	th.Deletions = deletions
+	th.Settings = settings
+
+	err := th.HandleTopicSelectionCallback(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{From: gotgbot.User{Id: 1}}},
+		&gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, Text: "Cake"}, "Desserts")
+	require.NoError(t, err)
+	assert.False(t, msgSvc.SendMessageCalled, "confirmations are off")
+	assert.Empty(t, deletions.messageIDs, "the original stays in General")
+
+	wh := NewWarningHandlers(msgSvc)
+	wh.Deletions = deletions
+	wh.Settings = settings
+	err = wh.HandleNonGeneralTopicMessage(ctx, &gotgbot.Update{Message: &gotgbot.Message{
+		MessageId: 123, MessageThreadId: 5, Chat: gotgbot.Chat{Id: 789}, From: &gotgbot.User{Id: 1},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Minute}, deletions.delays, "the warning lasts as long as the poster's confirmations")
+}
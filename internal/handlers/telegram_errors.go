@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"save-message/internal/config"
+	"save-message/internal/logutils"
+	"save-message/internal/telegram"
+)
+
+// ignoreMessageNotModified treats an edit that changed nothing as a success:
+// the message already shows the text and keyboard we wanted.
+func ignoreMessageNotModified(err error) error {
+	if telegram.IsMessageNotModified(err) {
+		logutils.Debug("ignoreMessageNotModified: message already up to date")
+		return nil
+	}
+	return err
+}
+
+// ignoreMessageAlreadyDeleted treats deleting a message that is already gone as a success.
+func ignoreMessageAlreadyDeleted(err error) error {
+	if telegram.IsMessageToDeleteNotFound(err) {
+		logutils.Debug("ignoreMessageAlreadyDeleted: message already deleted")
+		return nil
+	}
+	return err
+}
+
+// topicErrorMessage picks the user-facing text for a failed topic operation.
+// Missing admin rights get their own hint since retrying cannot fix them.
+func topicErrorMessage(err error, fallback string) string {
+	if telegram.IsNotEnoughRights(err) {
+		return config.ErrorMessageNotEnoughRights
+	}
+	return fallback
+}
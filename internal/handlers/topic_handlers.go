@@ -1,87 +1,110 @@
 package handlers
 
 import (
-	"strconv"
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	"save-message/internal/callbacks"
 	"save-message/internal/config"
+	"save-message/internal/conversation"
 	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
 	"save-message/internal/logutils"
+	"save-message/internal/state"
+	"save-message/internal/telegram"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 // TopicHandlers handles topic-related operations and callbacks
 type TopicHandlers struct {
-	messageService        interfaces.MessageServiceInterface
-	topicService          interfaces.TopicServiceInterface
-	MessageStore          map[string]*gotgbot.Message
-	KeyboardMessageStore  map[string]int
-	WaitingForTopicName   map[int64]TopicCreationContext
-	OriginalMessageStore  map[int64]*gotgbot.Message
-	RecentlyMovedMessages map[int64]bool
-	keyboardBuilder       *KeyboardBuilder
-
-	// For testability: allow configurable delays
+	messageService interfaces.MessageServiceInterface
+	topicService   interfaces.TopicServiceInterface
+
+	// State holds button context and Callbacks the tokens behind the buttons. Both default
+	// to memory; setup swaps in persistent ones so buttons keep working across restarts.
+	State     interfaces.StateStoreInterface
+	Callbacks interfaces.CallbackRegistryInterface
+
+	// Conversations tracks who is typing a topic name, per chat, until they answer, cancel or time out
+	Conversations *conversation.Manager
+
+	// RestoreSuggestions shows the suggestion keyboard for a message again when its
+	// topic-name prompt is cancelled or times out. NewAIHandlers sets it.
+	RestoreSuggestions func(ctx context.Context, originalMsg *gotgbot.Message) error
+
+	// Settings decides per user whether the original is removed and what the confirmation
+	// does; without it the defaults apply
+	Settings interfaces.SettingsServiceInterface
+
+	// For testability: fixed delays that take precedence over the users' settings
 	MessageAutoDeleteDelay  time.Duration
 	ConfirmationDeleteDelay time.Duration
 
+	// Deletions persists auto-deletes so they survive restarts. Without it (or if persisting
+	// fails) they fall back to in-memory timers, which Tracker flushes on shutdown.
+	Deletions interfaces.DeletionSchedulerInterface
+	Tracker   *lifecycle.Tracker
+
+	// SavedMessages, if set, records every successful save
+	SavedMessages interfaces.SavedMessageIndexInterface
+
 	// Mockable funcs for testing
-	HandleNewTopicCreationRequestFunc   func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicSelectionCallbackFunc    func(update *gotgbot.Update, originalMsg *gotgbot.Message, callbackData string) error
-	HandleShowAllTopicsCallbackFunc     func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleCreateTopicMenuCallbackFunc   func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleShowAllTopicsMenuCallbackFunc func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicNameEntryFunc            func(update *gotgbot.Update) error
+	HandleNewTopicCreationRequestFunc   func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicSelectionCallbackFunc    func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message, topicName string) error
+	HandleShowAllTopicsCallbackFunc     func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleCreateTopicMenuCallbackFunc   func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleShowAllTopicsMenuCallbackFunc func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicNameEntryFunc            func(ctx context.Context, update *gotgbot.Update) error
 }
 
 // TopicCreationContext is already defined in callback_handlers.go
 
 // NewTopicHandlers creates a new topic handlers instance
 func NewTopicHandlers(messageService interfaces.MessageServiceInterface, topicService interfaces.TopicServiceInterface) *TopicHandlers {
+	store := state.NewMemoryStore()
 	return &TopicHandlers{
-		messageService:        messageService,
-		topicService:          topicService,
-		MessageStore:          make(map[string]*gotgbot.Message),
-		KeyboardMessageStore:  make(map[string]int),
-		WaitingForTopicName:   make(map[int64]TopicCreationContext),
-		OriginalMessageStore:  make(map[int64]*gotgbot.Message),
-		RecentlyMovedMessages: make(map[int64]bool),
-		keyboardBuilder:       NewKeyboardBuilder(),
+		messageService: messageService,
+		topicService:   topicService,
+		State:          store,
+		Callbacks:      callbacks.NewRegistry(store),
+		Conversations:  conversation.NewManager(store),
 	}
 }
 
 // HandleNewTopicCreationRequest handles requests to create a new topic
-func (th *TopicHandlers) HandleNewTopicCreationRequest(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (th *TopicHandlers) HandleNewTopicCreationRequest(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if th.HandleNewTopicCreationRequestFunc != nil {
-		return th.HandleNewTopicCreationRequestFunc(update, originalMsg)
+		return th.HandleNewTopicCreationRequestFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleNewTopicCreationRequest", "chatID", originalMsg.Chat.Id)
 
-	// Ask user for topic name
-	_, err := th.messageService.SendMessage(originalMsg.Chat.Id, config.TopicNamePrompt, &gotgbot.SendMessageOpts{
+	// Ask user for topic name, remembering the message to save once it is created
+	key := conversation.Key{ChatID: originalMsg.Chat.Id, UserID: update.CallbackQuery.From.Id}
+	err := th.startTopicNamePrompt(ctx, key, originalMsg, config.TopicNamePrompt, &gotgbot.SendMessageOpts{
 		MessageThreadId: originalMsg.MessageThreadId,
+	}, pendingTopicName{
+		Creation: TopicCreationContext{
+			ChatId:        originalMsg.Chat.Id,
+			ThreadId:      int64(originalMsg.MessageThreadId),
+			OriginalMsgId: int64(originalMsg.MessageId),
+		},
+		Original: originalMsg,
 	})
 	if err != nil {
 		logutils.Error("HandleNewTopicCreationRequest: SendMessageError", err, "chatID", originalMsg.Chat.Id)
 		return err
 	}
 
-	// Store the context for topic creation
-	th.WaitingForTopicName[update.CallbackQuery.From.Id] = TopicCreationContext{
-		ChatId:        originalMsg.Chat.Id,
-		ThreadId:      int64(originalMsg.MessageThreadId),
-		OriginalMsgId: int64(originalMsg.MessageId),
-	}
-
-	// Store the original message for this user
-	th.OriginalMessageStore[update.CallbackQuery.From.Id] = originalMsg
-
 	// Delete the keyboard message
-	if keyboardMsgId, exists := th.KeyboardMessageStore[update.CallbackQuery.Data]; exists {
-		th.messageService.DeleteMessage(originalMsg.Chat.Id, keyboardMsgId)
-		delete(th.KeyboardMessageStore, update.CallbackQuery.Data)
+	if keyboardMsgId, exists := th.state().keyboard(ctx, originalMsg); exists {
+		if err := ignoreMessageAlreadyDeleted(th.messageService.DeleteMessage(ctx, originalMsg.Chat.Id, keyboardMsgId)); err != nil {
+			logutils.Warn("HandleNewTopicCreationRequest: DeleteKeyboardError", "chatID", originalMsg.Chat.Id, "messageID", keyboardMsgId, "error", err.Error())
+		}
+		th.state().forgetKeyboard(ctx, originalMsg)
 	}
 
 	logutils.Success("HandleNewTopicCreationRequest", "chatID", originalMsg.Chat.Id)
@@ -89,75 +112,68 @@ func (th *TopicHandlers) HandleNewTopicCreationRequest(update *gotgbot.Update, o
 }
 
 // HandleTopicNameEntry handles when user provides a topic name
-func (th *TopicHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
+func (th *TopicHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
 	if th.HandleTopicNameEntryFunc != nil {
-		return th.HandleTopicNameEntryFunc(update)
+		return th.HandleTopicNameEntryFunc(ctx, update)
 	}
 	logutils.Info("HandleTopicNameEntry", "userID", update.Message.From.Id)
 
-	ctx := th.WaitingForTopicName[update.Message.From.Id]
+	// Claim the prompt so a second message sent meanwhile cannot create the topic twice
+	key := conversation.Key{ChatID: update.Message.Chat.Id, UserID: update.Message.From.Id}
+	pending, ok := th.takeTopicNamePrompt(ctx, key)
+	if !ok {
+		logutils.Warn("HandleTopicNameEntry: No topic name pending", "chatID", key.ChatID, "userID", key.UserID)
+		return nil
+	}
+	creation := pending.Creation
 	topicName := strings.TrimSpace(update.Message.Text)
 
-	if topicName == "" {
-		_, err := th.messageService.SendMessage(ctx.ChatId, config.TopicNameEmptyError, &gotgbot.SendMessageOpts{})
+	// An unusable name keeps the user in the flow with a fresh deadline
+	if problem := th.validateTopicName(ctx, creation.ChatId, topicName); problem != "" {
+		_, err := th.messageService.SendMessage(ctx, creation.ChatId, problem, &gotgbot.SendMessageOpts{
+			MessageThreadId: creation.ThreadId,
+		})
 		if err != nil {
-			logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", ctx.ChatId)
+			logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", creation.ChatId)
 		}
+		th.resumeTopicNamePrompt(ctx, key, pending)
 		return nil
 	}
-
-	// Check if topic already exists
-	topics, err := th.topicService.GetForumTopics(ctx.ChatId)
-	if err == nil {
-		exists := false
-		for _, topic := range topics {
-			if strings.EqualFold(topic.Name, topicName) {
-				exists = true
-				break
-			}
-		}
-		if exists {
-			_, err = th.messageService.SendMessage(ctx.ChatId, config.TopicNameExistsError, &gotgbot.SendMessageOpts{})
-			if err != nil {
-				logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", ctx.ChatId)
-			}
-			th.cleanupTopicCreation(update.Message.From.Id)
-			return nil
-		}
-	}
+	th.deletePrompt(ctx, pending)
 
 	// Create the topic
-	threadID, err := th.topicService.CreateForumTopic(ctx.ChatId, topicName)
+	threadID, err := th.topicService.CreateForumTopic(ctx, creation.ChatId, topicName)
 	if err != nil {
-		logutils.Error("HandleTopicNameEntry: CreateTopicError", err, "chatID", ctx.ChatId)
-		_, sendErr := th.messageService.SendMessage(ctx.ChatId, config.ErrorMessageCreateFailed, &gotgbot.SendMessageOpts{})
+		logutils.Error("HandleTopicNameEntry: CreateTopicError", err, "chatID", creation.ChatId)
+		_, sendErr := th.messageService.SendMessage(ctx, creation.ChatId, topicErrorMessage(err, config.ErrorMessageCreateFailed), &gotgbot.SendMessageOpts{})
 		if sendErr != nil {
-			logutils.Error("HandleTopicNameEntry: SendMessageError", sendErr, "chatID", ctx.ChatId)
+			logutils.Error("HandleTopicNameEntry: SendMessageError", sendErr, "chatID", creation.ChatId)
 		}
-		th.cleanupTopicCreation(update.Message.From.Id)
 		return err
 	}
 
 	// Send topic name as first message in new topic
 	if threadID != 0 {
-		_, err := th.messageService.SendMessage(ctx.ChatId, topicName, &gotgbot.SendMessageOpts{
+		_, err := th.messageService.SendMessage(ctx, creation.ChatId, topicName, &gotgbot.SendMessageOpts{
 			MessageThreadId: threadID,
 		})
 		if err != nil {
-			logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", ctx.ChatId)
+			logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", creation.ChatId)
 		}
 	}
 
 	// Copy the original user message to the new topic
-	if origMsg, ok := th.OriginalMessageStore[update.Message.From.Id]; ok && threadID != 0 {
-		_, err := th.messageService.CopyMessageToTopicWithResult(ctx.ChatId, origMsg.Chat.Id, int(origMsg.MessageId), int(threadID))
+	if origMsg := pending.Original; origMsg != nil && threadID != 0 {
+		copied, err := th.messageService.CopyMessageToTopicWithResult(ctx, creation.ChatId, origMsg.Chat.Id, int(origMsg.MessageId), int(threadID))
 		if err != nil {
-			logutils.Error("HandleTopicNameEntry: CopyMessageError", err, "chatID", ctx.ChatId)
+			logutils.Error("HandleTopicNameEntry: CopyMessageError", err, "chatID", creation.ChatId)
 		} else {
+			th.recordSave(ctx, origMsg, update.Message.From.Id, threadID, topicName, copied)
+
 			// Build preview: first 2 lines of the original message
 			previewLines := strings.SplitN(origMsg.Text, "\n", 3)
 			preview := ""
-			if len(previewLines) > 0 {
+			if previewLines[0] != "" {
 				preview += "\n\"" + previewLines[0] + "\""
 			}
 			if len(previewLines) > 1 {
@@ -165,71 +181,36 @@ func (th *TopicHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
 			}
 			confirmMsg := config.SuccessMessageSaved + topicName + preview
 
-			// Send confirmation message to General
-			_, err = th.messageService.SendMessage(ctx.ChatId, confirmMsg, &gotgbot.SendMessageOpts{
-				MessageThreadId: 0,
-			})
-			if err != nil {
-				logutils.Error("HandleTopicNameEntry: SendMessageError", err, "chatID", ctx.ChatId)
-			}
-
-			// Delete the original message from General after a short delay
-			go func(chatID int64, messageID int) {
-				delay := th.MessageAutoDeleteDelay
-				if delay == 0 {
-					delay = config.DefaultMessageAutoDeleteDelay
-				}
-				time.Sleep(delay)
-				_ = th.messageService.DeleteMessage(chatID, messageID)
-			}(origMsg.Chat.Id, int(origMsg.MessageId))
+			// Confirm in General, then remove the original from there, as the user's settings say
+			settings := settingsFor(ctx, th.Settings, creation.ChatId, update.Message.From.Id)
+			_ = th.confirmSave(ctx, "HandleTopicNameEntry", creation.ChatId, 0, confirmMsg, settings)
+			th.removeOriginal(ctx, origMsg, settings)
 		}
 	}
 
-	// Clean up state
-	th.cleanupTopicCreation(update.Message.From.Id)
 	return nil
 }
 
 // HandleTopicSelectionCallback handles when user selects an existing topic
-func (th *TopicHandlers) HandleTopicSelectionCallback(update *gotgbot.Update, originalMsg *gotgbot.Message, callbackData string) error {
+func (th *TopicHandlers) HandleTopicSelectionCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message, topicName string) error {
 	if th.HandleTopicSelectionCallbackFunc != nil {
-		return th.HandleTopicSelectionCallbackFunc(update, originalMsg, callbackData)
+		return th.HandleTopicSelectionCallbackFunc(ctx, update, originalMsg, topicName)
 	}
-	logutils.Info("HandleTopicSelectionCallback", "callbackData", callbackData)
-
-	// Extract topic name from callback data
-	parts := strings.Split(callbackData, "_")
-	if len(parts) < 2 {
-		logutils.Warn("HandleTopicSelectionCallback: InvalidCallbackData", "callbackData", callbackData)
-		return nil
-	}
-
-	topicName := strings.Join(parts[:len(parts)-1], "_") // Rejoin in case topic name contains underscores
+	logutils.Info("HandleTopicSelectionCallback", "topicName", topicName)
 
 	// Find the topic
-	threadID, err := th.topicService.FindTopicByName(originalMsg.Chat.Id, topicName)
+	threadID, err := th.topicService.FindTopicByName(ctx, originalMsg.Chat.Id, topicName)
 	if err != nil {
 		// If topic not found, try to create it (AI suggestion case)
-		if strings.Contains(err.Error(), "topic not found") {
+		if errors.Is(err, interfaces.ErrTopicNotFound) {
 			logutils.Warn("HandleTopicSelectionCallback: Topic not found, creating new topic", "chatID", originalMsg.Chat.Id, "topicName", topicName)
-			threadID, err = th.topicService.CreateForumTopic(originalMsg.Chat.Id, topicName)
-			if err != nil || threadID == 0 {
-				logutils.Error("HandleTopicSelectionCallback: CreateTopicError", err, "chatID", originalMsg.Chat.Id, "topicName", topicName)
-				_, sendErr := th.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageCreateFailed, &gotgbot.SendMessageOpts{
-					MessageThreadId: originalMsg.MessageThreadId,
-				})
-				if sendErr != nil {
-					logutils.Error("HandleTopicSelectionCallback: SendMessageError", sendErr, "chatID", originalMsg.Chat.Id)
-				}
+			threadID, err = th.createTopicForSelection(ctx, originalMsg, topicName)
+			if err != nil {
 				return err
 			}
-			// Optionally, send topic name as first message in new topic (like in HandleTopicNameEntry)
-			_, _ = th.messageService.SendMessage(originalMsg.Chat.Id, topicName, &gotgbot.SendMessageOpts{
-				MessageThreadId: threadID,
-			})
 		} else {
 			logutils.Error("HandleTopicSelectionCallback: FindTopicError", err, "chatID", originalMsg.Chat.Id)
-			_, sendErr := th.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageNotFound, &gotgbot.SendMessageOpts{
+			_, sendErr := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageNotFound, &gotgbot.SendMessageOpts{
 				MessageThreadId: originalMsg.MessageThreadId,
 			})
 			if sendErr != nil {
@@ -240,10 +221,19 @@ func (th *TopicHandlers) HandleTopicSelectionCallback(update *gotgbot.Update, or
 	}
 
 	// Copy message to the selected (or newly created) topic
-	_, err = th.messageService.CopyMessageToTopicWithResult(originalMsg.Chat.Id, originalMsg.Chat.Id, int(originalMsg.MessageId), int(threadID))
+	copied, err := th.messageService.CopyMessageToTopicWithResult(ctx, originalMsg.Chat.Id, originalMsg.Chat.Id, int(originalMsg.MessageId), int(threadID))
+	if telegram.IsTopicIDInvalid(err) {
+		// The topic was deleted in Telegram but is still known to us: recreate it and retry once
+		logutils.Warn("HandleTopicSelectionCallback: Topic no longer exists, recreating", "chatID", originalMsg.Chat.Id, "topicName", topicName, "threadID", threadID)
+		threadID, err = th.createTopicForSelection(ctx, originalMsg, topicName)
+		if err != nil {
+			return err
+		}
+		copied, err = th.messageService.CopyMessageToTopicWithResult(ctx, originalMsg.Chat.Id, originalMsg.Chat.Id, int(originalMsg.MessageId), int(threadID))
+	}
 	if err != nil {
 		logutils.Error("HandleTopicSelectionCallback: CopyMessageError", err, "chatID", originalMsg.Chat.Id)
-		_, sendErr := th.messageService.SendMessage(originalMsg.Chat.Id, "❌ Failed to save message to topic.", &gotgbot.SendMessageOpts{
+		_, sendErr := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, topicErrorMessage(err, config.ErrorMessageSaveFailed), &gotgbot.SendMessageOpts{
 			MessageThreadId: originalMsg.MessageThreadId,
 		})
 		if sendErr != nil {
@@ -252,13 +242,24 @@ func (th *TopicHandlers) HandleTopicSelectionCallback(update *gotgbot.Update, or
 		return err
 	}
 
+	savedBy := originalMsg.From
+	if update.CallbackQuery != nil {
+		savedBy = &update.CallbackQuery.From
+	}
+	var savedByID int64
+	if savedBy != nil {
+		savedByID = savedBy.Id
+		th.recordSave(ctx, originalMsg, savedBy.Id, threadID, topicName, copied)
+	}
+	settings := settingsFor(ctx, th.Settings, originalMsg.Chat.Id, savedByID)
+
 	// Mark message as moved
-	th.MarkMessageAsMoved(originalMsg.MessageId)
+	th.MarkMessageAsMoved(ctx, originalMsg.MessageId)
 
 	// Build preview: first 2 lines of the original message
 	previewLines := strings.SplitN(originalMsg.Text, "\n", 3)
 	preview := ""
-	if len(previewLines) > 0 {
+	if previewLines[0] != "" {
 		preview += "\n\"" + previewLines[0] + "\""
 	}
 	if len(previewLines) > 1 {
@@ -267,54 +268,34 @@ func (th *TopicHandlers) HandleTopicSelectionCallback(update *gotgbot.Update, or
 	confirmMsg := config.SuccessMessageSaved + topicName + preview
 
 	// Send confirmation message
-	confirmMsgObj, err := th.messageService.SendMessage(originalMsg.Chat.Id, confirmMsg, &gotgbot.SendMessageOpts{
-		MessageThreadId: originalMsg.MessageThreadId,
-	})
-	if err != nil {
-		logutils.Error("HandleTopicSelectionCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
+	if err := th.confirmSave(ctx, "HandleTopicSelectionCallback", originalMsg.Chat.Id, originalMsg.MessageThreadId, confirmMsg, settings); err != nil {
 		return err
 	}
 
 	// Delete the 'Choose a folder:' message (the keyboard message)
 	if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
-		_ = th.messageService.DeleteMessage(update.CallbackQuery.Message.Chat.Id, int(update.CallbackQuery.Message.MessageId))
+		_ = th.messageService.DeleteMessage(ctx, update.CallbackQuery.Message.Chat.Id, int(update.CallbackQuery.Message.MessageId))
 	}
+	th.state().forgetKeyboard(ctx, originalMsg)
 
 	// Delete the original message after a short delay
-	go func(chatID int64, messageID int) {
-		delay := th.MessageAutoDeleteDelay
-		if delay == 0 {
-			delay = config.DefaultMessageAutoDeleteDelay
-		}
-		time.Sleep(delay)
-		_ = th.messageService.DeleteMessage(chatID, messageID)
-	}(originalMsg.Chat.Id, int(originalMsg.MessageId))
-
-	// Delete the confirmation message after 1 minute
-	go func(chatID int64, messageID int) {
-		delay := th.ConfirmationDeleteDelay
-		if delay == 0 {
-			delay = time.Minute
-		}
-		time.Sleep(delay)
-		_ = th.messageService.DeleteMessage(chatID, messageID)
-	}(confirmMsgObj.Chat.Id, int(confirmMsgObj.MessageId))
+	th.removeOriginal(ctx, originalMsg, settings)
 
 	logutils.Success("HandleTopicSelectionCallback", "topicName", topicName, "chatID", originalMsg.Chat.Id)
 	return nil
 }
 
 // HandleShowAllTopicsCallback handles showing all topics from suggestions
-func (th *TopicHandlers) HandleShowAllTopicsCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (th *TopicHandlers) HandleShowAllTopicsCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if th.HandleShowAllTopicsCallbackFunc != nil {
-		return th.HandleShowAllTopicsCallbackFunc(update, originalMsg)
+		return th.HandleShowAllTopicsCallbackFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleShowAllTopicsCallback", "chatID", originalMsg.Chat.Id)
 
-	topics, err := th.topicService.GetForumTopics(originalMsg.Chat.Id)
+	topics, err := th.topicService.GetForumTopics(ctx, originalMsg.Chat.Id)
 	if err != nil {
 		logutils.Error("HandleShowAllTopicsCallback: GetTopicsError", err, "chatID", originalMsg.Chat.Id)
-		_, sendErr := th.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
+		_, sendErr := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{
 			MessageThreadId: originalMsg.MessageThreadId,
 		})
 		if sendErr != nil {
@@ -324,7 +305,7 @@ func (th *TopicHandlers) HandleShowAllTopicsCallback(update *gotgbot.Update, ori
 	}
 
 	if len(topics) == 0 {
-		_, err = th.messageService.SendMessage(originalMsg.Chat.Id, config.NoTopicsDiscoveredMessage, &gotgbot.SendMessageOpts{
+		_, err = th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.NoTopicsDiscoveredMessage, &gotgbot.SendMessageOpts{
 			MessageThreadId: originalMsg.MessageThreadId,
 		})
 		if err != nil {
@@ -333,68 +314,35 @@ func (th *TopicHandlers) HandleShowAllTopicsCallback(update *gotgbot.Update, ori
 		}
 	} else {
 		// Build keyboard with all existing topics
-		keyboard, err := th.keyboardBuilder.BuildAllTopicsKeyboard(originalMsg, topics)
+		keyboard, err := th.keyboards().BuildAllTopicsKeyboard(ctx, originalMsg, topics)
 		if err != nil {
 			logutils.Error("HandleShowAllTopicsCallback: BuildKeyboardError", err, "chatID", originalMsg.Chat.Id)
 			return err
 		}
 
-		// Store message references for all topic buttons
-		for _, topic := range topics {
-			topicCallbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-			th.MessageStore[topicCallbackData] = originalMsg
-		}
-
-		backCallbackData := config.CallbackPrefixBackToSuggestions + strconv.FormatInt(originalMsg.MessageId, 10)
-		th.MessageStore[backCallbackData] = originalMsg
+		th.state().rememberMessage(ctx, originalMsg)
 
 		// Try to update existing message or send new one
-		callbackData := "suggestions_" + strconv.FormatInt(originalMsg.MessageId, 10)
-		if keyboardMsgId, exists := th.KeyboardMessageStore[callbackData]; exists {
-			_, err = th.messageService.EditMessageText(originalMsg.Chat.Id, int64(keyboardMsgId), config.ChooseFromAllTopicsMessage, &gotgbot.EditMessageTextOpts{
+		if keyboardMsgId, exists := th.state().keyboard(ctx, originalMsg); exists {
+			_, err = th.messageService.EditMessageText(ctx, originalMsg.Chat.Id, int64(keyboardMsgId), config.ChooseFromAllTopicsMessage, &gotgbot.EditMessageTextOpts{
 				ReplyMarkup: *keyboard,
 			})
-			if err != nil {
-				logutils.Error("HandleShowAllTopicsCallback: EditMessageTextError", err, "chatID", originalMsg.Chat.Id)
-				// If update fails, send new message
-				newMsg, err := th.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFromAllTopicsMessage, &gotgbot.SendMessageOpts{
-					MessageThreadId: originalMsg.MessageThreadId,
-					ReplyMarkup:     *keyboard,
-				})
-				if err != nil {
-					logutils.Error("HandleShowAllTopicsCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-				} else {
-					// Store keyboard message ID for all topic buttons
-					for _, topic := range topics {
-						topicCallbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-						th.KeyboardMessageStore[topicCallbackData] = int(newMsg.MessageId)
-					}
-					th.KeyboardMessageStore[backCallbackData] = int(newMsg.MessageId)
-				}
-			} else {
-				// Store keyboard message ID for all topic buttons
-				for _, topic := range topics {
-					topicCallbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-					th.KeyboardMessageStore[topicCallbackData] = keyboardMsgId
-				}
-				th.KeyboardMessageStore[backCallbackData] = keyboardMsgId
+			if err = ignoreMessageNotModified(err); err == nil {
+				logutils.Success("HandleShowAllTopicsCallback", "chatID", originalMsg.Chat.Id)
+				return nil
 			}
+			logutils.Error("HandleShowAllTopicsCallback: EditMessageTextError", err, "chatID", originalMsg.Chat.Id)
+		}
+
+		// Send new message with all topics
+		newMsg, err := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ChooseFromAllTopicsMessage, &gotgbot.SendMessageOpts{
+			MessageThreadId: originalMsg.MessageThreadId,
+			ReplyMarkup:     *keyboard,
+		})
+		if err != nil {
+			logutils.Error("HandleShowAllTopicsCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
 		} else {
-			// Send new message with all topics
-			newMsg, err := th.messageService.SendMessage(originalMsg.Chat.Id, config.ChooseFromAllTopicsMessage, &gotgbot.SendMessageOpts{
-				MessageThreadId: originalMsg.MessageThreadId,
-				ReplyMarkup:     *keyboard,
-			})
-			if err != nil {
-				logutils.Error("HandleShowAllTopicsCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
-			} else {
-				// Store keyboard message ID for all topic buttons
-				for _, topic := range topics {
-					topicCallbackData := topic.Name + "_" + strconv.FormatInt(originalMsg.MessageId, 10)
-					th.KeyboardMessageStore[topicCallbackData] = int(newMsg.MessageId)
-				}
-				th.KeyboardMessageStore[backCallbackData] = int(newMsg.MessageId)
-			}
+			th.state().rememberKeyboard(ctx, originalMsg, int(newMsg.MessageId))
 		}
 	}
 
@@ -403,42 +351,44 @@ func (th *TopicHandlers) HandleShowAllTopicsCallback(update *gotgbot.Update, ori
 }
 
 // HandleCreateTopicMenuCallback handles the create topic menu callback
-func (th *TopicHandlers) HandleCreateTopicMenuCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (th *TopicHandlers) HandleCreateTopicMenuCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if th.HandleCreateTopicMenuCallbackFunc != nil {
-		return th.HandleCreateTopicMenuCallbackFunc(update, originalMsg)
+		return th.HandleCreateTopicMenuCallbackFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleCreateTopicMenuCallback", "chatID", originalMsg.Chat.Id)
 
-	_, err := th.messageService.SendMessage(originalMsg.Chat.Id, config.TopicCreationMenuMessage, &gotgbot.SendMessageOpts{
-		ParseMode: "Markdown",
+	// Nothing to save here: the topic is just created once the name arrives
+	key := conversation.Key{ChatID: originalMsg.Chat.Id, UserID: originalMsg.From.Id}
+	err := th.startTopicNamePrompt(ctx, key, originalMsg, config.TopicCreationMenuMessage, &gotgbot.SendMessageOpts{
+		ParseMode:       "Markdown",
+		MessageThreadId: originalMsg.MessageThreadId,
+	}, pendingTopicName{
+		Creation: TopicCreationContext{
+			ChatId:        originalMsg.Chat.Id,
+			ThreadId:      int64(originalMsg.MessageThreadId),
+			OriginalMsgId: int64(originalMsg.MessageId),
+		},
 	})
 	if err != nil {
 		logutils.Error("HandleCreateTopicMenuCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
 		return err
 	}
 
-	// Set flag to wait for topic name
-	th.WaitingForTopicName[originalMsg.From.Id] = TopicCreationContext{
-		ChatId:        originalMsg.Chat.Id,
-		ThreadId:      int64(originalMsg.MessageThreadId),
-		OriginalMsgId: int64(originalMsg.MessageId),
-	}
-
 	logutils.Success("HandleCreateTopicMenuCallback", "chatID", originalMsg.Chat.Id)
 	return nil
 }
 
 // HandleShowAllTopicsMenuCallback handles the show all topics menu callback
-func (th *TopicHandlers) HandleShowAllTopicsMenuCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+func (th *TopicHandlers) HandleShowAllTopicsMenuCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
 	if th.HandleShowAllTopicsMenuCallbackFunc != nil {
-		return th.HandleShowAllTopicsMenuCallbackFunc(update, originalMsg)
+		return th.HandleShowAllTopicsMenuCallbackFunc(ctx, update, originalMsg)
 	}
 	logutils.Info("HandleShowAllTopicsMenuCallback", "chatID", originalMsg.Chat.Id)
 
-	topics, err := th.topicService.GetForumTopics(originalMsg.Chat.Id)
+	topics, err := th.topicService.GetForumTopics(ctx, originalMsg.Chat.Id)
 	if err != nil {
 		logutils.Error("HandleShowAllTopicsMenuCallback: GetTopicsError", err, "chatID", originalMsg.Chat.Id)
-		_, sendErr := th.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{})
+		_, sendErr := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageFailed, &gotgbot.SendMessageOpts{})
 		if sendErr != nil {
 			logutils.Error("HandleShowAllTopicsMenuCallback: SendMessageError", sendErr, "chatID", originalMsg.Chat.Id)
 		}
@@ -446,7 +396,7 @@ func (th *TopicHandlers) HandleShowAllTopicsMenuCallback(update *gotgbot.Update,
 	}
 
 	if len(topics) == 0 {
-		_, err = th.messageService.SendMessage(originalMsg.Chat.Id, config.ErrorMessageNoTopics, &gotgbot.SendMessageOpts{})
+		_, err = th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.ErrorMessageNoTopics, &gotgbot.SendMessageOpts{})
 		if err != nil {
 			logutils.Error("HandleShowAllTopicsMenuCallback: SendMessageError", err, "chatID", originalMsg.Chat.Id)
 			return err
@@ -456,7 +406,7 @@ func (th *TopicHandlers) HandleShowAllTopicsMenuCallback(update *gotgbot.Update,
 		for _, topic := range topics {
 			topicList += "• " + topic.Name + "\n"
 		}
-		_, err = th.messageService.SendMessage(originalMsg.Chat.Id, topicList, &gotgbot.SendMessageOpts{
+		_, err = th.messageService.SendMessage(ctx, originalMsg.Chat.Id, topicList, &gotgbot.SendMessageOpts{
 			ParseMode: "Markdown",
 		})
 		if err != nil {
@@ -469,31 +419,115 @@ func (th *TopicHandlers) HandleShowAllTopicsMenuCallback(update *gotgbot.Update,
 	return nil
 }
 
-// GetMessageByCallbackData retrieves the original message associated with a callback data.
-func (th *TopicHandlers) GetMessageByCallbackData(callbackData string) *gotgbot.Message {
-	return th.MessageStore[callbackData]
+// GetOriginalMessage retrieves the message that buttons shown for it act on.
+func (th *TopicHandlers) GetOriginalMessage(ctx context.Context, chatID, messageID int64) *gotgbot.Message {
+	return th.state().message(ctx, chatID, messageID)
 }
 
-// IsWaitingForTopicName checks if a user is in the process of creating a new topic.
-func (th *TopicHandlers) IsWaitingForTopicName(userID int64) bool {
-	_, exists := th.WaitingForTopicName[userID]
-	return exists
+// Helper methods
+
+// createTopicForSelection creates a topic for a selected suggestion and posts its name as the first message.
+// On failure the user is told why and the error is returned.
+func (th *TopicHandlers) createTopicForSelection(ctx context.Context, originalMsg *gotgbot.Message, topicName string) (int64, error) {
+	threadID, err := th.topicService.CreateForumTopic(ctx, originalMsg.Chat.Id, topicName)
+	if err != nil || threadID == 0 {
+		logutils.Error("createTopicForSelection: CreateTopicError", err, "chatID", originalMsg.Chat.Id, "topicName", topicName)
+		_, sendErr := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, topicErrorMessage(err, config.ErrorMessageCreateFailed), &gotgbot.SendMessageOpts{
+			MessageThreadId: originalMsg.MessageThreadId,
+		})
+		if sendErr != nil {
+			logutils.Error("createTopicForSelection: SendMessageError", sendErr, "chatID", originalMsg.Chat.Id)
+		}
+		if err == nil {
+			err = fmt.Errorf("createForumTopic returned no thread ID for %q", topicName)
+		}
+		return 0, err
+	}
+	// Send topic name as first message in new topic (like in HandleTopicNameEntry)
+	_, _ = th.messageService.SendMessage(ctx, originalMsg.Chat.Id, topicName, &gotgbot.SendMessageOpts{
+		MessageThreadId: threadID,
+	})
+	return threadID, nil
 }
 
-// Helper methods
-func (th *TopicHandlers) cleanupTopicCreation(userID int64) {
-	delete(th.WaitingForTopicName, userID)
-	delete(th.OriginalMessageStore, userID)
+// recordSave adds a successful save to the saved-message index. A failure is logged
+// only: the message is already in its topic.
+func (th *TopicHandlers) recordSave(ctx context.Context, originalMsg *gotgbot.Message, savedBy int64, threadID int64, topicName string, copied *gotgbot.Message) {
+	if th.SavedMessages == nil {
+		return
+	}
+	var savedMessageID int64
+	if copied != nil {
+		savedMessageID = copied.MessageId
+	}
+	if err := th.SavedMessages.RecordSave(ctx, originalMsg, savedBy, threadID, topicName, savedMessageID); err != nil {
+		logutils.Error("recordSave: RecordSaveError", err, "chatID", originalMsg.Chat.Id, "messageID", originalMsg.MessageId)
+	}
 }
 
-func (th *TopicHandlers) IsRecentlyMovedMessage(messageID int64) bool {
-	return th.RecentlyMovedMessages[messageID]
+func (th *TopicHandlers) IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool {
+	return th.state().isMoved(ctx, messageID)
 }
 
-func (th *TopicHandlers) MarkMessageAsMoved(messageID int64) {
-	th.RecentlyMovedMessages[messageID] = true
+func (th *TopicHandlers) MarkMessageAsMoved(ctx context.Context, messageID int64) {
+	th.state().markMoved(ctx, messageID)
+}
+
+func (th *TopicHandlers) CleanupMovedMessage(ctx context.Context, messageID int64) {
+	th.state().clearMoved(ctx, messageID)
+}
+
+func (th *TopicHandlers) state() interactionState {
+	return interactionState{store: th.State}
+}
+
+func (th *TopicHandlers) keyboards() *KeyboardBuilder {
+	return NewKeyboardBuilder(th.Callbacks)
+}
+
+// confirmSave tells the user where their message went, unless their settings turn
+// confirmations off, and removes the notice later if they are timed
+func (th *TopicHandlers) confirmSave(ctx context.Context, caller string, chatID int64, threadID int64, text string, settings interfaces.UserSettings) error {
+	if settings.ConfirmationStyle == interfaces.ConfirmationOff {
+		return nil
+	}
+	confirmMsg, err := th.messageService.SendMessage(ctx, chatID, text, &gotgbot.SendMessageOpts{
+		MessageThreadId: threadID,
+	})
+	if err != nil {
+		logutils.Error(caller+": SendMessageError", err, "chatID", chatID)
+		return err
+	}
+	if settings.ConfirmationStyle == interfaces.ConfirmationTimed {
+		th.deleteLater(ctx, confirmMsg.Chat.Id, int(confirmMsg.MessageId), th.confirmationDeleteDelay(settings))
+	}
+	return nil
+}
+
+// removeOriginal deletes a saved message from General once the user's delay has passed,
+// unless they turned auto-delete off
+func (th *TopicHandlers) removeOriginal(ctx context.Context, originalMsg *gotgbot.Message, settings interfaces.UserSettings) {
+	if !settings.AutoDelete {
+		return
+	}
+	th.deleteLater(ctx, originalMsg.Chat.Id, int(originalMsg.MessageId), th.messageAutoDeleteDelay(settings))
+}
+
+func (th *TopicHandlers) messageAutoDeleteDelay(settings interfaces.UserSettings) time.Duration {
+	if th.MessageAutoDeleteDelay == 0 {
+		return settings.AutoDeleteDelay
+	}
+	return th.MessageAutoDeleteDelay
+}
+
+func (th *TopicHandlers) confirmationDeleteDelay(settings interfaces.UserSettings) time.Duration {
+	if th.ConfirmationDeleteDelay == 0 {
+		return settings.ConfirmationDelay
+	}
+	return th.ConfirmationDeleteDelay
 }
 
-func (th *TopicHandlers) CleanupMovedMessage(messageID int64) {
-	delete(th.RecentlyMovedMessages, messageID)
+// deleteLater removes a message after delay
+func (th *TopicHandlers) deleteLater(ctx context.Context, chatID int64, messageID int, delay time.Duration) {
+	deleteLater(ctx, th.Deletions, th.Tracker, th.messageService, chatID, int64(messageID), delay)
 }
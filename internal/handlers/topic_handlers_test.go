@@ -1,12 +1,17 @@
 package handlers_test
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	mocks "save-message/internal/mocks/handlers"
+	"save-message/internal/telegram"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
@@ -32,20 +37,20 @@ type TopicHandlers struct {
 	recentlyMovedMessages map[int64]bool
 	keyboardBuilder       interface{} // not used in test
 
-	HandleNewTopicCreationRequestFunc   func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicSelectionCallbackFunc    func(update *gotgbot.Update, originalMsg *gotgbot.Message, callbackData string) error
-	HandleShowAllTopicsCallbackFunc     func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleCreateTopicMenuCallbackFunc   func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleShowAllTopicsMenuCallbackFunc func(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicNameEntryFunc            func(update *gotgbot.Update) error
+	HandleNewTopicCreationRequestFunc   func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicSelectionCallbackFunc    func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message, topicName string) error
+	HandleShowAllTopicsCallbackFunc     func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleCreateTopicMenuCallbackFunc   func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleShowAllTopicsMenuCallbackFunc func(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicNameEntryFunc            func(ctx context.Context, update *gotgbot.Update) error
 
 	confirmCalled *bool
 	copyCalled    *bool
 	errorMsgSent  *string
 }
 
-func (th *TopicHandlers) HandleNewTopicCreationRequest(update *gotgbot.Update, originalMsg *gotgbot.Message) error {
-	_, err := th.messageService.SendMessage(originalMsg.Chat.Id, config.TopicNamePrompt, &gotgbot.SendMessageOpts{})
+func (th *TopicHandlers) HandleNewTopicCreationRequest(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error {
+	_, err := th.messageService.SendMessage(ctx, originalMsg.Chat.Id, config.TopicNamePrompt, &gotgbot.SendMessageOpts{})
 	if err != nil {
 		return err
 	}
@@ -56,23 +61,23 @@ func (th *TopicHandlers) HandleNewTopicCreationRequest(update *gotgbot.Update, o
 	}
 	th.originalMessageStore[update.CallbackQuery.From.Id] = originalMsg
 	if keyboardMsgId, exists := th.keyboardMessageStore[update.CallbackQuery.Data]; exists {
-		th.messageService.DeleteMessage(originalMsg.Chat.Id, keyboardMsgId)
+		th.messageService.DeleteMessage(ctx, originalMsg.Chat.Id, keyboardMsgId)
 		delete(th.keyboardMessageStore, update.CallbackQuery.Data)
 	}
 	return nil
 }
 
-func (th *TopicHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
-	ctx := th.WaitingForTopicName[update.Message.From.Id]
+func (th *TopicHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
+	creation := th.WaitingForTopicName[update.Message.From.Id]
 	topicName := update.Message.Text
 	if topicName == "" || len(topicName) == 0 || len(topicName) == len([]rune(topicName)) && topicName[0] == ' ' {
 		if th.messageService != nil {
-			th.messageService.SendMessage(ctx.ChatId, config.TopicNameEmptyError, &gotgbot.SendMessageOpts{})
+			th.messageService.SendMessage(ctx, creation.ChatId, config.TopicNameEmptyError, &gotgbot.SendMessageOpts{})
 		}
 		delete(th.WaitingForTopicName, update.Message.From.Id)
 		return nil
 	}
-	topics, err := th.topicService.GetForumTopics(ctx.ChatId)
+	topics, err := th.topicService.GetForumTopics(ctx, creation.ChatId)
 	if err == nil {
 		exists := false
 		for _, topic := range topics {
@@ -83,16 +88,16 @@ func (th *TopicHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
 		}
 		if exists {
 			if th.messageService != nil {
-				th.messageService.SendMessage(ctx.ChatId, config.TopicNameExistsError, &gotgbot.SendMessageOpts{})
+				th.messageService.SendMessage(ctx, creation.ChatId, config.TopicNameExistsError, &gotgbot.SendMessageOpts{})
 			}
 			delete(th.WaitingForTopicName, update.Message.From.Id)
 			return nil
 		}
 	}
-	_, err = th.topicService.CreateForumTopic(ctx.ChatId, topicName)
+	_, err = th.topicService.CreateForumTopic(ctx, creation.ChatId, topicName)
 	if err != nil {
 		if th.messageService != nil {
-			th.messageService.SendMessage(ctx.ChatId, config.ErrorMessageCreateFailed, &gotgbot.SendMessageOpts{})
+			th.messageService.SendMessage(ctx, creation.ChatId, config.ErrorMessageCreateFailed, &gotgbot.SendMessageOpts{})
 		}
 		delete(th.WaitingForTopicName, update.Message.From.Id)
 		return err
@@ -100,8 +105,8 @@ func (th *TopicHandlers) HandleTopicNameEntry(update *gotgbot.Update) error {
 	if th.originalMessageStore != nil {
 		if origMsg, ok := th.originalMessageStore[update.Message.From.Id]; ok {
 			if th.messageService != nil {
-				th.messageService.CopyMessageToTopicWithResult(ctx.ChatId, origMsg.Chat.Id, int(origMsg.MessageId), 999)
-				th.messageService.SendMessage(ctx.ChatId, "confirm", &gotgbot.SendMessageOpts{})
+				th.messageService.CopyMessageToTopicWithResult(ctx, creation.ChatId, origMsg.Chat.Id, int(origMsg.MessageId), 999)
+				th.messageService.SendMessage(ctx, creation.ChatId, "confirm", &gotgbot.SendMessageOpts{})
 			}
 		}
 	}
@@ -124,81 +129,100 @@ func NewTopicHandlers(messageService interfaces.MessageServiceInterface, topicSe
 
 // Local copy of MockMessageService for test visibility
 type MockMessageService struct {
-	SendMessageFunc                  func(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error)
-	DeleteMessageFunc                func(chatID int64, messageID int) error
-	CopyMessageToTopicFunc           func(chatID int64, fromChatID int64, messageID int, messageThreadID int) error
-	CopyMessageToTopicWithResultFunc func(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error)
-	EditMessageTextFunc              func(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error)
-	AnswerCallbackQueryFunc          func(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error
+	SendMessageFunc                  func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error)
+	DeleteMessageFunc                func(ctx context.Context, chatID int64, messageID int) error
+	CopyMessageToTopicFunc           func(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error
+	CopyMessageToTopicWithResultFunc func(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error)
+	EditMessageTextFunc              func(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error)
+	AnswerCallbackQueryFunc          func(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error
 }
 
-func (m *MockMessageService) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (m *MockMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	if m.SendMessageFunc != nil {
-		return m.SendMessageFunc(chatID, text, opts)
+		return m.SendMessageFunc(ctx, chatID, text, opts)
 	}
 	return nil, nil
 }
-func (m *MockMessageService) DeleteMessage(chatID int64, messageID int) error {
+func (m *MockMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	if m.DeleteMessageFunc != nil {
-		return m.DeleteMessageFunc(chatID, messageID)
+		return m.DeleteMessageFunc(ctx, chatID, messageID)
 	}
 	return nil
 }
-func (m *MockMessageService) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+func (m *MockMessageService) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
 	return nil
 }
-func (m *MockMessageService) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (m *MockMessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+	if m.CopyMessageToTopicWithResultFunc != nil {
+		return m.CopyMessageToTopicWithResultFunc(ctx, chatID, fromChatID, messageID, messageThreadID)
+	}
 	return nil, nil
 }
-func (m *MockMessageService) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (m *MockMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+	if m.EditMessageTextFunc != nil {
+		return m.EditMessageTextFunc(ctx, chatID, messageID, text, opts)
+	}
 	return nil, nil
 }
-func (m *MockMessageService) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (m *MockMessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	return nil
 }
 
 // Local copy of MockTopicService for test visibility
 type MockTopicService struct {
-	GetForumTopicsFunc   func(chatID int64) ([]interfaces.ForumTopic, error)
-	CreateForumTopicFunc func(chatID int64, name string) (int64, error)
-	TopicExistsFunc      func(chatID int64, name string) (bool, error)
-	FindTopicByNameFunc  func(chatID int64, name string) (int64, error)
+	interfaces.TopicServiceInterface // topic management is not used by topic handlers
+
+	GetForumTopicsFunc   func(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error)
+	CreateForumTopicFunc func(ctx context.Context, chatID int64, name string) (int64, error)
+	TopicExistsFunc      func(ctx context.Context, chatID int64, name string) (bool, error)
+	FindTopicByNameFunc  func(ctx context.Context, chatID int64, name string) (int64, error)
 }
 
-func (m *MockTopicService) GetForumTopics(chatID int64) ([]interfaces.ForumTopic, error) {
+func (m *MockTopicService) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
 	if m.GetForumTopicsFunc != nil {
-		return m.GetForumTopicsFunc(chatID)
+		return m.GetForumTopicsFunc(ctx, chatID)
 	}
 	return nil, nil
 }
-func (m *MockTopicService) CreateForumTopic(chatID int64, name string) (int64, error) { return 0, nil }
-func (m *MockTopicService) TopicExists(chatID int64, name string) (bool, error)       { return false, nil }
-func (m *MockTopicService) FindTopicByName(chatID int64, name string) (int64, error)  { return 0, nil }
+func (m *MockTopicService) CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error) {
+	if m.CreateForumTopicFunc != nil {
+		return m.CreateForumTopicFunc(ctx, chatID, name)
+	}
+	return 0, nil
+}
+func (m *MockTopicService) TopicExists(ctx context.Context, chatID int64, name string) (bool, error) {
+	return false, nil
+}
+func (m *MockTopicService) FindTopicByName(ctx context.Context, chatID int64, name string) (int64, error) {
+	if m.FindTopicByNameFunc != nil {
+		return m.FindTopicByNameFunc(ctx, chatID, name)
+	}
+	return 0, nil
+}
 
 func TestHandleNewTopicCreationRequest(t *testing.T) {
 	originalMsg := &gotgbot.Message{MessageId: 123, Chat: gotgbot.Chat{Id: 789}}
 	update := &gotgbot.Update{
 		CallbackQuery: &gotgbot.CallbackQuery{
 			From: gotgbot.User{Id: 555},
-			Data: "create_new_folder_123",
 		},
 	}
 
 	t.Run("success", func(t *testing.T) {
 		mockMsgSvc := &MockMessageService{
-			SendMessageFunc: func(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+			SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 				assert.Equal(t, int64(789), chatID)
 				assert.Equal(t, config.TopicNamePrompt, text)
 				return nil, nil
 			},
-			DeleteMessageFunc: func(chatID int64, messageID int) error {
+			DeleteMessageFunc: func(ctx context.Context, chatID int64, messageID int) error {
 				return nil
 			},
 		}
 		handlers := NewTopicHandlers(mockMsgSvc, nil)
 		handlers.keyboardMessageStore[update.CallbackQuery.Data] = 999 // Simulate a stored keyboard message
 
-		err := handlers.HandleNewTopicCreationRequest(update, originalMsg)
+		err := handlers.HandleNewTopicCreationRequest(context.Background(), update, originalMsg)
 
 		assert.NoError(t, err)
 		// Assert that the user's state was correctly stored
@@ -209,12 +233,12 @@ func TestHandleNewTopicCreationRequest(t *testing.T) {
 
 	t.Run("send message fails", func(t *testing.T) {
 		mockMsgSvc := &MockMessageService{
-			SendMessageFunc: func(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+			SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 				return nil, errors.New("send error")
 			},
 		}
 		handlers := NewTopicHandlers(mockMsgSvc, nil)
-		err := handlers.HandleNewTopicCreationRequest(update, originalMsg)
+		err := handlers.HandleNewTopicCreationRequest(context.Background(), update, originalMsg)
 		assert.Error(t, err)
 	})
 }
@@ -271,7 +295,7 @@ func TestHandleTopicNameEntry(t *testing.T) {
 			expectCopyCall:    false,
 			expectConfirmCall: false,
 			expectErrorMsg:    config.ErrorMessageCreateFailed,
-			wantErr:           false,
+			wantErr:           true, // Create errors are returned to the caller
 		},
 	}
 
@@ -285,7 +309,7 @@ func TestHandleTopicNameEntry(t *testing.T) {
 			errorMsgSent := ""
 
 			mockMsgSvc := &MockMessageService{
-				SendMessageFunc: func(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+				SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 					if text == config.TopicNameEmptyError || text == config.TopicNameExistsError {
 						errorMsgSent = text
 					}
@@ -297,21 +321,21 @@ func TestHandleTopicNameEntry(t *testing.T) {
 					}
 					return &gotgbot.Message{}, nil
 				},
-				CopyMessageToTopicWithResultFunc: func(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+				CopyMessageToTopicWithResultFunc: func(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 					if tt.expectCopyCall {
 						copyCalled = true
 					}
 					return &gotgbot.Message{}, tt.copyMessageErr
 				},
-				DeleteMessageFunc: func(chatID int64, messageID int) error {
+				DeleteMessageFunc: func(ctx context.Context, chatID int64, messageID int) error {
 					return nil
 				},
 			}
 			mockTopicSvc := &MockTopicService{
-				GetForumTopicsFunc: func(chatID int64) ([]interfaces.ForumTopic, error) {
+				GetForumTopicsFunc: func(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
 					return tt.getTopicsResult, tt.getTopicsErr
 				},
-				CreateForumTopicFunc: func(chatID int64, name string) (int64, error) {
+				CreateForumTopicFunc: func(ctx context.Context, chatID int64, name string) (int64, error) {
 					return 999, tt.createTopicErr
 				},
 			}
@@ -323,7 +347,7 @@ func TestHandleTopicNameEntry(t *testing.T) {
 			// handlers.copyCalled = &copyCalled // Removed as per edit hint
 			// handlers.errorMsgSent = &errorMsgSent // Removed as per edit hint
 
-			err := handlers.HandleTopicNameEntry(update)
+			err := handlers.HandleTopicNameEntry(context.Background(), update)
 
 			if tt.name == "full success" {
 				confirmCalled = true
@@ -347,10 +371,11 @@ func TestHandleTopicNameEntry(t *testing.T) {
 
 func TestHandleTopicSelectionCallback_DeletesKeyboardAndConfirmation(t *testing.T) {
 	// Regression test: After moving a message, the folder selection and confirmation messages are deleted as expected.
+	var mu sync.Mutex // delayed deletions run concurrently
 	var deleted []int
 	var sent []string
 	mockMsgSvc := &MockMessageService{
-		SendMessageFunc: func(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+		SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 			sent = append(sent, text)
 			// Simulate confirmation message
 			if text == "✅ Message saved to topic: Desserts\n\"Cake\"" {
@@ -358,16 +383,18 @@ func TestHandleTopicSelectionCallback_DeletesKeyboardAndConfirmation(t *testing.
 			}
 			return &gotgbot.Message{MessageId: 999, Chat: gotgbot.Chat{Id: chatID}}, nil
 		},
-		DeleteMessageFunc: func(chatID int64, messageID int) error {
+		DeleteMessageFunc: func(ctx context.Context, chatID int64, messageID int) error {
+			mu.Lock()
+			defer mu.Unlock()
 			deleted = append(deleted, messageID)
 			return nil
 		},
-		CopyMessageToTopicWithResultFunc: func(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+		CopyMessageToTopicWithResultFunc: func(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 			return &gotgbot.Message{MessageId: 1234, Chat: gotgbot.Chat{Id: chatID}}, nil
 		},
 	}
 	mockTopicSvc := &MockTopicService{
-		FindTopicByNameFunc: func(chatID int64, name string) (int64, error) {
+		FindTopicByNameFunc: func(ctx context.Context, chatID int64, name string) (int64, error) {
 			return 42, nil // Simulate topic exists
 		},
 	}
@@ -375,24 +402,24 @@ func TestHandleTopicSelectionCallback_DeletesKeyboardAndConfirmation(t *testing.
 	realhandlers := realhandlers.NewTopicHandlers(mockMsgSvc, mockTopicSvc)
 	realhandlers.MessageAutoDeleteDelay = 10 * time.Millisecond
 	realhandlers.ConfirmationDeleteDelay = 10 * time.Millisecond
+	realhandlers.Tracker = lifecycle.NewTracker()
 
 	// Simulate the callback update and original message
 	update := &gotgbot.Update{
 		CallbackQuery: &gotgbot.CallbackQuery{
 			From:    gotgbot.User{Id: 1},
-			Data:    "Desserts_1043",
+			Data:    "t:desserts",
 			Message: &gotgbot.Message{MessageId: 1044, Chat: gotgbot.Chat{Id: 789}}, // keyboard message
 		},
 	}
 	originalMsg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, Text: "Cake"}
-	realhandlers.MessageStore["Desserts_1043"] = originalMsg
 
 	// Call the handler
-	err := realhandlers.HandleTopicSelectionCallback(update, originalMsg, "Desserts_1043")
+	err := realhandlers.HandleTopicSelectionCallback(context.Background(), update, originalMsg, "Desserts")
 	assert.NoError(t, err)
 
-	// Wait for async deletions to occur
-	time.Sleep(50 * time.Millisecond)
+	// Wait for the delayed deletions to run
+	assert.NoError(t, realhandlers.Tracker.Shutdown(time.Second))
 
 	// The keyboard message should be deleted
 	assert.Contains(t, deleted, 1044, "Should delete the 'Choose a folder:' message")
@@ -409,3 +436,109 @@ func TestHandleTopicSelectionCallback_DeletesKeyboardAndConfirmation(t *testing.
 	}
 	assert.True(t, found, "Should send confirmation message")
 }
+
+func TestHandleTopicSelectionCallback_TelegramErrors(t *testing.T) {
+	rightsErr := &telegram.TelegramError{Method: "createForumTopic", ErrorCode: 400, Description: "Bad Request: not enough rights to create a topic"}
+	topicInvalidErr := &telegram.TelegramError{Method: "copyMessage", ErrorCode: 400, Description: "Bad Request: TOPIC_ID_INVALID"}
+
+	tests := []struct {
+		name          string
+		findErr       error
+		createErr     error
+		copyErrs      []error // returned by successive copy calls
+		wantErr       bool
+		wantCopyTo    []int
+		wantCreate    int
+		wantErrorText string
+		wantSavedTo   []int64 // thread IDs recorded in the saved-message index
+	}{
+		{
+			name:        "topic not found creates it",
+			findErr:     interfaces.ErrTopicNotFound,
+			wantCopyTo:  []int{77},
+			wantCreate:  1,
+			wantSavedTo: []int64{77},
+		},
+		{
+			name:        "deleted topic is recreated and copy retried",
+			copyErrs:    []error{topicInvalidErr, nil},
+			wantCopyTo:  []int{42, 77},
+			wantCreate:  1,
+			wantSavedTo: []int64{77},
+		},
+		{
+			name:          "missing rights tells the user to promote the bot",
+			findErr:       interfaces.ErrTopicNotFound,
+			createErr:     rightsErr,
+			wantErr:       true,
+			wantCreate:    1,
+			wantErrorText: config.ErrorMessageNotEnoughRights,
+		},
+		{
+			name:          "other find errors report message not found",
+			findErr:       errors.New("db down"),
+			wantErr:       true,
+			wantErrorText: config.ErrorMessageNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var copiedTo []int
+			var sent []string
+			createCalls := 0
+			mockMsgSvc := &MockMessageService{
+				SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+					sent = append(sent, text)
+					return &gotgbot.Message{MessageId: 999, Chat: gotgbot.Chat{Id: chatID}}, nil
+				},
+				CopyMessageToTopicWithResultFunc: func(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+					copiedTo = append(copiedTo, messageThreadID)
+					if len(copiedTo) <= len(tt.copyErrs) && tt.copyErrs[len(copiedTo)-1] != nil {
+						return nil, tt.copyErrs[len(copiedTo)-1]
+					}
+					return &gotgbot.Message{MessageId: 1234, Chat: gotgbot.Chat{Id: chatID}}, nil
+				},
+			}
+			mockTopicSvc := &MockTopicService{
+				FindTopicByNameFunc: func(ctx context.Context, chatID int64, name string) (int64, error) {
+					if tt.findErr != nil {
+						return 0, tt.findErr
+					}
+					return 42, nil
+				},
+				CreateForumTopicFunc: func(ctx context.Context, chatID int64, name string) (int64, error) {
+					createCalls++
+					if tt.createErr != nil {
+						return 0, tt.createErr
+					}
+					return 77, nil
+				},
+			}
+
+			handlers := realhandlers.NewTopicHandlers(mockMsgSvc, mockTopicSvc)
+			handlers.MessageAutoDeleteDelay = time.Millisecond
+			handlers.ConfirmationDeleteDelay = time.Millisecond
+			savedIndex := &mocks.MockSavedMessageIndex{}
+			handlers.SavedMessages = savedIndex
+			update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{From: gotgbot.User{Id: 1}}}
+			originalMsg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, Text: "Cake"}
+
+			err := handlers.HandleTopicSelectionCallback(context.Background(), update, originalMsg, "Desserts")
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCopyTo, copiedTo)
+			assert.Equal(t, tt.wantCreate, createCalls)
+			var savedTo []int64
+			for _, save := range savedIndex.Saves() {
+				assert.Equal(t, mocks.RecordedSave{ChatID: 789, OriginalMessageID: 1043, SavedBy: 1, ThreadID: save.ThreadID,
+					TopicName: "Desserts", SavedMessageID: 1234}, save)
+				savedTo = append(savedTo, save.ThreadID)
+			}
+			assert.Equal(t, tt.wantSavedTo, savedTo)
+			if tt.wantErrorText != "" {
+				assert.Contains(t, sent, tt.wantErrorText)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+	"save-message/internal/state"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TopicManagementHandlers renames, closes, reopens, deletes and merges existing topics.
+// Only the chat's owner and admins who may manage topics can use them.
+type TopicManagementHandlers struct {
+	messageService interfaces.MessageServiceInterface
+	topicService   interfaces.TopicServiceInterface
+	savedMessages  interfaces.SavedMessageIndexInterface
+
+	// Callbacks issues the tokens behind the delete confirmation buttons
+	Callbacks interfaces.CallbackRegistryInterface
+	// Tracker runs merges, which copy in the background, so shutdown waits for them
+	Tracker *lifecycle.Tracker
+
+	mu      sync.Mutex
+	merging map[topicKey]bool // topics merged from or into by the merges running now
+}
+
+// topicKey identifies a topic across chats
+type topicKey struct {
+	chatID   int64
+	threadID int64
+}
+
+var _ interfaces.TopicManagementHandlersInterface = (*TopicManagementHandlers)(nil)
+
+// NewTopicManagementHandlers creates a new topic management handlers instance
+func NewTopicManagementHandlers(messageService interfaces.MessageServiceInterface, topicService interfaces.TopicServiceInterface, savedMessages interfaces.SavedMessageIndexInterface) *TopicManagementHandlers {
+	return &TopicManagementHandlers{
+		messageService: messageService,
+		topicService:   topicService,
+		savedMessages:  savedMessages,
+		Callbacks:      callbacks.NewRegistry(state.NewMemoryStore()),
+		merging:        make(map[topicKey]bool),
+	}
+}
+
+// HandleTopicCommand handles /renametopic, /closetopic, /reopentopic, /deletetopic and /mergetopic
+func (tm *TopicManagementHandlers) HandleTopicCommand(ctx context.Context, update *gotgbot.Update) error {
+	msg := update.Message
+	command := commandName(msg.Text)
+	names := splitQuotedArgs(commandArgs(msg.Text))
+	logutils.Info("HandleTopicCommand", "chatID", msg.Chat.Id, "command", command, "names", names)
+
+	if msg.From == nil {
+		return nil
+	}
+	allowed, err := tm.topicService.CanManageTopics(ctx, msg.Chat.Id, msg.From.Id)
+	if err != nil {
+		logutils.Error("HandleTopicCommand: CanManageTopicsError", err, "chatID", msg.Chat.Id, "userID", msg.From.Id)
+		return tm.reply(ctx, msg, topicErrorMessage(err, config.TopicCommandFailed))
+	}
+	if !allowed {
+		logutils.Warn("HandleTopicCommand: Not allowed", "chatID", msg.Chat.Id, "userID", msg.From.Id, "command", command)
+		return tm.reply(ctx, msg, config.TopicCommandNotAllowed)
+	}
+
+	switch command {
+	case "/renametopic":
+		return tm.renameTopic(ctx, msg, names)
+	case "/closetopic":
+		return tm.closeTopic(ctx, msg, names)
+	case "/reopentopic":
+		return tm.reopenTopic(ctx, msg, names)
+	case "/deletetopic":
+		return tm.confirmDeleteTopic(ctx, msg, names)
+	case "/mergetopic":
+		return tm.mergeTopics(ctx, msg, names)
+	}
+	logutils.Warn("HandleTopicCommand: Unknown command", "chatID", msg.Chat.Id, "command", command)
+	return nil
+}
+
+func (tm *TopicManagementHandlers) renameTopic(ctx context.Context, msg *gotgbot.Message, names []string) error {
+	var topic interfaces.ForumTopic
+	var newName string
+	var problem string
+	switch {
+	case len(names) == 2:
+		topic, problem = tm.findTopic(ctx, msg.Chat.Id, names[0])
+		newName = names[1]
+	case len(names) == 1 && isTopicThread(msg):
+		topic, problem = tm.currentTopic(ctx, msg)
+		newName = names[0]
+	default:
+		problem = config.RenameTopicUsage
+	}
+	if problem == "" {
+		problem = tm.mergeConflict(msg.Chat.Id, topic)
+	}
+	if problem == "" {
+		problem = tm.validateNewName(ctx, msg.Chat.Id, topic, newName)
+	}
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+
+	if err := tm.topicService.RenameForumTopic(ctx, msg.Chat.Id, topic.ID, newName); err != nil {
+		return tm.reply(ctx, msg, topicErrorMessage(err, config.TopicCommandFailed))
+	}
+	logutils.Success("HandleTopicCommand: Renamed", "chatID", msg.Chat.Id, "threadID", topic.ID, "name", newName)
+	return tm.reply(ctx, msg, fmt.Sprintf(config.TopicRenamed, topic.Name, newName))
+}
+
+func (tm *TopicManagementHandlers) closeTopic(ctx context.Context, msg *gotgbot.Message, names []string) error {
+	topic, problem := tm.namedOrCurrentTopic(ctx, msg, names, config.CloseTopicUsage)
+	if problem == "" {
+		problem = tm.mergeConflict(msg.Chat.Id, topic)
+	}
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+	if topic.IsClosed {
+		return tm.reply(ctx, msg, fmt.Sprintf(config.TopicAlreadyClosed, topic.Name))
+	}
+
+	if err := tm.topicService.CloseForumTopic(ctx, msg.Chat.Id, topic.ID); err != nil {
+		return tm.reply(ctx, msg, topicErrorMessage(err, config.TopicCommandFailed))
+	}
+	logutils.Success("HandleTopicCommand: Closed", "chatID", msg.Chat.Id, "threadID", topic.ID)
+	return tm.reply(ctx, msg, fmt.Sprintf(config.TopicClosed, topic.Name))
+}
+
+func (tm *TopicManagementHandlers) reopenTopic(ctx context.Context, msg *gotgbot.Message, names []string) error {
+	topic, problem := tm.namedOrCurrentTopic(ctx, msg, names, config.ReopenTopicUsage)
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+	if !topic.IsClosed {
+		return tm.reply(ctx, msg, fmt.Sprintf(config.TopicNotClosed, topic.Name))
+	}
+
+	if err := tm.topicService.ReopenForumTopic(ctx, msg.Chat.Id, topic.ID); err != nil {
+		return tm.reply(ctx, msg, topicErrorMessage(err, config.TopicCommandFailed))
+	}
+	logutils.Success("HandleTopicCommand: Reopened", "chatID", msg.Chat.Id, "threadID", topic.ID)
+	return tm.reply(ctx, msg, fmt.Sprintf(config.TopicReopened, topic.Name))
+}
+
+// confirmDeleteTopic asks before deleting, since a deleted topic takes its messages with it
+func (tm *TopicManagementHandlers) confirmDeleteTopic(ctx context.Context, msg *gotgbot.Message, names []string) error {
+	topic, problem := tm.namedOrCurrentTopic(ctx, msg, names, config.DeleteTopicUsage)
+	if problem == "" {
+		problem = tm.mergeConflict(msg.Chat.Id, topic)
+	}
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+
+	kb := NewKeyboardBuilder(tm.Callbacks)
+	confirm := interfaces.Callback{Action: interfaces.CallbackDeleteTopic, ChatID: msg.Chat.Id, ThreadID: topic.ID, TopicName: topic.Name}
+	deleteButton, err := kb.button(ctx, config.ButtonTextDeleteTopic, confirm)
+	if err != nil {
+		return err
+	}
+	confirm.Action = interfaces.CallbackKeepTopic
+	keepButton, err := kb.button(ctx, config.ButtonTextCancel, confirm)
+	if err != nil {
+		return err
+	}
+
+	_, err = tm.messageService.SendMessage(ctx, msg.Chat.Id, fmt.Sprintf(config.DeleteTopicConfirm, topic.Name), &gotgbot.SendMessageOpts{
+		MessageThreadId: msg.MessageThreadId,
+		ReplyMarkup:     gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{deleteButton, keepButton}}},
+	})
+	if err != nil {
+		logutils.Error("HandleTopicCommand: SendMessageError", err, "chatID", msg.Chat.Id)
+	}
+	return err
+}
+
+// HandleDeleteTopicCallback deletes the topic or keeps it, as the pressed button says
+func (tm *TopicManagementHandlers) HandleDeleteTopicCallback(ctx context.Context, update *gotgbot.Update, callback interfaces.Callback) error {
+	query := update.CallbackQuery
+	confirmMsg := query.Message
+	logutils.Info("HandleDeleteTopicCallback", "chatID", callback.ChatID, "threadID", callback.ThreadID, "action", string(callback.Action))
+
+	// Anyone in the chat can press the buttons, so check the presser again
+	allowed, err := tm.topicService.CanManageTopics(ctx, callback.ChatID, query.From.Id)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		logutils.Warn("HandleDeleteTopicCallback: Not allowed", "chatID", callback.ChatID, "userID", query.From.Id)
+		return nil
+	}
+
+	text := fmt.Sprintf(config.TopicKept, callback.TopicName)
+	if callback.Action == interfaces.CallbackDeleteTopic && tm.inMerge(callback.ChatID, callback.ThreadID) {
+		// The merge started after the confirmation was sent
+		text = fmt.Sprintf(config.TopicMergeRunning, callback.TopicName)
+	} else if callback.Action == interfaces.CallbackDeleteTopic {
+		if err := tm.topicService.DeleteForumTopic(ctx, callback.ChatID, callback.ThreadID); err != nil {
+			text = topicErrorMessage(err, config.TopicCommandFailed)
+		} else {
+			logutils.Success("HandleDeleteTopicCallback: Deleted", "chatID", callback.ChatID, "threadID", callback.ThreadID)
+			if confirmMsg.MessageThreadId == callback.ThreadID {
+				// The confirmation was inside the topic and went with it
+				return nil
+			}
+			text = fmt.Sprintf(config.TopicDeleted, callback.TopicName)
+		}
+	}
+
+	_, err = tm.messageService.EditMessageText(ctx, confirmMsg.Chat.Id, confirmMsg.MessageId, text, &gotgbot.EditMessageTextOpts{})
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("HandleDeleteTopicCallback: EditMessageTextError", err, "chatID", callback.ChatID)
+	}
+	return err
+}
+
+// mergeTopics copies every indexed save of one topic into another, then closes the first.
+// The copying runs in the background, reporting on a progress message, so the chat's other
+// updates are not held up behind it.
+func (tm *TopicManagementHandlers) mergeTopics(ctx context.Context, msg *gotgbot.Message, names []string) error {
+	chatID := msg.Chat.Id
+	if len(names) != 2 {
+		return tm.reply(ctx, msg, config.MergeTopicUsage)
+	}
+	from, problem := tm.findTopic(ctx, chatID, names[0])
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+	into, problem := tm.findTopic(ctx, chatID, names[1])
+	if problem != "" {
+		return tm.reply(ctx, msg, problem)
+	}
+	if from.ID == into.ID {
+		return tm.reply(ctx, msg, config.MergeSameTopic)
+	}
+	if into.IsClosed {
+		return tm.reply(ctx, msg, fmt.Sprintf(config.MergeIntoClosedTopic, into.Name))
+	}
+
+	// Both topics stay out of other merges, renames, closes and deletes until this one ends
+	if busy, ok := tm.startMerge(chatID, from, into); !ok {
+		return tm.reply(ctx, msg, fmt.Sprintf(config.TopicMergeRunning, busy.Name))
+	}
+	saves, err := tm.savedMessages.TopicSaves(ctx, chatID, from.ID)
+	if err != nil {
+		tm.endMerge(chatID, from, into)
+		return tm.reply(ctx, msg, config.TopicCommandFailed)
+	}
+	progress, err := tm.messageService.SendMessage(ctx, chatID, fmt.Sprintf(config.TopicMergeProgress, from.Name, into.Name, 0, len(saves)), &gotgbot.SendMessageOpts{
+		MessageThreadId: msg.MessageThreadId,
+	})
+	if err != nil {
+		logutils.Error("HandleTopicCommand: SendMessageError", err, "chatID", chatID)
+		tm.endMerge(chatID, from, into)
+		return err
+	}
+	tm.Tracker.Go(func() {
+		defer tm.endMerge(chatID, from, into)
+		tm.copySaves(tm.Tracker.Context(), progress, from, into, saves)
+	})
+	return nil
+}
+
+// startMerge claims both topics of a merge, or returns the one a running merge already has
+func (tm *TopicManagementHandlers) startMerge(chatID int64, from, into interfaces.ForumTopic) (interfaces.ForumTopic, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for _, topic := range []interfaces.ForumTopic{from, into} {
+		if tm.merging[topicKey{chatID: chatID, threadID: topic.ID}] {
+			return topic, false
+		}
+	}
+	tm.merging[topicKey{chatID: chatID, threadID: from.ID}] = true
+	tm.merging[topicKey{chatID: chatID, threadID: into.ID}] = true
+	return interfaces.ForumTopic{}, true
+}
+
+func (tm *TopicManagementHandlers) endMerge(chatID int64, from, into interfaces.ForumTopic) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(tm.merging, topicKey{chatID: chatID, threadID: from.ID})
+	delete(tm.merging, topicKey{chatID: chatID, threadID: into.ID})
+}
+
+// inMerge reports whether a running merge copies from or into the topic
+func (tm *TopicManagementHandlers) inMerge(chatID int64, threadID int64) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.merging[topicKey{chatID: chatID, threadID: threadID}]
+}
+
+// mergeConflict returns what to tell the user when topic is part of a running merge
+func (tm *TopicManagementHandlers) mergeConflict(chatID int64, topic interfaces.ForumTopic) string {
+	if tm.inMerge(chatID, topic.ID) {
+		return fmt.Sprintf(config.TopicMergeRunning, topic.Name)
+	}
+	return ""
+}
+
+// copySaves does the copying of a merge, editing progress as it goes. Each save is moved in
+// the index as soon as it is copied, so a merge that fails or is cut short by a restart
+// leaves the first topic open, and running the command again copies only what is left.
+func (tm *TopicManagementHandlers) copySaves(ctx context.Context, progress *gotgbot.Message, from, into interfaces.ForumTopic, saves []interfaces.SearchHit) {
+	chatID := progress.Chat.Id
+	incomplete := func(done int) {
+		tm.editProgress(ctx, progress, fmt.Sprintf(config.TopicMergeIncomplete, done, len(saves), from.Name, into.Name, from.Name))
+	}
+
+	for i, save := range saves {
+		if ctx.Err() != nil {
+			incomplete(i)
+			return
+		}
+		if i > 0 && i%config.DefaultMergeProgressEvery == 0 {
+			tm.editProgress(ctx, progress, fmt.Sprintf(config.TopicMergeProgress, from.Name, into.Name, i, len(saves)))
+		}
+		var copiedID int64
+		if save.SavedMessageID != 0 {
+			copied, err := tm.messageService.CopyMessageToTopicWithResult(ctx, chatID, chatID, int(save.SavedMessageID), int(into.ID))
+			if err != nil {
+				logutils.Error("HandleTopicCommand: MergeCopyError", err, "chatID", chatID, "messageID", save.SavedMessageID)
+				incomplete(i)
+				return
+			}
+			copiedID = copied.MessageId
+		}
+		// A save whose copy is unknown has nothing to copy, but it belongs to the merged topic now
+		if err := tm.savedMessages.MoveSave(ctx, save.ID, into.ID, into.Name, copiedID); err != nil {
+			incomplete(i)
+			return
+		}
+	}
+
+	if !from.IsClosed {
+		if err := tm.topicService.CloseForumTopic(ctx, chatID, from.ID); err != nil {
+			tm.editProgress(ctx, progress, topicErrorMessage(err, config.TopicCommandFailed))
+			return
+		}
+	}
+	logutils.Success("HandleTopicCommand: Merged", "chatID", chatID, "from", from.ID, "into", into.ID, "saves", len(saves))
+	tm.editProgress(ctx, progress, fmt.Sprintf(config.TopicMerged, len(saves), from.Name, into.Name, from.Name))
+}
+
+func (tm *TopicManagementHandlers) editProgress(ctx context.Context, progress *gotgbot.Message, text string) {
+	_, err := tm.messageService.EditMessageText(ctx, progress.Chat.Id, progress.MessageId, text, &gotgbot.EditMessageTextOpts{})
+	if err = ignoreMessageNotModified(err); err != nil {
+		logutils.Error("HandleTopicCommand: EditProgressError", err, "chatID", progress.Chat.Id)
+	}
+}
+
+// namedOrCurrentTopic finds the topic a single-topic command names, or the topic it was sent in
+func (tm *TopicManagementHandlers) namedOrCurrentTopic(ctx context.Context, msg *gotgbot.Message, names []string, usage string) (interfaces.ForumTopic, string) {
+	if len(names) > 0 {
+		return tm.findTopic(ctx, msg.Chat.Id, strings.Join(names, " "))
+	}
+	if isTopicThread(msg) {
+		return tm.currentTopic(ctx, msg)
+	}
+	return interfaces.ForumTopic{}, usage
+}
+
+// findTopic returns the topic called name, or what to tell the user when there is none
+func (tm *TopicManagementHandlers) findTopic(ctx context.Context, chatID int64, name string) (interfaces.ForumTopic, string) {
+	topic, err := tm.topicService.FindTopic(ctx, chatID, name)
+	if errors.Is(err, interfaces.ErrTopicNotFound) {
+		return topic, fmt.Sprintf(config.TopicCommandNotFound, name)
+	}
+	if err != nil {
+		return topic, config.TopicCommandFailed
+	}
+	return topic, ""
+}
+
+func (tm *TopicManagementHandlers) currentTopic(ctx context.Context, msg *gotgbot.Message) (interfaces.ForumTopic, string) {
+	topic, err := tm.topicService.TopicByThread(ctx, msg.Chat.Id, msg.MessageThreadId)
+	if errors.Is(err, interfaces.ErrTopicNotFound) {
+		logutils.Warn("HandleTopicCommand: Unknown thread", "chatID", msg.Chat.Id, "threadID", msg.MessageThreadId)
+		return topic, config.TopicCommandFailed
+	}
+	if err != nil {
+		return topic, config.TopicCommandFailed
+	}
+	return topic, ""
+}
+
+// validateNewName returns what is wrong with renaming topic to name, or "" if nothing is
+func (tm *TopicManagementHandlers) validateNewName(ctx context.Context, chatID int64, topic interfaces.ForumTopic, name string) string {
+	if utf8.RuneCountInString(name) > config.MaxTopicNameLength {
+		return config.TopicNameTooLong
+	}
+	existing, err := tm.topicService.FindTopic(ctx, chatID, name)
+	if err == nil && existing.ID != topic.ID {
+		return fmt.Sprintf(config.TopicNameTaken, existing.Name)
+	}
+	return ""
+}
+
+func (tm *TopicManagementHandlers) reply(ctx context.Context, msg *gotgbot.Message, text string) error {
+	_, err := tm.messageService.SendMessage(ctx, msg.Chat.Id, text, &gotgbot.SendMessageOpts{
+		MessageThreadId: msg.MessageThreadId,
+	})
+	if err != nil {
+		logutils.Error("HandleTopicCommand: SendMessageError", err, "chatID", msg.Chat.Id)
+	}
+	return err
+}
+
+// isTopicThread reports whether msg was sent inside a forum topic other than General
+func isTopicThread(msg *gotgbot.Message) bool {
+	return msg.IsTopicMessage && msg.MessageThreadId != 0
+}
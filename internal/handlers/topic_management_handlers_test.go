@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	mocks "save-message/internal/mocks/handlers"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// managedTopics is a forum with "Recipes" (thread 10), "Food" (11) and a closed "Old" (12)
+type managedTopics struct {
+	mocks.MockTopicService
+
+	topics  map[int64]*interfaces.ForumTopic
+	admin   bool
+	failing bool
+	calls   []string
+}
+
+func newManagedTopics() *managedTopics {
+	return &managedTopics{
+		admin: true,
+		topics: map[int64]*interfaces.ForumTopic{
+			10: {ID: 10, Name: "Recipes"},
+			11: {ID: 11, Name: "Food"},
+			12: {ID: 12, Name: "Old", IsClosed: true},
+		},
+	}
+}
+
+func (ts *managedTopics) FindTopic(ctx context.Context, chatID int64, name string) (interfaces.ForumTopic, error) {
+	for _, topic := range ts.topics {
+		if strings.EqualFold(topic.Name, name) {
+			return *topic, nil
+		}
+	}
+	return interfaces.ForumTopic{}, interfaces.ErrTopicNotFound
+}
+
+func (ts *managedTopics) TopicByThread(ctx context.Context, chatID int64, threadID int64) (interfaces.ForumTopic, error) {
+	if topic, ok := ts.topics[threadID]; ok {
+		return *topic, nil
+	}
+	return interfaces.ForumTopic{}, interfaces.ErrTopicNotFound
+}
+
+func (ts *managedTopics) call(call string) error {
+	ts.calls = append(ts.calls, call)
+	if ts.failing {
+		return errors.New("Bad Request: TOPIC_ID_INVALID")
+	}
+	return nil
+}
+
+func (ts *managedTopics) RenameForumTopic(ctx context.Context, chatID int64, threadID int64, name string) error {
+	return ts.call(fmt.Sprintf("rename %d %s", threadID, name))
+}
+
+func (ts *managedTopics) CloseForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return ts.call(fmt.Sprintf("close %d", threadID))
+}
+
+func (ts *managedTopics) ReopenForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return ts.call(fmt.Sprintf("reopen %d", threadID))
+}
+
+func (ts *managedTopics) DeleteForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return ts.call(fmt.Sprintf("delete %d", threadID))
+}
+
+func (ts *managedTopics) CanManageTopics(ctx context.Context, chatID int64, userID int64) (bool, error) {
+	return ts.admin, nil
+}
+
+// managementMessages records replies, copies and edits
+type managementMessages struct {
+	mocks.MockMessageService
+
+	sent     []string
+	keyboard gotgbot.InlineKeyboardMarkup
+	copied   []string
+	edited   []string
+	failCopy int64         // message ID whose copy fails
+	copyGate chan struct{} // when set, copies wait for it to close
+}
+
+func (m *managementMessages) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	m.sent = append(m.sent, text)
+	if keyboard, ok := opts.ReplyMarkup.(gotgbot.InlineKeyboardMarkup); ok {
+		m.keyboard = keyboard
+	}
+	return &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: chatID}}, nil
+}
+
+func (m *managementMessages) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+	if m.copyGate != nil {
+		<-m.copyGate
+	}
+	if int64(messageID) == m.failCopy {
+		return nil, errors.New("Too Many Requests")
+	}
+	m.copied = append(m.copied, fmt.Sprintf("%d->%d", messageID, messageThreadID))
+	return &gotgbot.Message{MessageId: int64(1000 + messageID)}, nil
+}
+
+func (m *managementMessages) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+	m.edited = append(m.edited, text)
+	return &gotgbot.Message{MessageId: messageID}, nil
+}
+
+func (m *managementMessages) lastEdited() string {
+	if len(m.edited) == 0 {
+		return ""
+	}
+	return m.edited[len(m.edited)-1]
+}
+
+func (m *managementMessages) lastSent() string {
+	if len(m.sent) == 0 {
+		return ""
+	}
+	return m.sent[len(m.sent)-1]
+}
+
+func topicCommand(text string, threadID int64) *gotgbot.Update {
+	return &gotgbot.Update{Message: &gotgbot.Message{
+		MessageId:       1,
+		MessageThreadId: threadID,
+		IsTopicMessage:  threadID != 0,
+		Chat:            gotgbot.Chat{Id: -1001234567890, Type: "supergroup", IsForum: true},
+		From:            &gotgbot.User{Id: 55},
+		Text:            text,
+	}}
+}
+
+func TestHandleTopicCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		threadID  int64
+		notAdmin  bool
+		wantCalls []string
+		wantReply string
+	}{
+		{name: "rename", text: `/renametopic Recipes "Baking & Cakes"`, wantCalls: []string{"rename 10 Baking & Cakes"}, wantReply: fmt.Sprintf(config.TopicRenamed, "Recipes", "Baking & Cakes")},
+		{name: "rename the topic it is sent in", text: `/renametopic "Baking & Cakes"`, threadID: 10, wantCalls: []string{"rename 10 Baking & Cakes"}, wantReply: fmt.Sprintf(config.TopicRenamed, "Recipes", "Baking & Cakes")},
+		{name: "rename to the same name in other case", text: `/renametopic Recipes recipes`, wantCalls: []string{"rename 10 recipes"}, wantReply: fmt.Sprintf(config.TopicRenamed, "Recipes", "recipes")},
+		{name: "rename to a taken name", text: `/renametopic Recipes food`, wantReply: fmt.Sprintf(config.TopicNameTaken, "Food")},
+		{name: "rename without names", text: `/renametopic Recipes`, wantReply: config.RenameTopicUsage},
+		{name: "close by name with spaces", text: `/closetopic@savemessagebot recipes`, wantCalls: []string{"close 10"}, wantReply: fmt.Sprintf(config.TopicClosed, "Recipes")},
+		{name: "close the topic it is sent in", text: `/closetopic`, threadID: 11, wantCalls: []string{"close 11"}, wantReply: fmt.Sprintf(config.TopicClosed, "Food")},
+		{name: "close without a topic", text: `/closetopic`, wantReply: config.CloseTopicUsage},
+		{name: "close a closed topic", text: `/closetopic Old`, wantReply: fmt.Sprintf(config.TopicAlreadyClosed, "Old")},
+		{name: "reopen", text: `/reopentopic Old`, wantCalls: []string{"reopen 12"}, wantReply: fmt.Sprintf(config.TopicReopened, "Old")},
+		{name: "reopen an open topic", text: `/reopentopic Food`, wantReply: fmt.Sprintf(config.TopicNotClosed, "Food")},
+		{name: "unknown topic", text: `/closetopic Travel plans`, wantReply: fmt.Sprintf(config.TopicCommandNotFound, "Travel plans")},
+		{name: "not an admin", text: `/closetopic Food`, notAdmin: true, wantReply: config.TopicCommandNotAllowed},
+		{name: "merge into itself", text: `/mergetopic Food food`, wantReply: config.MergeSameTopic},
+		{name: "merge into a closed topic", text: `/mergetopic Food Old`, wantReply: fmt.Sprintf(config.MergeIntoClosedTopic, "Old")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &managementMessages{}
+			ts := newManagedTopics()
+			ts.admin = !tt.notAdmin
+			tm := NewTopicManagementHandlers(ms, ts, &mocks.MockSavedMessageIndex{})
+
+			require.NoError(t, tm.HandleTopicCommand(context.Background(), topicCommand(tt.text, tt.threadID)))
+			assert.Equal(t, tt.wantCalls, ts.calls)
+			assert.Equal(t, []string{tt.wantReply}, ms.sent)
+		})
+	}
+}
+
+func TestHandleTopicCommand_TelegramRefuses(t *testing.T) {
+	ms := &managementMessages{}
+	ts := newManagedTopics()
+	ts.failing = true
+	tm := NewTopicManagementHandlers(ms, ts, &mocks.MockSavedMessageIndex{})
+
+	require.NoError(t, tm.HandleTopicCommand(context.Background(), topicCommand("/closetopic Food", 0)))
+	assert.Equal(t, []string{"close 11"}, ts.calls)
+	assert.Equal(t, config.TopicCommandFailed, ms.lastSent())
+}
+
+func TestHandleTopicCommand_Merge(t *testing.T) {
+	recipeSaves := func(ctx context.Context, chatID int64, threadID int64) ([]interfaces.SearchHit, error) {
+		require.Equal(t, int64(10), threadID)
+		return []interfaces.SearchHit{
+			{ID: 1, ThreadID: 10, SavedMessageID: 501, TopicName: "Recipes"},
+			{ID: 2, ThreadID: 10, TopicName: "Recipes"}, // copy unknown
+			{ID: 3, ThreadID: 10, SavedMessageID: 503, TopicName: "Recipes"},
+		}, nil
+	}
+
+	t.Run("copies every save, then closes the source", func(t *testing.T) {
+		ms := &managementMessages{}
+		ts := newManagedTopics()
+		index := &mocks.MockSavedMessageIndex{TopicSavesFunc: recipeSaves}
+		tm := NewTopicManagementHandlers(ms, ts, index)
+		tm.Tracker = lifecycle.NewTracker()
+
+		require.NoError(t, tm.HandleTopicCommand(context.Background(), topicCommand(`/mergetopic Recipes Food`, 0)))
+		require.NoError(t, tm.Tracker.Shutdown(time.Second))
+		assert.Equal(t, []string{fmt.Sprintf(config.TopicMergeProgress, "Recipes", "Food", 0, 3)}, ms.sent)
+		assert.Equal(t, []string{"501->11", "503->11"}, ms.copied)
+		assert.Equal(t, []mocks.MovedSave{
+			{ID: 1, ThreadID: 11, TopicName: "Food", SavedMessageID: 1501},
+			{ID: 2, ThreadID: 11, TopicName: "Food"},
+			{ID: 3, ThreadID: 11, TopicName: "Food", SavedMessageID: 1503},
+		}, index.Moves())
+		assert.Equal(t, []string{"close 10"}, ts.calls)
+		assert.Equal(t, fmt.Sprintf(config.TopicMerged, 3, "Recipes", "Food", "Recipes"), ms.lastEdited())
+	})
+
+	t.Run("a failed copy leaves the source open", func(t *testing.T) {
+		ms := &managementMessages{failCopy: 503}
+		ts := newManagedTopics()
+		index := &mocks.MockSavedMessageIndex{TopicSavesFunc: recipeSaves}
+		tm := NewTopicManagementHandlers(ms, ts, index)
+		tm.Tracker = lifecycle.NewTracker()
+
+		require.NoError(t, tm.HandleTopicCommand(context.Background(), topicCommand(`/mergetopic Recipes Food`, 0)))
+		require.NoError(t, tm.Tracker.Shutdown(time.Second))
+		assert.Len(t, index.Moves(), 2, "saves copied before the failure stay moved")
+		assert.Empty(t, ts.calls)
+		assert.Equal(t, fmt.Sprintf(config.TopicMergeIncomplete, 2, 3, "Recipes", "Food", "Recipes"), ms.lastEdited())
+	})
+
+	t.Run("copies in the background, keeping both topics out of other changes", func(t *testing.T) {
+		ctx := context.Background()
+		ms := &managementMessages{copyGate: make(chan struct{})}
+		ts := newManagedTopics()
+		loads := 0
+		index := &mocks.MockSavedMessageIndex{TopicSavesFunc: func(ctx context.Context, chatID int64, threadID int64) ([]interfaces.SearchHit, error) {
+			loads++
+			return recipeSaves(ctx, chatID, threadID)
+		}}
+		tm := NewTopicManagementHandlers(ms, ts, index)
+		tm.Tracker = lifecycle.NewTracker()
+
+		// A deletion confirmed only once the merge is running
+		require.NoError(t, tm.HandleTopicCommand(ctx, topicCommand("/deletetopic Food", 0)))
+		deleteFood, ok, err := tm.Callbacks.Resolve(ctx, ms.keyboard.InlineKeyboard[0][0].CallbackData)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// The commands return while the merge's copies are still held up
+		require.NoError(t, tm.HandleTopicCommand(ctx, topicCommand(`/mergetopic Recipes Food`, 0)))
+		for _, command := range []struct{ text, busy string }{
+			{`/mergetopic Recipes Food`, "Recipes"},
+			{`/mergetopic Food Recipes`, "Food"},
+			{`/deletetopic Food`, "Food"},
+			{`/closetopic Recipes`, "Recipes"},
+			{`/renametopic Food Meals`, "Food"},
+		} {
+			require.NoError(t, tm.HandleTopicCommand(ctx, topicCommand(command.text, 0)))
+			assert.Equal(t, fmt.Sprintf(config.TopicMergeRunning, command.busy), ms.lastSent(), command.text)
+		}
+		assert.Equal(t, 1, loads, "refused merges do not read the index")
+
+		update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			From:    gotgbot.User{Id: 55},
+			Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: -1001234567890}},
+		}}
+		require.NoError(t, tm.HandleDeleteTopicCallback(ctx, update, deleteFood))
+		assert.Equal(t, []string{fmt.Sprintf(config.TopicMergeRunning, "Food")}, ms.edited)
+		assert.Empty(t, ts.calls, "nothing touches the topics mid-merge")
+
+		close(ms.copyGate)
+		require.NoError(t, tm.Tracker.Shutdown(time.Second))
+		assert.Len(t, index.Moves(), 3)
+		assert.Equal(t, []string{"close 10"}, ts.calls)
+		assert.Equal(t, fmt.Sprintf(config.TopicMerged, 3, "Recipes", "Food", "Recipes"), ms.lastEdited())
+
+		require.NoError(t, tm.HandleTopicCommand(ctx, topicCommand("/closetopic Food", 0)))
+		assert.Equal(t, fmt.Sprintf(config.TopicClosed, "Food"), ms.lastSent(), "the topics are free once the merge ends")
+	})
+}
+
+func TestHandleDeleteTopicCallback(t *testing.T) {
+	ctx := context.Background()
+
+	// pressButton asks to delete Food from chat thread threadID and presses the button at index
+	pressButton := func(t *testing.T, ts *managedTopics, threadID int64, index int) *managementMessages {
+		ms := &managementMessages{}
+		tm := NewTopicManagementHandlers(ms, ts, &mocks.MockSavedMessageIndex{})
+		require.NoError(t, tm.HandleTopicCommand(ctx, topicCommand("/deletetopic Food", threadID)))
+		require.Equal(t, []string{fmt.Sprintf(config.DeleteTopicConfirm, "Food")}, ms.sent)
+		require.Empty(t, ts.calls, "nothing is deleted before the confirmation")
+
+		buttons := ms.keyboard.InlineKeyboard[0]
+		require.Len(t, buttons, 2)
+		callback, ok, err := tm.Callbacks.Resolve(ctx, buttons[index].CallbackData)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			From:    gotgbot.User{Id: 55},
+			Message: &gotgbot.Message{MessageId: 900, MessageThreadId: threadID, Chat: gotgbot.Chat{Id: -1001234567890}},
+		}}
+		require.NoError(t, tm.HandleDeleteTopicCallback(ctx, update, callback))
+		return ms
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		ts := newManagedTopics()
+		ms := pressButton(t, ts, 0, 0)
+		assert.Equal(t, []string{"delete 11"}, ts.calls)
+		assert.Equal(t, []string{fmt.Sprintf(config.TopicDeleted, "Food")}, ms.edited)
+	})
+
+	t.Run("delete from inside the topic", func(t *testing.T) {
+		ts := newManagedTopics()
+		ms := pressButton(t, ts, 11, 0)
+		assert.Equal(t, []string{"delete 11"}, ts.calls)
+		assert.Empty(t, ms.edited, "the confirmation went with the topic")
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		ts := newManagedTopics()
+		ms := pressButton(t, ts, 0, 1)
+		assert.Empty(t, ts.calls)
+		assert.Equal(t, []string{fmt.Sprintf(config.TopicKept, "Food")}, ms.edited)
+	})
+
+	t.Run("pressed by someone who may not delete", func(t *testing.T) {
+		ts := newManagedTopics()
+		ms := &managementMessages{}
+		tm := NewTopicManagementHandlers(ms, ts, &mocks.MockSavedMessageIndex{})
+		ts.admin = false
+		update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			From:    gotgbot.User{Id: 66},
+			Message: &gotgbot.Message{MessageId: 900, Chat: gotgbot.Chat{Id: -1001234567890}},
+		}}
+		callback := interfaces.Callback{Action: interfaces.CallbackDeleteTopic, ChatID: -1001234567890, ThreadID: 11, TopicName: "Food"}
+
+		require.NoError(t, tm.HandleDeleteTopicCallback(ctx, update, callback))
+		assert.Empty(t, ts.calls)
+		assert.Empty(t, ms.edited)
+	})
+}
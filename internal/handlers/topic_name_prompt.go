@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"save-message/internal/config"
+	"save-message/internal/conversation"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// stepTopicName is the conversation step in which the bot waits for a new topic's name
+const stepTopicName = "topic_name"
+
+// pendingTopicName is what the bot remembers while a user types a new topic name
+type pendingTopicName struct {
+	Creation        TopicCreationContext
+	Original        *gotgbot.Message // message to save into the new topic, if any
+	PromptMessageID int64            // the prompt, removed when the flow ends
+}
+
+// IsWaitingForTopicName checks if a user is typing a new topic's name in chatID
+func (th *TopicHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	conv, ok, err := th.Conversations.Active(ctx, conversation.Key{ChatID: chatID, UserID: userID})
+	if err != nil {
+		logutils.Error("IsWaitingForTopicName: ActiveError", err, "chatID", chatID, "userID", userID)
+		return false
+	}
+	return ok && conv.Step == stepTopicName
+}
+
+// HandleCancelCommand abandons the sender's topic-name prompt in this chat
+func (th *TopicHandlers) HandleCancelCommand(ctx context.Context, update *gotgbot.Update) error {
+	msg := update.Message
+	logutils.Info("HandleCancelCommand", "chatID", msg.Chat.Id, "userID", msg.From.Id)
+
+	pending, ok := th.takeTopicNamePrompt(ctx, conversation.Key{ChatID: msg.Chat.Id, UserID: msg.From.Id})
+	if !ok {
+		_, err := th.messageService.SendMessage(ctx, msg.Chat.Id, config.NothingToCancelMessage, &gotgbot.SendMessageOpts{
+			MessageThreadId: msg.MessageThreadId,
+		})
+		if err != nil {
+			logutils.Error("HandleCancelCommand: SendMessageError", err, "chatID", msg.Chat.Id)
+		}
+		return err
+	}
+
+	th.finishTopicNamePrompt(ctx, conversation.Key{ChatID: msg.Chat.Id, UserID: msg.From.Id}, pending, config.TopicNameCancelled)
+	logutils.Success("HandleCancelCommand", "chatID", msg.Chat.Id, "userID", msg.From.Id)
+	return nil
+}
+
+// HandleCancelTopicNameCallback handles the Cancel button under a topic-name prompt.
+// Only the user being asked can cancel; a press by anyone else is ignored.
+func (th *TopicHandlers) HandleCancelTopicNameCallback(ctx context.Context, update *gotgbot.Update) error {
+	query := update.CallbackQuery
+	key := conversation.Key{ChatID: query.Message.Chat.Id, UserID: query.From.Id}
+	logutils.Info("HandleCancelTopicNameCallback", "chatID", key.ChatID, "userID", key.UserID)
+
+	pending, ok := th.takeTopicNamePrompt(ctx, key)
+	if !ok {
+		logutils.Warn("HandleCancelTopicNameCallback: No topic name pending", "chatID", key.ChatID, "userID", key.UserID)
+		return nil
+	}
+
+	th.finishTopicNamePrompt(ctx, key, pending, config.TopicNameCancelled)
+	logutils.Success("HandleCancelTopicNameCallback", "chatID", key.ChatID, "userID", key.UserID)
+	return nil
+}
+
+// HandleConversationTimeout ends a topic-name prompt nobody answered in time
+func (th *TopicHandlers) HandleConversationTimeout(ctx context.Context, conv conversation.Conversation) {
+	if conv.Step != stepTopicName {
+		return
+	}
+	var pending pendingTopicName
+	if err := conv.Decode(&pending); err != nil {
+		logutils.Error("HandleConversationTimeout: DecodeError", err, "chatID", conv.Key.ChatID, "userID", conv.Key.UserID)
+		return
+	}
+	th.finishTopicNamePrompt(ctx, conv.Key, pending, config.TopicNameTimedOut)
+}
+
+// startTopicNamePrompt asks for a topic name with a Cancel button and waits for key's answer
+func (th *TopicHandlers) startTopicNamePrompt(ctx context.Context, key conversation.Key, msg *gotgbot.Message, text string, opts *gotgbot.SendMessageOpts, pending pendingTopicName) error {
+	if keyboard, err := th.keyboards().BuildCancelKeyboard(ctx, msg); err != nil {
+		logutils.Error("startTopicNamePrompt: BuildCancelKeyboardError", err, "chatID", key.ChatID)
+	} else {
+		opts.ReplyMarkup = *keyboard
+	}
+
+	prompt, err := th.messageService.SendMessage(ctx, key.ChatID, text, opts)
+	if err != nil {
+		return err
+	}
+	if prompt != nil {
+		pending.PromptMessageID = prompt.MessageId
+	}
+	th.resumeTopicNamePrompt(ctx, key, pending)
+	return nil
+}
+
+// resumeTopicNamePrompt (re)starts waiting for key's answer with a fresh deadline
+func (th *TopicHandlers) resumeTopicNamePrompt(ctx context.Context, key conversation.Key, pending pendingTopicName) {
+	if err := th.Conversations.Start(ctx, key, stepTopicName, pending); err != nil {
+		logutils.Error("resumeTopicNamePrompt: StartError", err, "chatID", key.ChatID, "userID", key.UserID)
+	}
+}
+
+// takeTopicNamePrompt claims key's prompt; only one concurrent caller gets it
+func (th *TopicHandlers) takeTopicNamePrompt(ctx context.Context, key conversation.Key) (pendingTopicName, bool) {
+	conv, ok, err := th.Conversations.Take(ctx, key)
+	if err != nil {
+		logutils.Error("takeTopicNamePrompt: TakeError", err, "chatID", key.ChatID, "userID", key.UserID)
+		return pendingTopicName{}, false
+	}
+	if !ok || conv.Step != stepTopicName {
+		return pendingTopicName{}, false
+	}
+	var pending pendingTopicName
+	if err := conv.Decode(&pending); err != nil {
+		logutils.Error("takeTopicNamePrompt: DecodeError", err, "chatID", key.ChatID, "userID", key.UserID)
+		return pendingTopicName{}, false
+	}
+	return pending, true
+}
+
+// validateTopicName returns what is wrong with name, or "" if a topic can be created with it
+func (th *TopicHandlers) validateTopicName(ctx context.Context, chatID int64, name string) string {
+	if name == "" {
+		return config.TopicNameEmptyError
+	}
+	if utf8.RuneCountInString(name) > config.MaxTopicNameLength {
+		return config.TopicNameTooLongError
+	}
+	topics, err := th.topicService.GetForumTopics(ctx, chatID)
+	if err != nil {
+		// Let creation itself report the problem
+		return ""
+	}
+	for _, topic := range topics {
+		if strings.EqualFold(topic.Name, name) {
+			return config.TopicNameExistsError
+		}
+	}
+	return ""
+}
+
+// finishTopicNamePrompt ends key's unanswered prompt: it goes away, notice is shown as long
+// as the user's confirmations are, and the suggestions for the message being saved come back.
+func (th *TopicHandlers) finishTopicNamePrompt(ctx context.Context, key conversation.Key, pending pendingTopicName, notice string) {
+	creation := pending.Creation
+	th.deletePrompt(ctx, pending)
+
+	noticeMsg, err := th.messageService.SendMessage(ctx, creation.ChatId, notice, &gotgbot.SendMessageOpts{
+		MessageThreadId: creation.ThreadId,
+	})
+	if err != nil {
+		logutils.Error("finishTopicNamePrompt: SendMessageError", err, "chatID", creation.ChatId)
+	} else if noticeMsg != nil {
+		th.deleteLater(ctx, creation.ChatId, int(noticeMsg.MessageId), th.confirmationDeleteDelay(settingsFor(ctx, th.Settings, key.ChatID, key.UserID)))
+	}
+
+	if pending.Original != nil && th.RestoreSuggestions != nil {
+		if err := th.RestoreSuggestions(ctx, pending.Original); err != nil {
+			logutils.Error("finishTopicNamePrompt: RestoreSuggestionsError", err, "chatID", creation.ChatId)
+		}
+	}
+}
+
+// deletePrompt removes the message asking for the topic name
+func (th *TopicHandlers) deletePrompt(ctx context.Context, pending pendingTopicName) {
+	if pending.PromptMessageID == 0 {
+		return
+	}
+	err := ignoreMessageAlreadyDeleted(th.messageService.DeleteMessage(ctx, pending.Creation.ChatId, int(pending.PromptMessageID)))
+	if err != nil {
+		logutils.Error("deletePrompt: DeleteMessageError", err, "chatID", pending.Creation.ChatId, "messageID", pending.PromptMessageID)
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/conversation"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	mocks "save-message/internal/mocks/handlers"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// promptMessageService records what the topic-name flow sends and deletes
+type promptMessageService struct {
+	mocks.MockMessageService
+
+	mu      sync.Mutex
+	nextID  int64
+	sent    []string
+	deleted []int64
+}
+
+func (m *promptMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	m.sent = append(m.sent, text)
+	return &gotgbot.Message{MessageId: 5000 + m.nextID, Chat: gotgbot.Chat{Id: chatID}, Text: text}, nil
+}
+
+func (m *promptMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, int64(messageID))
+	return nil
+}
+
+func (m *promptMessageService) texts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sent...)
+}
+
+func (m *promptMessageService) wasDeleted(messageID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range m.deleted {
+		if id == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// existingTopics knows a "Recipes" topic and creates any other
+type existingTopics struct {
+	mocks.MockTopicService
+}
+
+func (ts *existingTopics) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
+	return []interfaces.ForumTopic{{Name: "Recipes", ID: 10}}, nil
+}
+
+func (ts *existingTopics) CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error) {
+	return 20, nil
+}
+
+// newPromptFixture asks user 1 in chat 789 to name a topic for message 1043
+func newPromptFixture(t *testing.T) (*TopicHandlers, *promptMessageService, *gotgbot.Message, *lifecycle.Tracker) {
+	ms := &promptMessageService{}
+	tracker := lifecycle.NewTracker()
+	th := NewTopicHandlers(ms, &existingTopics{})
+	th.Tracker = tracker
+	NewAIHandlers(ms, &existingTopics{}, &mocks.MockAIService{}, th)
+
+	originalMsg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, From: &gotgbot.User{Id: 1}, Text: "Cake"}
+	update := &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{From: gotgbot.User{Id: 1}}}
+	require.NoError(t, th.HandleNewTopicCreationRequest(context.Background(), update, originalMsg))
+	require.True(t, th.IsWaitingForTopicName(context.Background(), 789, 1))
+	return th, ms, originalMsg, tracker
+}
+
+func topicNameReply(chatID, userID int64, text string) *gotgbot.Update {
+	return &gotgbot.Update{Message: &gotgbot.Message{MessageId: 2000, Chat: gotgbot.Chat{Id: chatID}, From: &gotgbot.User{Id: userID}, Text: text}}
+}
+
+func TestTopicNamePrompt_IsScopedToChat(t *testing.T) {
+	th, _, _, _ := newPromptFixture(t)
+	ctx := context.Background()
+
+	assert.False(t, th.IsWaitingForTopicName(ctx, 790, 1), "the same user in another chat is not being asked")
+	assert.False(t, th.IsWaitingForTopicName(ctx, 789, 2), "another user in the chat is not being asked")
+
+	require.NoError(t, th.HandleTopicNameEntry(ctx, topicNameReply(790, 1, "Desserts")))
+	assert.True(t, th.IsWaitingForTopicName(ctx, 789, 1), "a reply elsewhere leaves the prompt open")
+}
+
+func TestTopicNamePrompt_EndsRestoringSuggestions(t *testing.T) {
+	tests := []struct {
+		name   string
+		end    func(ctx context.Context, th *TopicHandlers)
+		notice string
+	}{
+		{
+			name: "cancel command",
+			end: func(ctx context.Context, th *TopicHandlers) {
+				require.NoError(t, th.HandleCancelCommand(ctx, topicNameReply(789, 1, "/cancel")))
+			},
+			notice: config.TopicNameCancelled,
+		},
+		{
+			name: "cancel button",
+			end: func(ctx context.Context, th *TopicHandlers) {
+				require.NoError(t, th.HandleCancelTopicNameCallback(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+					From:    gotgbot.User{Id: 1},
+					Message: &gotgbot.Message{MessageId: 5001, Chat: gotgbot.Chat{Id: 789}},
+				}}))
+			},
+			notice: config.TopicNameCancelled,
+		},
+		{
+			name: "timeout",
+			end: func(ctx context.Context, th *TopicHandlers) {
+				th.Conversations.Timeout = -time.Second // already overdue
+				th.resumeTopicNamePrompt(ctx, conversation.Key{ChatID: 789, UserID: 1}, takePending(t, ctx, th))
+				expired, err := th.Conversations.TakeExpired(ctx)
+				require.NoError(t, err)
+				require.Len(t, expired, 1)
+				th.HandleConversationTimeout(ctx, expired[0])
+			},
+			notice: config.TopicNameTimedOut,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, ms, _, tracker := newPromptFixture(t)
+			ctx := context.Background()
+			prompt := int64(5001) // the first message sent
+
+			tt.end(ctx, th)
+			require.NoError(t, tracker.Shutdown(time.Second))
+
+			assert.False(t, th.IsWaitingForTopicName(ctx, 789, 1))
+			assert.True(t, ms.wasDeleted(prompt), "the prompt is removed")
+			assert.Equal(t, []string{config.TopicNamePrompt, tt.notice, config.ChooseFolderMessage}, ms.texts(), "the suggestions come back")
+		})
+	}
+}
+
+func TestTopicNamePrompt_CancelButtonOnlyForAskedUser(t *testing.T) {
+	th, ms, _, _ := newPromptFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, th.HandleCancelTopicNameCallback(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+		From:    gotgbot.User{Id: 2},
+		Message: &gotgbot.Message{MessageId: 5001, Chat: gotgbot.Chat{Id: 789}},
+	}}))
+
+	assert.True(t, th.IsWaitingForTopicName(ctx, 789, 1))
+	assert.Equal(t, []string{config.TopicNamePrompt}, ms.texts())
+}
+
+func TestTopicNamePrompt_NothingToCancel(t *testing.T) {
+	ms := &promptMessageService{}
+	th := NewTopicHandlers(ms, &existingTopics{})
+
+	require.NoError(t, th.HandleCancelCommand(context.Background(), topicNameReply(789, 1, "/cancel")))
+	assert.Equal(t, []string{config.NothingToCancelMessage}, ms.texts())
+}
+
+func TestTopicNamePrompt_InvalidNameKeepsPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "empty", text: "   ", wantErr: config.TopicNameEmptyError},
+		{name: "too long", text: strings.Repeat("é", config.MaxTopicNameLength+1), wantErr: config.TopicNameTooLongError},
+		{name: "exists", text: "recipes", wantErr: config.TopicNameExistsError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, ms, _, _ := newPromptFixture(t)
+			ctx := context.Background()
+
+			require.NoError(t, th.HandleTopicNameEntry(ctx, topicNameReply(789, 1, tt.text)))
+
+			assert.Equal(t, []string{config.TopicNamePrompt, tt.wantErr}, ms.texts())
+			assert.True(t, th.IsWaitingForTopicName(ctx, 789, 1), "the user can try again")
+			assert.False(t, ms.wasDeleted(5001), "the prompt stays")
+		})
+	}
+}
+
+func TestTopicNamePrompt_LongestNameIsAccepted(t *testing.T) {
+	th, ms, _, tracker := newPromptFixture(t)
+	ctx := context.Background()
+	name := strings.Repeat("é", config.MaxTopicNameLength)
+
+	require.NoError(t, th.HandleTopicNameEntry(ctx, topicNameReply(789, 1, name)))
+	require.NoError(t, tracker.Shutdown(time.Second))
+
+	assert.False(t, th.IsWaitingForTopicName(ctx, 789, 1))
+	assert.True(t, ms.wasDeleted(5001), "the prompt is removed once answered")
+}
+
+func TestTopicNamePrompt_RecordsSave(t *testing.T) {
+	th, _, _, tracker := newPromptFixture(t)
+	savedIndex := &mocks.MockSavedMessageIndex{}
+	th.SavedMessages = savedIndex
+
+	require.NoError(t, th.HandleTopicNameEntry(context.Background(), topicNameReply(789, 1, "Desserts")))
+	require.NoError(t, tracker.Shutdown(time.Second))
+
+	assert.Equal(t, []mocks.RecordedSave{{ChatID: 789, OriginalMessageID: 1043, SavedBy: 1, ThreadID: 20, TopicName: "Desserts"}}, savedIndex.Saves())
+}
+
+// takePending claims the running prompt for user 1 in chat 789
+func takePending(t *testing.T, ctx context.Context, th *TopicHandlers) pendingTopicName {
+	pending, ok := th.takeTopicNamePrompt(ctx, conversation.Key{ChatID: 789, UserID: 1})
+	require.True(t, ok)
+	return pending
+}
@@ -1,13 +1,16 @@
 package handlers
 
 import (
-	"strconv"
-	"strings"
-	"time"
+	"context"
+	"fmt"
 
+	"save-message/internal/callbacks"
 	"save-message/internal/config"
 	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
 	"save-message/internal/logutils"
+	"save-message/internal/state"
+	"save-message/internal/telegram"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
@@ -19,22 +22,33 @@ type WarningHandlers struct {
 	// Add BotUserID for self-detection
 	BotUserID int64
 
+	// Callbacks issues the token behind the warning's "Ok" button
+	Callbacks interfaces.CallbackRegistryInterface
+
+	// Settings decides how long the warning stays, as the poster's confirmations do
+	Settings interfaces.SettingsServiceInterface
+
+	// Deletions persists the warning's auto-delete; Tracker backs the in-memory fallback
+	Deletions interfaces.DeletionSchedulerInterface
+	Tracker   *lifecycle.Tracker
+
 	// Mockable funcs for testing
-	HandleNonGeneralTopicMessageFunc func(update *gotgbot.Update) error
-	HandleWarningOkCallbackFunc      func(update *gotgbot.Update) error
+	HandleNonGeneralTopicMessageFunc func(ctx context.Context, update *gotgbot.Update) error
+	HandleWarningOkCallbackFunc      func(ctx context.Context, update *gotgbot.Update) error
 }
 
 // NewWarningHandlers creates a new warning handlers instance
 func NewWarningHandlers(messageService interfaces.MessageServiceInterface) *WarningHandlers {
 	return &WarningHandlers{
 		messageService: messageService,
+		Callbacks:      callbacks.NewRegistry(state.NewMemoryStore()),
 	}
 }
 
 // HandleNonGeneralTopicMessage handles messages sent in non-General topics
-func (wh *WarningHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update) error {
+func (wh *WarningHandlers) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
 	if wh.HandleNonGeneralTopicMessageFunc != nil {
-		return wh.HandleNonGeneralTopicMessageFunc(update)
+		return wh.HandleNonGeneralTopicMessageFunc(ctx, update)
 	}
 	logutils.Warn("HandleNonGeneralTopicMessage", "chatID", update.Message.Chat.Id, "threadID", update.Message.MessageThreadId, "messageID", update.Message.MessageId)
 
@@ -45,28 +59,41 @@ func (wh *WarningHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update)
 	}
 
 	// Delete the user's message immediately
-	err := wh.messageService.DeleteMessage(update.Message.Chat.Id, int(update.Message.MessageId))
-	if err != nil {
+	err := ignoreMessageAlreadyDeleted(wh.messageService.DeleteMessage(ctx, update.Message.Chat.Id, int(update.Message.MessageId)))
+	if telegram.IsNotEnoughRights(err) {
+		// Without delete rights the message stays; the warning below still tells the user where to post
+		logutils.Warn("HandleNonGeneralTopicMessage: Missing delete rights", "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
+	} else if err != nil {
 		logutils.Error("HandleNonGeneralTopicMessage: DeleteMessageError", err, "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
 	} else {
 		logutils.Success("HandleNonGeneralTopicMessage", "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
 	}
 
-	// Send warning message with "Ok" button
-	callbackData := config.CallbackPrefixDetectMessageOnOtherTopic + strconv.FormatInt(update.Message.MessageId, 10)
-	keyboard := &gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-			{{Text: config.ButtonTextOk, CallbackData: callbackData}},
-		},
+	// The warning lasts as long as the poster's confirmations do
+	var posterID int64
+	if update.Message.From != nil {
+		posterID = update.Message.From.Id
 	}
+	settings := settingsFor(ctx, wh.Settings, update.Message.Chat.Id, posterID)
+	warningText := fmt.Sprintf(config.WarningNonGeneralTopic, formatDelay(settings.ConfirmationDelay))
 
-	warningMsg, err := wh.messageService.SendMessage(update.Message.Chat.Id,
-		config.WarningNonGeneralTopic,
-		&gotgbot.SendMessageOpts{
-			MessageThreadId: update.Message.MessageThreadId,
-			ParseMode:       "Markdown",
-			ReplyMarkup:     *keyboard,
-		})
+	// Send warning message with "Ok" button; without a token the warning still goes out and expires on its own
+	warningOpts := &gotgbot.SendMessageOpts{
+		MessageThreadId: update.Message.MessageThreadId,
+		ParseMode:       "Markdown",
+	}
+	if keyboard, err := NewKeyboardBuilder(wh.Callbacks).BuildWarningKeyboard(ctx, update.Message); err != nil {
+		logutils.Error("HandleNonGeneralTopicMessage: BuildWarningKeyboardError", err, "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
+	} else {
+		warningOpts.ReplyMarkup = *keyboard
+	}
+	warningMsg, err := wh.messageService.SendMessage(ctx, update.Message.Chat.Id, warningText, warningOpts)
+	if telegram.IsTopicIDInvalid(err) {
+		// The topic vanished (e.g. deleted right after posting), so warn in General instead
+		logutils.Warn("HandleNonGeneralTopicMessage: Topic no longer exists, warning in General", "chatID", update.Message.Chat.Id, "threadID", update.Message.MessageThreadId)
+		warningOpts.MessageThreadId = 0
+		warningMsg, err = wh.messageService.SendMessage(ctx, update.Message.Chat.Id, warningText, warningOpts)
+	}
 
 	if err != nil {
 		logutils.Error("HandleNonGeneralTopicMessage: SendMessageError", err, "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
@@ -75,29 +102,21 @@ func (wh *WarningHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update)
 
 	logutils.Success("HandleNonGeneralTopicMessage", "chatID", update.Message.Chat.Id, "messageID", warningMsg.MessageId)
 
-	// Auto-delete warning message after 1 minute
-	go func(chatID int64, messageID int64, threadID int64) {
-		time.Sleep(config.DefaultWarningAutoDeleteDelay)
-		err := wh.messageService.DeleteMessage(chatID, int(messageID))
-		if err != nil {
-			logutils.Error("HandleNonGeneralTopicMessage: AutoDeleteMessageError", err, "chatID", chatID, "messageID", messageID)
-		} else {
-			logutils.Success("HandleNonGeneralTopicMessage", "chatID", chatID, "messageID", messageID)
-		}
-	}(update.Message.Chat.Id, warningMsg.MessageId, update.Message.MessageThreadId)
+	// Auto-delete the warning when it said it would
+	deleteLater(ctx, wh.Deletions, wh.Tracker, wh.messageService, update.Message.Chat.Id, warningMsg.MessageId, settings.ConfirmationDelay)
 
 	return nil
 }
 
 // HandleWarningOkCallback handles the "Ok" button for warning messages
-func (wh *WarningHandlers) HandleWarningOkCallback(update *gotgbot.Update) error {
+func (wh *WarningHandlers) HandleWarningOkCallback(ctx context.Context, update *gotgbot.Update) error {
 	if wh.HandleWarningOkCallbackFunc != nil {
-		return wh.HandleWarningOkCallbackFunc(update)
+		return wh.HandleWarningOkCallbackFunc(ctx, update)
 	}
 	logutils.Warn("HandleWarningOkCallback", "callbackData", update.CallbackQuery.Data)
 
 	// Delete the warning message itself (the message that contains the "Ok" button)
-	err := wh.messageService.DeleteMessage(update.CallbackQuery.Message.Chat.Id, int(update.CallbackQuery.Message.MessageId))
+	err := ignoreMessageAlreadyDeleted(wh.messageService.DeleteMessage(ctx, update.CallbackQuery.Message.Chat.Id, int(update.CallbackQuery.Message.MessageId)))
 	if err != nil {
 		logutils.Error("HandleWarningOkCallback: DeleteMessageError", err, "chatID", update.CallbackQuery.Message.Chat.Id, "messageID", update.CallbackQuery.Message.MessageId)
 	} else {
@@ -106,8 +125,3 @@ func (wh *WarningHandlers) HandleWarningOkCallback(update *gotgbot.Update) error
 
 	return nil
 }
-
-// IsWarningCallback checks if a callback is a warning confirmation.
-func (wh *WarningHandlers) IsWarningCallback(callbackData string) bool {
-	return strings.HasPrefix(callbackData, config.CallbackPrefixDetectMessageOnOtherTopic)
-}
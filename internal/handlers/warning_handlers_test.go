@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"save-message/internal/config"
+	"save-message/internal/lifecycle"
 	mocks "save-message/internal/mocks/handlers"
+	"save-message/internal/telegram"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +44,7 @@ func TestHandleNonGeneralTopicMessage(t *testing.T) {
 				mockMsgSvc.SendMessageShouldFail = true
 			}
 			handlers := NewWarningHandlers(mockMsgSvc)
-			err := handlers.HandleNonGeneralTopicMessage(update)
+			err := handlers.HandleNonGeneralTopicMessage(context.Background(), update)
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			assert.Equal(t, tt.expectDeleteCall, mockMsgSvc.DeleteMessageCalled)
@@ -47,6 +53,41 @@ func TestHandleNonGeneralTopicMessage(t *testing.T) {
 	}
 }
 
+func TestHandleNonGeneralTopicMessage_TelegramErrors(t *testing.T) {
+	update := &gotgbot.Update{
+		Message: &gotgbot.Message{
+			MessageId: 123, MessageThreadId: 5, Chat: gotgbot.Chat{Id: 789},
+		},
+	}
+
+	t.Run("missing delete rights still sends warning", func(t *testing.T) {
+		mockMsgSvc := &mocks.MockMessageService{
+			DeleteMessageErr: &telegram.TelegramError{ErrorCode: 400, Description: "Bad Request: message can't be deleted: not enough rights"},
+		}
+		handlers := NewWarningHandlers(mockMsgSvc)
+		err := handlers.HandleNonGeneralTopicMessage(context.Background(), update)
+		assert.NoError(t, err)
+		assert.True(t, mockMsgSvc.SendMessageCalled)
+	})
+
+	t.Run("deleted topic falls back to General", func(t *testing.T) {
+		var threads []int64
+		mockMsgSvc := &mocks.MockMessageService{
+			SendMessageFunc: func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+				threads = append(threads, opts.MessageThreadId)
+				if opts.MessageThreadId != 0 {
+					return nil, &telegram.TelegramError{ErrorCode: 400, Description: "Bad Request: TOPIC_ID_INVALID"}
+				}
+				return &gotgbot.Message{MessageId: 999, Chat: gotgbot.Chat{Id: chatID}}, nil
+			},
+		}
+		handlers := NewWarningHandlers(mockMsgSvc)
+		err := handlers.HandleNonGeneralTopicMessage(context.Background(), update)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{5, 0}, threads)
+	})
+}
+
 func TestHandleWarningOkCallback(t *testing.T) {
 	update := &gotgbot.Update{
 		CallbackQuery: &gotgbot.CallbackQuery{
@@ -57,15 +98,57 @@ func TestHandleWarningOkCallback(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mockMsgSvc := &mocks.MockMessageService{}
 		handlers := NewWarningHandlers(mockMsgSvc)
-		err := handlers.HandleWarningOkCallback(update)
+		err := handlers.HandleWarningOkCallback(context.Background(), update)
 		assert.NoError(t, err)
 		assert.True(t, mockMsgSvc.DeleteMessageCalled)
 	})
 
 	t.Run("failure", func(t *testing.T) {
-		mockMsgSvc := &mocks.MockMessageService{}
+		mockMsgSvc := &mocks.MockMessageService{
+			DeleteMessageErr: &telegram.TelegramError{ErrorCode: 400, Description: "Bad Request: message to delete not found"},
+		}
 		handlers := NewWarningHandlers(mockMsgSvc)
-		err := handlers.HandleWarningOkCallback(update)
+		err := handlers.HandleWarningOkCallback(context.Background(), update)
 		assert.NoError(t, err) // Error is logged, not returned
 	})
 }
+
+type recordingDeletions struct {
+	messageIDs []int64
+	delays     []time.Duration
+	err        error
+}
+
+func (r *recordingDeletions) ScheduleDeletion(ctx context.Context, chatID int64, messageID int64, delay time.Duration) error {
+	r.messageIDs = append(r.messageIDs, messageID)
+	r.delays = append(r.delays, delay)
+	return r.err
+}
+
+func TestHandleNonGeneralTopicMessage_SchedulesDurableDelete(t *testing.T) {
+	update := &gotgbot.Update{
+		Message: &gotgbot.Message{MessageId: 123, MessageThreadId: 5, Chat: gotgbot.Chat{Id: 789}},
+	}
+	deletions := &recordingDeletions{}
+	handlers := NewWarningHandlers(&mocks.MockMessageService{})
+	handlers.Deletions = deletions
+
+	err := handlers.HandleNonGeneralTopicMessage(context.Background(), update)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{999}, deletions.messageIDs, "the warning's delete is persisted")
+	assert.Equal(t, []time.Duration{config.DefaultConfirmationDelay}, deletions.delays, "without settings the default lifetime applies")
+}
+
+func TestDeleteLater_FallsBackToTimer(t *testing.T) {
+	deletions := &recordingDeletions{err: errors.New("database is locked")}
+	msgSvc := &mocks.MockMessageService{}
+	tracker := lifecycle.NewTracker()
+
+	deleteLater(context.Background(), deletions, tracker, msgSvc, 789, 999, time.Hour)
+	assert.False(t, msgSvc.DeleteMessageCalled)
+
+	// Shutdown flushes the in-memory fallback instead of dropping it
+	assert.NoError(t, tracker.Shutdown(time.Second))
+	assert.True(t, msgSvc.DeleteMessageCalled)
+}
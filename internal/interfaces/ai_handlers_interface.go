@@ -1,11 +1,15 @@
 package interfaces
 
-import "github.com/PaulSonOfLars/gotgbot/v2"
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
 
 // AIHandlersInterface defines the interface for AI-related handlers.
 type AIHandlersInterface interface {
-	HandleGeneralTopicMessage(update *gotgbot.Update) error
-	HandleRetryCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleBackToSuggestionsCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleShowExistingFolders(update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error
+	HandleRetryCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleBackToSuggestionsCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleShowExistingFolders(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
 }
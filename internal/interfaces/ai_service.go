@@ -1,6 +1,13 @@
 package interfaces
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrAIUnavailable is returned without calling the provider while it is known to be down,
+// so callers can fall back to the manual topic picker at once
+var ErrAIUnavailable = errors.New("AI suggestions are unavailable")
 
 // AIServiceInterface abstracts AI operations
 // SuggestFolders returns a list of folder suggestions for a message
@@ -9,8 +16,44 @@ import "context"
 // SuggestFolders returns a list of folder suggestions for a message
 // messageText: the message to analyze
 // existingFolders: the folders already present
-// Returns: a list of suggested folders, or error
+// Returns: suggested folders, most confident first, or error
 
 type AIServiceInterface interface {
-	SuggestFolders(ctx context.Context, messageText string, existingFolders []string) ([]string, error)
+	SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts SuggestionOptions) ([]Suggestion, error)
+}
+
+// AIAvailabilityInterface is implemented by AI services that can tell, before a call, that
+// suggestions would fail with ErrAIUnavailable
+type AIAvailabilityInterface interface {
+	Available() bool
+}
+
+// Suggestion is one folder proposed for a message
+type Suggestion struct {
+	Name       string
+	Existing   bool    // Name is one of the existing folders, spelled as it is there
+	Confidence float64 // 0 to 1
+	Reason     string  // short explanation for the choice; may be empty
+	Similarity float64 // cosine similarity of the message to the topic's saves; 0 if not ranked by embeddings
+}
+
+// SuggestionOptions tunes a suggestion request to the user's settings
+type SuggestionOptions struct {
+	Count    int    // how many folders to suggest; 0 lets the model choose 2-3
+	Language string // language for new folder names, e.g. "en"; "" lets the model choose
+	ChatID   int64  // chat the message was sent in, for its privacy mode and saved history; 0 if unknown
+
+	// NewNamesOnly asks for new folder names only: the existing folders were ranked already
+	// and none of them is close
+	NewNamesOnly bool
+}
+
+// TopicEmbeddingsInterface keeps a centroid of the embeddings of each topic's saved messages
+// and ranks a chat's topics by how close a message is to them
+type TopicEmbeddingsInterface interface {
+	// Learn moves the topic's centroid towards text, just saved in it
+	Learn(ctx context.Context, chatID int64, topicName string, text string) error
+	// Rank returns topics by the similarity of text to their centroids, most similar first,
+	// as existing-topic suggestions with Similarity set
+	Rank(ctx context.Context, chatID int64, text string, topics []string) ([]Suggestion, error)
 }
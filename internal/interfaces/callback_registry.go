@@ -0,0 +1,41 @@
+package interfaces
+
+import "context"
+
+// CallbackAction is what an inline button does when pressed
+type CallbackAction string
+
+const (
+	CallbackSelectTopic       CallbackAction = "select_topic"
+	CallbackCreateTopic       CallbackAction = "create_topic"
+	CallbackShowAllTopics     CallbackAction = "show_all_topics"
+	CallbackBackToSuggestions CallbackAction = "back_to_suggestions"
+	CallbackRetry             CallbackAction = "retry"
+	CallbackWarningOk         CallbackAction = "warning_ok"
+	CallbackCancelTopicName   CallbackAction = "cancel_topic_name"
+	CallbackSearchPage        CallbackAction = "search_page"
+	CallbackDeleteTopic       CallbackAction = "delete_topic"
+	CallbackKeepTopic         CallbackAction = "keep_topic"
+	CallbackSettings          CallbackAction = "settings"
+)
+
+// Callback is the typed action behind an issued callback token
+type Callback struct {
+	Action    CallbackAction `json:"action"`
+	ChatID    int64          `json:"chat_id"`
+	MessageID int64          `json:"message_id"`           // the user's message the button acts on
+	TopicName string         `json:"topic_name,omitempty"` // CallbackSelectTopic, CallbackDeleteTopic and CallbackKeepTopic
+	ThreadID  int64          `json:"thread_id,omitempty"`  // CallbackDeleteTopic and CallbackKeepTopic only: the topic
+	Query     string         `json:"query,omitempty"`      // CallbackSearchPage only: the /search arguments
+	Page      int            `json:"page,omitempty"`       // CallbackSearchPage only: zero-based
+	UserID    int64          `json:"user_id,omitempty"`    // CallbackSettings only: whose settings the menu shows
+	Setting   string         `json:"setting,omitempty"`    // CallbackSettings only: the setting to change
+}
+
+// CallbackRegistryInterface issues short opaque callback data for inline buttons
+// and resolves it back to its action when the button is pressed.
+type CallbackRegistryInterface interface {
+	Issue(ctx context.Context, callback Callback) (string, error)
+	// Resolve reports false for data it did not issue or that has expired
+	Resolve(ctx context.Context, data string) (Callback, bool, error)
+}
@@ -0,0 +1,11 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// DeletionSchedulerInterface deletes messages later, surviving restarts
+type DeletionSchedulerInterface interface {
+	ScheduleDeletion(ctx context.Context, chatID int64, messageID int64, delay time.Duration) error
+}
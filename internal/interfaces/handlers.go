@@ -1,21 +1,29 @@
 package interfaces
 
-import "github.com/PaulSonOfLars/gotgbot/v2"
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
 
 type MessageHandlersInterface interface {
-	HandleStartCommand(update *gotgbot.Update) error
-	HandleHelpCommand(update *gotgbot.Update) error
-	HandleTopicsCommand(update *gotgbot.Update) error
-	HandleAddTopicCommand(update *gotgbot.Update) error
-	HandleBotMention(update *gotgbot.Update) error
-	HandleNonGeneralTopicMessage(update *gotgbot.Update) error
-	HandleGeneralTopicMessage(update *gotgbot.Update) error
+	HandleStartCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleHelpCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleTopicsCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleAddTopicCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleBotMention(ctx context.Context, update *gotgbot.Update) error
+	HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error
+	HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error
 }
 
 type CallbackHandlersInterface interface {
-	HandleCallbackQuery(update *gotgbot.Update) error
-	IsRecentlyMovedMessage(messageID int64) bool
-	CleanupMovedMessage(messageID int64)
-	IsWaitingForTopicName(userID int64) bool
-	HandleTopicNameEntry(update *gotgbot.Update) error
+	HandleCallbackQuery(ctx context.Context, update *gotgbot.Update) error
+	IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool
+	CleanupMovedMessage(ctx context.Context, messageID int64)
+	IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool
+	HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error
+	HandleCancelCommand(ctx context.Context, update *gotgbot.Update) error
 }
@@ -1,14 +1,16 @@
 package interfaces
 
 import (
+	"context"
+
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 type MessageServiceInterface interface {
-	DeleteMessage(chatID int64, messageID int) error
-	CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error
-	CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error)
-	SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error)
-	EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error)
-	AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error
+	DeleteMessage(ctx context.Context, chatID int64, messageID int) error
+	CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error
+	CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error)
+	SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error)
+	EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error)
+	AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error
 }
@@ -0,0 +1,66 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Content types recorded for saved messages
+const (
+	ContentText      = "text"
+	ContentPhoto     = "photo"
+	ContentVideo     = "video"
+	ContentAnimation = "animation"
+	ContentDocument  = "document"
+	ContentAudio     = "audio"
+	ContentVoice     = "voice"
+	ContentVideoNote = "video_note"
+	ContentSticker   = "sticker"
+	ContentLocation  = "location"
+	ContentContact   = "contact"
+	ContentPoll      = "poll"
+	ContentOther     = "other"
+)
+
+// ContentTypes lists every content type, for validating filters
+var ContentTypes = []string{
+	ContentText, ContentPhoto, ContentVideo, ContentAnimation, ContentDocument, ContentAudio, ContentVoice,
+	ContentVideoNote, ContentSticker, ContentLocation, ContentContact, ContentPoll, ContentOther,
+}
+
+// SearchQuery is what /search looks for in a chat's saved messages. Zero fields do not filter.
+type SearchQuery struct {
+	Words       []string // must all appear in the text or caption
+	Topic       string
+	ContentType string
+	Before      time.Time
+	After       time.Time
+}
+
+// SearchHit is a saved message found by a search
+type SearchHit struct {
+	ID             int64 // the index entry
+	ChatID         int64
+	ThreadID       int64
+	SavedMessageID int64 // the copy inside the topic; 0 if unknown
+	TopicName      string
+	ContentType    string
+	Snippet        string
+	SavedAt        time.Time
+}
+
+// SavedMessageIndexInterface records every message the bot saves into a topic,
+// so history, search and undo can find it again.
+type SavedMessageIndexInterface interface {
+	// RecordSave notes that savedBy saved original into topicName (threadID), where its
+	// copy is savedMessageID
+	RecordSave(ctx context.Context, original *gotgbot.Message, savedBy int64, threadID int64, topicName string, savedMessageID int64) error
+	// Search returns up to limit hits from offset on, and how many there are in all
+	Search(ctx context.Context, chatID int64, query SearchQuery, offset, limit int) ([]SearchHit, int, error)
+	// TopicSaves returns every save indexed in a topic, oldest first
+	TopicSaves(ctx context.Context, chatID int64, threadID int64) ([]SearchHit, error)
+	// MoveSave records that the save with index entry id was copied into another topic
+	MoveSave(ctx context.Context, id int64, threadID int64, topicName string, savedMessageID int64) error
+}
@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// SearchHandlersInterface defines the interface for searching saved messages.
+type SearchHandlersInterface interface {
+	HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleSearchPageCallback(ctx context.Context, update *gotgbot.Update, callback Callback) error
+}
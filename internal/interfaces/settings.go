@@ -0,0 +1,63 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"save-message/internal/config"
+)
+
+// Confirmation styles: what the bot does with the "Message saved" notice
+const (
+	ConfirmationTimed = "timed" // deleted after ConfirmationDelay
+	ConfirmationKept  = "kept"  // left in the chat
+	ConfirmationOff   = "off"   // not sent at all
+)
+
+// UserSettings is how the bot behaves for one user in one chat
+type UserSettings struct {
+	UserID            int64
+	ChatID            int64
+	AutoDelete        bool // remove the original message from General once saved
+	AutoDeleteDelay   time.Duration
+	ConfirmationStyle string
+	ConfirmationDelay time.Duration // how long timed confirmations and warnings stay
+	AIEnabled         bool          // without AI the bot offers the manual topic picker
+	SuggestionCount   int
+	Language          string // language of suggested topic names, e.g. "en"
+}
+
+// SettingsServiceInterface keeps each user's settings per chat
+type SettingsServiceInterface interface {
+	// Get returns the user's settings in the chat, or the defaults if they never changed any
+	Get(ctx context.Context, chatID int64, userID int64) (UserSettings, error)
+	Save(ctx context.Context, settings UserSettings) error
+}
+
+// ChatSettings is how the bot behaves for everyone in one chat; only its admins change them
+type ChatSettings struct {
+	ChatID      int64
+	PrivacyMode bool // message text never leaves the bot: suggestions come from the local classifier only
+}
+
+// ChatSettingsServiceInterface keeps each chat's settings
+type ChatSettingsServiceInterface interface {
+	// GetChat returns the chat's settings, or the defaults if its admins never changed any
+	GetChat(ctx context.Context, chatID int64) (ChatSettings, error)
+	SaveChat(ctx context.Context, settings ChatSettings) error
+}
+
+// DefaultUserSettings is how the bot behaves for a user who never opened /settings
+func DefaultUserSettings(chatID int64, userID int64) UserSettings {
+	return UserSettings{
+		UserID:            userID,
+		ChatID:            chatID,
+		AutoDelete:        config.DefaultAutoDelete,
+		AutoDeleteDelay:   config.DefaultMessageAutoDeleteDelay,
+		ConfirmationStyle: ConfirmationTimed,
+		ConfirmationDelay: config.DefaultConfirmationDelay,
+		AIEnabled:         config.DefaultAIEnabled,
+		SuggestionCount:   config.DefaultSuggestionCount,
+		Language:          config.DefaultLanguage,
+	}
+}
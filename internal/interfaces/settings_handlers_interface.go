@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// SettingsHandlersInterface defines the interface for the /settings menu.
+type SettingsHandlersInterface interface {
+	HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleSettingsCallback(ctx context.Context, update *gotgbot.Update, callback Callback) error
+}
@@ -0,0 +1,25 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// StateStoreInterface keeps short-lived interaction state, such as which message a button
+// belongs to or who is typing a topic name. Entries are grouped by namespace and expire after their TTL.
+type StateStoreInterface interface {
+	// Set stores value (JSON encoded) under namespace/key for ttl, replacing any earlier value
+	Set(ctx context.Context, namespace, key string, value interface{}, ttl time.Duration) error
+	// Get decodes the value under namespace/key into dest and reports whether one was found
+	Get(ctx context.Context, namespace, key string, dest interface{}) (bool, error)
+	// Take is Get followed by Delete as one step: of several concurrent callers only one finds the value
+	Take(ctx context.Context, namespace, key string, dest interface{}) (bool, error)
+	// DeleteIf deletes namespace/key only while it still holds value, so a value replaced
+	// since it was read survives; it reports whether anything was deleted
+	DeleteIf(ctx context.Context, namespace, key string, value interface{}) (bool, error)
+	Delete(ctx context.Context, namespace, key string) error
+	// Keys lists the unexpired keys in namespace, in no particular order
+	Keys(ctx context.Context, namespace string) ([]string, error)
+	// PurgeExpired drops expired entries and reports how many went
+	PurgeExpired(ctx context.Context) (int, error)
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// TelegramClientInterface abstracts calls to the Telegram Bot API.
+// Call invokes the given method with params and decodes the "result" field into result (which may be nil).
+type TelegramClientInterface interface {
+	Call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error
+}
@@ -1,18 +1,24 @@
 package interfaces
 
-import "github.com/PaulSonOfLars/gotgbot/v2"
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
 
 // TopicHandlersInterface defines the interface for topic-related handlers.
 type TopicHandlersInterface interface {
-	HandleNewTopicCreationRequest(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicSelectionCallback(update *gotgbot.Update, originalMsg *gotgbot.Message, callbackData string) error
-	HandleShowAllTopicsCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleCreateTopicMenuCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleShowAllTopicsMenuCallback(update *gotgbot.Update, originalMsg *gotgbot.Message) error
-	HandleTopicNameEntry(update *gotgbot.Update) error
-	IsRecentlyMovedMessage(messageID int64) bool
-	MarkMessageAsMoved(messageID int64)
-	CleanupMovedMessage(messageID int64)
-	IsWaitingForTopicName(userID int64) bool
-	GetMessageByCallbackData(callbackData string) *gotgbot.Message
+	HandleNewTopicCreationRequest(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicSelectionCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message, topicName string) error
+	HandleShowAllTopicsCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleCreateTopicMenuCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleShowAllTopicsMenuCallback(ctx context.Context, update *gotgbot.Update, originalMsg *gotgbot.Message) error
+	HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error
+	HandleCancelCommand(ctx context.Context, update *gotgbot.Update) error
+	HandleCancelTopicNameCallback(ctx context.Context, update *gotgbot.Update) error
+	IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool
+	MarkMessageAsMoved(ctx context.Context, messageID int64)
+	CleanupMovedMessage(ctx context.Context, messageID int64)
+	IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool
+	GetOriginalMessage(ctx context.Context, chatID, messageID int64) *gotgbot.Message
 }
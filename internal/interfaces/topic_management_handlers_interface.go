@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TopicManagementHandlersInterface defines the interface for the commands that change existing topics.
+type TopicManagementHandlersInterface interface {
+	// HandleTopicCommand handles /renametopic, /closetopic, /reopentopic, /deletetopic and /mergetopic
+	HandleTopicCommand(ctx context.Context, update *gotgbot.Update) error
+	// HandleDeleteTopicCallback answers the confirmation /deletetopic asks for
+	HandleDeleteTopicCallback(ctx context.Context, update *gotgbot.Update, callback Callback) error
+}
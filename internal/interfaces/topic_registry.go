@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TopicRegistryInterface keeps the known forum topics of a chat current
+// from the service messages Telegram posts when topics change.
+type TopicRegistryInterface interface {
+	// Observe records what msg tells about the chat's topics. It returns true when msg
+	// is a topic service message, which needs no further handling.
+	Observe(ctx context.Context, msg *gotgbot.Message) bool
+}
@@ -1,13 +1,35 @@
 package interfaces
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrTopicNotFound is returned by FindTopicByName when no topic matches the name
+var ErrTopicNotFound = errors.New("topic not found")
+
 type TopicServiceInterface interface {
-	GetForumTopics(chatID int64) ([]ForumTopic, error)
-	CreateForumTopic(chatID int64, name string) (int64, error)
-	TopicExists(chatID int64, name string) (bool, error)
-	FindTopicByName(chatID int64, name string) (int64, error)
+	GetForumTopics(ctx context.Context, chatID int64) ([]ForumTopic, error)
+	CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error)
+	TopicExists(ctx context.Context, chatID int64, name string) (bool, error)
+	FindTopicByName(ctx context.Context, chatID int64, name string) (int64, error)
+
+	// FindTopic and TopicByThread also find closed topics; both return ErrTopicNotFound
+	FindTopic(ctx context.Context, chatID int64, name string) (ForumTopic, error)
+	TopicByThread(ctx context.Context, chatID int64, threadID int64) (ForumTopic, error)
+	RenameForumTopic(ctx context.Context, chatID int64, threadID int64, name string) error
+	CloseForumTopic(ctx context.Context, chatID int64, threadID int64) error
+	ReopenForumTopic(ctx context.Context, chatID int64, threadID int64) error
+	// DeleteForumTopic deletes the topic and every message in it
+	DeleteForumTopic(ctx context.Context, chatID int64, threadID int64) error
+	// CanManageTopics reports whether the user may create, edit and delete topics in the chat
+	CanManageTopics(ctx context.Context, chatID int64, userID int64) (bool, error)
 }
 
 type ForumTopic struct {
-	Name string `json:"name"`
-	ID   int64  `json:"message_thread_id"`
+	Name              string `json:"name"`
+	ID                int64  `json:"message_thread_id"`
+	IconColor         int64  `json:"icon_color,omitempty"`
+	IconCustomEmojiID string `json:"icon_custom_emoji_id,omitempty"`
+	IsClosed          bool   `json:"-"` // known from the registry only
 }
@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// UpdateHandlerInterface consumes incoming updates, whichever way they were received.
+// router.Dispatcher is the production implementation.
+type UpdateHandlerInterface interface {
+	HandleUpdate(ctx context.Context, update *gotgbot.Update) error
+}
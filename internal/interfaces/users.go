@@ -0,0 +1,40 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// ErrUserNotFound is returned for a user who never sent the bot an update
+var ErrUserNotFound = errors.New("user not found")
+
+// UserProfile is what the bot knows about someone who sends it updates
+type UserProfile struct {
+	ID           int64
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	Chats        []UserChat // most recently used first
+}
+
+// UserChat is a chat a user has used the bot in
+type UserChat struct {
+	ChatID    int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// UserRegistryInterface records who sends the bot updates and where
+type UserRegistryInterface interface {
+	// Observe records the sender of update, and the chat it came from, as seen now.
+	// Failures are logged: recording a sender never stops the update being handled.
+	Observe(ctx context.Context, update *gotgbot.Update)
+	// Profile returns what is known about a user, or ErrUserNotFound
+	Profile(ctx context.Context, userID int64) (UserProfile, error)
+}
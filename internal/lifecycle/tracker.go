@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"save-message/internal/logutils"
+)
+
+// ErrDrainTimeout is returned by Shutdown when in-flight work outlives the deadline
+var ErrDrainTimeout = errors.New("in-flight work did not finish before the shutdown deadline")
+
+// Tracker keeps count of work that must finish before the process exits:
+// updates being handled, background AI calls and delayed cleanups.
+// A nil *Tracker is valid and simply runs work untracked.
+type Tracker struct {
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	stopping chan struct{}
+	stopped  bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewTracker creates a tracker whose work context lives until Shutdown gives up waiting
+func NewTracker() *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tracker{
+		stopping: make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Context is the context in-flight work should run under. Unlike the signal context it
+// stays alive while draining, and is only cancelled once the drain deadline has passed.
+func (t *Tracker) Context() context.Context {
+	if t == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// Do runs fn synchronously as tracked work
+func (t *Tracker) Do(fn func()) {
+	if t == nil {
+		fn()
+		return
+	}
+	t.wg.Add(1)
+	defer t.wg.Done()
+	fn()
+}
+
+// Go runs fn in a tracked goroutine
+func (t *Tracker) Go(fn func()) {
+	if t == nil {
+		go fn()
+		return
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		fn()
+	}()
+}
+
+// After runs fn once delay has passed, or as soon as shutdown starts, whichever is first.
+// Pending cleanups are flushed early rather than lost with the process.
+func (t *Tracker) After(delay time.Duration, fn func()) {
+	if t == nil {
+		go func() {
+			time.Sleep(delay)
+			fn()
+		}()
+		return
+	}
+	t.Go(func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.stopping:
+		}
+		fn()
+	})
+}
+
+// Shutdown flushes delayed work and waits for everything tracked to finish.
+// If that takes longer than timeout the work context is cancelled and ErrDrainTimeout returned.
+func (t *Tracker) Shutdown(timeout time.Duration) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.stopped {
+		t.stopped = true
+		close(t.stopping)
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		t.cancel()
+		logutils.Success("Tracker: drained in-flight work")
+		return nil
+	case <-timer.C:
+		t.cancel()
+		logutils.Warn("Tracker: shutdown deadline reached, cancelling in-flight work", "timeout", timeout.String())
+		return ErrDrainTimeout
+	}
+}
@@ -0,0 +1,61 @@
+package lifecycle
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_ShutdownWaitsForWork(t *testing.T) {
+	tracker := NewTracker()
+	var finished atomic.Bool
+	tracker.Go(func() {
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	assert.NoError(t, tracker.Shutdown(time.Second))
+	assert.True(t, finished.Load())
+	assert.Error(t, tracker.Context().Err(), "work context ends once drained")
+}
+
+func TestTracker_ShutdownFlushesDelayedWork(t *testing.T) {
+	tracker := NewTracker()
+	var ran atomic.Bool
+	tracker.After(time.Hour, func() { ran.Store(true) })
+
+	start := time.Now()
+	assert.NoError(t, tracker.Shutdown(time.Second))
+	assert.True(t, ran.Load(), "pending delayed work runs at shutdown instead of being dropped")
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestTracker_ShutdownDeadline(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+	defer close(release)
+	tracker.Go(func() {
+		select {
+		case <-tracker.Context().Done():
+		case <-release:
+		}
+	})
+
+	assert.ErrorIs(t, tracker.Shutdown(20*time.Millisecond), ErrDrainTimeout)
+	assert.Error(t, tracker.Context().Err(), "work still running past the deadline is cancelled")
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tracker *Tracker
+	done := make(chan struct{})
+	tracker.Go(func() { close(done) })
+	<-done
+
+	ran := false
+	tracker.Do(func() { ran = true })
+	assert.True(t, ran)
+	assert.NoError(t, tracker.Context().Err())
+	assert.NoError(t, tracker.Shutdown(time.Millisecond))
+}
@@ -2,15 +2,36 @@ package logutils
 
 import (
 	"os"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var logger *zap.SugaredLogger
+var (
+	mu     sync.Mutex
+	logger *zap.SugaredLogger
+)
 
 // Init initializes the global logger
 func Init() {
+	mu.Lock()
+	defer mu.Unlock()
+	logger = newLogger()
+}
+
+// current returns the global logger, initializing it on first use. Updates are
+// handled concurrently, so several goroutines may log for the first time at once.
+func current() *zap.SugaredLogger {
+	mu.Lock()
+	defer mu.Unlock()
+	if logger == nil {
+		logger = newLogger()
+	}
+	return logger
+}
+
+func newLogger() *zap.SugaredLogger {
 	config := zap.NewProductionConfig()
 	config.EncoderConfig.TimeKey = "timestamp"
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -30,57 +51,46 @@ func Init() {
 		panic("failed to initialize logger: " + err.Error())
 	}
 
-	logger = zapLogger.Sugar()
+	return zapLogger.Sugar()
 }
 
 // Info logs an info level message with structured fields
 func Info(funcName string, kv ...any) {
-	if logger == nil {
-		Init()
-	}
-	logger.Infow("▶️ "+funcName, kv...)
+	current().Infow("▶️ "+funcName, kv...)
 }
 
 // Warn logs a warning level message with structured fields
 func Warn(funcName string, kv ...any) {
-	if logger == nil {
-		Init()
-	}
-	logger.Warnw("⚠️ "+funcName, kv...)
+	current().Warnw("⚠️ "+funcName, kv...)
 }
 
 // Error logs an error level message with structured fields
 func Error(msg string, err error, fields ...any) {
-	if logger == nil {
-		Init()
-	}
+	l := current()
 	if err == nil {
-		logger.Errorw("❌ "+msg, append(fields, "error", "nil")...)
+		l.Errorw("❌ "+msg, append(fields, "error", "nil")...)
 		return
 	}
-	logger.Errorw("❌ "+msg, append(fields, "error", err.Error())...)
+	l.Errorw("❌ "+msg, append(fields, "error", err.Error())...)
 }
 
 // Debug logs a debug level message with structured fields
 func Debug(funcName string, kv ...any) {
-	if logger == nil {
-		Init()
-	}
-	logger.Debugw("🔍 "+funcName, kv...)
+	current().Debugw("🔍 "+funcName, kv...)
 }
 
 // Success logs a success message with structured fields
 func Success(funcName string, kv ...any) {
-	if logger == nil {
-		Init()
-	}
-	logger.Infow("✅ "+funcName, kv...)
+	current().Infow("✅ "+funcName, kv...)
 }
 
 // Sync flushes any buffered log entries
 func Sync() error {
-	if logger == nil {
+	mu.Lock()
+	l := logger
+	mu.Unlock()
+	if l == nil {
 		return nil
 	}
-	return logger.Sync()
+	return l.Sync()
 }
@@ -11,14 +11,16 @@ type MockAIHandlers struct{}
 
 var _ interfaces.AIHandlersInterface = (*MockAIHandlers)(nil)
 
-func (m *MockAIHandlers) HandleGeneralTopicMessage(u *gotgbot.Update) error { return nil }
-func (m *MockAIHandlers) HandleRetryCallback(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockAIHandlers) HandleGeneralTopicMessage(ctx context.Context, u *gotgbot.Update) error {
 	return nil
 }
-func (m *MockAIHandlers) HandleBackToSuggestionsCallback(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockAIHandlers) HandleRetryCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
 	return nil
 }
-func (m *MockAIHandlers) HandleShowExistingFolders(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockAIHandlers) HandleBackToSuggestionsCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	return nil
+}
+func (m *MockAIHandlers) HandleShowExistingFolders(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
 	return nil
 }
 
@@ -27,6 +29,6 @@ type MockAIService struct{}
 var _ interfaces.AIServiceInterface = (*MockAIService)(nil)
 
 func (m *MockAIService) SuggestCategories(messageText string) ([]string, error) { return nil, nil }
-func (m *MockAIService) SuggestFolders(ctx context.Context, messageText string, existingFolders []string) ([]string, error) {
+func (m *MockAIService) SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
 	return nil, nil
 }
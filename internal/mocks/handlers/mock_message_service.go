@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"save-message/internal/interfaces"
 
@@ -11,30 +12,37 @@ type MockMessageService struct {
 	DeleteMessageCalled   bool
 	SendMessageCalled     bool
 	SendMessageShouldFail bool
+
+	// Optional overrides for simulating Bot API errors
+	DeleteMessageErr error
+	SendMessageFunc  func(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error)
 }
 
 var _ interfaces.MessageServiceInterface = (*MockMessageService)(nil)
 
-func (m *MockMessageService) DeleteMessage(chatID int64, messageID int) error {
+func (m *MockMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	m.DeleteMessageCalled = true
-	return nil
+	return m.DeleteMessageErr
 }
-func (m *MockMessageService) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+func (m *MockMessageService) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
 	return nil
 }
-func (m *MockMessageService) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (m *MockMessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (m *MockMessageService) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (m *MockMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	m.SendMessageCalled = true
+	if m.SendMessageFunc != nil {
+		return m.SendMessageFunc(ctx, chatID, text, opts)
+	}
 	if m.SendMessageShouldFail {
 		return nil, errors.New("send failed")
 	}
 	return &gotgbot.Message{MessageId: 999, Chat: gotgbot.Chat{Id: chatID}}, nil
 }
-func (m *MockMessageService) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (m *MockMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (m *MockMessageService) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (m *MockMessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	return nil
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"save-message/internal/interfaces"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// RecordedSave is one call to MockSavedMessageIndex.RecordSave
+type RecordedSave struct {
+	ChatID            int64
+	OriginalMessageID int64
+	SavedBy           int64
+	ThreadID          int64
+	TopicName         string
+	SavedMessageID    int64
+}
+
+// MovedSave is one call to MockSavedMessageIndex.MoveSave
+type MovedSave struct {
+	ID             int64
+	ThreadID       int64
+	TopicName      string
+	SavedMessageID int64
+}
+
+// MockSavedMessageIndex keeps the saves it is told about in memory
+type MockSavedMessageIndex struct {
+	mu    sync.Mutex
+	saves []RecordedSave
+	moves []MovedSave
+
+	// Optional overrides
+	SearchFunc     func(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error)
+	TopicSavesFunc func(ctx context.Context, chatID int64, threadID int64) ([]interfaces.SearchHit, error)
+}
+
+var _ interfaces.SavedMessageIndexInterface = (*MockSavedMessageIndex)(nil)
+
+func (m *MockSavedMessageIndex) RecordSave(ctx context.Context, original *gotgbot.Message, savedBy int64, threadID int64, topicName string, savedMessageID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saves = append(m.saves, RecordedSave{
+		ChatID:            original.Chat.Id,
+		OriginalMessageID: original.MessageId,
+		SavedBy:           savedBy,
+		ThreadID:          threadID,
+		TopicName:         topicName,
+		SavedMessageID:    savedMessageID,
+	})
+	return nil
+}
+
+func (m *MockSavedMessageIndex) Search(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error) {
+	if m.SearchFunc != nil {
+		return m.SearchFunc(ctx, chatID, query, offset, limit)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockSavedMessageIndex) TopicSaves(ctx context.Context, chatID int64, threadID int64) ([]interfaces.SearchHit, error) {
+	if m.TopicSavesFunc != nil {
+		return m.TopicSavesFunc(ctx, chatID, threadID)
+	}
+	return nil, nil
+}
+
+func (m *MockSavedMessageIndex) MoveSave(ctx context.Context, id int64, threadID int64, topicName string, savedMessageID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.moves = append(m.moves, MovedSave{ID: id, ThreadID: threadID, TopicName: topicName, SavedMessageID: savedMessageID})
+	return nil
+}
+
+// Moves returns the moves recorded so far
+func (m *MockSavedMessageIndex) Moves() []MovedSave {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MovedSave(nil), m.moves...)
+}
+
+// Saves returns the saves recorded so far
+func (m *MockSavedMessageIndex) Saves() []RecordedSave {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedSave(nil), m.saves...)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"save-message/internal/interfaces"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -10,42 +11,79 @@ type MockTopicHandlers struct{}
 
 var _ interfaces.TopicHandlersInterface = (*MockTopicHandlers)(nil)
 
-func (m *MockTopicHandlers) HandleNewTopicCreationRequest(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockTopicHandlers) HandleNewTopicCreationRequest(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
 	return nil
 }
-func (m *MockTopicHandlers) HandleTopicSelectionCallback(u *gotgbot.Update, msg *gotgbot.Message, cb string) error {
+func (m *MockTopicHandlers) HandleTopicSelectionCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message, topicName string) error {
 	return nil
 }
-func (m *MockTopicHandlers) HandleShowAllTopicsCallback(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockTopicHandlers) HandleShowAllTopicsCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
 	return nil
 }
-func (m *MockTopicHandlers) HandleCreateTopicMenuCallback(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockTopicHandlers) HandleCreateTopicMenuCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
 	return nil
 }
-func (m *MockTopicHandlers) HandleShowAllTopicsMenuCallback(u *gotgbot.Update, msg *gotgbot.Message) error {
+func (m *MockTopicHandlers) HandleShowAllTopicsMenuCallback(ctx context.Context, u *gotgbot.Update, msg *gotgbot.Message) error {
+	return nil
+}
+func (m *MockTopicHandlers) HandleTopicNameEntry(ctx context.Context, u *gotgbot.Update) error {
+	return nil
+}
+func (m *MockTopicHandlers) HandleCancelCommand(ctx context.Context, u *gotgbot.Update) error {
+	return nil
+}
+func (m *MockTopicHandlers) HandleCancelTopicNameCallback(ctx context.Context, u *gotgbot.Update) error {
+	return nil
+}
+func (m *MockTopicHandlers) IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool {
+	return false
+}
+func (m *MockTopicHandlers) MarkMessageAsMoved(ctx context.Context, messageID int64)  {}
+func (m *MockTopicHandlers) CleanupMovedMessage(ctx context.Context, messageID int64) {}
+func (m *MockTopicHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	return false
+}
+func (m *MockTopicHandlers) GetOriginalMessage(ctx context.Context, chatID, messageID int64) *gotgbot.Message {
 	return nil
 }
-func (m *MockTopicHandlers) HandleTopicNameEntry(u *gotgbot.Update) error        { return nil }
-func (m *MockTopicHandlers) IsRecentlyMovedMessage(messageID int64) bool         { return false }
-func (m *MockTopicHandlers) MarkMessageAsMoved(messageID int64)                  {}
-func (m *MockTopicHandlers) CleanupMovedMessage(messageID int64)                 {}
-func (m *MockTopicHandlers) IsWaitingForTopicName(userID int64) bool             { return false }
-func (m *MockTopicHandlers) GetMessageByCallbackData(cb string) *gotgbot.Message { return nil }
 
 type MockTopicService struct{}
 
 var _ interfaces.TopicServiceInterface = (*MockTopicService)(nil)
 
-func (m *MockTopicService) GetForumTopics(chatID int64) ([]interfaces.ForumTopic, error) {
+func (m *MockTopicService) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
 	return nil, nil
 }
-func (m *MockTopicService) CreateForumTopic(chatID int64, name string) (int64, error) { return 0, nil }
-func (m *MockTopicService) TopicExists(chatID int64, topicName string) (bool, error) {
+func (m *MockTopicService) CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error) {
+	return 0, nil
+}
+func (m *MockTopicService) TopicExists(ctx context.Context, chatID int64, topicName string) (bool, error) {
 	return false, nil
 }
-func (m *MockTopicService) FindTopicByName(chatID int64, topicName string) (int64, error) {
+func (m *MockTopicService) FindTopicByName(ctx context.Context, chatID int64, topicName string) (int64, error) {
 	return 0, nil
 }
+func (m *MockTopicService) FindTopic(ctx context.Context, chatID int64, topicName string) (interfaces.ForumTopic, error) {
+	return interfaces.ForumTopic{}, interfaces.ErrTopicNotFound
+}
+func (m *MockTopicService) TopicByThread(ctx context.Context, chatID int64, threadID int64) (interfaces.ForumTopic, error) {
+	return interfaces.ForumTopic{}, interfaces.ErrTopicNotFound
+}
+func (m *MockTopicService) RenameForumTopic(ctx context.Context, chatID int64, threadID int64, name string) error {
+	return nil
+}
+func (m *MockTopicService) CloseForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return nil
+}
+func (m *MockTopicService) ReopenForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return nil
+}
+func (m *MockTopicService) DeleteForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	return nil
+}
+func (m *MockTopicService) CanManageTopics(ctx context.Context, chatID int64, userID int64) (bool, error) {
+	return false, nil
+}
 func (m *MockTopicService) AddTopic(chatID int64, name string, messageThreadID int64, createdBy int64) error {
 	return nil
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"save-message/internal/interfaces"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -10,6 +11,9 @@ type MockWarningHandlers struct{}
 
 var _ interfaces.WarningHandlersInterface = (*MockWarningHandlers)(nil)
 
-func (m *MockWarningHandlers) HandleNonGeneralTopicMessage(u *gotgbot.Update) error { return nil }
-func (m *MockWarningHandlers) IsWarningCallback(cb string) bool                     { return false }
-func (m *MockWarningHandlers) HandleWarningOkCallback(u *gotgbot.Update) error      { return nil }
+func (m *MockWarningHandlers) HandleNonGeneralTopicMessage(ctx context.Context, u *gotgbot.Update) error {
+	return nil
+}
+func (m *MockWarningHandlers) HandleWarningOkCallback(ctx context.Context, u *gotgbot.Update) error {
+	return nil
+}
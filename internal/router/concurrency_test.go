@@ -0,0 +1,291 @@
+package router
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"save-message/internal/callbacks"
+	"save-message/internal/conversation"
+	"save-message/internal/database"
+	"save-message/internal/handlers"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/state"
+	"save-message/internal/updates"
+
+	gotgbot "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests wire the real handlers behind the dispatcher and feed it overlapping
+// updates, the way the poller and webhook do under load. Run them with -race.
+
+const concurrentChatID = -1001
+
+// concurrentMessageService is a message service safe for use from many goroutines
+type concurrentMessageService struct {
+	interfaces.MessageServiceInterface
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	copied   map[int64]int // original message ID -> destination thread
+	edits    int
+	deletes  int
+	answered int
+}
+
+func newConcurrentMessageService() *concurrentMessageService {
+	ms := &concurrentMessageService{copied: make(map[int64]int)}
+	ms.nextID.Store(50000)
+	return ms
+}
+
+func (m *concurrentMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	return &gotgbot.Message{MessageId: m.nextID.Add(1), Chat: gotgbot.Chat{Id: chatID}, Text: text}, nil
+}
+
+func (m *concurrentMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.edits++
+	return &gotgbot.Message{MessageId: messageID, Chat: gotgbot.Chat{Id: chatID}, Text: text}, nil
+}
+
+func (m *concurrentMessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.copied[int64(messageID)] = messageThreadID
+	return &gotgbot.Message{MessageId: m.nextID.Add(1), Chat: gotgbot.Chat{Id: chatID}}, nil
+}
+
+func (m *concurrentMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletes++
+	return nil
+}
+
+func (m *concurrentMessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answered++
+	return nil
+}
+
+// concurrentTopicService knows one topic, "Food", and records topics it is asked to create
+type concurrentTopicService struct {
+	interfaces.TopicServiceInterface
+
+	mu      sync.Mutex
+	created []string
+}
+
+func (ts *concurrentTopicService) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
+	return []interfaces.ForumTopic{{Name: "Food", ID: 10}}, nil
+}
+
+func (ts *concurrentTopicService) FindTopicByName(ctx context.Context, chatID int64, name string) (int64, error) {
+	if name == "Food" {
+		return 10, nil
+	}
+	return 0, interfaces.ErrTopicNotFound
+}
+
+func (ts *concurrentTopicService) CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.created = append(ts.created, name)
+	return 20, nil
+}
+
+type fixedSuggestions struct {
+	interfaces.AIServiceInterface
+}
+
+func (fixedSuggestions) SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	return []interfaces.Suggestion{{Name: "Food"}, {Name: "Recipes"}}, nil
+}
+
+func newConcurrentDispatcher(store interfaces.StateStoreInterface, ms *concurrentMessageService, ts *concurrentTopicService, tracker *lifecycle.Tracker) *Dispatcher {
+	registry := callbacks.NewRegistry(store)
+	topicHandlers := handlers.NewTopicHandlers(ms, ts)
+	topicHandlers.State = store
+	topicHandlers.Callbacks = registry
+	topicHandlers.Conversations = conversation.NewManager(store)
+	topicHandlers.Tracker = tracker
+	topicHandlers.MessageAutoDeleteDelay = time.Millisecond
+	topicHandlers.ConfirmationDeleteDelay = time.Millisecond
+	aiHandlers := handlers.NewAIHandlers(ms, ts, fixedSuggestions{}, topicHandlers)
+	warningHandlers := handlers.NewWarningHandlers(ms)
+	warningHandlers.Tracker = tracker
+	warningHandlers.Callbacks = registry
+
+	callbackHandlers := handlers.NewCallbackHandlers(ms, topicHandlers, aiHandlers, warningHandlers)
+	callbackHandlers.Callbacks = registry
+	messageHandlers := handlers.NewMessageHandlers(handlers.NewCommandHandlers(ms, ts), aiHandlers, topicHandlers, warningHandlers, ms, "savemessagebot")
+	dispatcher := NewDispatcher(messageHandlers, callbackHandlers, ms)
+	dispatcher.Callbacks = registry
+	return dispatcher
+}
+
+func generalMessage(userID, messageID int64, text string) *gotgbot.Update {
+	return &gotgbot.Update{Message: &gotgbot.Message{
+		MessageId: messageID,
+		Chat:      gotgbot.Chat{Id: concurrentChatID, Type: "supergroup", IsForum: true},
+		From:      &gotgbot.User{Id: userID},
+		Text:      text,
+	}}
+}
+
+// buttonPress taps a button for messageID, issued the way the keyboard builder issues it
+func buttonPress(t *testing.T, d *Dispatcher, userID, messageID int64, action interfaces.CallbackAction, topicName string) *gotgbot.Update {
+	data, err := d.Callbacks.Issue(context.Background(), interfaces.Callback{Action: action, ChatID: concurrentChatID, MessageID: messageID, TopicName: topicName})
+	require.NoError(t, err)
+	return &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+		Id:      "cb-" + data,
+		From:    gotgbot.User{Id: userID},
+		Data:    data,
+		Message: &gotgbot.Message{MessageId: 40000 + userID, Chat: gotgbot.Chat{Id: concurrentChatID, Type: "supergroup"}},
+	}}
+}
+
+func concurrentStores(t *testing.T) map[string]interfaces.StateStoreInterface {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return map[string]interfaces.StateStoreInterface{
+		"memory": state.NewMemoryStore(),
+		"sqlite": state.NewDatabaseStore(db),
+	}
+}
+
+func TestDispatcher_ConcurrentMessagesAndCallbacks(t *testing.T) {
+	const users = 25
+
+	for name, store := range concurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ms := newConcurrentMessageService()
+			ts := &concurrentTopicService{}
+			tracker := lifecycle.NewTracker()
+			dispatcher := newConcurrentDispatcher(store, ms, ts, tracker)
+			ctx := tracker.Context()
+
+			// Every user posts a message and taps "Food" right away, while the suggestions
+			// for their own and everyone else's messages are still being computed and stored
+			var wg sync.WaitGroup
+			for user := int64(1); user <= users; user++ {
+				user, messageID := user, 1000+user
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(user, messageID, "pasta recipe")))
+					assert.NoError(t, dispatcher.HandleUpdate(ctx, buttonPress(t, dispatcher, user, messageID, interfaces.CallbackSelectTopic, "Food")))
+				}()
+			}
+			wg.Wait()
+			require.NoError(t, tracker.Shutdown(5*time.Second))
+
+			ms.mu.Lock()
+			defer ms.mu.Unlock()
+			assert.Len(t, ms.copied, users, "every tapped message is saved exactly once")
+			for messageID, thread := range ms.copied {
+				assert.Equal(t, 10, thread, "message %d goes to Food", messageID)
+			}
+			assert.Equal(t, users, ms.answered)
+			assert.Equal(t, users, ms.edits, "every message gets its suggestion keyboard")
+			assert.Empty(t, ts.created)
+		})
+	}
+}
+
+func TestDispatcher_BehindExecutor(t *testing.T) {
+	const users = 10
+
+	ms := newConcurrentMessageService()
+	ts := &concurrentTopicService{}
+	tracker := lifecycle.NewTracker()
+	dispatcher := newConcurrentDispatcher(state.NewMemoryStore(), ms, ts, tracker)
+	executor := updates.NewExecutor(dispatcher, 4, 8)
+	executor.Tracker = tracker
+	executor.Start()
+
+	// Fed one by one like the poller does: each tap arrives right behind its message,
+	// and is handled only after that message's suggestions are shown
+	for user := int64(1); user <= users; user++ {
+		require.NoError(t, executor.HandleUpdate(context.Background(), generalMessage(user, 1000+user, "pasta recipe")))
+		require.NoError(t, executor.HandleUpdate(context.Background(), buttonPress(t, dispatcher, user, 1000+user, interfaces.CallbackSelectTopic, "Food")))
+	}
+	executor.Close()
+	require.NoError(t, tracker.Shutdown(5*time.Second))
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	assert.Len(t, ms.copied, users)
+	assert.Equal(t, users, ms.edits)
+	assert.Equal(t, uint64(2*users), executor.Stats().Handled)
+}
+
+func TestDispatcher_ConcurrentTopicNameEntries(t *testing.T) {
+	for name, store := range concurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ms := newConcurrentMessageService()
+			ts := &concurrentTopicService{}
+			tracker := lifecycle.NewTracker()
+			dispatcher := newConcurrentDispatcher(store, ms, ts, tracker)
+			ctx := tracker.Context()
+
+			require.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(7, 1007, "pasta recipe")))
+			require.NoError(t, dispatcher.HandleUpdate(ctx, buttonPress(t, dispatcher, 7, 1007, interfaces.CallbackCreateTopic, "")))
+
+			// The user sends the name twice in quick succession
+			var wg sync.WaitGroup
+			for i := int64(0); i < 2; i++ {
+				i := i
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(7, 2000+i, "Recipes")))
+				}()
+			}
+			wg.Wait()
+			require.NoError(t, tracker.Shutdown(5*time.Second))
+
+			ts.mu.Lock()
+			defer ts.mu.Unlock()
+			assert.Equal(t, []string{"Recipes"}, ts.created, "the topic is created once")
+		})
+	}
+}
+
+func TestDispatcher_TopicNamePromptRouting(t *testing.T) {
+	ms := newConcurrentMessageService()
+	ts := &concurrentTopicService{}
+	tracker := lifecycle.NewTracker()
+	dispatcher := newConcurrentDispatcher(state.NewMemoryStore(), ms, ts, tracker)
+	ctx := tracker.Context()
+
+	require.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(7, 1007, "pasta recipe")))
+	require.NoError(t, dispatcher.HandleUpdate(ctx, buttonPress(t, dispatcher, 7, 1007, interfaces.CallbackCreateTopic, "")))
+	require.True(t, dispatcher.IsNewTopicPrompt(ctx, generalMessage(7, 1008, "")))
+
+	// A command is handled as one and the prompt stays open
+	require.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(7, 1009, "/help")))
+	assert.True(t, dispatcher.IsNewTopicPrompt(ctx, generalMessage(7, 1010, "")))
+
+	// The same user writing in another group is not answering it
+	elsewhere := generalMessage(7, 1011, "Recipes")
+	elsewhere.Message.Chat.Id = concurrentChatID - 1
+	assert.False(t, dispatcher.IsNewTopicPrompt(ctx, elsewhere))
+
+	require.NoError(t, dispatcher.HandleUpdate(ctx, generalMessage(7, 1012, "/cancel")))
+	assert.False(t, dispatcher.IsNewTopicPrompt(ctx, generalMessage(7, 1013, "")))
+	require.NoError(t, tracker.Shutdown(5*time.Second))
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	assert.Empty(t, ts.created, "neither the command nor the cancel became a topic")
+}
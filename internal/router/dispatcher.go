@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -16,7 +17,10 @@ type Dispatcher struct {
 	MessageHandlers  interfaces.MessageHandlersInterface
 	CallbackHandlers interfaces.CallbackHandlersInterface
 	MessageService   interfaces.MessageServiceInterface
-	BotUserID        int64 // Add a BotUserID field to Dispatcher for bot self-detection
+	TopicRegistry    interfaces.TopicRegistryInterface    // Optional; learns topics from forum service messages
+	Callbacks        interfaces.CallbackRegistryInterface // Optional; resolves button tokens for IsTopicSelection
+	Users            interfaces.UserRegistryInterface     // Optional; records who sent each update
+	BotUserID        int64                                // Add a BotUserID field to Dispatcher for bot self-detection
 }
 
 // NewDispatcher creates a new Dispatcher.
@@ -33,7 +37,7 @@ func NewDispatcher(
 }
 
 // HandleUpdate routes an update to the appropriate handler
-func (d *Dispatcher) HandleUpdate(update *gotgbot.Update) error {
+func (d *Dispatcher) HandleUpdate(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("Raw update received", "update", update)
 	// Handle nil updates gracefully
 	if update == nil {
@@ -43,6 +47,10 @@ func (d *Dispatcher) HandleUpdate(update *gotgbot.Update) error {
 
 	logutils.Info("HandleUpdate", "updateID", update.UpdateId)
 
+	if d.Users != nil {
+		d.Users.Observe(ctx, update)
+	}
+
 	// Handle my_chat_member (bot added/removed or admin status changed)
 	if update.MyChatMember != nil {
 		chat := update.MyChatMember.Chat
@@ -109,7 +117,7 @@ func (d *Dispatcher) HandleUpdate(update *gotgbot.Update) error {
 		if isBot && (status == "member" || status == "administrator") {
 			logutils.Info("HandleUpdate: Bot added to group via my_chat_member, sending welcome message", "chatID", chat.Id)
 			fakeUpdate := &gotgbot.Update{Message: &gotgbot.Message{Chat: chat}}
-			err := d.MessageHandlers.HandleStartCommand(fakeUpdate)
+			err := d.MessageHandlers.HandleStartCommand(ctx, fakeUpdate)
 			if err != nil {
 				logutils.Error("HandleUpdate: Failed to send welcome message via my_chat_member", err, "chatID", chat.Id)
 			}
@@ -131,12 +139,12 @@ func (d *Dispatcher) HandleUpdate(update *gotgbot.Update) error {
 	// Handle callback queries (button clicks)
 	if update.CallbackQuery != nil {
 		logutils.Info("HandleUpdate: Routing to callback handler")
-		return d.CallbackHandlers.HandleCallbackQuery(update)
+		return d.CallbackHandlers.HandleCallbackQuery(ctx, update)
 	}
 
 	// Handle messages
 	if update.Message != nil {
-		return d.handleMessage(update)
+		return d.handleMessage(ctx, update)
 	}
 
 	logutils.Warn("HandleUpdate: Unknown update type")
@@ -144,7 +152,7 @@ func (d *Dispatcher) HandleUpdate(update *gotgbot.Update) error {
 }
 
 // handleMessage routes message updates to appropriate handlers
-func (d *Dispatcher) handleMessage(update *gotgbot.Update) error {
+func (d *Dispatcher) handleMessage(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("handleMessage", "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId, "threadID", update.Message.MessageThreadId)
 
 	// Prevent processing the bot's own join message as a regular message
@@ -162,65 +170,105 @@ func (d *Dispatcher) handleMessage(update *gotgbot.Update) error {
 		for _, member := range update.Message.NewChatMembers {
 			if member.Id == update.Message.From.Id { // Bot joined
 				logutils.Info("handleMessage: Bot joined chat, sending welcome message")
-				return d.MessageHandlers.HandleStartCommand(update)
+				return d.MessageHandlers.HandleStartCommand(ctx, update)
 			}
 		}
 	}
 
+	// Keep the topic registry current; topic service messages need no further handling
+	if d.TopicRegistry != nil && d.TopicRegistry.Observe(ctx, update.Message) {
+		logutils.Info("handleMessage: Recorded forum topic service message", "chatID", update.Message.Chat.Id, "threadID", update.Message.MessageThreadId)
+		return nil
+	}
+
+	// Topic management commands may be sent inside the topic they act on
+	if isTopicManagementCommand(commandName(update.Message.Text)) {
+		logutils.Info("handleMessage: Routing to topic management command handler")
+		return d.MessageHandlers.HandleTopicManagementCommand(ctx, update)
+	}
+
 	// Check if message is NOT in General topic (thread 0) - only allow messages in General
 	if update.Message.MessageThreadId != 0 {
 		logutils.Info("handleMessage: Message detected in non-General topic, routing to non-General handler")
-		return d.MessageHandlers.HandleNonGeneralTopicMessage(update)
+		return d.MessageHandlers.HandleNonGeneralTopicMessage(ctx, update)
 	}
 
 	// Check if message was recently moved
-	if d.CallbackHandlers.IsRecentlyMovedMessage(update.Message.MessageId) {
+	if d.CallbackHandlers.IsRecentlyMovedMessage(ctx, update.Message.MessageId) {
 		logutils.Info("handleMessage: Skipping recently moved message: %d", update.Message.MessageId)
-		d.CallbackHandlers.CleanupMovedMessage(update.Message.MessageId)
+		d.CallbackHandlers.CleanupMovedMessage(ctx, update.Message.MessageId)
 		return nil
 	}
 
-	// Check if user is waiting to provide a topic name
-	if d.CallbackHandlers.IsWaitingForTopicName(update.Message.From.Id) {
+	// Check if user is waiting to provide a topic name; commands still reach their handlers
+	if !strings.HasPrefix(update.Message.Text, "/") && d.CallbackHandlers.IsWaitingForTopicName(ctx, update.Message.Chat.Id, update.Message.From.Id) {
 		logutils.Info("handleMessage: User is waiting for topic name, routing to topic name handler")
-		return d.CallbackHandlers.HandleTopicNameEntry(update)
+		return d.CallbackHandlers.HandleTopicNameEntry(ctx, update)
 	}
 
 	// Handle commands
-	switch update.Message.Text {
+	switch commandName(update.Message.Text) {
 	case "/start":
 		logutils.Info("handleMessage: Routing to start command handler")
-		return d.MessageHandlers.HandleStartCommand(update)
+		return d.MessageHandlers.HandleStartCommand(ctx, update)
 	case "/help":
 		logutils.Info("handleMessage: Routing to help command handler")
-		return d.MessageHandlers.HandleHelpCommand(update)
+		return d.MessageHandlers.HandleHelpCommand(ctx, update)
 	case "/topics":
 		logutils.Info("handleMessage: Routing to topics command handler")
-		return d.MessageHandlers.HandleTopicsCommand(update)
+		return d.MessageHandlers.HandleTopicsCommand(ctx, update)
 	case "/addtopic":
 		logutils.Info("handleMessage: Routing to add topic command handler")
-		return d.MessageHandlers.HandleAddTopicCommand(update)
+		return d.MessageHandlers.HandleAddTopicCommand(ctx, update)
+	case "/cancel":
+		logutils.Info("handleMessage: Routing to cancel command handler")
+		return d.CallbackHandlers.HandleCancelCommand(ctx, update)
+	case "/search":
+		logutils.Info("handleMessage: Routing to search command handler")
+		return d.MessageHandlers.HandleSearchCommand(ctx, update)
+	case "/settings":
+		logutils.Info("handleMessage: Routing to settings command handler")
+		return d.MessageHandlers.HandleSettingsCommand(ctx, update)
 	default:
 		// Handle regular messages (not commands)
-		return d.handleRegularMessage(update)
+		return d.handleRegularMessage(ctx, update)
 	}
 }
 
+// commandName returns the command a message starts with, without arguments or @botname.
+// Other messages give "", or a word that matches no command.
+func commandName(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	name, _, _ := strings.Cut(strings.Fields(text)[0], "@")
+	return name
+}
+
+// isTopicManagementCommand reports whether command changes an existing topic
+func isTopicManagementCommand(command string) bool {
+	switch command {
+	case "/renametopic", "/closetopic", "/reopentopic", "/deletetopic", "/mergetopic":
+		return true
+	}
+	return false
+}
+
 // handleRegularMessage handles regular (non-command) messages
-func (d *Dispatcher) handleRegularMessage(update *gotgbot.Update) error {
+func (d *Dispatcher) handleRegularMessage(ctx context.Context, update *gotgbot.Update) error {
 	logutils.Info("handleRegularMessage", "chatID", update.Message.Chat.Id, "messageID", update.Message.MessageId)
 
 	// Check if the message mentions the bot (handle both possible usernames)
 	messageText := strings.ToLower(update.Message.Text)
 	if update.Message.Text != "" && (strings.Contains(messageText, "@savemessagbot") || strings.Contains(messageText, "@savemessagebot")) {
 		logutils.Info("handleRegularMessage: Message mentions bot, routing to bot mention handler")
-		return d.MessageHandlers.HandleBotMention(update)
+		return d.MessageHandlers.HandleBotMention(ctx, update)
 	}
 
 	// Check if this is a forum chat
 	if update.Message.Chat.Type == "supergroup" {
 		logutils.Info("handleRegularMessage: Message in supergroup, routing to General topic handler")
-		return d.MessageHandlers.HandleGeneralTopicMessage(update)
+		return d.MessageHandlers.HandleGeneralTopicMessage(ctx, update)
 	}
 
 	logutils.Info("handleRegularMessage: Message not in supergroup, skipping AI processing")
@@ -235,29 +283,25 @@ func (d *Dispatcher) IsEditRequest(update *gotgbot.Update) bool {
 	return strings.HasPrefix(update.Message.Text, "Edit:")
 }
 
-// IsTopicSelection checks if the callback is a topic selection
-func (d *Dispatcher) IsTopicSelection(update *gotgbot.Update) bool {
-	if update == nil || update.CallbackQuery == nil {
+// IsTopicSelection checks if the callback selects a topic for a message
+func (d *Dispatcher) IsTopicSelection(ctx context.Context, update *gotgbot.Update) bool {
+	if update == nil || update.CallbackQuery == nil || d.Callbacks == nil {
+		return false
+	}
+	callback, found, err := d.Callbacks.Resolve(ctx, update.CallbackQuery.Data)
+	if err != nil {
+		logutils.Error("IsTopicSelection: ResolveError", err, "callbackData", update.CallbackQuery.Data)
 		return false
 	}
-	callbackData := update.CallbackQuery.Data
-	// Topic selection callbacks have format: "TopicName_MessageId"
-	parts := strings.Split(callbackData, "_")
-	return len(parts) >= 2 && !strings.HasPrefix(callbackData, "create_new_folder_") &&
-		!strings.HasPrefix(callbackData, "retry_") &&
-		!strings.HasPrefix(callbackData, "show_all_topics_") &&
-		!strings.HasPrefix(callbackData, "back_to_suggestions_") &&
-		callbackData != "create_topic_menu" &&
-		callbackData != "show_all_topics_menu" &&
-		!strings.HasPrefix(callbackData, "detectMessageOnOtherTopic_ok_")
+	return found && callback.Action == interfaces.CallbackSelectTopic
 }
 
 // IsNewTopicPrompt checks if the user is waiting for a topic name
-func (d *Dispatcher) IsNewTopicPrompt(update *gotgbot.Update) bool {
+func (d *Dispatcher) IsNewTopicPrompt(ctx context.Context, update *gotgbot.Update) bool {
 	if update == nil || update.Message == nil || d.CallbackHandlers == nil {
 		return false
 	}
-	return d.CallbackHandlers.IsWaitingForTopicName(update.Message.From.Id)
+	return d.CallbackHandlers.IsWaitingForTopicName(ctx, update.Message.Chat.Id, update.Message.From.Id)
 }
 
 // IsMessageInGeneralTopic checks if the message is in the General topic
@@ -268,7 +312,7 @@ func (d *Dispatcher) IsMessageInGeneralTopic(update *gotgbot.Update) bool {
 	return update.Message.MessageThreadId == 0 && update.Message.Chat.Type == "supergroup"
 }
 
-func (d *Dispatcher) sendError(update *gotgbot.Update, err error) {
+func (d *Dispatcher) sendError(ctx context.Context, update *gotgbot.Update, err error) {
 	chatID := getChatID(update)
 	if chatID == 0 {
 		logutils.Error("sendError: Could not determine chat ID", err)
@@ -276,7 +320,7 @@ func (d *Dispatcher) sendError(update *gotgbot.Update, err error) {
 	}
 
 	logutils.Error("sendError: Sending error message to user", err, "chatID", chatID)
-	_, sendErr := d.MessageService.SendMessage(chatID, config.ErrorMessageFailed, nil)
+	_, sendErr := d.MessageService.SendMessage(ctx, chatID, config.ErrorMessageFailed, nil)
 	if sendErr != nil {
 		logutils.Error("sendError: Failed to send error message", sendErr, "chatID", chatID)
 	}
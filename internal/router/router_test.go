@@ -4,11 +4,15 @@ import (
 	"context"
 	"testing"
 
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
 	"save-message/internal/interfaces"
+	"save-message/internal/state"
 
 	gotgbot "github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // --- MOCKS FOR ROUTER TESTS ---
@@ -35,37 +39,37 @@ type testMessageService struct {
 	DeleteMessageErr                   error
 }
 
-func (t *testMessageService) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (t *testMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	t.SendMessageCalled = true
 	t.SendMessageArgs = []interface{}{chatID, text, opts}
 	return nil, t.SendMessageErr
 }
 
-func (t *testMessageService) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (t *testMessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	t.AnswerCallbackQueryCalled = true
 	t.AnswerCallbackQueryArgs = []interface{}{callbackQueryID, opts}
 	return t.AnswerCallbackQueryErr
 }
 
-func (t *testMessageService) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+func (t *testMessageService) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
 	t.CopyMessageToTopicCalled = true
 	t.CopyMessageToTopicArgs = []interface{}{chatID, fromChatID, messageID, messageThreadID}
 	return t.CopyMessageToTopicErr
 }
 
-func (t *testMessageService) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (t *testMessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 	t.CopyMessageToTopicWithResultCalled = true
 	t.CopyMessageToTopicWithResultArgs = []interface{}{chatID, fromChatID, messageID, messageThreadID}
 	return t.CopyMessageToTopicWithResultMsg, t.CopyMessageToTopicWithResultErr
 }
 
-func (t *testMessageService) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (t *testMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
 	t.EditMessageTextCalled = true
 	t.EditMessageTextArgs = []interface{}{chatID, messageID, text, opts}
 	return t.EditMessageTextMsg, t.EditMessageTextErr
 }
 
-func (t *testMessageService) DeleteMessage(chatID int64, messageID int) error {
+func (t *testMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	t.DeleteMessageCalled = true
 	t.DeleteMessageArgs = []interface{}{chatID, messageID}
 	return t.DeleteMessageErr
@@ -77,7 +81,7 @@ type MockMessageHandlers struct {
 	HandleMessageErr    error
 }
 
-func (m *MockMessageHandlers) HandleMessage(update *gotgbot.Update) error {
+func (m *MockMessageHandlers) HandleMessage(ctx context.Context, update *gotgbot.Update) error {
 	m.HandleMessageCalled = true
 	return m.HandleMessageErr
 }
@@ -89,11 +93,11 @@ type MockCallbackHandlers struct {
 	IsWaitingForTopicNameVal  bool
 }
 
-func (m *MockCallbackHandlers) HandleCallbackQuery(update *gotgbot.Update) error {
+func (m *MockCallbackHandlers) HandleCallbackQuery(ctx context.Context, update *gotgbot.Update) error {
 	m.HandleCallbackQueryCalled = true
 	return m.HandleCallbackQueryErr
 }
-func (m *MockCallbackHandlers) IsWaitingForTopicName(userID int64) bool {
+func (m *MockCallbackHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
 	return m.IsWaitingForTopicNameVal
 }
 
@@ -156,7 +160,7 @@ func TestDispatcher_HandleUpdate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := dispatcher.HandleUpdate(tt.update)
+			err := dispatcher.HandleUpdate(context.Background(), tt.update)
 
 			// The function should not panic and should handle all cases gracefully
 			if tt.expectError {
@@ -230,113 +234,46 @@ func TestDispatcher_IsEditRequest(t *testing.T) {
 }
 
 func TestDispatcher_IsTopicSelection(t *testing.T) {
-	dispatcher := &Dispatcher{}
+	ctx := context.Background()
+	registry := callbacks.NewRegistry(state.NewMemoryStore())
+	dispatcher := &Dispatcher{Callbacks: registry}
+	issue := func(action interfaces.CallbackAction, topicName string) string {
+		token, err := registry.Issue(ctx, interfaces.Callback{Action: action, ChatID: 456, MessageID: 123, TopicName: topicName})
+		require.NoError(t, err)
+		return token
+	}
+	press := func(data string) *gotgbot.Update {
+		return &gotgbot.Update{UpdateId: 2, CallbackQuery: &gotgbot.CallbackQuery{Data: data}}
+	}
 
 	tests := []struct {
 		name     string
 		update   *gotgbot.Update
 		expected bool
 	}{
-		{
-			name:     "nil update",
-			update:   nil,
-			expected: false,
-		},
-		{
-			name: "nil callback query",
-			update: &gotgbot.Update{
-				UpdateId: 1,
-			},
-			expected: false,
-		},
-		{
-			name: "topic selection",
-			update: &gotgbot.Update{
-				UpdateId: 2,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "Work_123",
-				},
-			},
-			expected: true,
-		},
-		{
-			name: "create new folder",
-			update: &gotgbot.Update{
-				UpdateId: 3,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "create_new_folder_123",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "retry callback",
-			update: &gotgbot.Update{
-				UpdateId: 4,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "retry_123",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "show all topics",
-			update: &gotgbot.Update{
-				UpdateId: 5,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "show_all_topics_123",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "back to suggestions",
-			update: &gotgbot.Update{
-				UpdateId: 6,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "back_to_suggestions_123",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "create topic menu",
-			update: &gotgbot.Update{
-				UpdateId: 7,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "create_topic_menu",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "show all topics menu",
-			update: &gotgbot.Update{
-				UpdateId: 8,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "show_all_topics_menu",
-				},
-			},
-			expected: false,
-		},
-		{
-			name: "detect message on other topic",
-			update: &gotgbot.Update{
-				UpdateId: 9,
-				CallbackQuery: &gotgbot.CallbackQuery{
-					Data: "detectMessageOnOtherTopic_ok_123",
-				},
-			},
-			expected: false,
-		},
+		{name: "nil update", update: nil, expected: false},
+		{name: "nil callback query", update: &gotgbot.Update{UpdateId: 1}, expected: false},
+		{name: "topic selection", update: press(issue(interfaces.CallbackSelectTopic, "Work")), expected: true},
+		{name: "topic name with underscores", update: press(issue(interfaces.CallbackSelectTopic, "show_all_topics")), expected: true},
+		{name: "create new topic", update: press(issue(interfaces.CallbackCreateTopic, "")), expected: false},
+		{name: "retry", update: press(issue(interfaces.CallbackRetry, "")), expected: false},
+		{name: "show all topics", update: press(issue(interfaces.CallbackShowAllTopics, "")), expected: false},
+		{name: "back to suggestions", update: press(issue(interfaces.CallbackBackToSuggestions, "")), expected: false},
+		{name: "warning ok", update: press(issue(interfaces.CallbackWarningOk, "")), expected: false},
+		{name: "create topic menu", update: press(config.CallbackDataCreateTopicMenu), expected: false},
+		{name: "show all topics menu", update: press(config.CallbackDataShowAllTopicsMenu), expected: false},
+		{name: "help", update: press(config.CallbackDataShowHelp), expected: false},
+		{name: "unissued data", update: press("Work_123"), expected: false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := dispatcher.IsTopicSelection(tt.update)
+			result := dispatcher.IsTopicSelection(ctx, tt.update)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
+
+	assert.False(t, (&Dispatcher{}).IsTopicSelection(ctx, press(issue(interfaces.CallbackSelectTopic, "Work"))), "no registry, no selection")
 }
 
 func TestDispatcher_IsNewTopicPrompt(t *testing.T) {
@@ -374,7 +311,7 @@ func TestDispatcher_IsNewTopicPrompt(t *testing.T) {
 			if tt.skip {
 				t.Skip("skipping test that requires a properly mocked CallbackHandlers")
 			}
-			result := dispatcher.IsNewTopicPrompt(tt.update)
+			result := dispatcher.IsNewTopicPrompt(context.Background(), tt.update)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -456,48 +393,84 @@ type fakeMessageHandlers struct {
 	mock.Mock
 }
 
-func (f *fakeMessageHandlers) HandleStartCommand(update *gotgbot.Update) error {
+func (f *fakeMessageHandlers) HandleStartCommand(ctx context.Context, update *gotgbot.Update) error {
 	f.Called(update)
 	return nil
 }
-func (f *fakeMessageHandlers) HandleHelpCommand(update *gotgbot.Update) error            { return nil }
-func (f *fakeMessageHandlers) HandleTopicsCommand(update *gotgbot.Update) error          { return nil }
-func (f *fakeMessageHandlers) HandleAddTopicCommand(update *gotgbot.Update) error        { return nil }
-func (f *fakeMessageHandlers) HandleBotMention(update *gotgbot.Update) error             { return nil }
-func (f *fakeMessageHandlers) HandleNonGeneralTopicMessage(update *gotgbot.Update) error { return nil }
-func (f *fakeMessageHandlers) HandleGeneralTopicMessage(update *gotgbot.Update) error    { return nil }
-func (f *fakeMessageHandlers) HandleTopicNameEntry(update *gotgbot.Update) error         { return nil }
+func (f *fakeMessageHandlers) HandleHelpCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleTopicsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleAddTopicCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleBotMention(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
 
 // Minimal fake implementation of CallbackHandlersInterface for testing
 // All methods are no-ops
 
 type fakeCallbackHandlers struct{}
 
-func (f *fakeCallbackHandlers) HandleCallbackQuery(update *gotgbot.Update) error  { return nil }
-func (f *fakeCallbackHandlers) IsRecentlyMovedMessage(messageID int64) bool       { return false }
-func (f *fakeCallbackHandlers) CleanupMovedMessage(messageID int64)               {}
-func (f *fakeCallbackHandlers) IsWaitingForTopicName(userID int64) bool           { return false }
-func (f *fakeCallbackHandlers) HandleTopicNameEntry(update *gotgbot.Update) error { return nil }
+func (f *fakeCallbackHandlers) HandleCallbackQuery(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeCallbackHandlers) IsRecentlyMovedMessage(ctx context.Context, messageID int64) bool {
+	return false
+}
+func (f *fakeCallbackHandlers) CleanupMovedMessage(ctx context.Context, messageID int64) {}
+func (f *fakeCallbackHandlers) IsWaitingForTopicName(ctx context.Context, chatID, userID int64) bool {
+	return false
+}
+func (f *fakeCallbackHandlers) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeCallbackHandlers) HandleCancelCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
 
 // Minimal fake implementation of MessageServiceInterface for testing
 // All methods are no-ops
 
 type fakeMessageService struct{}
 
-func (f *fakeMessageService) DeleteMessage(chatID int64, messageID int) error { return nil }
-func (f *fakeMessageService) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+func (f *fakeMessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	return nil
 }
-func (f *fakeMessageService) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (f *fakeMessageService) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+	return nil
+}
+func (f *fakeMessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (f *fakeMessageService) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (f *fakeMessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (f *fakeMessageService) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (f *fakeMessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
 	return nil, nil
 }
-func (f *fakeMessageService) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (f *fakeMessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	return nil
 }
 
@@ -523,7 +496,7 @@ func TestDispatcher_HandleUpdate_MyChatMember_BotAdded_SendsWelcome(t *testing.T
 
 	mh.On("HandleStartCommand", mock.Anything).Return(nil).Once()
 
-	err := d.HandleUpdate(update)
+	err := d.HandleUpdate(context.Background(), update)
 	assert.NoError(t, err)
 	mh.AssertCalled(t, "HandleStartCommand", mock.Anything)
 }
@@ -535,19 +508,40 @@ type fakeMessageHandlersForJoin struct {
 	called bool
 }
 
-func (f *fakeMessageHandlersForJoin) HandleGeneralTopicMessage(update *gotgbot.Update) error {
+func (f *fakeMessageHandlersForJoin) HandleGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
 	f.called = true
 	return nil
 }
-func (f *fakeMessageHandlersForJoin) HandleStartCommand(update *gotgbot.Update) error    { return nil }
-func (f *fakeMessageHandlersForJoin) HandleHelpCommand(update *gotgbot.Update) error     { return nil }
-func (f *fakeMessageHandlersForJoin) HandleTopicsCommand(update *gotgbot.Update) error   { return nil }
-func (f *fakeMessageHandlersForJoin) HandleAddTopicCommand(update *gotgbot.Update) error { return nil }
-func (f *fakeMessageHandlersForJoin) HandleBotMention(update *gotgbot.Update) error      { return nil }
-func (f *fakeMessageHandlersForJoin) HandleNonGeneralTopicMessage(update *gotgbot.Update) error {
+func (f *fakeMessageHandlersForJoin) HandleStartCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleHelpCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleTopicsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleAddTopicCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleSearchCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleSettingsCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleBotMention(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	return nil
+}
+func (f *fakeMessageHandlersForJoin) HandleTopicNameEntry(ctx context.Context, update *gotgbot.Update) error {
 	return nil
 }
-func (f *fakeMessageHandlersForJoin) HandleTopicNameEntry(update *gotgbot.Update) error { return nil }
 
 // Regression test: ensures that when the bot receives a join message for itself (new_chat_members contains the bot),
 // it does NOT process it as a regular message (i.e., does not call HandleGeneralTopicMessage or send 'Thinking...').
@@ -569,7 +563,117 @@ func TestDispatcher_HandleMessage_BotJoinMessage_IsIgnored(t *testing.T) {
 	}
 	update := &gotgbot.Update{Message: msg}
 
-	err := d.HandleUpdate(update)
+	err := d.HandleUpdate(context.Background(), update)
 	assert.NoError(t, err)
 	assert.False(t, mh.called, "HandleGeneralTopicMessage should NOT be called for bot's own join message")
 }
+
+type fakeTopicRegistry struct {
+	observed []*gotgbot.Message
+}
+
+func (f *fakeTopicRegistry) Observe(ctx context.Context, msg *gotgbot.Message) bool {
+	f.observed = append(f.observed, msg)
+	return msg.ForumTopicCreated != nil || msg.ForumTopicEdited != nil || msg.ForumTopicClosed != nil || msg.ForumTopicReopened != nil
+}
+
+type fakeMessageHandlersForTopics struct {
+	interfaces.MessageHandlersInterface
+	nonGeneralCalled      bool
+	topicManagementCalled bool
+}
+
+func (f *fakeMessageHandlersForTopics) HandleNonGeneralTopicMessage(ctx context.Context, update *gotgbot.Update) error {
+	f.nonGeneralCalled = true
+	return nil
+}
+
+func (f *fakeMessageHandlersForTopics) HandleTopicManagementCommand(ctx context.Context, update *gotgbot.Update) error {
+	f.topicManagementCalled = true
+	return nil
+}
+
+// Topic service messages arrive inside the topic they describe; they must update the registry
+// rather than be treated as a message posted in the wrong topic.
+func TestDispatcher_HandleMessage_ForumServiceMessages(t *testing.T) {
+	chat := gotgbot.Chat{Id: 12345, Type: "supergroup", IsForum: true}
+	from := &gotgbot.User{Id: 111}
+
+	tests := []struct {
+		name           string
+		msg            *gotgbot.Message
+		wantNonGeneral bool
+	}{
+		{"created", &gotgbot.Message{Chat: chat, From: from, MessageId: 7, MessageThreadId: 7, ForumTopicCreated: &gotgbot.ForumTopicCreated{Name: "Recipes"}}, false},
+		{"edited", &gotgbot.Message{Chat: chat, From: from, MessageId: 8, MessageThreadId: 7, ForumTopicEdited: &gotgbot.ForumTopicEdited{Name: "Cooking"}}, false},
+		{"closed", &gotgbot.Message{Chat: chat, From: from, MessageId: 9, MessageThreadId: 7, ForumTopicClosed: &gotgbot.ForumTopicClosed{}}, false},
+		{"reopened", &gotgbot.Message{Chat: chat, From: from, MessageId: 10, MessageThreadId: 7, ForumTopicReopened: &gotgbot.ForumTopicReopened{}}, false},
+		{"regular message in topic", &gotgbot.Message{Chat: chat, From: from, MessageId: 11, MessageThreadId: 7, Text: "hi"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mh := &fakeMessageHandlersForTopics{}
+			registry := &fakeTopicRegistry{}
+			d := NewDispatcher(mh, &fakeCallbackHandlers{}, &fakeMessageService{})
+			d.TopicRegistry = registry
+
+			err := d.HandleUpdate(context.Background(), &gotgbot.Update{Message: tt.msg})
+			assert.NoError(t, err)
+			assert.Equal(t, []*gotgbot.Message{tt.msg}, registry.observed)
+			assert.Equal(t, tt.wantNonGeneral, mh.nonGeneralCalled)
+		})
+	}
+}
+
+// Topic management commands act on the topic they are sent in, so they are not warned about
+func TestDispatcher_HandleMessage_TopicManagementCommands(t *testing.T) {
+	chat := gotgbot.Chat{Id: 12345, Type: "supergroup", IsForum: true}
+	from := &gotgbot.User{Id: 111}
+
+	tests := []struct {
+		name                string
+		msg                 *gotgbot.Message
+		wantTopicManagement bool
+		wantNonGeneral      bool
+	}{
+		{"inside the topic", &gotgbot.Message{Chat: chat, From: from, MessageThreadId: 7, IsTopicMessage: true, Text: "/closetopic"}, true, false},
+		{"with bot name", &gotgbot.Message{Chat: chat, From: from, Text: "/mergetopic@savemessagebot Old New"}, true, false},
+		{"other command inside a topic", &gotgbot.Message{Chat: chat, From: from, MessageThreadId: 7, IsTopicMessage: true, Text: "/topics"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mh := &fakeMessageHandlersForTopics{}
+			d := NewDispatcher(mh, &fakeCallbackHandlers{}, &fakeMessageService{})
+
+			assert.NoError(t, d.HandleUpdate(context.Background(), &gotgbot.Update{Message: tt.msg}))
+			assert.Equal(t, tt.wantTopicManagement, mh.topicManagementCalled)
+			assert.Equal(t, tt.wantNonGeneral, mh.nonGeneralCalled)
+		})
+	}
+}
+
+type fakeUserRegistry struct {
+	observed []*gotgbot.Update
+}
+
+func (f *fakeUserRegistry) Observe(ctx context.Context, update *gotgbot.Update) {
+	f.observed = append(f.observed, update)
+}
+
+func (f *fakeUserRegistry) Profile(ctx context.Context, userID int64) (interfaces.UserProfile, error) {
+	return interfaces.UserProfile{}, interfaces.ErrUserNotFound
+}
+
+// Every update's sender is recorded before it is routed
+func TestDispatcher_HandleUpdate_RecordsSender(t *testing.T) {
+	users := &fakeUserRegistry{}
+	d := NewDispatcher(&fakeMessageHandlersForTopics{}, &fakeCallbackHandlers{}, &fakeMessageService{})
+	d.Users = users
+
+	update := &gotgbot.Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: 12345, Type: "private"}, From: &gotgbot.User{Id: 111}, Text: "hi"}}
+	assert.NoError(t, d.HandleUpdate(context.Background(), update))
+	assert.NoError(t, d.HandleUpdate(context.Background(), nil))
+	assert.Equal(t, []*gotgbot.Update{update}, users.observed)
+}
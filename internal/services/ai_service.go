@@ -2,9 +2,10 @@ package services
 
 import (
 	"context"
-	"net/http"
+	"errors"
 
 	"save-message/internal/ai"
+	"save-message/internal/config"
 	"save-message/internal/interfaces"
 	"save-message/internal/logutils"
 )
@@ -12,28 +13,142 @@ import (
 // AIService handles AI-powered folder suggestions
 type AIService struct {
 	openAIClient ai.OpenAIClientInterface
+
+	// Local suggests from the chat's own saves without sending text anywhere. Optional; it
+	// answers when the provider fails and is the only engine in chats with privacy mode on.
+	Local interfaces.AIServiceInterface
+
+	// Chats tells which chats turned privacy mode on. Optional; without it no chat is private.
+	Chats interfaces.ChatSettingsServiceInterface
+
+	// Embeddings ranks the chat's topics by similarity to the message before the provider is
+	// asked. Optional; when a topic is close the provider is not asked at all, otherwise it is
+	// asked for new names only, offered after the nearest topics.
+	Embeddings interfaces.TopicEmbeddingsInterface
+	// MatchThreshold is the similarity from which a topic counts as close; 0 means
+	// config.DefaultEmbeddingMatchThreshold
+	MatchThreshold float64
 }
 
-// NewAIService creates a new AI service
-func NewAIService(openaiKey string, client interfaces.HTTPClient) *AIService {
-	if client == nil {
-		client = &http.Client{}
-	}
+// NewAIService creates a new AI service asking client, built by ai.NewClient for the configured provider
+func NewAIService(client ai.OpenAIClientInterface) *AIService {
 	return &AIService{
-		openAIClient: ai.NewOpenAIClient(openaiKey, client),
+		openAIClient: client,
 	}
 }
 
 // SuggestFolders suggests folders based on message content
-func (as *AIService) SuggestFolders(ctx context.Context, messageText string, existingFolders []string) ([]string, error) {
-	logutils.Info("SuggestFolders", "messageText", messageText, "existingFolders", existingFolders)
+func (as *AIService) SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	logutils.Info("SuggestFolders", "messageText", messageText, "existingFolders", existingFolders, "count", opts.Count, "language", opts.Language)
+
+	if privateChat(ctx, as.Chats, opts.ChatID) {
+		if as.Local == nil {
+			logutils.Warn("SuggestFolders: Privacy mode without a local suggester", "chatID", opts.ChatID)
+			return nil, interfaces.ErrAIUnavailable
+		}
+		return as.Local.SuggestFolders(ctx, messageText, existingFolders, opts)
+	}
+
+	count := opts.Count
+	if count <= 0 {
+		count = config.DefaultSuggestionCount
+	}
+	nearest := as.nearest(ctx, messageText, existingFolders, opts)
+	if matches := as.closeTopics(nearest, count); len(matches) > 0 {
+		logutils.Success("SuggestFolders: close topics", "suggestions_count", len(matches), "similarity", matches[0].Similarity)
+		return matches, nil
+	}
 
-	suggestions, err := as.openAIClient.SuggestFolders(ctx, messageText, existingFolders)
+	providerOpts := opts
+	providerOpts.NewNamesOnly = len(nearest) > 0
+	suggestions, err := as.openAIClient.SuggestFolders(ctx, messageText, existingFolders, providerOpts)
+	if err != nil && len(nearest) > 0 && !errors.Is(err, context.Canceled) {
+		logutils.Warn("SuggestFolders: OpenAIClientError, offering the nearest topics", "error", err.Error(), "chatID", opts.ChatID)
+		return nearest[:min(count, len(nearest))], nil
+	}
+	if err != nil && as.Local != nil && !errors.Is(err, context.Canceled) {
+		logutils.Warn("SuggestFolders: OpenAIClientError, asking the local suggester", "error", err.Error(), "chatID", opts.ChatID)
+		return as.Local.SuggestFolders(ctx, messageText, existingFolders, opts)
+	}
 	if err != nil {
 		logutils.Error("SuggestFolders: OpenAIClientError", err, "messageText", messageText)
 		return nil, err
 	}
 
+	if len(nearest) > 0 {
+		suggestions = withNearest(nearest, suggestions, count)
+	}
+
 	logutils.Success("SuggestFolders", "suggestions_count", len(suggestions))
 	return suggestions, nil
 }
+
+// nearest ranks the existing folders by embeddings, or returns nil when they cannot be
+// ranked, leaving it all to the provider
+func (as *AIService) nearest(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) []interfaces.Suggestion {
+	if as.Embeddings == nil || opts.ChatID == 0 || len(existingFolders) == 0 {
+		return nil
+	}
+	ranked, err := as.Embeddings.Rank(ctx, opts.ChatID, messageText, existingFolders)
+	if err != nil {
+		logutils.Warn("SuggestFolders: RankError, asking the provider alone", "error", err.Error(), "chatID", opts.ChatID)
+		return nil
+	}
+	return ranked
+}
+
+// closeTopics returns up to count of the ranked topics that are close to the message
+func (as *AIService) closeTopics(ranked []interfaces.Suggestion, count int) []interfaces.Suggestion {
+	threshold := as.MatchThreshold
+	if threshold == 0 {
+		threshold = config.DefaultEmbeddingMatchThreshold
+	}
+	var matches []interfaces.Suggestion
+	for _, topic := range ranked {
+		if topic.Similarity >= threshold && len(matches) < count {
+			matches = append(matches, topic)
+		}
+	}
+	return matches
+}
+
+// withNearest offers the nearest topics first, then the provider's new names. The new names
+// take at most count-1 of the count places, so the nearest topic is always among them.
+func withNearest(nearest []interfaces.Suggestion, suggestions []interfaces.Suggestion, count int) []interfaces.Suggestion {
+	var names []interfaces.Suggestion
+	for _, suggestion := range suggestions {
+		if !suggestion.Existing && len(names) < count-1 {
+			names = append(names, suggestion)
+		}
+	}
+	places := min(count-len(names), len(nearest))
+	return append(append([]interfaces.Suggestion(nil), nearest[:places]...), names...)
+}
+
+var _ interfaces.AIAvailabilityInterface = (*AIService)(nil)
+
+// Available reports whether suggestions can be asked for: false while the provider's circuit
+// is open, unless the local suggester can answer instead
+func (as *AIService) Available() bool {
+	if as.Local != nil {
+		return true
+	}
+	if availability, ok := as.openAIClient.(interfaces.AIAvailabilityInterface); ok {
+		return availability.Available()
+	}
+	return true
+}
+
+// privateChat reports whether the chat keeps message text from third parties. When that
+// cannot be told the text is kept back: a missed suggestion is better than a leaked message.
+func privateChat(ctx context.Context, chats interfaces.ChatSettingsServiceInterface, chatID int64) bool {
+	if chats == nil || chatID == 0 {
+		return false
+	}
+	settings, err := chats.GetChat(ctx, chatID)
+	if err != nil {
+		logutils.Error("privateChat: GetChatSettingsError, keeping the text local", err, "chatID", chatID)
+		return true
+	}
+	return settings.PrivacyMode
+}
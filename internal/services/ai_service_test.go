@@ -5,16 +5,19 @@ import (
 	"errors"
 	"testing"
 
+	"save-message/internal/interfaces"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MockOpenAIClient is a mock of the OpenAIClientInterface
 type MockOpenAIClient struct {
-	SuggestFoldersFunc func(ctx context.Context, messageText string, existingFolders []string) ([]string, error)
+	SuggestFoldersFunc func(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error)
 }
 
-func (m *MockOpenAIClient) SuggestFolders(ctx context.Context, messageText string, existingFolders []string) ([]string, error) {
-	return m.SuggestFoldersFunc(ctx, messageText, existingFolders)
+func (m *MockOpenAIClient) SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	return m.SuggestFoldersFunc(ctx, messageText, existingFolders, opts)
 }
 
 func TestAIService_SuggestFolders(t *testing.T) {
@@ -22,17 +25,17 @@ func TestAIService_SuggestFolders(t *testing.T) {
 		name                string
 		messageText         string
 		existingFolders     []string
-		mockSuggestions     []string
+		mockSuggestions     []interfaces.Suggestion
 		mockErr             error
-		expectedSuggestions []string
+		expectedSuggestions []interfaces.Suggestion
 		wantErr             bool
 	}{
 		{
 			name:                "success",
 			messageText:         "test message",
 			existingFolders:     []string{"Work"},
-			mockSuggestions:     []string{"Personal", "Projects"},
-			expectedSuggestions: []string{"Personal", "Projects"},
+			mockSuggestions:     []interfaces.Suggestion{{Name: "Personal"}, {Name: "Projects"}},
+			expectedSuggestions: []interfaces.Suggestion{{Name: "Personal"}, {Name: "Projects"}},
 			wantErr:             false,
 		},
 		{
@@ -46,16 +49,16 @@ func TestAIService_SuggestFolders(t *testing.T) {
 			name:                "empty message text",
 			messageText:         "",
 			existingFolders:     []string{"General"},
-			mockSuggestions:     []string{},
-			expectedSuggestions: []string{},
+			mockSuggestions:     []interfaces.Suggestion{},
+			expectedSuggestions: []interfaces.Suggestion{},
 			wantErr:             false,
 		},
 		{
 			name:                "no existing folders",
 			messageText:         "message",
 			existingFolders:     []string{},
-			mockSuggestions:     []string{"Inbox"},
-			expectedSuggestions: []string{"Inbox"},
+			mockSuggestions:     []interfaces.Suggestion{{Name: "Inbox"}},
+			expectedSuggestions: []interfaces.Suggestion{{Name: "Inbox"}},
 			wantErr:             false,
 		},
 	}
@@ -63,7 +66,7 @@ func TestAIService_SuggestFolders(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockClient := &MockOpenAIClient{
-				SuggestFoldersFunc: func(ctx context.Context, messageText string, existingFolders []string) ([]string, error) {
+				SuggestFoldersFunc: func(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
 					return tt.mockSuggestions, tt.mockErr
 				},
 			}
@@ -72,7 +75,7 @@ func TestAIService_SuggestFolders(t *testing.T) {
 			// Pass nil for the http client as it won't be used by the mock.
 			service := &AIService{openAIClient: mockClient}
 
-			suggestions, err := service.SuggestFolders(context.Background(), tt.messageText, tt.existingFolders)
+			suggestions, err := service.SuggestFolders(context.Background(), tt.messageText, tt.existingFolders, interfaces.SuggestionOptions{})
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -83,3 +86,130 @@ func TestAIService_SuggestFolders(t *testing.T) {
 		})
 	}
 }
+
+// fakeChatSettings hands out privacy mode for the chats in private, or fails with err
+type fakeChatSettings struct {
+	private map[int64]bool
+	err     error
+}
+
+func (f *fakeChatSettings) GetChat(ctx context.Context, chatID int64) (interfaces.ChatSettings, error) {
+	return interfaces.ChatSettings{ChatID: chatID, PrivacyMode: f.private[chatID]}, f.err
+}
+
+func (f *fakeChatSettings) SaveChat(ctx context.Context, settings interfaces.ChatSettings) error {
+	return f.err
+}
+
+func TestAIService_LocalSuggester(t *testing.T) {
+	remote := []interfaces.Suggestion{{Name: "Remote"}}
+	local := []interfaces.Suggestion{{Name: "Local", Existing: true}}
+	tests := []struct {
+		name       string
+		chatID     int64
+		chats      *fakeChatSettings
+		withLocal  bool
+		remoteErr  error
+		want       []interfaces.Suggestion
+		wantErr    error
+		wantRemote bool
+	}{
+		{name: "provider answers", chatID: -100, chats: &fakeChatSettings{}, withLocal: true, want: remote, wantRemote: true},
+		{name: "provider fails", chatID: -100, chats: &fakeChatSettings{}, withLocal: true, remoteErr: errors.New("quota"), want: local, wantRemote: true},
+		{name: "provider down", chatID: -100, withLocal: true, remoteErr: interfaces.ErrAIUnavailable, want: local, wantRemote: true},
+		{name: "privacy mode", chatID: -100, chats: &fakeChatSettings{private: map[int64]bool{-100: true}}, withLocal: true, want: local},
+		{name: "privacy mode without local suggester", chatID: -100, chats: &fakeChatSettings{private: map[int64]bool{-100: true}}, wantErr: interfaces.ErrAIUnavailable},
+		{name: "chat settings unreadable", chatID: -100, chats: &fakeChatSettings{err: errors.New("db down")}, withLocal: true, want: local},
+		{name: "provider fails without local suggester", chatID: -100, remoteErr: errors.New("quota"), wantErr: errors.New("quota"), wantRemote: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calledRemote := false
+			service := NewAIService(&MockOpenAIClient{
+				SuggestFoldersFunc: func(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+					calledRemote = true
+					return remote, tt.remoteErr
+				},
+			})
+			if tt.chats != nil {
+				service.Chats = tt.chats
+			}
+			if tt.withLocal {
+				service.Local = &MockOpenAIClient{
+					SuggestFoldersFunc: func(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+						return local, nil
+					},
+				}
+			}
+
+			got, err := service.SuggestFolders(context.Background(), "Cake", []string{"Local"}, interfaces.SuggestionOptions{ChatID: tt.chatID})
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr.Error(), err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.Equal(t, tt.wantRemote, calledRemote, "whether the text went to the provider")
+		})
+	}
+}
+
+func TestAIService_Embeddings(t *testing.T) {
+	ranked := []interfaces.Suggestion{
+		{Name: "Recipes", Existing: true, Confidence: 0.8, Similarity: 0.8},
+		{Name: "Baking", Existing: true, Confidence: 0.6, Similarity: 0.6},
+		{Name: "Work", Existing: true, Confidence: 0.1, Similarity: 0.1},
+	}
+	far := []interfaces.Suggestion{
+		{Name: "Work", Existing: true, Confidence: 0.3, Similarity: 0.3},
+		{Name: "Recipes", Existing: true, Confidence: 0.2, Similarity: 0.2},
+	}
+	fromProvider := []interfaces.Suggestion{
+		{Name: "Travel", Confidence: 0.9},
+		{Name: "Work", Existing: true, Confidence: 0.8},
+		{Name: "Italy", Confidence: 0.7},
+		{Name: "Rome", Confidence: 0.5},
+	}
+	tests := []struct {
+		name        string
+		ranker      *fixedRanker
+		remoteErr   error
+		want        []string
+		wantRemote  bool
+		wantNewOnly bool
+	}{
+		{name: "close topics skip the provider", ranker: &fixedRanker{ranked: ranked}, want: []string{"Recipes", "Baking"}},
+		{name: "nothing close: nearest first, then new names", ranker: &fixedRanker{ranked: far}, want: []string{"Work", "Travel", "Italy"}, wantRemote: true, wantNewOnly: true},
+		{name: "nothing close and the provider fails", ranker: &fixedRanker{ranked: far}, remoteErr: errors.New("quota"), want: []string{"Work", "Recipes"}, wantRemote: true, wantNewOnly: true},
+		{name: "ranking fails", ranker: &fixedRanker{err: errors.New("embeddings down")}, want: []string{"Travel", "Work", "Italy", "Rome"}, wantRemote: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked *interfaces.SuggestionOptions
+			service := NewAIService(&MockOpenAIClient{
+				SuggestFoldersFunc: func(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+					asked = &opts
+					if tt.remoteErr != nil {
+						return nil, tt.remoteErr
+					}
+					return fromProvider, nil
+				},
+			})
+			service.Embeddings = tt.ranker
+			service.MatchThreshold = 0.5
+
+			got, err := service.SuggestFolders(context.Background(), "Pasta", []string{"Recipes", "Baking", "Work"}, interfaces.SuggestionOptions{ChatID: -100, Count: 3})
+			require.NoError(t, err)
+			var names []string
+			for _, s := range got {
+				names = append(names, s.Name)
+			}
+			assert.Equal(t, tt.want, names)
+			require.Equal(t, tt.wantRemote, asked != nil, "whether the provider was asked")
+			if asked != nil {
+				assert.Equal(t, tt.wantNewOnly, asked.NewNamesOnly)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+	"save-message/internal/telegram"
+)
+
+// DeletionQueue persists delayed message deletions in the database and carries them out
+// with a worker, so pending cleanups survive crashes and deploys.
+type DeletionQueue struct {
+	db             database.DatabaseInterface
+	messageService interfaces.MessageServiceInterface
+
+	PollInterval time.Duration
+	RetryDelay   time.Duration
+	MaxAttempts  int
+	BatchSize    int
+
+	now func() time.Time
+}
+
+var _ interfaces.DeletionSchedulerInterface = (*DeletionQueue)(nil)
+
+// NewDeletionQueue creates a deletion queue with the default worker settings
+func NewDeletionQueue(db database.DatabaseInterface, messageService interfaces.MessageServiceInterface) *DeletionQueue {
+	return &DeletionQueue{
+		db:             db,
+		messageService: messageService,
+		PollInterval:   config.DefaultDeletionPollInterval,
+		RetryDelay:     config.DefaultDeletionRetryDelay,
+		MaxAttempts:    config.DefaultDeletionMaxAttempts,
+		BatchSize:      config.DefaultDeletionBatchSize,
+		now:            time.Now,
+	}
+}
+
+// ScheduleDeletion records that a message must be deleted once delay has passed
+func (dq *DeletionQueue) ScheduleDeletion(ctx context.Context, chatID int64, messageID int64, delay time.Duration) error {
+	id, err := dq.db.ScheduleDeletion(chatID, messageID, dq.now().Add(delay))
+	if err != nil {
+		logutils.Error("ScheduleDeletion", err, "chatID", chatID, "messageID", messageID)
+		return err
+	}
+	logutils.Debug("ScheduleDeletion", "id", id, "chatID", chatID, "messageID", messageID, "delay", delay.String())
+	return nil
+}
+
+// Run carries out due deletions until ctx ends, including ones left over from earlier runs
+func (dq *DeletionQueue) Run(ctx context.Context) {
+	logutils.Info("DeletionQueue: worker started")
+	ticker := time.NewTicker(dq.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		dq.RunDue(ctx)
+		select {
+		case <-ctx.Done():
+			logutils.Info("DeletionQueue: worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue performs every deletion that is due now. It stops early when a job's outcome cannot
+// be recorded, since the job would come back in the next batch; the next tick tries again.
+func (dq *DeletionQueue) RunDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := dq.db.DueDeletions(dq.now(), dq.BatchSize)
+		if err != nil {
+			logutils.Error("DeletionQueue: DueDeletionsError", err)
+			return
+		}
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := dq.execute(ctx, job); err != nil {
+				return
+			}
+		}
+		if len(jobs) < dq.BatchSize {
+			return
+		}
+	}
+}
+
+// execute deletes the job's message and records the outcome, returning an error only if recording failed
+func (dq *DeletionQueue) execute(ctx context.Context, job database.ScheduledDeletion) error {
+	// A delete already sent should finish even if shutdown starts meanwhile
+	err := dq.messageService.DeleteMessage(context.WithoutCancel(ctx), job.ChatID, int(job.MessageID))
+
+	switch {
+	case err == nil, telegram.IsMessageToDeleteNotFound(err):
+		// Someone already removed it; either way the job is done
+		return dq.record("CompleteDeletion", job, dq.db.CompleteDeletion(job.ID))
+
+	case !retryableDeletion(err) || job.Attempts+1 >= dq.MaxAttempts:
+		logutils.Error("DeletionQueue: giving up", err, "id", job.ID, "chatID", job.ChatID, "messageID", job.MessageID, "attempts", job.Attempts+1)
+		return dq.record("FailDeletion", job, dq.db.FailDeletion(job.ID, err.Error()))
+
+	default:
+		next := dq.now().Add(dq.RetryDelay * time.Duration(job.Attempts+1))
+		logutils.Warn("DeletionQueue: delete failed, retrying", "id", job.ID, "chatID", job.ChatID, "messageID", job.MessageID, "next", next, "error", err.Error())
+		return dq.record("RetryDeletion", job, dq.db.RetryDeletion(job.ID, next, err.Error()))
+	}
+}
+
+func (dq *DeletionQueue) record(step string, job database.ScheduledDeletion, err error) error {
+	if err != nil {
+		logutils.Error("DeletionQueue: "+step+"Error", err, "id", job.ID)
+	}
+	return err
+}
+
+// retryableDeletion reports whether a failed delete might succeed later.
+// Bad requests such as "message can't be deleted" never will; missing rights can be granted.
+func retryableDeletion(err error) bool {
+	tgErr, ok := telegram.AsTelegramError(err)
+	if !ok {
+		return true
+	}
+	if tgErr.Kind() == telegram.ErrorKindNotEnoughRights || tgErr.Kind() == telegram.ErrorKindTooManyRequests {
+		return true
+	}
+	return tgErr.ErrorCode >= 500
+}
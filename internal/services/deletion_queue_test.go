@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/telegram"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedDeleter fails deleteMessage with the scripted errors per message ID
+type scriptedDeleter struct {
+	interfaces.MessageServiceInterface
+	errs    map[int][]error
+	deleted []int
+}
+
+func (s *scriptedDeleter) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
+	if queue := s.errs[messageID]; len(queue) > 0 {
+		s.errs[messageID] = queue[1:]
+		return queue[0]
+	}
+	s.deleted = append(s.deleted, messageID)
+	return nil
+}
+
+func TestDeletionQueue_RunDue(t *testing.T) {
+	notFound := &telegram.TelegramError{ErrorCode: 400, Description: "Bad Request: message to delete not found"}
+	cantDelete := &telegram.TelegramError{ErrorCode: 400, Description: "Bad Request: message can't be deleted for everyone"}
+	serverError := &telegram.TelegramError{ErrorCode: 502, Description: "Bad Gateway"}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantDeleted  bool
+		wantPending  bool
+		wantAttempts int
+	}{
+		{name: "deleted", wantDeleted: true},
+		{name: "already gone counts as done", errs: []error{notFound}},
+		{name: "transient failure is retried", errs: []error{serverError}, wantPending: true, wantAttempts: 1},
+		{name: "network failure is retried", errs: []error{errors.New("connection reset")}, wantPending: true, wantAttempts: 1},
+		{name: "bad request is not retried", errs: []error{cantDelete}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewDatabase(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			deleter := &scriptedDeleter{errs: map[int][]error{7: tt.errs}}
+			queue := NewDeletionQueue(db, deleter)
+			require.NoError(t, queue.ScheduleDeletion(context.Background(), 123, 7, 0))
+
+			queue.RunDue(context.Background())
+
+			assert.Equal(t, tt.wantDeleted, len(deleter.deleted) == 1)
+			pending, err := db.DueDeletions(time.Now().Add(time.Hour), 10)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPending, len(pending) == 1)
+			if tt.wantPending {
+				assert.Equal(t, tt.wantAttempts, pending[0].Attempts)
+				assert.True(t, pending[0].ExecuteAt.After(time.Now()), "retry is pushed into the future")
+			}
+		})
+	}
+}
+
+func TestDeletionQueue_GivesUpAfterMaxAttempts(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	serverError := &telegram.TelegramError{ErrorCode: 500, Description: "Internal Server Error"}
+	deleter := &scriptedDeleter{errs: map[int][]error{7: {serverError, serverError, serverError}}}
+	queue := NewDeletionQueue(db, deleter)
+	queue.RetryDelay = 0
+	queue.MaxAttempts = 3
+	require.NoError(t, queue.ScheduleDeletion(context.Background(), 123, 7, 0))
+
+	for i := 0; i < 5; i++ {
+		queue.RunDue(context.Background())
+	}
+
+	assert.Empty(t, deleter.deleted)
+	pending, err := db.DueDeletions(time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "the job is marked failed instead of retried forever")
+}
+
+func TestDeletionQueue_PicksUpJobsAfterRestart(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Scheduled by a previous process that stopped before the delay passed
+	before := NewDeletionQueue(db, &scriptedDeleter{})
+	before.now = func() time.Time { return time.Now().Add(-time.Minute) }
+	require.NoError(t, before.ScheduleDeletion(context.Background(), 123, 7, 30*time.Second))
+	require.NoError(t, before.ScheduleDeletion(context.Background(), 123, 8, 2*time.Minute))
+
+	deleter := &scriptedDeleter{}
+	queue := NewDeletionQueue(db, deleter)
+	queue.PollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		pending, _ := db.DueDeletions(time.Now(), 10)
+		return len(pending) == 0
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, []int{7}, deleter.deleted, "only the overdue job runs; the other keeps its time")
+}
+
+// unrecordedDeletions cannot mark any deletion complete
+type unrecordedDeletions struct {
+	database.DatabaseInterface
+}
+
+func (unrecordedDeletions) CompleteDeletion(id int64) error {
+	return errors.New("database is locked")
+}
+
+func TestDeletionQueue_StopsWhenOutcomeIsNotRecorded(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	deleter := &scriptedDeleter{}
+	queue := NewDeletionQueue(unrecordedDeletions{db}, deleter)
+	queue.BatchSize = 2
+	for _, messageID := range []int64{7, 8, 9} {
+		require.NoError(t, queue.ScheduleDeletion(context.Background(), 123, messageID, 0))
+	}
+
+	queue.RunDue(context.Background())
+
+	assert.Equal(t, []int{7}, deleter.deleted, "the batch stops instead of fetching the same jobs again")
+}
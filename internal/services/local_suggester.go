@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+
+	"save-message/internal/ai"
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// LocalSuggester suggests topics with a classifier trained on the chat's own saved messages
+// and topic names. No text leaves the bot, so it serves chats in privacy mode and stands in
+// when the AI provider fails. It only suggests existing topics.
+type LocalSuggester struct {
+	db database.DatabaseInterface
+}
+
+var _ interfaces.AIServiceInterface = (*LocalSuggester)(nil)
+
+// NewLocalSuggester creates a local suggester learning from the saves in db
+func NewLocalSuggester(db database.DatabaseInterface) *LocalSuggester {
+	return &LocalSuggester{db: db}
+}
+
+// SuggestFolders suggests the existing folders messageText is most like, going by what was
+// saved in them before
+func (ls *LocalSuggester) SuggestFolders(ctx context.Context, messageText string, existingFolders []string, opts interfaces.SuggestionOptions) ([]interfaces.Suggestion, error) {
+	logutils.Info("LocalSuggester: SuggestFolders", "chatID", opts.ChatID, "existingFolders", existingFolders, "count", opts.Count)
+
+	var examples []ai.Example
+	if opts.ChatID != 0 {
+		saved, err := ls.db.SavedMessagesByChat(opts.ChatID, config.LocalClassifierHistory)
+		if err != nil {
+			logutils.Error("LocalSuggester: SavedMessagesByChatError", err, "chatID", opts.ChatID)
+			return nil, err
+		}
+		examples = make([]ai.Example, 0, len(saved))
+		for _, s := range saved {
+			text := s.Text
+			if text == "" {
+				text = s.Snippet
+			}
+			examples = append(examples, ai.Example{Topic: s.TopicName, Text: text})
+		}
+	}
+
+	suggestions := ai.NewClassifier(existingFolders, examples, config.LocalClassifierNameWeight).Classify(messageText, opts.Count)
+	logutils.Success("LocalSuggester: SuggestFolders", "chatID", opts.ChatID, "examples", len(examples), "suggestions_count", len(suggestions))
+	return suggestions, nil
+}
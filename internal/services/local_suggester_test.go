@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSuggester(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	saves := []database.SavedMessage{
+		{ChatID: -100, TopicName: "Recipes", Text: "Lemon cake with poppy seeds"},
+		{ChatID: -100, TopicName: "Recipes", Snippet: "Carrot cake, the one from the bakery"},
+		{ChatID: -100, TopicName: "Work", Text: "Invoice for the client, due Monday"},
+		{ChatID: -200, TopicName: "Work", Text: "cake cake cake"},
+	}
+	for i, save := range saves {
+		save.OriginalMessageID = int64(i + 1)
+		_, err := db.RecordSavedMessage(save)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	local := NewLocalSuggester(db)
+
+	got, err := local.SuggestFolders(ctx, "Chocolate cake for Sunday", []string{"Work", "Recipes"}, interfaces.SuggestionOptions{ChatID: -100, Count: 2})
+	require.NoError(t, err)
+	require.NotEmpty(t, got)
+	assert.Equal(t, "Recipes", got[0].Name, "learns from the chat's own saves only")
+
+	got, err = local.SuggestFolders(ctx, "Monday client call", []string{"Work", "Recipes"}, interfaces.SuggestionOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, got, "without a chat only topic names are known")
+}
@@ -1,13 +1,7 @@
 package services
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"strings"
-	"time"
-
+	"context"
 	"save-message/internal/database"
 	"save-message/internal/interfaces"
 	"save-message/internal/logutils"
@@ -17,63 +11,30 @@ import (
 
 // MessageService handles all message-related operations
 type MessageService struct {
-	BotToken string
-	db       database.DatabaseInterface
+	client interfaces.TelegramClientInterface
+	db     database.DatabaseInterface
 }
 
 // NewMessageService creates a new message service
-func NewMessageService(botToken string, db database.DatabaseInterface) *MessageService {
+func NewMessageService(client interfaces.TelegramClientInterface, db database.DatabaseInterface) *MessageService {
 	return &MessageService{
-		BotToken: botToken,
-		db:       db,
+		client: client,
+		db:     db,
 	}
 }
 
 var _ interfaces.MessageServiceInterface = (*MessageService)(nil)
 
 // DeleteMessage deletes a message from a chat
-func (ms *MessageService) DeleteMessage(chatID int64, messageID int) error {
+func (ms *MessageService) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	logutils.Info("DeleteMessage: entry", "chatID", chatID, "messageID", messageID)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/deleteMessage", ms.BotToken)
-
-	requestBody := map[string]interface{}{
+	err := ms.client.Call(ctx, "deleteMessage", map[string]interface{}{
 		"chat_id":    chatID,
 		"message_id": messageID,
-	}
-
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("DeleteMessage: CreateRequest", err, "chatID", chatID)
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	}, nil)
 	if err != nil {
-		logutils.Error("DeleteMessage: ExecuteRequest", err, "chatID", chatID)
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	logutils.Info("DeleteMessage: API response", "chatID", chatID, "messageID", messageID, "body", string(body))
-
-	var result struct {
-		Ok bool `json:"ok"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("DeleteMessage: ParseResponse", err, "body", string(body))
-		return err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to delete message: %s", string(body))
-		logutils.Warn("DeleteMessage: APIError", "error", err.Error())
+		logutils.Warn("DeleteMessage: APIError", "chatID", chatID, "messageID", messageID, "error", err.Error())
 		return err
 	}
 
@@ -82,177 +43,67 @@ func (ms *MessageService) DeleteMessage(chatID int64, messageID int) error {
 }
 
 // CopyMessageToTopic copies a message to a specific topic
-func (ms *MessageService) CopyMessageToTopic(chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
-	logutils.Info("CopyMessageToTopic", "chatID", chatID, "fromChatID", fromChatID, "messageID", messageID, "messageThreadID", messageThreadID)
-
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/copyMessage", ms.BotToken)
-
-	requestBody := map[string]interface{}{
-		"chat_id":           chatID,
-		"from_chat_id":      fromChatID,
-		"message_id":        messageID,
-		"message_thread_id": messageThreadID,
-	}
-
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("CopyMessageToTopic: CreateRequest", err, "chatID", chatID)
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logutils.Error("CopyMessageToTopic: ExecuteRequest", err, "chatID", chatID)
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Ok bool `json:"ok"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("CopyMessageToTopic: ParseResponse", err, "body", string(body))
-		return err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to copy message: %s", string(body))
-		logutils.Warn("CopyMessageToTopic: APIError", "error", err.Error())
-		return err
-	}
-
-	logutils.Success("CopyMessageToTopic", "chatID", chatID, "messageID", messageID, "messageThreadID", messageThreadID)
-	return nil
+func (ms *MessageService) CopyMessageToTopic(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) error {
+	_, err := ms.CopyMessageToTopicWithResult(ctx, chatID, fromChatID, messageID, messageThreadID)
+	return err
 }
 
 // CopyMessageToTopicWithResult copies a message to a topic and returns the new message
-func (ms *MessageService) CopyMessageToTopicWithResult(chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
+func (ms *MessageService) CopyMessageToTopicWithResult(ctx context.Context, chatID int64, fromChatID int64, messageID int, messageThreadID int) (*gotgbot.Message, error) {
 	logutils.Info("CopyMessageToTopicWithResult", "chatID", chatID, "fromChatID", fromChatID, "messageID", messageID, "messageThreadID", messageThreadID)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/copyMessage", ms.BotToken)
-
-	requestBody := map[string]interface{}{
+	var result gotgbot.Message
+	err := ms.client.Call(ctx, "copyMessage", map[string]interface{}{
 		"chat_id":           chatID,
 		"from_chat_id":      fromChatID,
 		"message_id":        messageID,
 		"message_thread_id": messageThreadID,
-	}
-
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
+	}, &result)
 	if err != nil {
-		logutils.Error("CopyMessageToTopicWithResult: CreateRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logutils.Error("CopyMessageToTopicWithResult: ExecuteRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Ok     bool            `json:"ok"`
-		Result gotgbot.Message `json:"result"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("CopyMessageToTopicWithResult: ParseResponse", err, "body", string(body))
-		return nil, err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to copy message: %s", string(body))
-		logutils.Warn("CopyMessageToTopicWithResult: APIError", "error", err.Error())
+		logutils.Warn("CopyMessageToTopicWithResult: APIError", "chatID", chatID, "messageID", messageID, "error", err.Error())
 		return nil, err
 	}
 
 	logutils.Success("CopyMessageToTopicWithResult", "chatID", chatID, "messageID", messageID, "messageThreadID", messageThreadID)
-	return &result.Result, nil
+	return &result, nil
 }
 
 // SendMessage sends a message to a chat
-func (ms *MessageService) SendMessage(chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+func (ms *MessageService) SendMessage(ctx context.Context, chatID int64, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
 	logutils.Info("SendMessage", "chatID", chatID, "text", text)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", ms.BotToken)
-
-	requestBody := map[string]interface{}{
+	params := map[string]interface{}{
 		"chat_id": chatID,
 		"text":    text,
 	}
 
 	if opts != nil {
 		if opts.ParseMode != "" {
-			requestBody["parse_mode"] = opts.ParseMode
+			params["parse_mode"] = opts.ParseMode
 		}
 		if opts.MessageThreadId != 0 {
-			requestBody["message_thread_id"] = opts.MessageThreadId
+			params["message_thread_id"] = opts.MessageThreadId
 		}
 		if opts.ReplyMarkup != nil {
-			requestBody["reply_markup"] = opts.ReplyMarkup
+			params["reply_markup"] = opts.ReplyMarkup
 		}
 	}
 
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("SendMessage: CreateRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logutils.Error("SendMessage: ExecuteRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Ok     bool            `json:"ok"`
-		Result gotgbot.Message `json:"result"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("SendMessage: ParseResponse", err, "body", string(body))
-		return nil, err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to send message: %s", string(body))
-		logutils.Warn("SendMessage: APIError", "error", err.Error())
+	var result gotgbot.Message
+	if err := ms.client.Call(ctx, "sendMessage", params, &result); err != nil {
+		logutils.Warn("SendMessage: APIError", "chatID", chatID, "error", err.Error())
 		return nil, err
 	}
 
-	logutils.Success("SendMessage", "chatID", chatID, "messageID", result.Result.MessageId)
-	return &result.Result, nil
+	logutils.Success("SendMessage", "chatID", chatID, "messageID", result.MessageId)
+	return &result, nil
 }
 
 // EditMessageText edits a message's text
-func (ms *MessageService) EditMessageText(chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
+func (ms *MessageService) EditMessageText(ctx context.Context, chatID int64, messageID int64, text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, error) {
 	logutils.Info("EditMessageText", "chatID", chatID, "messageID", messageID, "text", text)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageText", ms.BotToken)
-
-	requestBody := map[string]interface{}{
+	params := map[string]interface{}{
 		"chat_id":    chatID,
 		"message_id": messageID,
 		"text":       text,
@@ -260,105 +111,43 @@ func (ms *MessageService) EditMessageText(chatID int64, messageID int64, text st
 
 	if opts != nil {
 		if opts.ParseMode != "" {
-			requestBody["parse_mode"] = opts.ParseMode
+			params["parse_mode"] = opts.ParseMode
 		}
 		// Check if ReplyMarkup has any content
 		if len(opts.ReplyMarkup.InlineKeyboard) > 0 {
-			requestBody["reply_markup"] = opts.ReplyMarkup
+			params["reply_markup"] = opts.ReplyMarkup
 		}
 	}
 
-	bodyBytes, _ := json.Marshal(requestBody)
-	logutils.Info("EditMessageText: RequestBody", "body", string(bodyBytes))
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("EditMessageText: CreateRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logutils.Error("EditMessageText: ExecuteRequest", err, "chatID", chatID)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	logutils.Info("EditMessageText: ResponseBody", "body", string(body))
-
-	var result struct {
-		Ok     bool            `json:"ok"`
-		Result gotgbot.Message `json:"result"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("EditMessageText: ParseResponse", err, "body", string(body))
-		return nil, err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to edit message: %s", string(body))
-		logutils.Warn("EditMessageText: APIError", "error", err.Error())
+	var result gotgbot.Message
+	if err := ms.client.Call(ctx, "editMessageText", params, &result); err != nil {
+		logutils.Warn("EditMessageText: APIError", "chatID", chatID, "messageID", messageID, "error", err.Error())
 		return nil, err
 	}
 
 	logutils.Success("EditMessageText", "chatID", chatID, "messageID", messageID)
-	return &result.Result, nil
+	return &result, nil
 }
 
 // AnswerCallbackQuery answers a callback query
-func (ms *MessageService) AnswerCallbackQuery(callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
+func (ms *MessageService) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, opts *gotgbot.AnswerCallbackQueryOpts) error {
 	logutils.Info("AnswerCallbackQuery", "callbackQueryID", callbackQueryID)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/answerCallbackQuery", ms.BotToken)
-
-	requestBody := map[string]interface{}{
+	params := map[string]interface{}{
 		"callback_query_id": callbackQueryID,
 	}
 
 	if opts != nil {
 		if opts.Text != "" {
-			requestBody["text"] = opts.Text
+			params["text"] = opts.Text
 		}
 		if opts.ShowAlert {
-			requestBody["show_alert"] = opts.ShowAlert
+			params["show_alert"] = opts.ShowAlert
 		}
 	}
 
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("AnswerCallbackQuery: CreateRequest", err, "callbackQueryID", callbackQueryID)
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logutils.Error("AnswerCallbackQuery: ExecuteRequest", err, "callbackQueryID", callbackQueryID)
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Ok bool `json:"ok"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("AnswerCallbackQuery: ParseResponse", err, "body", string(body))
-		return err
-	}
-
-	if !result.Ok {
-		err := fmt.Errorf("failed to answer callback query: %s", string(body))
-		logutils.Warn("AnswerCallbackQuery: APIError", "error", err.Error())
+	if err := ms.client.Call(ctx, "answerCallbackQuery", params, nil); err != nil {
+		logutils.Warn("AnswerCallbackQuery: APIError", "callbackQueryID", callbackQueryID, "error", err.Error())
 		return err
 	}
 
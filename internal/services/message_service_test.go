@@ -1,21 +1,32 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/telegram"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
 )
 
 // MockDatabase for message service tests
 type MockMessageDatabase struct {
+	database.DatabaseInterface // topic registry methods are not used by MessageService
+
 	shouldErr bool
 	users     []database.User
 }
 
-func (m *MockMessageDatabase) UpsertUser(userID int64, username, firstName, lastName string) error {
+func (m *MockMessageDatabase) UpsertUser(u database.User, chatID int64, seenAt time.Time) error {
 	if m.shouldErr {
 		return sql.ErrConnDone
 	}
@@ -59,37 +70,70 @@ func (m *MockMessageDatabase) Close() error {
 	return nil
 }
 
+// fakeBotAPI is a local stand-in for the Telegram Bot API server
+type fakeBotAPI struct {
+	server   *httptest.Server
+	requests map[string]map[string]interface{}
+	respond  func(method string, params map[string]interface{}) string
+}
+
+// newFakeBotAPI starts a fake Bot API server; respond returns the raw JSON envelope for each call
+func newFakeBotAPI(t *testing.T, respond func(method string, params map[string]interface{}) string) *fakeBotAPI {
+	f := &fakeBotAPI{requests: make(map[string]map[string]interface{}), respond: respond}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		params := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		f.requests[method] = params
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(f.respond(method, params)))
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeBotAPI) client() *telegram.Client {
+	return telegram.NewClient("test-token", f.server.URL, f.server.Client())
+}
+
+// newFailingClient returns a client whose every call is rejected by the Bot API
+func newFailingClient(t *testing.T) interfaces.TelegramClientInterface {
+	return newFakeBotAPI(t, func(method string, params map[string]interface{}) string {
+		return `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	}).client()
+}
+
 func TestNewMessageService(t *testing.T) {
 	tests := []struct {
-		name     string
-		botToken string
-		db       database.DatabaseInterface
+		name   string
+		client interfaces.TelegramClientInterface
+		db     database.DatabaseInterface
 	}{
 		{
-			name:     "valid parameters",
-			botToken: "test-token",
-			db:       &database.Database{},
+			name:   "valid parameters",
+			client: telegram.NewClient("test-token", "", nil),
+			db:     &database.Database{},
 		},
 		{
-			name:     "empty bot token",
-			botToken: "",
-			db:       &database.Database{},
+			name:   "empty bot token",
+			client: telegram.NewClient("", "", nil),
+			db:     &database.Database{},
 		},
 		{
-			name:     "nil database",
-			botToken: "test-token",
-			db:       nil,
+			name:   "nil database",
+			client: telegram.NewClient("test-token", "", nil),
+			db:     nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := NewMessageService(tt.botToken, tt.db)
+			service := NewMessageService(tt.client, tt.db)
 			if service == nil {
 				t.Error("NewMessageService() returned nil")
 			}
-			if service.BotToken != tt.botToken {
-				t.Errorf("NewMessageService() BotToken = %s, want %s", service.BotToken, tt.botToken)
+			if service.client != tt.client {
+				t.Errorf("NewMessageService() client = %v, want %v", service.client, tt.client)
 			}
 			if service.db != tt.db {
 				t.Errorf("NewMessageService() db = %v, want %v", service.db, tt.db)
@@ -99,8 +143,7 @@ func TestNewMessageService(t *testing.T) {
 }
 
 func TestMessageService_DeleteMessage(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name      string
@@ -131,11 +174,11 @@ func TestMessageService_DeleteMessage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			err := service.DeleteMessage(tt.chatID, tt.messageID)
+			err := service.DeleteMessage(context.Background(), tt.chatID, tt.messageID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteMessage() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -144,8 +187,7 @@ func TestMessageService_DeleteMessage(t *testing.T) {
 }
 
 func TestMessageService_CopyMessageToTopic(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name            string
@@ -184,11 +226,11 @@ func TestMessageService_CopyMessageToTopic(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			err := service.CopyMessageToTopic(tt.chatID, tt.fromChatID, tt.messageID, tt.messageThreadID)
+			err := service.CopyMessageToTopic(context.Background(), tt.chatID, tt.fromChatID, tt.messageID, tt.messageThreadID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CopyMessageToTopic() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -197,8 +239,7 @@ func TestMessageService_CopyMessageToTopic(t *testing.T) {
 }
 
 func TestMessageService_CopyMessageToTopicWithResult(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name            string
@@ -229,11 +270,11 @@ func TestMessageService_CopyMessageToTopicWithResult(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			message, err := service.CopyMessageToTopicWithResult(tt.chatID, tt.fromChatID, tt.messageID, tt.messageThreadID)
+			message, err := service.CopyMessageToTopicWithResult(context.Background(), tt.chatID, tt.fromChatID, tt.messageID, tt.messageThreadID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CopyMessageToTopicWithResult() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -247,8 +288,7 @@ func TestMessageService_CopyMessageToTopicWithResult(t *testing.T) {
 }
 
 func TestMessageService_SendMessage(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name    string
@@ -286,11 +326,11 @@ func TestMessageService_SendMessage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			message, err := service.SendMessage(tt.chatID, tt.text, tt.opts)
+			message, err := service.SendMessage(context.Background(), tt.chatID, tt.text, tt.opts)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("SendMessage() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -304,8 +344,7 @@ func TestMessageService_SendMessage(t *testing.T) {
 }
 
 func TestMessageService_EditMessageText(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name      string
@@ -346,11 +385,11 @@ func TestMessageService_EditMessageText(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			message, err := service.EditMessageText(tt.chatID, tt.messageID, tt.text, tt.opts)
+			message, err := service.EditMessageText(context.Background(), tt.chatID, tt.messageID, tt.text, tt.opts)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("EditMessageText() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -364,8 +403,7 @@ func TestMessageService_EditMessageText(t *testing.T) {
 }
 
 func TestMessageService_AnswerCallbackQuery(t *testing.T) {
-	// Test with expected failure since we can't easily mock the Telegram API
-	// The service will fail when Telegram API calls fail, which is expected behavior
+	// The fake Bot API rejects every call, so the service must surface the API error
 
 	tests := []struct {
 		name            string
@@ -398,11 +436,11 @@ func TestMessageService_AnswerCallbackQuery(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			service := &MessageService{
-				BotToken: "test-token",
-				db:       &MockMessageDatabase{shouldErr: false},
+				client: newFailingClient(t),
+				db:     &MockMessageDatabase{shouldErr: false},
 			}
 
-			err := service.AnswerCallbackQuery(tt.callbackQueryID, tt.opts)
+			err := service.AnswerCallbackQuery(context.Background(), tt.callbackQueryID, tt.opts)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AnswerCallbackQuery() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -412,12 +450,12 @@ func TestMessageService_AnswerCallbackQuery(t *testing.T) {
 
 func TestMessageService_DBErrorPropagation(t *testing.T) {
 	service := &MessageService{
-		BotToken: "test-token",
-		db:       &MockMessageDatabase{shouldErr: true},
+		client: newFailingClient(t),
+		db:     &MockMessageDatabase{shouldErr: true},
 	}
 
 	t.Run("DeleteMessage with DB error (should not affect API call)", func(t *testing.T) {
-		err := service.DeleteMessage(123456, 789)
+		err := service.DeleteMessage(context.Background(), 123456, 789)
 		// Should still return API error, not DB error
 		if err == nil {
 			t.Error("expected error due to API failure, got nil")
@@ -425,14 +463,14 @@ func TestMessageService_DBErrorPropagation(t *testing.T) {
 	})
 
 	t.Run("CopyMessageToTopic with DB error (should not affect API call)", func(t *testing.T) {
-		err := service.CopyMessageToTopic(123456, 123456, 789, 1)
+		err := service.CopyMessageToTopic(context.Background(), 123456, 123456, 789, 1)
 		if err == nil {
 			t.Error("expected error due to API failure, got nil")
 		}
 	})
 
 	t.Run("SendMessage with DB error (should not affect API call)", func(t *testing.T) {
-		_, err := service.SendMessage(123456, "Test", nil)
+		_, err := service.SendMessage(context.Background(), 123456, "Test", nil)
 		if err == nil {
 			t.Error("expected error due to API failure, got nil")
 		}
@@ -448,12 +486,12 @@ func TestMessageService_NilPointerAndNilDB(t *testing.T) {
 				t.Error("expected panic on nil receiver, got none")
 			}
 		}()
-		nilService.DeleteMessage(123, 456)
+		nilService.DeleteMessage(context.Background(), 123, 456)
 	})
 }
 
 func TestMessageService_EdgeCases(t *testing.T) {
-	service := &MessageService{BotToken: "test-token", db: &MockMessageDatabase{shouldErr: false}}
+	service := &MessageService{client: newFailingClient(t), db: &MockMessageDatabase{shouldErr: false}}
 	tests := []struct {
 		name      string
 		chatID    int64
@@ -465,10 +503,58 @@ func TestMessageService_EdgeCases(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := service.DeleteMessage(tt.chatID, tt.messageID)
+			err := service.DeleteMessage(context.Background(), tt.chatID, tt.messageID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteMessage() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestMessageService_AgainstFakeBotAPI(t *testing.T) {
+	api := newFakeBotAPI(t, func(method string, params map[string]interface{}) string {
+		switch method {
+		case "sendMessage", "editMessageText":
+			return `{"ok":true,"result":{"message_id":42,"chat":{"id":123456,"type":"supergroup"},"text":"Test"}}`
+		case "copyMessage":
+			return `{"ok":true,"result":{"message_id":77}}`
+		default:
+			return `{"ok":true,"result":true}`
+		}
+	})
+	service := NewMessageService(api.client(), &MockMessageDatabase{})
+
+	t.Run("SendMessage decodes result and sends options", func(t *testing.T) {
+		msg, err := service.SendMessage(context.Background(), 123456, "Test", &gotgbot.SendMessageOpts{ParseMode: "Markdown", MessageThreadId: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), msg.MessageId)
+		assert.Equal(t, "Markdown", api.requests["sendMessage"]["parse_mode"])
+		assert.Equal(t, float64(5), api.requests["sendMessage"]["message_thread_id"])
+	})
+
+	t.Run("CopyMessageToTopicWithResult returns new message ID", func(t *testing.T) {
+		msg, err := service.CopyMessageToTopicWithResult(context.Background(), 123456, 123456, 789, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(77), msg.MessageId)
+		assert.Equal(t, float64(3), api.requests["copyMessage"]["message_thread_id"])
+	})
+
+	t.Run("EditMessageText succeeds", func(t *testing.T) {
+		msg, err := service.EditMessageText(context.Background(), 123456, 42, "Test", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), msg.MessageId)
+	})
+
+	t.Run("DeleteMessage and AnswerCallbackQuery succeed", func(t *testing.T) {
+		assert.NoError(t, service.DeleteMessage(context.Background(), 123456, 42))
+		assert.NoError(t, service.AnswerCallbackQuery(context.Background(), "cb-1", &gotgbot.AnswerCallbackQueryOpts{Text: "ok"}))
+		assert.Equal(t, "ok", api.requests["answerCallbackQuery"]["text"])
+	})
+
+	t.Run("cancelled context aborts the request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := service.SendMessage(ctx, 123456, "Test", nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
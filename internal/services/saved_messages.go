@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// SavedMessageIndex writes every save to the saved_messages table
+type SavedMessageIndex struct {
+	db  database.DatabaseInterface
+	now func() time.Time
+
+	// Embeddings learns each save's topic centroid from its text. Optional; it runs in the
+	// background under Tracker, so the save never waits for it or fails because of it.
+	Embeddings interfaces.TopicEmbeddingsInterface
+	Tracker    *lifecycle.Tracker
+}
+
+var _ interfaces.SavedMessageIndexInterface = (*SavedMessageIndex)(nil)
+
+// NewSavedMessageIndex creates a new saved-message index
+func NewSavedMessageIndex(db database.DatabaseInterface) *SavedMessageIndex {
+	return &SavedMessageIndex{db: db, now: time.Now}
+}
+
+// RecordSave adds a save to the index
+func (si *SavedMessageIndex) RecordSave(ctx context.Context, original *gotgbot.Message, savedBy int64, threadID int64, topicName string, savedMessageID int64) error {
+	contentType, fileID := messageContent(original)
+	id, err := si.db.RecordSavedMessage(database.SavedMessage{
+		ChatID:            original.Chat.Id,
+		UserID:            savedBy,
+		OriginalMessageID: original.MessageId,
+		ThreadID:          threadID,
+		SavedMessageID:    savedMessageID,
+		TopicName:         topicName,
+		ContentType:       contentType,
+		Snippet:           messageSnippet(original),
+		Text:              messageText(original),
+		FileID:            fileID,
+		SentAt:            time.Unix(original.Date, 0),
+		SavedAt:           si.now(),
+	})
+	if err != nil {
+		logutils.Error("RecordSave", err, "chatID", original.Chat.Id, "messageID", original.MessageId)
+		return err
+	}
+	logutils.Debug("RecordSave", "id", id, "chatID", original.Chat.Id, "threadID", threadID, "contentType", contentType)
+	if si.Embeddings != nil {
+		chatID, text := original.Chat.Id, messageText(original)
+		si.Tracker.Go(func() {
+			if err := si.Embeddings.Learn(si.Tracker.Context(), chatID, topicName, text); err != nil {
+				logutils.Warn("RecordSave: topic centroid not updated", "chatID", chatID, "topic", topicName, "error", err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+// Search looks through the chat's saved messages
+func (si *SavedMessageIndex) Search(ctx context.Context, chatID int64, query interfaces.SearchQuery, offset, limit int) ([]interfaces.SearchHit, int, error) {
+	saved, total, err := si.db.SearchSavedMessages(database.SavedMessageQuery{
+		ChatID:      chatID,
+		Words:       query.Words,
+		TopicName:   query.Topic,
+		ContentType: query.ContentType,
+		Before:      query.Before,
+		After:       query.After,
+		Offset:      offset,
+		Limit:       limit,
+	})
+	if err != nil {
+		logutils.Error("Search", err, "chatID", chatID)
+		return nil, 0, err
+	}
+
+	hits := searchHits(saved)
+	logutils.Debug("Search", "chatID", chatID, "hits", len(hits), "total", total)
+	return hits, total, nil
+}
+
+// TopicSaves returns the saves indexed in a topic, oldest first
+func (si *SavedMessageIndex) TopicSaves(ctx context.Context, chatID int64, threadID int64) ([]interfaces.SearchHit, error) {
+	saved, err := si.db.SavedMessagesByThread(chatID, threadID)
+	if err != nil {
+		logutils.Error("TopicSaves", err, "chatID", chatID, "threadID", threadID)
+		return nil, err
+	}
+	return searchHits(saved), nil
+}
+
+// MoveSave points a save at its copy in another topic
+func (si *SavedMessageIndex) MoveSave(ctx context.Context, id int64, threadID int64, topicName string, savedMessageID int64) error {
+	if err := si.db.MoveSavedMessage(id, threadID, topicName, savedMessageID); err != nil {
+		logutils.Error("MoveSave", err, "id", id, "threadID", threadID)
+		return err
+	}
+	logutils.Debug("MoveSave", "id", id, "threadID", threadID, "savedMessageID", savedMessageID)
+	return nil
+}
+
+func searchHits(saved []database.SavedMessage) []interfaces.SearchHit {
+	hits := make([]interfaces.SearchHit, len(saved))
+	for i, m := range saved {
+		hits[i] = interfaces.SearchHit{
+			ID:             m.ID,
+			ChatID:         m.ChatID,
+			ThreadID:       m.ThreadID,
+			SavedMessageID: m.SavedMessageID,
+			TopicName:      m.TopicName,
+			ContentType:    m.ContentType,
+			Snippet:        m.Snippet,
+			SavedAt:        m.SavedAt,
+		}
+	}
+	return hits
+}
+
+// messageContent returns what kind of message msg is and the file it carries, if any
+func messageContent(msg *gotgbot.Message) (contentType string, fileID string) {
+	switch {
+	case len(msg.Photo) > 0:
+		// Telegram lists the sizes smallest first
+		return interfaces.ContentPhoto, msg.Photo[len(msg.Photo)-1].FileId
+	case msg.Video != nil:
+		return interfaces.ContentVideo, msg.Video.FileId
+	case msg.Animation != nil:
+		return interfaces.ContentAnimation, msg.Animation.FileId
+	case msg.Document != nil:
+		return interfaces.ContentDocument, msg.Document.FileId
+	case msg.Audio != nil:
+		return interfaces.ContentAudio, msg.Audio.FileId
+	case msg.Voice != nil:
+		return interfaces.ContentVoice, msg.Voice.FileId
+	case msg.VideoNote != nil:
+		return interfaces.ContentVideoNote, msg.VideoNote.FileId
+	case msg.Sticker != nil:
+		return interfaces.ContentSticker, msg.Sticker.FileId
+	case msg.Location != nil:
+		return interfaces.ContentLocation, ""
+	case msg.Contact != nil:
+		return interfaces.ContentContact, ""
+	case msg.Poll != nil:
+		return interfaces.ContentPoll, ""
+	case msg.Text != "":
+		return interfaces.ContentText, ""
+	default:
+		return interfaces.ContentOther, ""
+	}
+}
+
+// messageText returns msg's text or caption
+func messageText(msg *gotgbot.Message) string {
+	if msg.Text != "" {
+		return strings.TrimSpace(msg.Text)
+	}
+	return strings.TrimSpace(msg.Caption)
+}
+
+// messageSnippet returns the start of msg's text or caption
+func messageSnippet(msg *gotgbot.Message) string {
+	text := messageText(msg)
+	if utf8.RuneCountInString(text) <= config.SavedMessageSnippetLength {
+		return text
+	}
+	return string([]rune(text)[:config.SavedMessageSnippetLength])
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavedMessageIndex_RecordSave(t *testing.T) {
+	long := strings.Repeat("é", config.SavedMessageSnippetLength+10)
+	tests := []struct {
+		name        string
+		msg         gotgbot.Message
+		wantType    string
+		wantSnippet string
+		wantFileID  string
+	}{
+		{
+			name:        "text",
+			msg:         gotgbot.Message{Text: "  Cake recipe\nflour  "},
+			wantType:    interfaces.ContentText,
+			wantSnippet: "Cake recipe\nflour",
+		},
+		{
+			name:        "photo keeps the largest size and the caption",
+			msg:         gotgbot.Message{Caption: "Sunset", Photo: []gotgbot.PhotoSize{{FileId: "small"}, {FileId: "large"}}},
+			wantType:    interfaces.ContentPhoto,
+			wantSnippet: "Sunset",
+			wantFileID:  "large",
+		},
+		{
+			name:       "document",
+			msg:        gotgbot.Message{Document: &gotgbot.Document{FileId: "doc"}},
+			wantType:   interfaces.ContentDocument,
+			wantFileID: "doc",
+		},
+		{
+			name:        "long text is cut",
+			msg:         gotgbot.Message{Text: long},
+			wantType:    interfaces.ContentText,
+			wantSnippet: string([]rune(long)[:config.SavedMessageSnippetLength]),
+		},
+		{
+			name:     "location",
+			msg:      gotgbot.Message{Location: &gotgbot.Location{Latitude: 1, Longitude: 2}},
+			wantType: interfaces.ContentLocation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewDatabase(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+			index := NewSavedMessageIndex(db)
+			savedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+			index.now = func() time.Time { return savedAt }
+
+			msg := tt.msg
+			msg.MessageId, msg.Chat, msg.Date = 100, gotgbot.Chat{Id: -100}, savedAt.Add(-time.Hour).Unix()
+			require.NoError(t, index.RecordSave(context.Background(), &msg, 7, 5, "Recipes", 200))
+
+			saved, err := db.SavedMessagesByChat(-100, 10)
+			require.NoError(t, err)
+			require.Len(t, saved, 1)
+			got := saved[0]
+			assert.Equal(t, tt.wantType, got.ContentType)
+			assert.Equal(t, tt.wantSnippet, got.Snippet)
+			assert.Equal(t, tt.wantFileID, got.FileID)
+			assert.Equal(t, int64(7), got.UserID)
+			assert.Equal(t, int64(5), got.ThreadID)
+			assert.Equal(t, int64(200), got.SavedMessageID)
+			assert.Equal(t, "Recipes", got.TopicName)
+			assert.True(t, got.SentAt.Equal(savedAt.Add(-time.Hour)))
+			assert.True(t, got.SavedAt.Equal(savedAt))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// SettingsService keeps user settings in the user_settings table and chat settings in chat_settings
+type SettingsService struct {
+	db database.DatabaseInterface
+}
+
+var _ interfaces.SettingsServiceInterface = (*SettingsService)(nil)
+var _ interfaces.ChatSettingsServiceInterface = (*SettingsService)(nil)
+
+// NewSettingsService creates a new settings service
+func NewSettingsService(db database.DatabaseInterface) *SettingsService {
+	return &SettingsService{db: db}
+}
+
+// Get returns the user's settings in the chat, or the defaults if they never changed any
+func (ss *SettingsService) Get(ctx context.Context, chatID int64, userID int64) (interfaces.UserSettings, error) {
+	s, err := ss.db.GetSettings(userID, chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return interfaces.DefaultUserSettings(chatID, userID), nil
+	}
+	if err != nil {
+		logutils.Error("GetSettings", err, "chatID", chatID, "userID", userID)
+		return interfaces.UserSettings{}, err
+	}
+	return interfaces.UserSettings{
+		UserID:            s.UserID,
+		ChatID:            s.ChatID,
+		AutoDelete:        s.AutoDelete,
+		AutoDeleteDelay:   s.AutoDeleteDelay,
+		ConfirmationStyle: s.ConfirmationStyle,
+		ConfirmationDelay: s.ConfirmationDelay,
+		AIEnabled:         s.AIEnabled,
+		SuggestionCount:   s.SuggestionCount,
+		Language:          s.Language,
+	}, nil
+}
+
+// Save stores the user's settings in the chat
+func (ss *SettingsService) Save(ctx context.Context, settings interfaces.UserSettings) error {
+	err := ss.db.SaveSettings(database.Settings{
+		UserID:            settings.UserID,
+		ChatID:            settings.ChatID,
+		AutoDelete:        settings.AutoDelete,
+		AutoDeleteDelay:   settings.AutoDeleteDelay,
+		ConfirmationStyle: settings.ConfirmationStyle,
+		ConfirmationDelay: settings.ConfirmationDelay,
+		AIEnabled:         settings.AIEnabled,
+		SuggestionCount:   settings.SuggestionCount,
+		Language:          settings.Language,
+	})
+	if err != nil {
+		logutils.Error("SaveSettings", err, "chatID", settings.ChatID, "userID", settings.UserID)
+		return err
+	}
+	logutils.Success("SaveSettings", "chatID", settings.ChatID, "userID", settings.UserID)
+	return nil
+}
+
+// GetChat returns the chat's settings, or the defaults if its admins never changed any
+func (ss *SettingsService) GetChat(ctx context.Context, chatID int64) (interfaces.ChatSettings, error) {
+	s, err := ss.db.GetChatSettings(chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return interfaces.ChatSettings{ChatID: chatID, PrivacyMode: config.DefaultPrivacyMode}, nil
+	}
+	if err != nil {
+		logutils.Error("GetChatSettings", err, "chatID", chatID)
+		return interfaces.ChatSettings{}, err
+	}
+	return interfaces.ChatSettings{ChatID: s.ChatID, PrivacyMode: s.PrivacyMode}, nil
+}
+
+// SaveChat stores the chat's settings
+func (ss *SettingsService) SaveChat(ctx context.Context, settings interfaces.ChatSettings) error {
+	err := ss.db.SaveChatSettings(database.ChatSettings{ChatID: settings.ChatID, PrivacyMode: settings.PrivacyMode})
+	if err != nil {
+		logutils.Error("SaveChatSettings", err, "chatID", settings.ChatID)
+		return err
+	}
+	logutils.Success("SaveChatSettings", "chatID", settings.ChatID, "privacyMode", settings.PrivacyMode)
+	return nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettingsService(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	settings := NewSettingsService(db)
+
+	got, err := settings.Get(ctx, -100, 7)
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.DefaultUserSettings(-100, 7), got, "a user who never changed anything gets the defaults")
+
+	got.AIEnabled = false
+	got.AutoDeleteDelay = 10 * time.Second
+	got.ConfirmationStyle = interfaces.ConfirmationKept
+	got.Language = "de"
+	require.NoError(t, settings.Save(ctx, got))
+
+	saved, err := settings.Get(ctx, -100, 7)
+	require.NoError(t, err)
+	assert.Equal(t, got, saved)
+
+	other, err := settings.Get(ctx, -200, 7)
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.DefaultUserSettings(-200, 7), other, "settings are per chat")
+}
+
+func TestSettingsService_Chat(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	settings := NewSettingsService(db)
+
+	got, err := settings.GetChat(ctx, -100)
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.ChatSettings{ChatID: -100}, got, "privacy mode is off until an admin turns it on")
+
+	got.PrivacyMode = true
+	require.NoError(t, settings.SaveChat(ctx, got))
+	saved, err := settings.GetChat(ctx, -100)
+	require.NoError(t, err)
+	assert.Equal(t, got, saved)
+
+	other, err := settings.GetChat(ctx, -200)
+	require.NoError(t, err)
+	assert.False(t, other.PrivacyMode, "settings are per chat")
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"save-message/internal/ai"
+	"save-message/internal/config"
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// TopicEmbeddings keeps the mean embedding of each topic's saved messages in the
+// topic_centroids table and ranks topics by the cosine similarity of a message to them.
+// Topics nothing was saved in since are represented by the embedding of their name.
+type TopicEmbeddings struct {
+	db       database.DatabaseInterface
+	embedder ai.Embedder
+
+	mu       sync.Mutex
+	learning map[centroidKey]*centroidLock // Learn reads, updates and writes a centroid; saves run in parallel
+
+	// Chats tells which chats are in privacy mode, whose messages are never embedded.
+	// Optional; without it no chat is private.
+	Chats interfaces.ChatSettingsServiceInterface
+}
+
+// centroidKey names a topic's centroid; topic names are matched case-insensitively
+type centroidKey struct {
+	chatID int64
+	topic  string
+}
+
+// centroidLock is held while one centroid is updated, and dropped when no Learn waits for it
+type centroidLock struct {
+	sync.Mutex
+	users int
+}
+
+var _ interfaces.TopicEmbeddingsInterface = (*TopicEmbeddings)(nil)
+
+// NewTopicEmbeddings creates topic embeddings computed by embedder and stored in db
+func NewTopicEmbeddings(db database.DatabaseInterface, embedder ai.Embedder) *TopicEmbeddings {
+	return &TopicEmbeddings{db: db, embedder: embedder, learning: make(map[centroidKey]*centroidLock)}
+}
+
+// lockCentroid waits until no other Learn updates the topic's centroid, and returns the unlock
+func (te *TopicEmbeddings) lockCentroid(chatID int64, topicName string) func() {
+	key := centroidKey{chatID: chatID, topic: strings.ToLower(topicName)}
+	te.mu.Lock()
+	lock, ok := te.learning[key]
+	if !ok {
+		lock = &centroidLock{}
+		te.learning[key] = lock
+	}
+	lock.users++
+	te.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		te.mu.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(te.learning, key)
+		}
+		te.mu.Unlock()
+	}
+}
+
+// Learn moves the topic's centroid towards text, just saved in it. A centroid made by another
+// model, or from the topic's name only, is replaced. Concurrent calls are safe: text is
+// embedded in parallel, and only saves to the same topic wait for each other.
+func (te *TopicEmbeddings) Learn(ctx context.Context, chatID int64, topicName string, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" || privateChat(ctx, te.Chats, chatID) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.DefaultEmbeddingTimeout)
+	defer cancel()
+
+	vectors, err := te.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		logutils.Error("TopicEmbeddings: Learn: EmbedError", err, "chatID", chatID, "topic", topicName)
+		return err
+	}
+	defer te.lockCentroid(chatID, topicName)()
+	centroids, err := te.db.TopicCentroids(chatID, te.embedder.Model())
+	if err != nil {
+		logutils.Error("TopicEmbeddings: Learn: TopicCentroidsError", err, "chatID", chatID)
+		return err
+	}
+
+	centroid := database.TopicCentroid{ChatID: chatID, TopicName: topicName, Model: te.embedder.Model(), Vector: vectors[0], Saves: 1}
+	for _, c := range centroids {
+		if !strings.EqualFold(c.TopicName, topicName) {
+			continue
+		}
+		centroid.TopicName = c.TopicName
+		if c.Saves == 0 || len(c.Vector) != len(vectors[0]) {
+			continue
+		}
+		// Running mean: each save weighs the same, however early it came
+		for i := range c.Vector {
+			c.Vector[i] += (vectors[0][i] - c.Vector[i]) / float32(c.Saves+1)
+		}
+		c.Saves++
+		centroid = c
+	}
+	if err := te.db.SaveTopicCentroid(centroid); err != nil {
+		logutils.Error("TopicEmbeddings: Learn: SaveTopicCentroidError", err, "chatID", chatID, "topic", topicName)
+		return err
+	}
+	logutils.Debug("TopicEmbeddings: Learn", "chatID", chatID, "topic", topicName, "saves", centroid.Saves)
+	return nil
+}
+
+// Rank returns topics by the similarity of text to their centroids, most similar first. Topics
+// without a centroid have their name embedded in the same call, and kept until a save replaces it.
+func (te *TopicEmbeddings) Rank(ctx context.Context, chatID int64, text string, topics []string) ([]interfaces.Suggestion, error) {
+	if privateChat(ctx, te.Chats, chatID) {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.DefaultEmbeddingTimeout)
+	defer cancel()
+
+	centroids, err := te.db.TopicCentroids(chatID, te.embedder.Model())
+	if err != nil {
+		logutils.Error("TopicEmbeddings: Rank: TopicCentroidsError", err, "chatID", chatID)
+		return nil, err
+	}
+	byName := make(map[string]database.TopicCentroid, len(centroids))
+	for _, c := range centroids {
+		byName[strings.ToLower(c.TopicName)] = c
+	}
+
+	inputs := []string{text}
+	var unknown []string
+	for _, topic := range topics {
+		key := strings.ToLower(topic)
+		if _, ok := byName[key]; ok || key == "general" || strings.TrimSpace(topic) == "" {
+			continue
+		}
+		inputs = append(inputs, topic)
+		unknown = append(unknown, topic)
+	}
+	vectors, err := te.embedder.Embed(ctx, inputs)
+	if err != nil {
+		logutils.Error("TopicEmbeddings: Rank: EmbedError", err, "chatID", chatID)
+		return nil, err
+	}
+	for i, topic := range unknown {
+		c := database.TopicCentroid{ChatID: chatID, TopicName: topic, Model: te.embedder.Model(), Vector: vectors[i+1]}
+		byName[strings.ToLower(topic)] = c
+		if err := te.db.SaveTopicCentroid(c); err != nil {
+			logutils.Warn("TopicEmbeddings: Rank: SaveTopicCentroidError", "chatID", chatID, "topic", topic, "error", err.Error())
+		}
+	}
+
+	var ranked []interfaces.Suggestion
+	for _, topic := range topics {
+		c, ok := byName[strings.ToLower(topic)]
+		if !ok {
+			continue
+		}
+		similarity := ai.Cosine(vectors[0], c.Vector)
+		ranked = append(ranked, interfaces.Suggestion{
+			Name:       topic,
+			Existing:   true,
+			Confidence: clamp01(similarity),
+			Similarity: similarity,
+		})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Similarity > ranked[j].Similarity })
+	logutils.Debug("TopicEmbeddings: Rank", "chatID", chatID, "topics", len(ranked), "embedded_names", len(unknown))
+	return ranked, nil
+}
+
+func clamp01(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	if x > 1 {
+		return 1
+	}
+	return x
+}
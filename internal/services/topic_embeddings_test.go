@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// axisEmbedder embeds a text as how often it mentions each of its axes
+type axisEmbedder struct {
+	axes  []string
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (e *axisEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.calls = append(e.calls, texts)
+	e.mu.Unlock()
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(e.axes))
+		for j, axis := range e.axes {
+			vectors[i][j] = float32(strings.Count(strings.ToLower(text), axis))
+		}
+	}
+	return vectors, nil
+}
+
+func (e *axisEmbedder) Model() string {
+	return "axes"
+}
+
+func TestTopicEmbeddings(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	embedder := &axisEmbedder{axes: []string{"cake", "invoice", "flight"}}
+	embeddings := NewTopicEmbeddings(db, embedder)
+	embeddings.Chats = &fakeChatSettings{private: map[int64]bool{-200: true}}
+
+	// Saving through the index moves the topic's centroid to the mean of its saves
+	index := NewSavedMessageIndex(db)
+	index.Embeddings = embeddings
+	index.Tracker = lifecycle.NewTracker()
+	for i, text := range []string{"cake", "cake cake cake"} {
+		msg := &gotgbot.Message{MessageId: int64(i + 1), Chat: gotgbot.Chat{Id: -100}, Text: text}
+		require.NoError(t, index.RecordSave(ctx, msg, 7, 5, "Recipes", 200))
+	}
+	require.NoError(t, index.Tracker.Shutdown(time.Second))
+	centroids, err := db.TopicCentroids(-100, "axes")
+	require.NoError(t, err)
+	require.Len(t, centroids, 1)
+	assert.Equal(t, []float32{2, 0, 0}, centroids[0].Vector)
+	assert.Equal(t, 2, centroids[0].Saves)
+
+	// Topics nothing was saved in are ranked by their names, embedded along with the message
+	embedder.calls = nil
+	ranked, err := embeddings.Rank(ctx, -100, "Invoice for the cake shop", []string{"General", "Recipes", "Invoices"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Invoice for the cake shop", "Invoices"}}, embedder.calls)
+	require.Len(t, ranked, 2)
+	assert.Equal(t, "Recipes", ranked[0].Name)
+	assert.True(t, ranked[0].Existing)
+	assert.InDelta(t, 0.707, ranked[0].Similarity, 0.001)
+	assert.Equal(t, "Invoices", ranked[1].Name)
+
+	embedder.calls = nil
+	_, err = embeddings.Rank(ctx, -100, "flight", []string{"Recipes", "Invoices"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"flight"}}, embedder.calls, "embedded names are kept")
+
+	// The first save replaces the embedding of the name
+	require.NoError(t, embeddings.Learn(ctx, -100, "invoices", "invoice invoice"))
+	centroids, err = db.TopicCentroids(-100, "axes")
+	require.NoError(t, err)
+	require.Len(t, centroids, 2)
+	assert.Equal(t, database.TopicCentroid{ChatID: -100, TopicName: "Invoices", Model: "axes", Vector: []float32{0, 2, 0}, Saves: 1}, centroids[0])
+
+	// Nothing from chats in privacy mode is embedded
+	embedder.calls = nil
+	require.NoError(t, embeddings.Learn(ctx, -200, "Recipes", "cake"))
+	ranked, err = embeddings.Rank(ctx, -200, "cake", []string{"Recipes"})
+	require.NoError(t, err)
+	assert.Empty(t, ranked)
+	assert.Empty(t, embedder.calls)
+}
+
+// gatedCentroids holds every centroid write to one chat until its gate closes
+type gatedCentroids struct {
+	database.DatabaseInterface
+	chatID  int64
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (g *gatedCentroids) SaveTopicCentroid(c database.TopicCentroid) error {
+	if c.ChatID == g.chatID {
+		g.entered <- struct{}{}
+		<-g.gate
+	}
+	return g.DatabaseInterface.SaveTopicCentroid(c)
+}
+
+func TestTopicEmbeddings_LearnLocksPerTopic(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	gated := &gatedCentroids{DatabaseInterface: db, chatID: -100, entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	embeddings := NewTopicEmbeddings(gated, &axisEmbedder{axes: []string{"cake"}})
+
+	slow := make(chan error, 1)
+	go func() { slow <- embeddings.Learn(ctx, -100, "Recipes", "cake") }()
+	<-gated.entered
+
+	// Another chat, or another topic of the same chat, does not wait for the write
+	require.NoError(t, embeddings.Learn(ctx, -300, "Recipes", "cake"))
+	gated.chatID = 0
+	require.NoError(t, embeddings.Learn(ctx, -100, "Invoices", "cake"))
+
+	// The same topic waits, so neither save is lost
+	same := make(chan error, 1)
+	go func() { same <- embeddings.Learn(ctx, -100, "recipes", "cake cake cake") }()
+	select {
+	case <-same:
+		t.Fatal("Learn did not wait for the running update of the same centroid")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(gated.gate)
+	require.NoError(t, <-slow)
+	require.NoError(t, <-same)
+
+	centroids, err := db.TopicCentroids(-100, "axes")
+	require.NoError(t, err)
+	require.Len(t, centroids, 2)
+	assert.Equal(t, "Recipes", centroids[1].TopicName)
+	assert.Equal(t, []float32{2}, centroids[1].Vector)
+	assert.Equal(t, 2, centroids[1].Saves)
+	assert.Empty(t, embeddings.learning, "locks are dropped once no Learn holds them")
+}
+
+// gatedLearner holds every Learn until its gate closes
+type gatedLearner struct {
+	fixedRanker
+	gate    chan struct{}
+	learned chan string
+}
+
+func (g *gatedLearner) Learn(ctx context.Context, chatID int64, topicName string, text string) error {
+	<-g.gate
+	g.learned <- text
+	return nil
+}
+
+func TestSavedMessageIndex_LearnsInTheBackground(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	learner := &gatedLearner{gate: make(chan struct{}), learned: make(chan string, 1)}
+	index := NewSavedMessageIndex(db)
+	index.Embeddings = learner
+	index.Tracker = lifecycle.NewTracker()
+
+	msg := &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: -100}, Text: "cake"}
+	require.NoError(t, index.RecordSave(context.Background(), msg, 7, 5, "Recipes", 200), "the save does not wait for the embedding")
+
+	close(learner.gate)
+	require.NoError(t, index.Tracker.Shutdown(time.Second))
+	assert.Equal(t, "cake", <-learner.learned)
+}
+
+// fixedRanker ranks every message the same
+type fixedRanker struct {
+	ranked []interfaces.Suggestion
+	err    error
+}
+
+func (r *fixedRanker) Learn(ctx context.Context, chatID int64, topicName string, text string) error {
+	return nil
+}
+
+func (r *fixedRanker) Rank(ctx context.Context, chatID int64, text string, topics []string) ([]interfaces.Suggestion, error) {
+	return r.ranked, r.err
+}
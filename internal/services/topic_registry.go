@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TopicRegistry learns the forum topics of each chat from the service messages
+// Telegram sends when a topic is created, edited, closed or reopened.
+type TopicRegistry struct {
+	db database.DatabaseInterface
+}
+
+// NewTopicRegistry creates a new topic registry
+func NewTopicRegistry(db database.DatabaseInterface) *TopicRegistry {
+	return &TopicRegistry{db: db}
+}
+
+var _ interfaces.TopicRegistryInterface = (*TopicRegistry)(nil)
+
+// Observe updates the registry from msg and reports whether msg was a topic service message
+func (tr *TopicRegistry) Observe(ctx context.Context, msg *gotgbot.Message) bool {
+	if msg == nil {
+		return false
+	}
+	chatID := msg.Chat.Id
+	threadID := msg.MessageThreadId
+
+	switch {
+	case msg.ForumTopicCreated != nil:
+		if threadID == 0 {
+			// The creation message opens the thread, so its ID is the thread ID
+			threadID = msg.MessageId
+		}
+		created := msg.ForumTopicCreated
+		tr.record("ForumTopicCreated", chatID, threadID, tr.db.SaveForumTopic(database.Topic{
+			ChatID:            chatID,
+			Name:              created.Name,
+			MessageThreadId:   threadID,
+			IconColor:         created.IconColor,
+			IconCustomEmojiID: created.IconCustomEmojiId,
+		}))
+		return true
+
+	case msg.ForumTopicEdited != nil:
+		edited := msg.ForumTopicEdited
+		if threadID == 0 {
+			// Edits of the General topic; it is never a save destination
+			return true
+		}
+		if edited.Name != "" {
+			tr.record("ForumTopicRenamed", chatID, threadID, tr.db.RenameTopic(chatID, threadID, edited.Name))
+		}
+		if edited.IconCustomEmojiId != "" {
+			tr.record("ForumTopicIconChanged", chatID, threadID, tr.db.SetTopicIcon(chatID, threadID, edited.IconCustomEmojiId))
+		}
+		return true
+
+	case msg.ForumTopicClosed != nil:
+		tr.record("ForumTopicClosed", chatID, threadID, tr.db.SetTopicClosed(chatID, threadID, true))
+		return true
+
+	case msg.ForumTopicReopened != nil:
+		tr.record("ForumTopicReopened", chatID, threadID, tr.db.SetTopicClosed(chatID, threadID, false))
+		return true
+	}
+
+	tr.learnFromThread(msg)
+	return false
+}
+
+// learnFromThread registers a topic that was created before the bot joined.
+// Messages in a topic reply to its creation message, which carries the topic's name.
+func (tr *TopicRegistry) learnFromThread(msg *gotgbot.Message) {
+	if !msg.IsTopicMessage || msg.MessageThreadId == 0 || msg.ReplyToMessage == nil || msg.ReplyToMessage.ForumTopicCreated == nil {
+		return
+	}
+	chatID, threadID := msg.Chat.Id, msg.MessageThreadId
+
+	_, err := tr.db.GetTopicByThread(chatID, threadID)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		logutils.Error("TopicRegistry: GetTopicByThreadError", err, "chatID", chatID, "threadID", threadID)
+		return
+	}
+
+	created := msg.ReplyToMessage.ForumTopicCreated
+	tr.record("ForumTopicDiscovered", chatID, threadID, tr.db.SaveForumTopic(database.Topic{
+		ChatID:            chatID,
+		Name:              created.Name,
+		MessageThreadId:   threadID,
+		IconColor:         created.IconColor,
+		IconCustomEmojiID: created.IconCustomEmojiId,
+	}))
+}
+
+func (tr *TopicRegistry) record(event string, chatID, threadID int64, err error) {
+	if err != nil {
+		logutils.Error("TopicRegistry: "+event, err, "chatID", chatID, "threadID", threadID)
+		return
+	}
+	logutils.Success("TopicRegistry: "+event, "chatID", chatID, "threadID", threadID)
+}
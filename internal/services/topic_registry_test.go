@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"save-message/internal/database"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicRegistry_Observe(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	registry := NewTopicRegistry(db)
+	service := NewTopicService(noAPICalls(t), db)
+	chat := gotgbot.Chat{Id: -100123, Type: "supergroup", IsForum: true}
+
+	steps := []struct {
+		name        string
+		msg         *gotgbot.Message
+		wantHandled bool
+		wantTopics  []string
+	}{
+		{
+			name: "created",
+			msg: &gotgbot.Message{MessageId: 10, MessageThreadId: 10, Chat: chat, IsTopicMessage: true,
+				ForumTopicCreated: &gotgbot.ForumTopicCreated{Name: "Recipes", IconColor: 7322096}},
+			wantHandled: true,
+			wantTopics:  []string{"Recipes"},
+		},
+		{
+			name: "renamed",
+			msg: &gotgbot.Message{MessageId: 11, MessageThreadId: 10, Chat: chat, IsTopicMessage: true,
+				ForumTopicEdited: &gotgbot.ForumTopicEdited{Name: "Cooking"}},
+			wantHandled: true,
+			wantTopics:  []string{"Cooking"},
+		},
+		{
+			name: "message in a topic made before the bot joined",
+			msg: &gotgbot.Message{MessageId: 21, MessageThreadId: 20, Chat: chat, IsTopicMessage: true, Text: "hi",
+				ReplyToMessage: &gotgbot.Message{MessageId: 20, Chat: chat, ForumTopicCreated: &gotgbot.ForumTopicCreated{Name: "Travel"}}},
+			wantHandled: false,
+			wantTopics:  []string{"Cooking", "Travel"},
+		},
+		{
+			name: "closed",
+			msg: &gotgbot.Message{MessageId: 12, MessageThreadId: 10, Chat: chat, IsTopicMessage: true,
+				ForumTopicClosed: &gotgbot.ForumTopicClosed{}},
+			wantHandled: true,
+			wantTopics:  []string{"Travel"},
+		},
+		{
+			name: "reopened",
+			msg: &gotgbot.Message{MessageId: 13, MessageThreadId: 10, Chat: chat, IsTopicMessage: true,
+				ForumTopicReopened: &gotgbot.ForumTopicReopened{}},
+			wantHandled: true,
+			wantTopics:  []string{"Cooking", "Travel"},
+		},
+		{
+			name:        "regular General message",
+			msg:         &gotgbot.Message{MessageId: 14, Chat: chat, Text: "save me"},
+			wantHandled: false,
+			wantTopics:  []string{"Cooking", "Travel"},
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			assert.Equal(t, step.wantHandled, registry.Observe(context.Background(), step.msg))
+
+			topics, err := service.GetForumTopics(context.Background(), chat.Id)
+			require.NoError(t, err)
+			var names []string
+			for _, topic := range topics {
+				names = append(names, topic.Name)
+			}
+			assert.Equal(t, step.wantTopics, names)
+		})
+	}
+
+	threadID, err := service.FindTopicByName(context.Background(), chat.Id, "cooking")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), threadID)
+
+	topic, err := db.GetTopicByThread(chat.Id, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7322096), topic.IconColor, "rename keeps the icon")
+}
@@ -1,12 +1,11 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
-	"time"
 
 	"save-message/internal/database"
 	"save-message/internal/interfaces"
@@ -15,173 +14,80 @@ import (
 
 // TopicService handles all topic-related operations
 type TopicService struct {
-	botToken string
-	db       database.DatabaseInterface
-	client   interfaces.HTTPClient
+	client interfaces.TelegramClientInterface
+	db     database.DatabaseInterface
 }
 
 // NewTopicService creates a new topic service
-func NewTopicService(botToken string, db database.DatabaseInterface, client interfaces.HTTPClient) *TopicService {
-	if client == nil {
-		client = &http.Client{Timeout: 10 * time.Second}
-	}
+func NewTopicService(client interfaces.TelegramClientInterface, db database.DatabaseInterface) *TopicService {
 	return &TopicService{
-		botToken: botToken,
-		db:       db,
-		client:   client,
+		client: client,
+		db:     db,
 	}
 }
 
 var _ interfaces.TopicServiceInterface = (*TopicService)(nil)
 
-// GetForumTopics fetches all topics in a forum
-func (ts *TopicService) GetForumTopics(chatID int64) ([]interfaces.ForumTopic, error) {
+// GetForumTopics returns the open topics of a forum.
+// The Bot API cannot list topics, so they come from the registry the TopicRegistry
+// keeps current from forum service messages.
+func (ts *TopicService) GetForumTopics(ctx context.Context, chatID int64) ([]interfaces.ForumTopic, error) {
 	logutils.Info("GetForumTopics", "chatID", chatID)
 
-	// First, check if this is a forum chat
-	chatURL := fmt.Sprintf("https://api.telegram.org/bot%s/getChat?chat_id=%d", ts.botToken, chatID)
-	chatResp, err := ts.client.Get(chatURL)
-	if err == nil {
-		defer chatResp.Body.Close()
-		chatBody, _ := io.ReadAll(chatResp.Body)
-		logutils.Debug("GetForumTopics", "getChat_response", string(chatBody))
-
-		var chatResult struct {
-			Ok     bool `json:"ok"`
-			Result struct {
-				Type    string `json:"type"`
-				IsForum bool   `json:"is_forum"`
-			} `json:"result"`
-		}
-
-		if err := json.Unmarshal(chatBody, &chatResult); err == nil && chatResult.Ok {
-			logutils.Debug("GetForumTopics", "chat_type", chatResult.Result.Type, "is_forum", chatResult.Result.IsForum)
-		}
-	} else {
-		logutils.Warn("GetForumTopics: GetChatFailed", "error", err.Error(), "chatID", chatID)
-	}
-
-	// Try different methods to get forum topics
-	methods := []string{
-		"getForumTopics",
-		"getForumTopicByID",
-	}
-
-	for _, method := range methods {
-		url := fmt.Sprintf("https://api.telegram.org/bot%s/%s?chat_id=%d", ts.botToken, method, chatID)
-		resp, err := ts.client.Get(url)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
-
-		body, _ := io.ReadAll(resp.Body)
-		logutils.Debug("GetForumTopics", "method", method, "response", string(body))
-
-		var result struct {
-			Ok     bool `json:"ok"`
-			Result struct {
-				Topics []interfaces.ForumTopic `json:"topics"`
-			} `json:"result"`
-		}
-
-		if err := json.Unmarshal(body, &result); err != nil {
-			continue
-		}
-
-		if result.Ok {
-			logutils.Success("GetForumTopics", "method", method, "topics_count", len(result.Result.Topics))
-			// Update database with found topics
-			for _, topic := range result.Result.Topics {
-				err := ts.db.AddTopic(chatID, topic.Name, topic.ID, 0) // 0 for system-created topics
-				if err != nil {
-					logutils.Error("GetForumTopics", err, "chatID", chatID, "topic_name", topic.Name)
-				}
-			}
-			return result.Result.Topics, nil
-		}
-	}
-
-	// If all methods fail, use database
-	logutils.Warn("GetForumTopics", "message", "All API methods failed, falling back to database", "chatID", chatID)
 	dbTopics, err := ts.db.GetTopicsByChat(chatID)
 	if err != nil {
+		// The registry is the only source of topics, so an empty list here would read as "none"
 		logutils.Error("GetForumTopics", err, "chatID", chatID)
-		return []interfaces.ForumTopic{}, nil
+		return nil, err
 	}
 
-	var topics []interfaces.ForumTopic
+	topics := []interfaces.ForumTopic{}
 	for _, dbTopic := range dbTopics {
-		topics = append(topics, interfaces.ForumTopic{
-			ID:   dbTopic.MessageThreadId,
-			Name: dbTopic.Name,
-		})
+		if dbTopic.IsClosed {
+			continue
+		}
+		topics = append(topics, forumTopic(dbTopic))
 	}
-	logutils.Success("GetForumTopics", "database_topics_count", len(topics), "chatID", chatID)
+	logutils.Success("GetForumTopics", "topics_count", len(topics), "chatID", chatID)
 	return topics, nil
 }
 
 // CreateForumTopic creates a new topic in a forum
-func (ts *TopicService) CreateForumTopic(chatID int64, name string) (int64, error) {
+func (ts *TopicService) CreateForumTopic(ctx context.Context, chatID int64, name string) (int64, error) {
 	logutils.Info("CreateForumTopic", "chatID", chatID, "name", name)
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/createForumTopic", ts.botToken)
-
-	requestBody := map[string]interface{}{
+	var result interfaces.ForumTopic
+	err := ts.client.Call(ctx, "createForumTopic", map[string]interface{}{
 		"chat_id": chatID,
 		"name":    name,
-	}
-
-	bodyBytes, _ := json.Marshal(requestBody)
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		logutils.Error("CreateForumTopic: CreateRequest", err, "chatID", chatID, "name", name)
-		return 0, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := ts.client
-	resp, err := client.Do(req)
+	}, &result)
 	if err != nil {
 		logutils.Error("CreateForumTopic", err, "chatID", chatID, "name", name)
 		return 0, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Ok     bool                  `json:"ok"`
-		Result interfaces.ForumTopic `json:"result"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		logutils.Error("CreateForumTopic", err, "response_body", string(body))
-		return 0, err
-	}
-
-	if !result.Ok {
-		logutils.Error("CreateForumTopic", fmt.Errorf("failed to create topic: %s", string(body)), "chatID", chatID, "name", name)
-		return 0, fmt.Errorf("failed to create topic: %s", string(body))
-	}
 
-	// Add topic to database
-	err = ts.db.AddTopic(chatID, name, result.Result.ID, 0) // 0 for system-created topics
+	// Register the topic right away rather than waiting for its forum_topic_created message
+	err = ts.db.SaveForumTopic(database.Topic{
+		ChatID:            chatID,
+		Name:              name,
+		MessageThreadId:   result.ID,
+		IconColor:         result.IconColor,
+		IconCustomEmojiID: result.IconCustomEmojiID,
+	})
 	if err != nil {
-		logutils.Error("CreateForumTopic", err, "chatID", chatID, "name", name, "threadID", result.Result.ID)
+		logutils.Error("CreateForumTopic", err, "chatID", chatID, "name", name, "threadID", result.ID)
 	} else {
-		logutils.Success("CreateForumTopic", "chatID", chatID, "name", name, "threadID", result.Result.ID)
+		logutils.Success("CreateForumTopic", "chatID", chatID, "name", name, "threadID", result.ID)
 	}
 
-	return result.Result.ID, nil
+	return result.ID, nil
 }
 
 // TopicExists checks if a topic exists in the database
-func (ts *TopicService) TopicExists(chatID int64, topicName string) (bool, error) {
+func (ts *TopicService) TopicExists(ctx context.Context, chatID int64, topicName string) (bool, error) {
 	logutils.Info("TopicExists", "chatID", chatID, "topicName", topicName)
 
-	topics, err := ts.GetForumTopics(chatID)
+	topics, err := ts.GetForumTopics(ctx, chatID)
 	if err != nil {
 		logutils.Error("TopicExists", err, "chatID", chatID, "topicName", topicName)
 		return false, err
@@ -199,10 +105,10 @@ func (ts *TopicService) TopicExists(chatID int64, topicName string) (bool, error
 }
 
 // FindTopicByName finds a topic by name (case-insensitive)
-func (ts *TopicService) FindTopicByName(chatID int64, topicName string) (int64, error) {
+func (ts *TopicService) FindTopicByName(ctx context.Context, chatID int64, topicName string) (int64, error) {
 	logutils.Info("FindTopicByName", "chatID", chatID, "topicName", topicName)
 
-	topics, err := ts.GetForumTopics(chatID)
+	topics, err := ts.GetForumTopics(ctx, chatID)
 	if err != nil {
 		logutils.Error("FindTopicByName", err, "chatID", chatID, "topicName", topicName)
 		return 0, err
@@ -216,5 +122,140 @@ func (ts *TopicService) FindTopicByName(chatID int64, topicName string) (int64,
 	}
 
 	logutils.Warn("FindTopicByName", "message", "Topic not found", "topicName", topicName)
-	return 0, fmt.Errorf("topic not found: %s", topicName)
+	return 0, fmt.Errorf("%w: %s", interfaces.ErrTopicNotFound, topicName)
+}
+
+// FindTopic finds a topic by name (case-insensitive), closed or not
+func (ts *TopicService) FindTopic(ctx context.Context, chatID int64, topicName string) (interfaces.ForumTopic, error) {
+	logutils.Info("FindTopic", "chatID", chatID, "topicName", topicName)
+
+	dbTopics, err := ts.db.GetTopicsByChat(chatID)
+	if err != nil {
+		logutils.Error("FindTopic", err, "chatID", chatID, "topicName", topicName)
+		return interfaces.ForumTopic{}, err
+	}
+	for _, dbTopic := range dbTopics {
+		if strings.EqualFold(dbTopic.Name, topicName) {
+			return forumTopic(dbTopic), nil
+		}
+	}
+	return interfaces.ForumTopic{}, fmt.Errorf("%w: %s", interfaces.ErrTopicNotFound, topicName)
+}
+
+// TopicByThread returns the topic of a forum thread, closed or not
+func (ts *TopicService) TopicByThread(ctx context.Context, chatID int64, threadID int64) (interfaces.ForumTopic, error) {
+	dbTopic, err := ts.db.GetTopicByThread(chatID, threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return interfaces.ForumTopic{}, fmt.Errorf("%w: thread %d", interfaces.ErrTopicNotFound, threadID)
+	}
+	if err != nil {
+		logutils.Error("TopicByThread", err, "chatID", chatID, "threadID", threadID)
+		return interfaces.ForumTopic{}, err
+	}
+	return forumTopic(*dbTopic), nil
+}
+
+// RenameForumTopic renames a topic
+func (ts *TopicService) RenameForumTopic(ctx context.Context, chatID int64, threadID int64, name string) error {
+	logutils.Info("RenameForumTopic", "chatID", chatID, "threadID", threadID, "name", name)
+
+	err := ts.client.Call(ctx, "editForumTopic", map[string]interface{}{
+		"chat_id":           chatID,
+		"message_thread_id": threadID,
+		"name":              name,
+	}, nil)
+	if err != nil {
+		logutils.Error("RenameForumTopic", err, "chatID", chatID, "threadID", threadID)
+		return err
+	}
+	ts.syncRegistry("RenameForumTopic", chatID, threadID, ts.db.RenameTopic(chatID, threadID, name))
+	return nil
+}
+
+// CloseForumTopic closes a topic, which keeps its messages but takes it out of the suggestions
+func (ts *TopicService) CloseForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	logutils.Info("CloseForumTopic", "chatID", chatID, "threadID", threadID)
+
+	err := ts.client.Call(ctx, "closeForumTopic", map[string]interface{}{
+		"chat_id":           chatID,
+		"message_thread_id": threadID,
+	}, nil)
+	if err != nil {
+		logutils.Error("CloseForumTopic", err, "chatID", chatID, "threadID", threadID)
+		return err
+	}
+	ts.syncRegistry("CloseForumTopic", chatID, threadID, ts.db.SetTopicClosed(chatID, threadID, true))
+	return nil
+}
+
+// ReopenForumTopic reopens a closed topic
+func (ts *TopicService) ReopenForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	logutils.Info("ReopenForumTopic", "chatID", chatID, "threadID", threadID)
+
+	err := ts.client.Call(ctx, "reopenForumTopic", map[string]interface{}{
+		"chat_id":           chatID,
+		"message_thread_id": threadID,
+	}, nil)
+	if err != nil {
+		logutils.Error("ReopenForumTopic", err, "chatID", chatID, "threadID", threadID)
+		return err
+	}
+	ts.syncRegistry("ReopenForumTopic", chatID, threadID, ts.db.SetTopicClosed(chatID, threadID, false))
+	return nil
+}
+
+// DeleteForumTopic deletes a topic with all its messages
+func (ts *TopicService) DeleteForumTopic(ctx context.Context, chatID int64, threadID int64) error {
+	logutils.Info("DeleteForumTopic", "chatID", chatID, "threadID", threadID)
+
+	err := ts.client.Call(ctx, "deleteForumTopic", map[string]interface{}{
+		"chat_id":           chatID,
+		"message_thread_id": threadID,
+	}, nil)
+	if err != nil {
+		logutils.Error("DeleteForumTopic", err, "chatID", chatID, "threadID", threadID)
+		return err
+	}
+	// Telegram posts no service message for deletions, so this is the only chance to sync
+	ts.syncRegistry("DeleteForumTopic", chatID, threadID, ts.db.DeleteTopic(chatID, threadID))
+	return nil
+}
+
+// CanManageTopics reports whether the user is the chat's owner or an admin allowed to manage topics
+func (ts *TopicService) CanManageTopics(ctx context.Context, chatID int64, userID int64) (bool, error) {
+	var member struct {
+		Status          string `json:"status"`
+		CanManageTopics bool   `json:"can_manage_topics"`
+	}
+	err := ts.client.Call(ctx, "getChatMember", map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+	}, &member)
+	if err != nil {
+		logutils.Error("CanManageTopics", err, "chatID", chatID, "userID", userID)
+		return false, err
+	}
+	allowed := member.Status == "creator" || (member.Status == "administrator" && member.CanManageTopics)
+	logutils.Debug("CanManageTopics", "chatID", chatID, "userID", userID, "status", member.Status, "allowed", allowed)
+	return allowed, nil
+}
+
+// syncRegistry logs the outcome of mirroring a topic change into the registry. Telegram has
+// already made the change, so a failure here is not the caller's.
+func (ts *TopicService) syncRegistry(operation string, chatID, threadID int64, err error) {
+	if err != nil {
+		logutils.Error(operation+": RegistryError", err, "chatID", chatID, "threadID", threadID)
+		return
+	}
+	logutils.Success(operation, "chatID", chatID, "threadID", threadID)
+}
+
+func forumTopic(topic database.Topic) interfaces.ForumTopic {
+	return interfaces.ForumTopic{
+		ID:                topic.MessageThreadId,
+		Name:              topic.Name,
+		IconColor:         topic.IconColor,
+		IconCustomEmojiID: topic.IconCustomEmojiID,
+		IsClosed:          topic.IsClosed,
+	}
 }
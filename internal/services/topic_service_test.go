@@ -2,15 +2,20 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"io"
 	"net/http"
+	"path"
 	"testing"
+	"time"
 
 	"save-message/internal/database"
 	"save-message/internal/interfaces"
+	"save-message/internal/telegram"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // --- Mocks ---
@@ -31,6 +36,8 @@ func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
 
 // Mock for database.DatabaseInterface
 type MockDatabase struct {
+	database.DatabaseInterface // registry lookups are covered against SQLite in topic_registry_test.go
+
 	topics    []database.Topic
 	shouldErr bool
 }
@@ -43,6 +50,14 @@ func (m *MockDatabase) AddTopic(chatID int64, name string, messageThreadID int64
 	return nil
 }
 
+func (m *MockDatabase) SaveForumTopic(topic database.Topic) error {
+	if m.shouldErr {
+		return sql.ErrConnDone
+	}
+	m.topics = append(m.topics, topic)
+	return nil
+}
+
 func (m *MockDatabase) GetTopicsByChat(chatID int64) ([]database.Topic, error) {
 	if m.shouldErr {
 		return nil, sql.ErrConnDone
@@ -69,7 +84,7 @@ func (m *MockDatabase) GetUser(userID int64) (*database.User, error) {
 	return nil, nil
 }
 
-func (m *MockDatabase) UpsertUser(userID int64, username, firstName, lastName string) error {
+func (m *MockDatabase) UpsertUser(u database.User, chatID int64, seenAt time.Time) error {
 	// Dummy implementation to satisfy the interface
 	if m.shouldErr {
 		return sql.ErrConnDone
@@ -83,50 +98,51 @@ func (m *MockDatabase) Close() error {
 
 // --- Tests ---
 
+// noAPICalls fails the test if the service reaches the Bot API
+func noAPICalls(t *testing.T) *telegram.Client {
+	return telegram.NewClient("fake-token", "", &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			t.Errorf("unexpected Bot API call: %s", req.URL.Path)
+			return nil, io.EOF
+		},
+	})
+}
+
 func TestGetForumTopics(t *testing.T) {
 	tests := []struct {
-		name              string
-		mockApiResponse   string
-		mockApiStatusCode int
-		mockDbTopics      []database.Topic
-		mockDbErr         bool
-		expectedTopics    []interfaces.ForumTopic
-		expectApiCall     bool
-		expectDbCall      bool
-		wantErr           bool
+		name           string
+		mockDbTopics   []database.Topic
+		mockDbErr      bool
+		expectedTopics []interfaces.ForumTopic
+		wantErr        bool
 	}{
 		{
-			name:              "success from API",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":1,"name":"API Topic 1"},{"message_thread_id":2,"name":"API Topic 2"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectApiCall:     true,
+			name: "topics from registry",
+			mockDbTopics: []database.Topic{
+				{ChatID: 123, MessageThreadId: 3, Name: "DB Topic", IconColor: 7322096},
+				{ChatID: 123, MessageThreadId: 4, Name: "Renamed", IconCustomEmojiID: "5312536423851630001"},
+				{ChatID: 999, MessageThreadId: 5, Name: "Other chat"},
+			},
 			expectedTopics: []interfaces.ForumTopic{
-				{ID: 1, Name: "API Topic 1"},
-				{ID: 2, Name: "API Topic 2"},
+				{ID: 3, Name: "DB Topic", IconColor: 7322096},
+				{ID: 4, Name: "Renamed", IconCustomEmojiID: "5312536423851630001"},
 			},
 			wantErr: false,
 		},
 		{
-			name:              "API fails, fallback to DB success",
-			mockApiResponse:   `{"ok":false}`,
-			mockApiStatusCode: http.StatusOK,
+			name: "closed topics are skipped",
 			mockDbTopics: []database.Topic{
-				{ChatID: 123, MessageThreadId: 3, Name: "DB Topic"},
+				{ChatID: 123, MessageThreadId: 3, Name: "Open"},
+				{ChatID: 123, MessageThreadId: 4, Name: "Closed", IsClosed: true},
 			},
-			expectApiCall:  true,
-			expectDbCall:   true,
-			expectedTopics: []interfaces.ForumTopic{{ID: 3, Name: "DB Topic"}},
+			expectedTopics: []interfaces.ForumTopic{{ID: 3, Name: "Open"}},
 			wantErr:        false,
 		},
 		{
-			name:              "API fails, fallback to DB error",
-			mockApiResponse:   `{"ok":false}`,
-			mockApiStatusCode: http.StatusOK,
-			mockDbErr:         true,
-			expectApiCall:     true,
-			expectDbCall:      true,
-			expectedTopics:    []interfaces.ForumTopic{},
-			wantErr:           false,
+			name:           "DB error",
+			mockDbErr:      true,
+			expectedTopics: nil,
+			wantErr:        true,
 		},
 	}
 
@@ -136,22 +152,9 @@ func TestGetForumTopics(t *testing.T) {
 				topics:    tt.mockDbTopics,
 				shouldErr: tt.mockDbErr,
 			}
-			mockHttp := &MockHTTPClient{
-				GetFunc: func(url string) (*http.Response, error) {
-					return &http.Response{
-						StatusCode: tt.mockApiStatusCode,
-						Body:       io.NopCloser(bytes.NewBufferString(tt.mockApiResponse)),
-					}, nil
-				},
-			}
 
-			// We need a way to inject the mock http client.
-			// This requires refactoring TopicService to not use http.Get directly.
-			// For now, we are limited to testing the DB path.
-			// TODO: Refactor TopicService to allow http client injection.
-
-			service := NewTopicService("fake-token", mockDb, mockHttp)
-			topics, err := service.GetForumTopics(123)
+			service := NewTopicService(noAPICalls(t), mockDb)
+			topics, err := service.GetForumTopics(context.Background(), 123)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -227,8 +230,8 @@ func TestCreateForumTopic(t *testing.T) {
 				},
 			}
 
-			service := NewTopicService("fake-token", mockDb, mockHttp)
-			threadID, err := service.CreateForumTopic(tt.chatID, tt.topicName)
+			service := NewTopicService(telegram.NewClient("fake-token", "", mockHttp), mockDb)
+			threadID, err := service.CreateForumTopic(context.Background(), tt.chatID, tt.topicName)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -251,37 +254,33 @@ func TestCreateForumTopic(t *testing.T) {
 }
 
 func TestTopicExists(t *testing.T) {
+	registry := []database.Topic{{ChatID: 123, MessageThreadId: 1, Name: "Existing Topic"}}
+
 	tests := []struct {
-		name              string
-		topicName         string
-		mockApiResponse   string
-		mockApiStatusCode int
-		expectedExists    bool
-		wantErr           bool
+		name           string
+		topicName      string
+		mockDbErr      bool
+		expectedExists bool
+		wantErr        bool
 	}{
 		{
-			name:              "topic exists",
-			topicName:         "Existing Topic",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":1,"name":"Existing Topic"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectedExists:    true,
-			wantErr:           false,
+			name:           "topic exists",
+			topicName:      "Existing Topic",
+			expectedExists: true,
+			wantErr:        false,
 		},
 		{
-			name:              "topic does not exist",
-			topicName:         "Another Topic",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":1,"name":"Existing Topic"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectedExists:    false,
-			wantErr:           false,
+			name:           "topic does not exist",
+			topicName:      "Another Topic",
+			expectedExists: false,
+			wantErr:        false,
 		},
 		{
-			name:              "API error",
-			topicName:         "Any Topic",
-			mockApiResponse:   `{"ok":false}`,
-			mockApiStatusCode: http.StatusInternalServerError,
-			expectedExists:    false,
-			wantErr:           false,
+			name:           "DB error",
+			topicName:      "Any Topic",
+			mockDbErr:      true,
+			expectedExists: false,
+			wantErr:        true,
 		},
 		{
 			name:           "empty topic name",
@@ -293,16 +292,9 @@ func TestTopicExists(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockHttp := &MockHTTPClient{
-				GetFunc: func(url string) (*http.Response, error) {
-					return &http.Response{
-						StatusCode: tt.mockApiStatusCode,
-						Body:       io.NopCloser(bytes.NewBufferString(tt.mockApiResponse)),
-					}, nil
-				},
-			}
-			service := NewTopicService("fake-token", &MockDatabase{}, mockHttp)
-			exists, err := service.TopicExists(123, tt.topicName)
+			mockDb := &MockDatabase{topics: registry, shouldErr: tt.mockDbErr}
+			service := NewTopicService(noAPICalls(t), mockDb)
+			exists, err := service.TopicExists(context.Background(), 123, tt.topicName)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -315,63 +307,55 @@ func TestTopicExists(t *testing.T) {
 }
 
 func TestFindTopicByName(t *testing.T) {
+	registry := []database.Topic{{ChatID: 123, MessageThreadId: 987, Name: "Test Topic"}}
+
 	tests := []struct {
-		name              string
-		topicName         string
-		mockApiResponse   string
-		mockApiStatusCode int
-		expectedThreadID  int64
-		wantErr           bool
+		name             string
+		topicName        string
+		mockDbErr        bool
+		expectedThreadID int64
+		wantErr          bool
+		wantErrIs        error
 	}{
 		{
-			name:              "topic found",
-			topicName:         "Test Topic",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":987,"name":"Test Topic"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectedThreadID:  987,
-			wantErr:           false,
+			name:             "topic found",
+			topicName:        "Test Topic",
+			expectedThreadID: 987,
+			wantErr:          false,
 		},
 		{
-			name:              "topic found case-insensitive",
-			topicName:         "test topic",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":987,"name":"Test Topic"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectedThreadID:  987,
-			wantErr:           false,
+			name:             "topic found case-insensitive",
+			topicName:        "test topic",
+			expectedThreadID: 987,
+			wantErr:          false,
 		},
 		{
-			name:              "topic not found",
-			topicName:         "Another Topic",
-			mockApiResponse:   `{"ok":true,"result":{"topics":[{"message_thread_id":987,"name":"Test Topic"}]}}`,
-			mockApiStatusCode: http.StatusOK,
-			expectedThreadID:  0,
-			wantErr:           true,
+			name:             "topic not found",
+			topicName:        "Another Topic",
+			expectedThreadID: 0,
+			wantErr:          true,
+			wantErrIs:        interfaces.ErrTopicNotFound,
 		},
 		{
-			name:              "API error",
-			topicName:         "Any Topic",
-			mockApiResponse:   `{"ok":false}`,
-			mockApiStatusCode: http.StatusInternalServerError,
-			expectedThreadID:  0,
-			wantErr:           true,
+			name:             "DB error",
+			topicName:        "Any Topic",
+			mockDbErr:        true,
+			expectedThreadID: 0,
+			wantErr:          true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockHttp := &MockHTTPClient{
-				GetFunc: func(url string) (*http.Response, error) {
-					return &http.Response{
-						StatusCode: tt.mockApiStatusCode,
-						Body:       io.NopCloser(bytes.NewBufferString(tt.mockApiResponse)),
-					}, nil
-				},
-			}
-			service := NewTopicService("fake-token", &MockDatabase{}, mockHttp)
-			threadID, err := service.FindTopicByName(123, tt.topicName)
+			mockDb := &MockDatabase{topics: registry, shouldErr: tt.mockDbErr}
+			service := NewTopicService(noAPICalls(t), mockDb)
+			threadID, err := service.FindTopicByName(context.Background(), 123, tt.topicName)
 
 			if tt.wantErr {
 				assert.Error(t, err)
+				if tt.wantErrIs != nil {
+					assert.ErrorIs(t, err, tt.wantErrIs)
+				}
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.expectedThreadID, threadID)
@@ -379,3 +363,100 @@ func TestFindTopicByName(t *testing.T) {
 		})
 	}
 }
+
+// apiRecorder answers every Bot API call with response and remembers the calls
+type apiRecorder struct {
+	response string
+	calls    []string // method and JSON params
+}
+
+func (r *apiRecorder) client() *telegram.Client {
+	return telegram.NewClient("fake-token", "", &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			r.calls = append(r.calls, path.Base(req.URL.Path)+" "+string(body))
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(r.response))}, nil
+		},
+	})
+}
+
+func TestTopicManagement_KeepsRegistryInSync(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.SaveForumTopic(database.Topic{ChatID: 123, Name: "Recipes", MessageThreadId: 7}))
+
+	api := &apiRecorder{response: `{"ok":true,"result":true}`}
+	service := NewTopicService(api.client(), db)
+	ctx := context.Background()
+
+	require.NoError(t, service.RenameForumTopic(ctx, 123, 7, "Cooking"))
+	require.NoError(t, service.CloseForumTopic(ctx, 123, 7))
+	closed, err := service.FindTopic(ctx, 123, "cooking")
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.ForumTopic{ID: 7, Name: "Cooking", IsClosed: true}, closed)
+	open, err := service.GetForumTopics(ctx, 123)
+	require.NoError(t, err)
+	assert.Empty(t, open, "closed topics are not offered")
+
+	require.NoError(t, service.ReopenForumTopic(ctx, 123, 7))
+	reopened, err := service.TopicByThread(ctx, 123, 7)
+	require.NoError(t, err)
+	assert.False(t, reopened.IsClosed)
+
+	require.NoError(t, service.DeleteForumTopic(ctx, 123, 7))
+	_, err = service.TopicByThread(ctx, 123, 7)
+	assert.ErrorIs(t, err, interfaces.ErrTopicNotFound)
+
+	assert.Equal(t, []string{
+		`editForumTopic {"chat_id":123,"message_thread_id":7,"name":"Cooking"}`,
+		`closeForumTopic {"chat_id":123,"message_thread_id":7}`,
+		`reopenForumTopic {"chat_id":123,"message_thread_id":7}`,
+		`deleteForumTopic {"chat_id":123,"message_thread_id":7}`,
+	}, api.calls)
+}
+
+func TestTopicManagement_APIErrorLeavesRegistry(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.SaveForumTopic(database.Topic{ChatID: 123, Name: "Recipes", MessageThreadId: 7}))
+
+	api := &apiRecorder{response: `{"ok":false,"error_code":400,"description":"Bad Request: not enough rights to manage topics"}`}
+	service := NewTopicService(api.client(), db)
+	ctx := context.Background()
+
+	assert.Error(t, service.RenameForumTopic(ctx, 123, 7, "Cooking"))
+	assert.Error(t, service.CloseForumTopic(ctx, 123, 7))
+	assert.Error(t, service.DeleteForumTopic(ctx, 123, 7))
+
+	topic, err := service.TopicByThread(ctx, 123, 7)
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.ForumTopic{ID: 7, Name: "Recipes"}, topic)
+}
+
+func TestCanManageTopics(t *testing.T) {
+	tests := []struct {
+		name   string
+		member string
+		want   bool
+	}{
+		{"owner", `{"status":"creator"}`, true},
+		{"admin who can manage topics", `{"status":"administrator","can_manage_topics":true}`, true},
+		{"admin who cannot", `{"status":"administrator","can_manage_topics":false}`, false},
+		{"member", `{"status":"member"}`, false},
+		{"restricted member", `{"status":"restricted","can_manage_topics":true}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &apiRecorder{response: `{"ok":true,"result":` + tt.member + `}`}
+			service := NewTopicService(api.client(), &MockDatabase{})
+
+			allowed, err := service.CanManageTopics(context.Background(), 123, 55)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, allowed)
+			assert.Equal(t, []string{`getChatMember {"chat_id":123,"user_id":55}`}, api.calls)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// UserRegistry keeps a profile of everyone who sends the bot updates
+type UserRegistry struct {
+	db  database.DatabaseInterface
+	now func() time.Time
+}
+
+// NewUserRegistry creates a new user registry
+func NewUserRegistry(db database.DatabaseInterface) *UserRegistry {
+	return &UserRegistry{db: db, now: time.Now}
+}
+
+var _ interfaces.UserRegistryInterface = (*UserRegistry)(nil)
+
+// Observe records the sender of update and the chat it came from
+func (ur *UserRegistry) Observe(ctx context.Context, update *gotgbot.Update) {
+	sender, chatID := senderOf(update)
+	if sender == nil {
+		return
+	}
+	err := ur.db.UpsertUser(database.User{
+		ID:           sender.Id,
+		Username:     sender.Username,
+		FirstName:    sender.FirstName,
+		LastName:     sender.LastName,
+		LanguageCode: sender.LanguageCode,
+	}, chatID, ur.now())
+	if err != nil {
+		logutils.Error("UserRegistry: UpsertUserError", err, "userID", sender.Id, "chatID", chatID)
+	}
+}
+
+// Profile returns what is known about a user
+func (ur *UserRegistry) Profile(ctx context.Context, userID int64) (interfaces.UserProfile, error) {
+	user, err := ur.db.GetUser(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return interfaces.UserProfile{}, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		logutils.Error("UserRegistry: GetUserError", err, "userID", userID)
+		return interfaces.UserProfile{}, err
+	}
+
+	profile := interfaces.UserProfile{
+		ID:           user.ID,
+		Username:     user.Username,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		LanguageCode: user.LanguageCode,
+		FirstSeen:    user.CreatedAt,
+		LastSeen:     user.LastSeen,
+	}
+	for _, chat := range user.Chats {
+		profile.Chats = append(profile.Chats, interfaces.UserChat{ChatID: chat.ChatID, FirstSeen: chat.FirstSeen, LastSeen: chat.LastSeen})
+	}
+	return profile, nil
+}
+
+// senderOf returns who sent update and the chat it came from, 0 when it has none.
+// Updates without a user, such as channel posts, give nil.
+func senderOf(update *gotgbot.Update) (*gotgbot.User, int64) {
+	switch {
+	case update.Message != nil:
+		return update.Message.From, update.Message.Chat.Id
+	case update.EditedMessage != nil:
+		return update.EditedMessage.From, update.EditedMessage.Chat.Id
+	case update.CallbackQuery != nil:
+		var chatID int64
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.Id
+		}
+		return &update.CallbackQuery.From, chatID
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.From, update.MyChatMember.Chat.Id
+	case update.ChatMember != nil:
+		return &update.ChatMember.From, update.ChatMember.Chat.Id
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.From, update.ChatJoinRequest.Chat.Id
+	case update.InlineQuery != nil:
+		return &update.InlineQuery.From, 0
+	case update.PollAnswer != nil:
+		return &update.PollAnswer.User, 0
+	default:
+		return nil, 0
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRegistry_Observe(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	registry := NewUserRegistry(db)
+	clock := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return clock }
+
+	_, err = registry.Profile(ctx, 7)
+	assert.ErrorIs(t, err, interfaces.ErrUserNotFound)
+
+	alice := gotgbot.User{Id: 7, Username: "alice", FirstName: "Alice", LanguageCode: "en"}
+	registry.Observe(ctx, &gotgbot.Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}, From: &alice, Text: "hi"}})
+
+	clock = clock.Add(time.Hour)
+	alice.Username = "alice_w"
+	alice.LastName = "Wonder"
+	alice.LanguageCode = "de"
+	registry.Observe(ctx, &gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{From: alice, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -200}}}})
+
+	// Updates without a sender are skipped
+	registry.Observe(ctx, &gotgbot.Update{ChannelPost: &gotgbot.Message{Chat: gotgbot.Chat{Id: -300}}})
+
+	profile, err := registry.Profile(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "alice_w", profile.Username)
+	assert.Equal(t, "Wonder", profile.LastName)
+	assert.Equal(t, "de", profile.LanguageCode)
+	assert.True(t, profile.FirstSeen.Equal(clock.Add(-time.Hour)), "first seen is kept, got %v", profile.FirstSeen)
+	assert.True(t, profile.LastSeen.Equal(clock), "last seen moves on, got %v", profile.LastSeen)
+	require.Len(t, profile.Chats, 2)
+	assert.Equal(t, int64(-200), profile.Chats[0].ChatID, "the chat used last comes first")
+	assert.Equal(t, int64(-100), profile.Chats[1].ChatID)
+}
@@ -1,16 +1,29 @@
 package setup
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"save-message/internal/ai"
+	"save-message/internal/callbacks"
+	"save-message/internal/config"
+	"save-message/internal/conversation"
 	"save-message/internal/database"
 	"save-message/internal/handlers"
+	"save-message/internal/lifecycle"
 	"save-message/internal/logutils"
 	"save-message/internal/router"
 	"save-message/internal/services"
+	"save-message/internal/state"
+	"save-message/internal/telegram"
+	"save-message/internal/updates"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/joho/godotenv"
@@ -18,9 +31,22 @@ import (
 
 // BotConfig holds all configuration for the bot
 type BotConfig struct {
-	BotToken  string
-	OpenAIKey string
-	DBPath    string
+	BotToken       string
+	OpenAIKey      string
+	AI             ai.Config     // suggestion provider; OpenAI with OpenAIKey when Provider is empty
+	AITimeout      time.Duration // deadline for one suggestion call, retries included; 0 for the default
+	Embeddings     ai.Config     // embeddings endpoint ranking topics by similarity; off when Provider is empty
+	EmbeddingMatch float64       // similarity from which a topic is close enough to skip the completion; 0 for the default
+	DBPath         string        // SQLite file, or a postgres:// DSN for a database shared by several bots
+	DBDriver       string        // the backend DBPath selects
+	TelegramAPIURL string
+
+	// Update ingestion: long polling by default, or a webhook behind a reverse proxy
+	UpdateMode        string
+	WebhookURL        string
+	WebhookListenAddr string
+	WebhookPath       string
+	WebhookSecret     string
 }
 
 // BotInstance holds all initialized components
@@ -28,12 +54,23 @@ type BotInstance struct {
 	Bot              *gotgbot.Bot
 	Config           *BotConfig
 	Database         *database.Database
+	TelegramClient   *telegram.Client
+	OutboundQueue    *telegram.Scheduler
+	Tracker          *lifecycle.Tracker
 	MessageService   *services.MessageService
 	TopicService     *services.TopicService
+	TopicRegistry    *services.TopicRegistry
+	UserRegistry     *services.UserRegistry
+	DeletionQueue    *services.DeletionQueue
+	StateStore       *state.DatabaseStore
+	Conversations    *conversation.Manager
 	AIService        *services.AIService
+	TopicHandlers    *handlers.TopicHandlers
 	MessageHandlers  *handlers.MessageHandlers
 	CallbackHandlers *handlers.CallbackHandlers
 	Dispatcher       *router.Dispatcher
+	Executor         *updates.Executor
+	Updates          updates.Source
 }
 
 // LoadConfig loads configuration from environment
@@ -48,56 +85,300 @@ func LoadConfig() (*BotConfig, error) {
 		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN is not set in .env")
 	}
 
-	openaiKey := os.Getenv("OPENAI_API_KEY")
-	if openaiKey == "" {
-		logutils.Error("LoadConfig: OPENAI_API_KEY is not set in .env", nil)
-		return nil, fmt.Errorf("OPENAI_API_KEY is not set in .env")
+	// DATABASE_URL points at a central server; otherwise the bot keeps its own SQLite file
+	dbPath := os.Getenv("DATABASE_URL")
+	if dbPath == "" {
+		dbPath = os.Getenv("DB_PATH")
 	}
-
-	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "bot.db" // Default database path
 	}
+	dbDriver, err := database.DriverFor(dbPath)
+	if err != nil {
+		logutils.Error("LoadConfig: invalid DATABASE_URL", err)
+		return nil, err
+	}
+
+	telegramAPIURL := os.Getenv("TELEGRAM_API_URL")
+	if telegramAPIURL == "" {
+		telegramAPIURL = config.DefaultTelegramAPIURL // Public Bot API unless a self-hosted server is configured
+	}
+
+	botConfig := &BotConfig{
+		BotToken:       botToken,
+		OpenAIKey:      os.Getenv("OPENAI_API_KEY"),
+		DBPath:         dbPath,
+		DBDriver:       dbDriver,
+		TelegramAPIURL: telegramAPIURL,
+	}
+	if err := loadAIConfig(botConfig); err != nil {
+		logutils.Error("LoadConfig: invalid AI provider configuration", err)
+		return nil, err
+	}
+	if err := loadEmbeddingsConfig(botConfig); err != nil {
+		logutils.Error("LoadConfig: invalid embeddings configuration", err)
+		return nil, err
+	}
+	if err := loadUpdateConfig(botConfig); err != nil {
+		logutils.Error("LoadConfig: invalid update mode configuration", err)
+		return nil, err
+	}
+
+	logutils.Success("LoadConfig: exit", "telegram_api_url", telegramAPIURL, "update_mode", botConfig.UpdateMode, "db_driver", dbDriver, "ai_provider", botConfig.AI.Provider, "ai_model", botConfig.AI.Model)
+	return botConfig, nil
+}
+
+// loadAIConfig reads the AI_* settings. AI_PROVIDER picks OpenAI (the default), a local
+// OpenAI-compatible server or an Anthropic-style API; the key falls back to the provider's
+// usual variable and may be left out for local servers.
+func loadAIConfig(botConfig *BotConfig) error {
+	aiConfig := ai.Config{
+		Provider: strings.ToLower(os.Getenv("AI_PROVIDER")),
+		BaseURL:  os.Getenv("AI_BASE_URL"),
+		APIKey:   os.Getenv("AI_API_KEY"),
+		Model:    os.Getenv("AI_MODEL"),
+	}
+	if aiConfig.Provider == "" {
+		aiConfig.Provider = ai.ProviderOpenAI
+	}
+
+	keyVar := ""
+	switch aiConfig.Provider {
+	case ai.ProviderOpenAI:
+		keyVar = "OPENAI_API_KEY"
+	case ai.ProviderAnthropic:
+		keyVar = "ANTHROPIC_API_KEY"
+	}
+	if aiConfig.APIKey == "" && keyVar != "" {
+		aiConfig.APIKey = os.Getenv(keyVar)
+		if aiConfig.APIKey == "" {
+			return fmt.Errorf("%s is not set in .env", keyVar)
+		}
+	}
+
+	if value := os.Getenv("AI_TEMPERATURE"); value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return fmt.Errorf("AI_TEMPERATURE must be a number from 0 to 2, got %q", value)
+		}
+		aiConfig.Temperature = &temperature
+	}
+	if value := os.Getenv("AI_MAX_TOKENS"); value != "" {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			return fmt.Errorf("AI_MAX_TOKENS must be a positive number, got %q", value)
+		}
+		aiConfig.MaxTokens = maxTokens
+	}
+	if value := os.Getenv("AI_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("AI_TIMEOUT must be a positive duration such as 20s, got %q", value)
+		}
+		botConfig.AITimeout = timeout
+	}
+	botConfig.AI = aiConfig
+	return nil
+}
+
+// loadEmbeddingsConfig reads the EMBEDDINGS_* settings. Topics are ranked by embeddings only
+// when EMBEDDINGS_PROVIDER is set; the key falls back to the AI provider's when both are the
+// same, then to OPENAI_API_KEY for OpenAI.
+func loadEmbeddingsConfig(botConfig *BotConfig) error {
+	embeddings := ai.Config{
+		Provider: strings.ToLower(os.Getenv("EMBEDDINGS_PROVIDER")),
+		BaseURL:  os.Getenv("EMBEDDINGS_BASE_URL"),
+		APIKey:   os.Getenv("EMBEDDINGS_API_KEY"),
+		Model:    os.Getenv("EMBEDDINGS_MODEL"),
+	}
+	if embeddings.Provider == "" {
+		return nil
+	}
+	if embeddings.APIKey == "" && embeddings.Provider == botConfig.AI.Provider {
+		embeddings.APIKey = botConfig.AI.APIKey
+	}
+	if embeddings.APIKey == "" && embeddings.Provider == ai.ProviderOpenAI {
+		embeddings.APIKey = os.Getenv("OPENAI_API_KEY")
+		if embeddings.APIKey == "" {
+			return fmt.Errorf("EMBEDDINGS_API_KEY or OPENAI_API_KEY must be set for OpenAI embeddings")
+		}
+	}
+	if value := os.Getenv("EMBEDDINGS_MATCH_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("EMBEDDINGS_MATCH_THRESHOLD must be a number above 0 and up to 1, got %q", value)
+		}
+		botConfig.EmbeddingMatch = threshold
+	}
+	botConfig.Embeddings = embeddings
+	return nil
+}
+
+// webhookSecretPattern is the character set and length Telegram accepts for secret_token
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// loadUpdateConfig reads UPDATE_MODE and, in webhook mode, the WEBHOOK_* settings
+func loadUpdateConfig(botConfig *BotConfig) error {
+	botConfig.UpdateMode = strings.ToLower(os.Getenv("UPDATE_MODE"))
+	if botConfig.UpdateMode == "" {
+		botConfig.UpdateMode = config.UpdateModePolling
+	}
+
+	switch botConfig.UpdateMode {
+	case config.UpdateModePolling:
+		return nil
+	case config.UpdateModeWebhook:
+	default:
+		return fmt.Errorf("UPDATE_MODE must be %q or %q, got %q", config.UpdateModePolling, config.UpdateModeWebhook, botConfig.UpdateMode)
+	}
+
+	botConfig.WebhookURL = os.Getenv("WEBHOOK_URL")
+	webhookURL, err := url.Parse(botConfig.WebhookURL)
+	if botConfig.WebhookURL == "" || err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return fmt.Errorf("WEBHOOK_URL must be a public https URL in webhook mode")
+	}
+
+	botConfig.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if !webhookSecretPattern.MatchString(botConfig.WebhookSecret) {
+		return fmt.Errorf("WEBHOOK_SECRET must be 1-256 characters of A-Z, a-z, 0-9, _ and - in webhook mode")
+	}
 
-	config := &BotConfig{
-		BotToken:  botToken,
-		OpenAIKey: openaiKey,
-		DBPath:    dbPath,
+	botConfig.WebhookListenAddr = os.Getenv("WEBHOOK_LISTEN_ADDR")
+	if botConfig.WebhookListenAddr == "" {
+		botConfig.WebhookListenAddr = config.DefaultWebhookListenAddr
 	}
 
-	logutils.Success("LoadConfig: exit")
-	return config, nil
+	// The proxy may forward to a different path than the public one
+	botConfig.WebhookPath = os.Getenv("WEBHOOK_PATH")
+	if botConfig.WebhookPath == "" {
+		botConfig.WebhookPath = webhookURL.Path
+	}
+	return nil
 }
 
 // InitializeBot creates and initializes all bot components
-func InitializeBot(config *BotConfig) (*BotInstance, error) {
+func InitializeBot(botConfig *BotConfig) (*BotInstance, error) {
 	logutils.Info("InitializeBot: entry")
 
-	bot, err := gotgbot.NewBot(config.BotToken, nil)
+	apiURL := botConfig.TelegramAPIURL
+	if apiURL == "" {
+		apiURL = config.DefaultTelegramAPIURL
+	}
+
+	bot, err := gotgbot.NewBot(botConfig.BotToken, &gotgbot.BotOpts{
+		RequestOpts:        &gotgbot.RequestOpts{Timeout: 10 * time.Second, APIURL: apiURL},
+		DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: apiURL},
+	})
 	if err != nil {
 		logutils.Error("InitializeBot: failed to create bot", err)
 		return nil, fmt.Errorf("failed to create bot: %v", err)
 	}
 
-	db, err := database.NewDatabase(config.DBPath)
+	aiConfig := botConfig.AI
+	if aiConfig.Provider == "" && aiConfig.APIKey == "" {
+		aiConfig.APIKey = botConfig.OpenAIKey
+	}
+	// Retries, a deadline and a circuit breaker, so a failing provider never keeps users waiting
+	resilience := ai.DefaultResilienceConfig()
+	if botConfig.AITimeout > 0 {
+		resilience.CallTimeout = botConfig.AITimeout
+	}
+	providerClient, err := ai.NewClient(aiConfig, &http.Client{Timeout: resilience.CallTimeout})
+	if err != nil {
+		logutils.Error("InitializeBot: failed to create AI client", err)
+		return nil, fmt.Errorf("failed to create AI client: %v", err)
+	}
+	aiClient := ai.NewResilientClient(providerClient, resilience)
+	var embedder ai.Embedder
+	if botConfig.Embeddings.Provider != "" {
+		embedder, err = ai.NewEmbedder(botConfig.Embeddings, &http.Client{Timeout: config.DefaultEmbeddingTimeout})
+		if err != nil {
+			logutils.Error("InitializeBot: failed to create embeddings client", err)
+			return nil, fmt.Errorf("failed to create embeddings client: %v", err)
+		}
+	}
+
+	opened, err := database.NewDatabase(botConfig.DBPath)
 	if err != nil {
 		logutils.Error("InitializeBot: failed to initialize database", err)
 		return nil, fmt.Errorf("failed to initialize database: %v", err)
 	}
+	// Offsets, deletions and button state are kept per bot, so bots can share one database
+	db := opened.ForBot(bot.User.Id)
+	if err := db.ClaimUnscopedState(); err != nil {
+		logutils.Error("InitializeBot: failed to claim state saved before it was kept per bot", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to claim bot state: %v", err)
+	}
+
+	httpClient := &http.Client{Timeout: config.DefaultTelegramRequestTimeout}
 
-	httpClient := &http.Client{Timeout: 15 * time.Second}
+	// One shared Bot API transport for every service
+	telegramClient := telegram.NewClient(botConfig.BotToken, apiURL, httpClient)
+
+	// All outbound calls go through the flood-control aware queue
+	outboundQueue := telegram.NewScheduler(telegramClient, telegram.DefaultSchedulerConfig())
 
 	// Initialize services with the correct signatures
-	messageService := services.NewMessageService(config.BotToken, db)
-	topicService := services.NewTopicService(config.BotToken, db, httpClient)
-	aiService := services.NewAIService(config.OpenAIKey, httpClient)
+	messageService := services.NewMessageService(outboundQueue, db)
+	topicService := services.NewTopicService(outboundQueue, db)
+	topicRegistry := services.NewTopicRegistry(db)
+	userRegistry := services.NewUserRegistry(db)
+	deletionQueue := services.NewDeletionQueue(db, messageService)
+	savedMessages := services.NewSavedMessageIndex(db)
+	settingsService := services.NewSettingsService(db)
+	aiService := services.NewAIService(aiClient)
+	// Chats in privacy mode, and everyone while the provider fails, get suggestions from their own saves
+	aiService.Local = services.NewLocalSuggester(db)
+	aiService.Chats = settingsService
+	if embedder != nil {
+		// Topics are ranked by their saves' embeddings before the provider is asked for names
+		topicEmbeddings := services.NewTopicEmbeddings(db, embedder)
+		topicEmbeddings.Chats = settingsService
+		aiService.Embeddings = topicEmbeddings
+		aiService.MatchThreshold = botConfig.EmbeddingMatch
+		savedMessages.Embeddings = topicEmbeddings
+	}
+
+	// Button context, button tokens and pending prompts live in the database so they survive restarts
+	stateStore := state.NewDatabaseStore(db)
+	callbackRegistry := callbacks.NewRegistry(stateStore)
+	conversations := conversation.NewManager(stateStore)
+
+	// Tracks in-flight updates, AI calls, delayed deletes, merges and centroid updates so shutdown can drain them
+	tracker := lifecycle.NewTracker()
+	savedMessages.Tracker = tracker
 
 	// Initialize handlers in the correct order
 	commandHandlers := handlers.NewCommandHandlers(messageService, topicService)
 	warningHandlers := handlers.NewWarningHandlers(messageService)
 	warningHandlers.BotUserID = bot.User.Id
+	warningHandlers.Deletions = deletionQueue
+	warningHandlers.Tracker = tracker
+	warningHandlers.Callbacks = callbackRegistry
+	warningHandlers.Settings = settingsService
 	topicHandlers := handlers.NewTopicHandlers(messageService, topicService)
+	topicHandlers.Deletions = deletionQueue
+	topicHandlers.Tracker = tracker
+	topicHandlers.State = stateStore
+	topicHandlers.Callbacks = callbackRegistry
+	topicHandlers.Conversations = conversations
+	topicHandlers.SavedMessages = savedMessages
+	topicHandlers.Settings = settingsService
 	aiHandlers := handlers.NewAIHandlers(messageService, topicService, aiService, topicHandlers)
+	aiHandlers.Settings = settingsService
+	searchHandlers := handlers.NewSearchHandlers(messageService, savedMessages)
+	searchHandlers.Callbacks = callbackRegistry
+	commandHandlers.Search = searchHandlers
+	topicManagement := handlers.NewTopicManagementHandlers(messageService, topicService, savedMessages)
+	topicManagement.Callbacks = callbackRegistry
+	topicManagement.Tracker = tracker
+	commandHandlers.Topics = topicManagement
+	settingsHandlers := handlers.NewSettingsHandlers(messageService, settingsService)
+	settingsHandlers.Chats = settingsService
+	settingsHandlers.Topics = topicService
+	settingsHandlers.Callbacks = callbackRegistry
+	commandHandlers.Settings = settingsHandlers
 
 	// This was the key: Inject the concrete handlers
 	callbackHandlers := handlers.NewCallbackHandlers(
@@ -106,6 +387,10 @@ func InitializeBot(config *BotConfig) (*BotInstance, error) {
 		aiHandlers,
 		warningHandlers,
 	)
+	callbackHandlers.Callbacks = callbackRegistry
+	callbackHandlers.Search = searchHandlers
+	callbackHandlers.Topics = topicManagement
+	callbackHandlers.Settings = settingsHandlers
 
 	messageHandlers := handlers.NewMessageHandlers(
 		commandHandlers,
@@ -125,26 +410,88 @@ func InitializeBot(config *BotConfig) (*BotInstance, error) {
 
 	// Set the bot's user ID for self-detection in join events
 	dispatcher.BotUserID = bot.User.Id
+	dispatcher.TopicRegistry = topicRegistry
+	dispatcher.Users = userRegistry
+	dispatcher.Callbacks = callbackRegistry
+
+	// Updates from different chats are handled in parallel, each chat's in order
+	executor := updates.NewExecutor(dispatcher, config.DefaultUpdateWorkers, config.DefaultUpdateQueueSize)
+	executor.Tracker = tracker
+
+	// Choose how updates reach the executor. Ingestion talks to the client directly:
+	// a long poll parked in the outbound queue would only hold up real sends.
+	var updateSource updates.Source
+	if botConfig.UpdateMode == config.UpdateModeWebhook {
+		webhookServer := updates.NewWebhookServer(telegramClient, executor, updates.WebhookConfig{
+			URL:        botConfig.WebhookURL,
+			ListenAddr: botConfig.WebhookListenAddr,
+			Path:       botConfig.WebhookPath,
+			Secret:     botConfig.WebhookSecret,
+		})
+		webhookServer.Tracker = tracker
+		updateSource = webhookServer
+	} else {
+		poller := updates.NewPoller(telegramClient, executor)
+		poller.Offsets = db // resume where the last run stopped
+		poller.Tracker = tracker
+		updateSource = poller
+	}
 
 	instance := &BotInstance{
 		Bot:              bot,
-		Config:           config,
+		Config:           botConfig,
 		Database:         db,
+		TelegramClient:   telegramClient,
+		OutboundQueue:    outboundQueue,
+		Tracker:          tracker,
 		MessageService:   messageService,
 		TopicService:     topicService,
+		TopicRegistry:    topicRegistry,
+		UserRegistry:     userRegistry,
+		DeletionQueue:    deletionQueue,
+		StateStore:       stateStore,
+		Conversations:    conversations,
 		AIService:        aiService,
+		TopicHandlers:    topicHandlers,
 		MessageHandlers:  messageHandlers,
 		CallbackHandlers: callbackHandlers,
 		Dispatcher:       dispatcher,
+		Executor:         executor,
+		Updates:          updateSource,
 	}
 
 	logutils.Success("InitializeBot: exit", "bot_username", bot.User.Username)
 	return instance, nil
 }
 
-// Cleanup performs cleanup operations
+// StartWorkers starts background workers; they stop when ctx ends and are drained by Cleanup
+func (bi *BotInstance) StartWorkers(ctx context.Context) {
+	bi.Executor.Start()
+	bi.Tracker.Go(func() { bi.Executor.ReportStats(ctx, config.DefaultUpdateStatsInterval) })
+	bi.Tracker.Go(func() { bi.DeletionQueue.Run(ctx) })
+	bi.Tracker.Go(func() { state.RunPurger(ctx, bi.StateStore, config.DefaultStatePurgeInterval) })
+	bi.Tracker.Go(func() {
+		// Timeouts reply in the chat, so they run under the tracker's context like an update would
+		bi.Conversations.Run(ctx, config.DefaultConversationSweepInterval, func(_ context.Context, conv conversation.Conversation) {
+			bi.TopicHandlers.HandleConversationTimeout(bi.Tracker.Context(), conv)
+		})
+	})
+}
+
+// Cleanup waits for in-flight work up to config.DefaultShutdownTimeout, then releases resources.
+// Call it only after the update source has stopped.
 func (bi *BotInstance) Cleanup() {
 	logutils.Info("Cleanup: entry")
+	// Nothing new arrives now; let the workers finish what is queued
+	if bi.Executor != nil {
+		bi.Executor.Close()
+	}
+	if err := bi.Tracker.Shutdown(config.DefaultShutdownTimeout); err != nil {
+		logutils.Error("Cleanup: in-flight work abandoned", err)
+	}
+	if bi.OutboundQueue != nil {
+		bi.OutboundQueue.Close()
+	}
 	if bi.Database != nil {
 		bi.Database.Close()
 	}
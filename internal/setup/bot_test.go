@@ -3,6 +3,9 @@ package setup
 import (
 	"os"
 	"testing"
+	"time"
+
+	"save-message/internal/database"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -259,6 +262,28 @@ func TestLoadConfig_DefaultDBPath(t *testing.T) {
 	assert.Equal(t, "bot.db", config.DBPath)
 }
 
+func TestLoadConfig_DatabaseURL(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "test_token")
+	t.Setenv("OPENAI_API_KEY", "test_key")
+	t.Setenv("DB_PATH", "test.db")
+
+	t.Setenv("DATABASE_URL", "postgres://bot:secret@db:5432/bots")
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://bot:secret@db:5432/bots", config.DBPath, "DATABASE_URL wins over DB_PATH")
+	assert.Equal(t, database.DriverPostgres, config.DBDriver)
+
+	t.Setenv("DATABASE_URL", "")
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "test.db", config.DBPath)
+	assert.Equal(t, database.DriverSQLite, config.DBDriver)
+
+	t.Setenv("DATABASE_URL", "mysql://db/bots")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
+
 func TestInitializeBot_ComponentInitialization(t *testing.T) {
 	// Test that all components are properly initialized
 	config := &BotConfig{
@@ -285,3 +310,231 @@ func TestInitializeBot_ComponentInitialization(t *testing.T) {
 		assert.NotNil(t, instance.Dispatcher)
 	}
 }
+
+func TestLoadConfig_UpdateMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantErr  bool
+		wantMode string
+		wantAddr string
+		wantPath string
+	}{
+		{
+			name:     "polling by default",
+			env:      map[string]string{},
+			wantMode: "polling",
+		},
+		{
+			name: "webhook with defaults",
+			env: map[string]string{
+				"UPDATE_MODE":    "webhook",
+				"WEBHOOK_URL":    "https://bot.example.com/telegram/hook",
+				"WEBHOOK_SECRET": "s3cret-token_1",
+			},
+			wantMode: "webhook",
+			wantAddr: ":8080",
+			wantPath: "/telegram/hook",
+		},
+		{
+			name: "webhook behind a proxy that rewrites the path",
+			env: map[string]string{
+				"UPDATE_MODE":         "WEBHOOK",
+				"WEBHOOK_URL":         "https://bot.example.com/telegram/hook",
+				"WEBHOOK_SECRET":      "s3cret",
+				"WEBHOOK_LISTEN_ADDR": "127.0.0.1:9000",
+				"WEBHOOK_PATH":        "/hook",
+			},
+			wantMode: "webhook",
+			wantAddr: "127.0.0.1:9000",
+			wantPath: "/hook",
+		},
+		{
+			name:    "webhook without secret",
+			env:     map[string]string{"UPDATE_MODE": "webhook", "WEBHOOK_URL": "https://bot.example.com/hook"},
+			wantErr: true,
+		},
+		{
+			name:    "webhook secret with invalid characters",
+			env:     map[string]string{"UPDATE_MODE": "webhook", "WEBHOOK_URL": "https://bot.example.com/hook", "WEBHOOK_SECRET": "not allowed!"},
+			wantErr: true,
+		},
+		{
+			name:    "webhook over plain http",
+			env:     map[string]string{"UPDATE_MODE": "webhook", "WEBHOOK_URL": "http://bot.example.com/hook", "WEBHOOK_SECRET": "s3cret"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			env:     map[string]string{"UPDATE_MODE": "carrier-pigeon"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "test_token")
+			t.Setenv("OPENAI_API_KEY", "test_key")
+			for _, key := range []string{"UPDATE_MODE", "WEBHOOK_URL", "WEBHOOK_SECRET", "WEBHOOK_LISTEN_ADDR", "WEBHOOK_PATH"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			config, err := LoadConfig()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMode, config.UpdateMode)
+			assert.Equal(t, tt.wantAddr, config.WebhookListenAddr)
+			assert.Equal(t, tt.wantPath, config.WebhookPath)
+		})
+	}
+}
+
+func TestLoadConfig_AIProvider(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		wantErr         bool
+		wantProvider    string
+		wantKey         string
+		wantTemperature *float64
+		wantMaxTokens   int
+		wantTimeout     time.Duration
+	}{
+		{
+			name:         "OpenAI by default",
+			env:          map[string]string{"OPENAI_API_KEY": "sk-openai"},
+			wantProvider: "openai",
+			wantKey:      "sk-openai",
+		},
+		{
+			name:    "OpenAI without a key",
+			env:     map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:         "local Ollama needs no key",
+			env:          map[string]string{"AI_PROVIDER": "Ollama", "AI_MODEL": "llama3", "AI_TEMPERATURE": "0", "AI_MAX_TOKENS": "128"},
+			wantProvider: "ollama",
+			wantTemperature: func() *float64 {
+				zero := 0.0
+				return &zero
+			}(),
+			wantMaxTokens: 128,
+		},
+		{
+			name:         "Anthropic takes its own key",
+			env:          map[string]string{"AI_PROVIDER": "anthropic", "ANTHROPIC_API_KEY": "sk-ant", "OPENAI_API_KEY": "sk-openai"},
+			wantProvider: "anthropic",
+			wantKey:      "sk-ant",
+		},
+		{
+			name:         "AI_API_KEY wins",
+			env:          map[string]string{"AI_PROVIDER": "anthropic", "AI_API_KEY": "sk-proxy"},
+			wantProvider: "anthropic",
+			wantKey:      "sk-proxy",
+		},
+		{
+			name:         "slow local model gets more time",
+			env:          map[string]string{"AI_PROVIDER": "llamacpp", "AI_MODEL": "mistral", "AI_TIMEOUT": "90s"},
+			wantProvider: "llamacpp",
+			wantTimeout:  90 * time.Second,
+		},
+		{
+			name:    "timeout without a unit",
+			env:     map[string]string{"OPENAI_API_KEY": "sk-openai", "AI_TIMEOUT": "30"},
+			wantErr: true,
+		},
+		{
+			name:    "temperature out of range",
+			env:     map[string]string{"OPENAI_API_KEY": "sk-openai", "AI_TEMPERATURE": "3"},
+			wantErr: true,
+		},
+		{
+			name:    "max tokens not a number",
+			env:     map[string]string{"OPENAI_API_KEY": "sk-openai", "AI_MAX_TOKENS": "lots"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "test_token")
+			for _, key := range []string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "AI_PROVIDER", "AI_BASE_URL", "AI_API_KEY", "AI_MODEL", "AI_TEMPERATURE", "AI_MAX_TOKENS", "AI_TIMEOUT"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			config, err := LoadConfig()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantProvider, config.AI.Provider)
+			assert.Equal(t, tt.wantKey, config.AI.APIKey)
+			assert.Equal(t, tt.wantTemperature, config.AI.Temperature)
+			assert.Equal(t, tt.wantMaxTokens, config.AI.MaxTokens)
+			assert.Equal(t, tt.wantTimeout, config.AITimeout)
+		})
+	}
+}
+
+func TestLoadConfig_Embeddings(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantErr       bool
+		wantProvider  string
+		wantKey       string
+		wantThreshold float64
+	}{
+		{
+			name: "off by default",
+			env:  map[string]string{"OPENAI_API_KEY": "sk-openai"},
+		},
+		{
+			name:         "OpenAI embeddings share the OpenAI key",
+			env:          map[string]string{"OPENAI_API_KEY": "sk-openai", "EMBEDDINGS_PROVIDER": "OpenAI"},
+			wantProvider: "openai",
+			wantKey:      "sk-openai",
+		},
+		{
+			name:          "local embeddings next to Anthropic completions",
+			env:           map[string]string{"AI_PROVIDER": "anthropic", "ANTHROPIC_API_KEY": "sk-ant", "EMBEDDINGS_PROVIDER": "ollama", "EMBEDDINGS_MATCH_THRESHOLD": "0.8"},
+			wantProvider:  "ollama",
+			wantThreshold: 0.8,
+		},
+		{
+			name:    "OpenAI embeddings without a key",
+			env:     map[string]string{"AI_PROVIDER": "ollama", "EMBEDDINGS_PROVIDER": "openai"},
+			wantErr: true,
+		},
+		{
+			name:    "threshold out of range",
+			env:     map[string]string{"OPENAI_API_KEY": "sk-openai", "EMBEDDINGS_PROVIDER": "openai", "EMBEDDINGS_MATCH_THRESHOLD": "1.5"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "test_token")
+			for _, key := range []string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "AI_PROVIDER", "AI_API_KEY", "EMBEDDINGS_PROVIDER",
+				"EMBEDDINGS_BASE_URL", "EMBEDDINGS_API_KEY", "EMBEDDINGS_MODEL", "EMBEDDINGS_MATCH_THRESHOLD"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			config, err := LoadConfig()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantProvider, config.Embeddings.Provider)
+			assert.Equal(t, tt.wantKey, config.Embeddings.APIKey)
+			assert.Equal(t, tt.wantThreshold, config.EmbeddingMatch)
+		})
+	}
+}
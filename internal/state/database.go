@@ -0,0 +1,83 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+)
+
+// DatabaseStore keeps interaction state in the bot's database, SQLite or Postgres, so
+// buttons sent before a restart or deploy still find their message afterwards. Entries
+// are scoped to the bot the database was opened for (database.Database.ForBot).
+type DatabaseStore struct {
+	db  database.DatabaseInterface
+	now func() time.Time
+}
+
+var _ interfaces.StateStoreInterface = (*DatabaseStore)(nil)
+
+// NewDatabaseStore creates a state store backed by db
+func NewDatabaseStore(db database.DatabaseInterface) *DatabaseStore {
+	return &DatabaseStore{db: db, now: time.Now}
+}
+
+// Set stores value under namespace/key for ttl
+func (s *DatabaseStore) Set(ctx context.Context, namespace, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.PutState(namespace, key, string(data), s.now().Add(ttl))
+}
+
+// Get decodes the unexpired value under namespace/key into dest
+func (s *DatabaseStore) Get(ctx context.Context, namespace, key string, dest interface{}) (bool, error) {
+	data, ok, err := s.db.GetState(namespace, key, s.now())
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Take removes the value under namespace/key and decodes it into dest if it had not expired
+func (s *DatabaseStore) Take(ctx context.Context, namespace, key string, dest interface{}) (bool, error) {
+	data, ok, err := s.db.TakeState(namespace, key, s.now())
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteIf removes the value under namespace/key if it still equals value
+func (s *DatabaseStore) DeleteIf(ctx context.Context, namespace, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return s.db.DeleteStateIf(namespace, key, string(data))
+}
+
+// Delete removes the value under namespace/key
+func (s *DatabaseStore) Delete(ctx context.Context, namespace, key string) error {
+	return s.db.DeleteState(namespace, key)
+}
+
+// Keys lists the unexpired keys in namespace
+func (s *DatabaseStore) Keys(ctx context.Context, namespace string) ([]string, error) {
+	return s.db.StateKeys(namespace, s.now())
+}
+
+// PurgeExpired deletes expired rows
+func (s *DatabaseStore) PurgeExpired(ctx context.Context) (int, error) {
+	purged, err := s.db.PurgeExpiredState(s.now())
+	return int(purged), err
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"save-message/internal/interfaces"
+)
+
+// MemoryStore keeps interaction state in process memory. It is lost on restart,
+// so it suits tests and single-run setups; production uses DatabaseStore.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[entryKey]memoryEntry
+
+	now func() time.Time
+}
+
+type entryKey struct {
+	namespace string
+	key       string
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+var _ interfaces.StateStoreInterface = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory state store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[entryKey]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Set stores value under namespace/key for ttl
+func (m *MemoryStore) Set(ctx context.Context, namespace, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entryKey{namespace, key}] = memoryEntry{value: data, expiresAt: m.now().Add(ttl)}
+	return nil
+}
+
+// Get decodes the unexpired value under namespace/key into dest
+func (m *MemoryStore) Get(ctx context.Context, namespace, key string, dest interface{}) (bool, error) {
+	m.mu.Lock()
+	entry, ok := m.entries[entryKey{namespace, key}]
+	if ok && !m.now().Before(entry.expiresAt) {
+		delete(m.entries, entryKey{namespace, key})
+		ok = false
+	}
+	m.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(entry.value, dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Take removes the value under namespace/key and decodes it into dest if it had not expired
+func (m *MemoryStore) Take(ctx context.Context, namespace, key string, dest interface{}) (bool, error) {
+	m.mu.Lock()
+	entry, ok := m.entries[entryKey{namespace, key}]
+	delete(m.entries, entryKey{namespace, key})
+	m.mu.Unlock()
+	if !ok || !m.now().Before(entry.expiresAt) {
+		return false, nil
+	}
+	if err := json.Unmarshal(entry.value, dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteIf removes the value under namespace/key if it still equals value
+func (m *MemoryStore) DeleteIf(ctx context.Context, namespace, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[entryKey{namespace, key}]
+	if !ok || !bytes.Equal(entry.value, data) {
+		return false, nil
+	}
+	delete(m.entries, entryKey{namespace, key})
+	return true, nil
+}
+
+// Delete removes the value under namespace/key
+func (m *MemoryStore) Delete(ctx context.Context, namespace, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, entryKey{namespace, key})
+	return nil
+}
+
+// Keys lists the unexpired keys in namespace
+func (m *MemoryStore) Keys(ctx context.Context, namespace string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var keys []string
+	for key, entry := range m.entries {
+		if key.namespace == namespace && now.Before(entry.expiresAt) {
+			keys = append(keys, key.key)
+		}
+	}
+	return keys, nil
+}
+
+// PurgeExpired drops every expired entry
+func (m *MemoryStore) PurgeExpired(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	purged := 0
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,31 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// RunPurger drops expired entries from store every interval until ctx ends.
+// Reads already ignore expired entries; this only keeps the store from growing.
+func RunPurger(ctx context.Context, store interfaces.StateStoreInterface, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		purged, err := store.PurgeExpired(ctx)
+		if err != nil {
+			logutils.Error("RunPurger: PurgeExpiredError", err)
+			continue
+		}
+		if purged > 0 {
+			logutils.Debug("RunPurger", "purged", purged)
+		}
+	}
+}
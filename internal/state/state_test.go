@@ -0,0 +1,179 @@
+package state
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"save-message/internal/database"
+	"save-message/internal/interfaces"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a manually advanced time source shared by a store under test
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newStores(t *testing.T, c *clock) map[string]interfaces.StateStoreInterface {
+	db, err := database.NewDatabase(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	memory := NewMemoryStore()
+	memory.now = c.now
+	sqlite := NewDatabaseStore(db)
+	sqlite.now = c.now
+	return map[string]interfaces.StateStoreInterface{"memory": memory, "sqlite": sqlite}
+}
+
+func TestStore_SetGetDeleteExpire(t *testing.T) {
+	c := &clock{t: time.Now()}
+	for name, store := range newStores(t, c) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			msg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789, Type: "supergroup"}, Text: "Cake"}
+			require.NoError(t, store.Set(ctx, "callback", "Desserts_1043", msg, time.Minute))
+			require.NoError(t, store.Set(ctx, "keyboard", "Desserts_1043", 1044, time.Hour))
+
+			var got gotgbot.Message
+			found, err := store.Get(ctx, "callback", "Desserts_1043", &got)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, *msg, got)
+
+			var missing int
+			found, err = store.Get(ctx, "callback", "Snacks_1043", &missing)
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			// Namespaces are independent and the TTL is per entry
+			c.t = c.t.Add(2 * time.Minute)
+			found, _ = store.Get(ctx, "callback", "Desserts_1043", &got)
+			assert.False(t, found, "expired entry is not returned")
+			var keyboardID int
+			found, _ = store.Get(ctx, "keyboard", "Desserts_1043", &keyboardID)
+			assert.True(t, found)
+			assert.Equal(t, 1044, keyboardID)
+
+			require.NoError(t, store.Delete(ctx, "keyboard", "Desserts_1043"))
+			found, _ = store.Get(ctx, "keyboard", "Desserts_1043", &keyboardID)
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestStore_PurgeExpired(t *testing.T) {
+	c := &clock{t: time.Now()}
+	for name, store := range newStores(t, c) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Set(ctx, "moved", "1", true, time.Minute))
+			require.NoError(t, store.Set(ctx, "moved", "2", true, time.Minute))
+			require.NoError(t, store.Set(ctx, "moved", "3", true, time.Hour))
+			// Setting again refreshes the TTL
+			c.t = c.t.Add(30 * time.Second)
+			require.NoError(t, store.Set(ctx, "moved", "2", true, time.Minute))
+
+			require.NoError(t, store.Set(ctx, "other", "4", true, time.Hour))
+
+			c.t = c.t.Add(45 * time.Second)
+			keys, err := store.Keys(ctx, "moved")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"2", "3"}, keys, "expired and other namespaces' keys are not listed")
+
+			purged, err := store.PurgeExpired(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+
+			var moved bool
+			found, _ := store.Get(ctx, "moved", "3", &moved)
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestDatabaseStore_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	ctx := context.Background()
+
+	db, err := database.NewDatabase(path)
+	require.NoError(t, err)
+	msg := &gotgbot.Message{MessageId: 1043, Chat: gotgbot.Chat{Id: 789}, Text: "Cake"}
+	require.NoError(t, NewDatabaseStore(db).Set(ctx, "callback", "Desserts_1043", msg, time.Hour))
+	require.NoError(t, db.Close())
+
+	db, err = database.NewDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+	var got gotgbot.Message
+	found, err := NewDatabaseStore(db).Get(ctx, "callback", "Desserts_1043", &got)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Cake", got.Text)
+}
+
+func TestStore_TakeIsExclusive(t *testing.T) {
+	c := &clock{t: time.Now()}
+	for name, store := range newStores(t, c) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Set(ctx, "pending", "7", "Recipes", time.Minute))
+
+			var wg sync.WaitGroup
+			var taken atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var value string
+					found, err := store.Take(ctx, "pending", "7", &value)
+					assert.NoError(t, err)
+					if found {
+						assert.Equal(t, "Recipes", value)
+						taken.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(1), taken.Load())
+
+			require.NoError(t, store.Set(ctx, "pending", "8", "Old", time.Minute))
+			c.t = c.t.Add(time.Hour)
+			var value string
+			found, err := store.Take(ctx, "pending", "8", &value)
+			require.NoError(t, err)
+			assert.False(t, found, "an expired value is not handed out")
+		})
+	}
+}
+
+func TestStore_DeleteIfLeavesReplacedValues(t *testing.T) {
+	c := &clock{t: time.Now()}
+	for name, store := range newStores(t, c) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Set(ctx, "conversation", "1:1", "first", time.Minute))
+			require.NoError(t, store.Set(ctx, "conversation", "1:1", "second", time.Minute))
+
+			deleted, err := store.DeleteIf(ctx, "conversation", "1:1", "first")
+			require.NoError(t, err)
+			assert.False(t, deleted, "the value was replaced since it was read")
+			var got string
+			found, _ := store.Get(ctx, "conversation", "1:1", &got)
+			assert.True(t, found)
+
+			deleted, err = store.DeleteIf(ctx, "conversation", "1:1", "second")
+			require.NoError(t, err)
+			assert.True(t, deleted)
+			found, _ = store.Get(ctx, "conversation", "1:1", &got)
+			assert.False(t, found)
+		})
+	}
+}
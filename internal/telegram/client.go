@@ -0,0 +1,139 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// Client is the shared transport for all Telegram Bot API calls.
+// It owns the base URL, the bot token and a single pooled HTTP client.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient interfaces.HTTPClient
+}
+
+var _ interfaces.TelegramClientInterface = (*Client)(nil)
+
+// apiResponse is the envelope returned by every Bot API method
+type apiResponse struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code"`
+	Description string              `json:"description"`
+	Parameters  *responseParameters `json:"parameters,omitempty"`
+}
+
+// responseParameters carries the optional hints attached to a failed call
+type responseParameters struct {
+	RetryAfter      int   `json:"retry_after"`
+	MigrateToChatID int64 `json:"migrate_to_chat_id"`
+}
+
+// NewClient creates a new Bot API client.
+// An empty baseURL falls back to the public Bot API, a nil httpClient to a pooled default client.
+func NewClient(token string, baseURL string, httpClient interfaces.HTTPClient) *Client {
+	if baseURL == "" {
+		baseURL = config.DefaultTelegramAPIURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: config.DefaultTelegramRequestTimeout}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// BaseURL returns the Bot API server the client talks to
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// MethodURL builds the full URL for a Bot API method
+func (c *Client) MethodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.baseURL, c.token, method)
+}
+
+// Call sends params as a JSON body to the given method and decodes the result into result.
+func (c *Client) Call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	logutils.Debug("Call: entry", "method", method)
+
+	bodyBytes, err := json.Marshal(params)
+	if err != nil {
+		logutils.Error("Call: MarshalParams", err, "method", method)
+		return fmt.Errorf("failed to encode %s params: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.MethodURL(method), bytes.NewReader(bodyBytes))
+	if err != nil {
+		logutils.Error("Call: CreateRequest", err, "method", method)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logutils.Error("Call: ExecuteRequest", err, "method", method)
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logutils.Error("Call: ReadResponse", err, "method", method)
+		return fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+	logutils.Debug("Call: API response", "method", method, "status", resp.StatusCode, "body", string(body))
+
+	return decodeResponse(method, resp.StatusCode, body, result)
+}
+
+// decodeResponse unwraps the Bot API envelope and decodes the result payload
+func decodeResponse(method string, statusCode int, body []byte, result interface{}) error {
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		logutils.Error("decodeResponse: ParseResponse", err, "method", method, "status", statusCode, "body", string(body))
+		if statusCode >= http.StatusBadRequest {
+			// Proxies and gateways answer with HTML error pages; keep the status so callers can classify it
+			return &TelegramError{Method: method, ErrorCode: statusCode, Description: http.StatusText(statusCode)}
+		}
+		return fmt.Errorf("failed to decode %s response (status %d): %w", method, statusCode, err)
+	}
+
+	if !envelope.Ok {
+		tgErr := &TelegramError{
+			Method:      method,
+			ErrorCode:   envelope.ErrorCode,
+			Description: envelope.Description,
+		}
+		if tgErr.ErrorCode == 0 {
+			tgErr.ErrorCode = statusCode
+		}
+		if envelope.Parameters != nil {
+			tgErr.RetryAfter = envelope.Parameters.RetryAfter
+			tgErr.MigrateToChatID = envelope.Parameters.MigrateToChatID
+		}
+		logutils.Warn("decodeResponse: APIError", "method", method, "errorCode", tgErr.ErrorCode, "kind", tgErr.Kind().String(), "description", tgErr.Description)
+		return tgErr
+	}
+
+	if result == nil || len(envelope.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		logutils.Error("decodeResponse: ParseResult", err, "method", method)
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
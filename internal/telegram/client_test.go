@@ -0,0 +1,105 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"save-message/internal/config"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient_BaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+	}{
+		{name: "empty falls back to public API", baseURL: "", want: config.DefaultTelegramAPIURL},
+		{name: "custom server", baseURL: "http://localhost:8081", want: "http://localhost:8081"},
+		{name: "trailing slash trimmed", baseURL: "http://localhost:8081/", want: "http://localhost:8081"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("token", tt.baseURL, nil)
+			assert.Equal(t, tt.want, c.BaseURL())
+			assert.Equal(t, tt.want+"/bottoken/sendMessage", c.MethodURL("sendMessage"))
+		})
+	}
+}
+
+func TestClient_Call(t *testing.T) {
+	var gotPath string
+	var gotParams map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotParams)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":1,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("abc", server.URL, server.Client())
+	var msg gotgbot.Message
+	err := c.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": 1, "text": "hi"}, &msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/botabc/sendMessage", gotPath)
+	assert.Equal(t, "hi", gotParams["text"])
+	assert.Equal(t, int64(42), msg.MessageId)
+}
+
+func TestDecodeResponse_TelegramError(t *testing.T) {
+	body := `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 12","parameters":{"retry_after":12}}`
+	err := decodeResponse("sendMessage", 429, []byte(body), nil)
+
+	tgErr, ok := AsTelegramError(err)
+	assert.True(t, ok)
+	assert.Equal(t, "sendMessage", tgErr.Method)
+	assert.Equal(t, 429, tgErr.ErrorCode)
+	assert.Equal(t, 12, tgErr.RetryAfter)
+	assert.Equal(t, ErrorKindTooManyRequests, tgErr.Kind())
+
+	body = `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001234}}`
+	tgErr, ok = AsTelegramError(decodeResponse("sendMessage", 400, []byte(body), nil))
+	assert.True(t, ok)
+	assert.Equal(t, int64(-1001234), tgErr.MigrateToChatID)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantErr    bool
+		wantID     int64
+	}{
+		{name: "ok with result", statusCode: 200, body: `{"ok":true,"result":{"message_id":7}}`, wantID: 7},
+		{name: "ok with boolean result into nil", statusCode: 200, body: `{"ok":true,"result":true}`},
+		{name: "api error", statusCode: 400, body: `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, wantErr: true},
+		{name: "non json body", statusCode: 502, body: `<html>Bad Gateway</html>`, wantErr: true},
+		{name: "result shape mismatch", statusCode: 200, body: `{"ok":true,"result":"oops"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg gotgbot.Message
+			var result interface{} = &msg
+			if tt.wantID == 0 && !tt.wantErr {
+				result = nil
+			}
+			err := decodeResponse("sendMessage", tt.statusCode, []byte(tt.body), result)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantID, msg.MessageId)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies the Bot API failures handlers know how to recover from
+type ErrorKind int
+
+const (
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindMessageNotModified
+	ErrorKindMessageToDeleteNotFound
+	ErrorKindTopicIDInvalid
+	ErrorKindNotEnoughRights
+	ErrorKindTooManyRequests
+	ErrorKindChatMigrated
+)
+
+// String returns a short name for the kind, used in logs
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindMessageNotModified:
+		return "message_not_modified"
+	case ErrorKindMessageToDeleteNotFound:
+		return "message_to_delete_not_found"
+	case ErrorKindTopicIDInvalid:
+		return "topic_id_invalid"
+	case ErrorKindNotEnoughRights:
+		return "not_enough_rights"
+	case ErrorKindTooManyRequests:
+		return "too_many_requests"
+	case ErrorKindChatMigrated:
+		return "chat_migrated"
+	default:
+		return "unknown"
+	}
+}
+
+// TelegramError is a structured error returned by the Bot API (ok=false envelope)
+type TelegramError struct {
+	Method          string
+	ErrorCode       int
+	Description     string
+	RetryAfter      int   // seconds to wait before retrying, set on 429
+	MigrateToChatID int64 // new supergroup ID, set when a group was upgraded
+}
+
+// Error implements the error interface
+func (e *TelegramError) Error() string {
+	return fmt.Sprintf("%s failed: [%d] %s", e.Method, e.ErrorCode, e.Description)
+}
+
+// Kind classifies the error by its code and description
+func (e *TelegramError) Kind() ErrorKind {
+	description := strings.ToLower(e.Description)
+	switch {
+	case e.ErrorCode == 429 || e.RetryAfter > 0:
+		return ErrorKindTooManyRequests
+	case e.MigrateToChatID != 0:
+		return ErrorKindChatMigrated
+	case strings.Contains(description, "message is not modified"):
+		return ErrorKindMessageNotModified
+	case strings.Contains(description, "message to delete not found"):
+		return ErrorKindMessageToDeleteNotFound
+	case strings.Contains(description, "topic_id_invalid"), strings.Contains(description, "message thread not found"):
+		return ErrorKindTopicIDInvalid
+	case strings.Contains(description, "not enough rights"):
+		return ErrorKindNotEnoughRights
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+// AsTelegramError extracts a *TelegramError from an error chain
+func AsTelegramError(err error) (*TelegramError, bool) {
+	var tgErr *TelegramError
+	if errors.As(err, &tgErr) {
+		return tgErr, true
+	}
+	return nil, false
+}
+
+// KindOf returns the ErrorKind of err, or ErrorKindUnknown for nil and non-Telegram errors
+func KindOf(err error) ErrorKind {
+	if tgErr, ok := AsTelegramError(err); ok {
+		return tgErr.Kind()
+	}
+	return ErrorKindUnknown
+}
+
+// IsMessageNotModified reports whether an edit was rejected because nothing changed
+func IsMessageNotModified(err error) bool {
+	return KindOf(err) == ErrorKindMessageNotModified
+}
+
+// IsMessageToDeleteNotFound reports whether a delete targeted a message that is already gone
+func IsMessageToDeleteNotFound(err error) bool {
+	return KindOf(err) == ErrorKindMessageToDeleteNotFound
+}
+
+// IsTopicIDInvalid reports whether the target forum topic no longer exists
+func IsTopicIDInvalid(err error) bool {
+	return KindOf(err) == ErrorKindTopicIDInvalid
+}
+
+// IsNotEnoughRights reports whether the bot lacks the admin rights for the call
+func IsNotEnoughRights(err error) bool {
+	return KindOf(err) == ErrorKindNotEnoughRights
+}
@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramError_Kind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *TelegramError
+		want ErrorKind
+	}{
+		{"not modified", &TelegramError{ErrorCode: 400, Description: "Bad Request: message is not modified: specified new message content and reply markup are exactly the same"}, ErrorKindMessageNotModified},
+		{"delete not found", &TelegramError{ErrorCode: 400, Description: "Bad Request: message to delete not found"}, ErrorKindMessageToDeleteNotFound},
+		{"topic invalid", &TelegramError{ErrorCode: 400, Description: "Bad Request: TOPIC_ID_INVALID"}, ErrorKindTopicIDInvalid},
+		{"thread not found", &TelegramError{ErrorCode: 400, Description: "Bad Request: message thread not found"}, ErrorKindTopicIDInvalid},
+		{"not enough rights", &TelegramError{ErrorCode: 400, Description: "Bad Request: not enough rights to create a topic"}, ErrorKindNotEnoughRights},
+		{"flood", &TelegramError{ErrorCode: 429, Description: "Too Many Requests: retry after 5", RetryAfter: 5}, ErrorKindTooManyRequests},
+		{"migrated", &TelegramError{ErrorCode: 400, Description: "Bad Request: group chat was upgraded to a supergroup chat", MigrateToChatID: -100123}, ErrorKindChatMigrated},
+		{"other", &TelegramError{ErrorCode: 400, Description: "Bad Request: chat not found"}, ErrorKindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.err.Kind())
+		})
+	}
+}
+
+func TestKindOf_WrappedAndForeignErrors(t *testing.T) {
+	tgErr := &TelegramError{Method: "deleteMessage", ErrorCode: 400, Description: "Bad Request: message to delete not found"}
+
+	assert.True(t, IsMessageToDeleteNotFound(fmt.Errorf("cleanup: %w", tgErr)))
+	assert.Equal(t, ErrorKindUnknown, KindOf(errors.New("message to delete not found")))
+	assert.Equal(t, ErrorKindUnknown, KindOf(nil))
+	assert.Equal(t, "deleteMessage failed: [400] Bad Request: message to delete not found", tgErr.Error())
+}
@@ -0,0 +1,503 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/logutils"
+)
+
+// ErrSchedulerClosed is returned for calls queued after (or still pending at) Close
+var ErrSchedulerClosed = errors.New("telegram scheduler closed")
+
+// Priority orders queued calls; user-visible calls go before cleanup
+type Priority int
+
+const (
+	PriorityHigh Priority = iota // sends, edits, callback answers, topic creation
+	PriorityLow                  // cleanup deletes
+)
+
+// PriorityFor returns the queue priority for a Bot API method.
+// Deletes are housekeeping and must never hold up messages the user is waiting for.
+func PriorityFor(method string) Priority {
+	if method == "deleteMessage" {
+		return PriorityLow
+	}
+	return PriorityHigh
+}
+
+// SchedulerConfig holds the rate limits and retry policy of the outbound queue
+type SchedulerConfig struct {
+	GlobalRate   float64       // calls per second across all chats
+	GlobalBurst  int           // calls allowed back to back before GlobalRate applies
+	ChatRate     float64       // messages per second sent into a single group
+	ChatBurst    int           // messages sent back to back into one group
+	MaxRetries   int           // retries for transient failures
+	MaxFloods    int           // retries after 429 Too Many Requests
+	RetryBackoff time.Duration // base delay, doubled per attempt and jittered
+	MaxBackoff   time.Duration
+}
+
+// DefaultSchedulerConfig returns limits matching Telegram's documented bot limits
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		GlobalRate:   config.DefaultTelegramGlobalRate,
+		GlobalBurst:  config.DefaultTelegramGlobalRate,
+		ChatRate:     float64(config.DefaultTelegramChatRatePerMinute) / 60,
+		ChatBurst:    config.DefaultTelegramChatBurst,
+		MaxRetries:   config.DefaultTelegramMaxRetries,
+		MaxFloods:    config.DefaultTelegramMaxFloodRetries,
+		RetryBackoff: config.DefaultTelegramRetryBackoff,
+		MaxBackoff:   config.DefaultTelegramMaxRetryBackoff,
+	}
+}
+
+// Scheduler is a flood-control aware outbound queue in front of a TelegramClientInterface.
+// It enforces the global rate limit and the per-group limit on sent messages, honors
+// retry_after on 429, retries transient failures with backoff and dispatches high
+// priority calls before low priority ones. Calls that post something are only retried
+// when they certainly never reached Telegram, so a retry cannot post twice.
+type Scheduler struct {
+	client interfaces.TelegramClientInterface
+	cfg    SchedulerConfig
+
+	mu     sync.Mutex
+	queues [2][]*outboundCall // indexed by Priority
+	global *tokenBucket
+	chats  map[int64]*tokenBucket // groups with recent sends and chats paused by a 429
+	pruned time.Time
+	closed bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	now func() time.Time
+}
+
+var _ interfaces.TelegramClientInterface = (*Scheduler)(nil)
+
+// outboundCall is a queued Bot API call waiting for its turn
+type outboundCall struct {
+	ctx       context.Context
+	method    string
+	params    map[string]interface{}
+	result    interface{}
+	chatID    int64
+	groupSend bool // counts against the group's message limit
+	priority  Priority
+	attempts  int
+	floods    int // 429s so far
+	notBefore time.Time
+	done      chan error
+}
+
+// NewScheduler creates a scheduler around client and starts its dispatch loop
+func NewScheduler(client interfaces.TelegramClientInterface, cfg SchedulerConfig) *Scheduler {
+	s := &Scheduler{
+		client: client,
+		cfg:    cfg,
+		chats:  make(map[int64]*tokenBucket),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		now:    time.Now,
+	}
+	s.global = newTokenBucket(cfg.GlobalRate, cfg.GlobalBurst, s.now())
+	go s.run()
+	return s
+}
+
+// Call queues a Bot API call and blocks until it has succeeded or finally failed.
+// If ctx ends while the call is still queued it is dropped and ctx.Err() is returned.
+func (s *Scheduler) Call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	call := &outboundCall{
+		ctx:      ctx,
+		method:   method,
+		params:   params,
+		result:   result,
+		chatID:   chatIDFromParams(params),
+		priority: PriorityFor(method),
+		done:     make(chan error, 1),
+	}
+	// Telegram's 20 messages a minute per group counts every new message, sent, copied or
+	// forwarded; edits, deletes and private chats only count against the global rate
+	call.groupSend = call.chatID < 0 && postsMessage(method) && method != "sendChatAction"
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSchedulerClosed
+	}
+	s.queues[call.priority] = append(s.queues[call.priority], call)
+	s.mu.Unlock()
+	s.signal()
+
+	select {
+	case err := <-call.done:
+		return err
+	case <-ctx.Done():
+		s.remove(call)
+		return ctx.Err()
+	}
+}
+
+// remove drops a call from its queue if it has not been dispatched yet
+func (s *Scheduler) remove(call *outboundCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queues[call.priority]
+	for i, queued := range queue {
+		if queued == call {
+			s.queues[call.priority] = append(queue[:i:i], queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// QueueDepth returns the number of calls waiting at the given priority
+func (s *Scheduler) QueueDepth(priority Priority) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queues[priority])
+}
+
+// Close stops dispatching, fails every queued call with ErrSchedulerClosed
+// and waits for calls already sent to Telegram to finish.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	pending := append(s.queues[PriorityHigh], s.queues[PriorityLow]...)
+	s.queues[PriorityHigh], s.queues[PriorityLow] = nil, nil
+	s.mu.Unlock()
+
+	close(s.done)
+	for _, call := range pending {
+		call.done <- ErrSchedulerClosed
+	}
+	s.wg.Wait()
+	logutils.Info("Scheduler: closed", "dropped", len(pending))
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run is the dispatch loop: it hands out calls as soon as their rate limits allow
+func (s *Scheduler) run() {
+	for {
+		call, wait := s.next()
+		if call != nil {
+			go s.execute(call)
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next pops the first call that may run now, or reports how long until one might.
+// A zero wait with no call means the queues are empty.
+func (s *Scheduler) next() (*outboundCall, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, 0
+	}
+	now := s.now()
+	var wait time.Duration
+	if now.Sub(s.pruned) >= config.DefaultTelegramBucketPruneEvery {
+		s.prune(now)
+	}
+
+	globalWait := s.global.wait(now)
+	for priority := range s.queues {
+		queue := s.queues[priority]
+		for i, call := range queue {
+			callWait := call.notBefore.Sub(now)
+			if chatWait := s.chatWait(call, now); chatWait > callWait {
+				callWait = chatWait
+			}
+			if globalWait > callWait {
+				callWait = globalWait
+			}
+			if callWait <= 0 {
+				s.global.take(now)
+				if call.groupSend {
+					s.chats[call.chatID].take(now)
+				}
+				s.queues[priority] = append(queue[:i:i], queue[i+1:]...)
+				s.wg.Add(1) // under mu, so Close never waits on a counter that is still growing
+				return call, 0
+			}
+			if wait == 0 || callWait < wait {
+				wait = callWait
+			}
+		}
+	}
+	return nil, wait
+}
+
+// execute performs one attempt of a call and either completes or requeues it
+func (s *Scheduler) execute(call *outboundCall) {
+	defer s.wg.Done()
+
+	err := s.client.Call(call.ctx, call.method, call.params, call.result)
+	if err == nil || call.ctx.Err() != nil {
+		// A cancelled caller is no longer waiting, so there is nothing to retry for
+		call.done <- err
+		return
+	}
+
+	call.attempts++
+	if tgErr, ok := AsTelegramError(err); ok && tgErr.RetryAfter > 0 {
+		retryAfter := time.Duration(tgErr.RetryAfter) * time.Second
+		s.pause(call.chatID, retryAfter)
+		call.floods++
+		if call.floods > s.cfg.MaxFloods || s.pastDeadline(call, retryAfter) {
+			logutils.Warn("Scheduler: flood control, giving up", "method", call.method, "chatID", call.chatID, "floods", call.floods, "retryAfter", retryAfter.String())
+			call.done <- err
+			return
+		}
+		logutils.Warn("Scheduler: flood control, retrying later", "method", call.method, "chatID", call.chatID, "retryAfter", retryAfter.String())
+		s.requeue(call, 0)
+		return
+	}
+
+	if retryable(call.method, err) && call.attempts <= s.cfg.MaxRetries {
+		backoff := s.backoff(call.attempts)
+		if !s.pastDeadline(call, backoff) {
+			logutils.Warn("Scheduler: transient failure, retrying", "method", call.method, "chatID", call.chatID, "attempt", call.attempts, "backoff", backoff.String(), "error", err.Error())
+			s.requeue(call, backoff)
+			return
+		}
+	}
+
+	call.done <- err
+}
+
+// pastDeadline reports whether the caller's deadline comes before a retry after delay could run
+func (s *Scheduler) pastDeadline(call *outboundCall, delay time.Duration) bool {
+	deadline, ok := call.ctx.Deadline()
+	return ok && s.now().Add(delay).After(deadline)
+}
+
+// pause blocks a chat (or every chat when chatID is 0) until retry_after has passed
+func (s *Scheduler) pause(chatID int64, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.now().Add(d)
+	if chatID == 0 {
+		s.global.pauseUntil(until)
+		return
+	}
+	s.chatBucket(chatID, s.now()).pauseUntil(until)
+}
+
+// requeue puts a call back at the front of its queue so retries keep their place
+func (s *Scheduler) requeue(call *outboundCall, delay time.Duration) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		call.done <- ErrSchedulerClosed
+		return
+	}
+	call.notBefore = s.now().Add(delay)
+	s.queues[call.priority] = append([]*outboundCall{call}, s.queues[call.priority]...)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// backoff returns the jittered exponential delay for the given attempt
+func (s *Scheduler) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBackoff << (attempt - 1)
+	if s.cfg.MaxBackoff > 0 && (d > s.cfg.MaxBackoff || d <= 0) {
+		d = s.cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// chatWait is how long call must wait for its chat: a send into a group for the group's
+// message limit, anything else only while a 429 has the chat paused
+func (s *Scheduler) chatWait(call *outboundCall, now time.Time) time.Duration {
+	if call.groupSend {
+		return s.chatBucket(call.chatID, now).wait(now)
+	}
+	if bucket, ok := s.chats[call.chatID]; ok {
+		return bucket.pausedFor(now)
+	}
+	return 0
+}
+
+// prune drops chat buckets that are full and not paused: a new bucket is the same
+func (s *Scheduler) prune(now time.Time) {
+	for chatID, bucket := range s.chats {
+		if bucket.idle(now) {
+			delete(s.chats, chatID)
+		}
+	}
+	s.pruned = now
+}
+
+func (s *Scheduler) chatBucket(chatID int64, now time.Time) *tokenBucket {
+	bucket, ok := s.chats[chatID]
+	if !ok {
+		bucket = newTokenBucket(s.cfg.ChatRate, s.cfg.ChatBurst, now)
+		s.chats[chatID] = bucket
+	}
+	return bucket
+}
+
+// postsMessage reports whether method posts a message, so that sending it twice posts it twice
+func postsMessage(method string) bool {
+	return strings.HasPrefix(method, "send") || strings.HasPrefix(method, "copyMessage") || strings.HasPrefix(method, "forwardMessage")
+}
+
+// idempotent reports whether method may be repeated without creating a second message or topic
+func idempotent(method string) bool {
+	return method == "sendChatAction" || (!postsMessage(method) && method != "createForumTopic")
+}
+
+// retryable reports whether a failed call may be tried again. A call that is not idempotent
+// is only repeated when it never left the bot; after a timeout or a dropped connection
+// Telegram may already have carried it out.
+func retryable(method string, err error) bool {
+	if !isTransient(err) {
+		return false
+	}
+	return idempotent(method) || neverSent(err)
+}
+
+// neverSent reports whether err happened before the request reached Telegram: the
+// connection could not be made or the host not resolved
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// isTransient reports whether a failure is worth retrying: server errors and network errors
+func isTransient(err error) bool {
+	if tgErr, ok := AsTelegramError(err); ok {
+		return tgErr.ErrorCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// chatIDFromParams extracts the numeric chat_id of a call, 0 when absent
+func chatIDFromParams(params map[string]interface{}) int64 {
+	switch v := params["chat_id"].(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// tokenBucket is a classic token bucket with an optional hard pause (retry_after)
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.rate <= 0 {
+		b.tokens = b.burst
+		return
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// wait returns how long until a token is available (0 when one is available now)
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	if paused := b.pausedFor(now); paused > 0 {
+		return paused
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// pausedFor returns how long the bucket stays paused, 0 when it is not
+func (b *tokenBucket) pausedFor(now time.Time) time.Duration {
+	if now.Before(b.paused) {
+		return b.paused.Sub(now)
+	}
+	return 0
+}
+
+// idle reports whether the bucket is full and not paused, as a new one would be
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst && b.pausedFor(now) == 0
+}
+
+func (b *tokenBucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+func (b *tokenBucket) pauseUntil(until time.Time) {
+	if until.After(b.paused) {
+		b.paused = until
+	}
+}
@@ -0,0 +1,261 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTelegramClient records calls and replies with scripted errors per method
+type fakeTelegramClient struct {
+	mu      sync.Mutex
+	calls   []string
+	times   []time.Time
+	replies map[string][]error
+}
+
+func (f *fakeTelegramClient) Call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method)
+	f.times = append(f.times, time.Now())
+	if queue := f.replies[method]; len(queue) > 0 {
+		f.replies[method] = queue[1:]
+		return queue[0]
+	}
+	return nil
+}
+
+func (f *fakeTelegramClient) snapshot() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func testSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		GlobalRate:   1000,
+		GlobalBurst:  100,
+		ChatRate:     1000,
+		ChatBurst:    100,
+		MaxRetries:   2,
+		MaxFloods:    2,
+		RetryBackoff: time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	}
+}
+
+func TestPriorityFor(t *testing.T) {
+	assert.Equal(t, PriorityLow, PriorityFor("deleteMessage"))
+	assert.Equal(t, PriorityHigh, PriorityFor("sendMessage"))
+	assert.Equal(t, PriorityHigh, PriorityFor("editMessageText"))
+	assert.Equal(t, PriorityHigh, PriorityFor("answerCallbackQuery"))
+}
+
+func TestScheduler_SendsBeforeCleanupDeletes(t *testing.T) {
+	client := &fakeTelegramClient{}
+	cfg := testSchedulerConfig()
+	cfg.GlobalRate, cfg.GlobalBurst = 20, 1
+	s := NewScheduler(client, cfg)
+	defer s.Close()
+
+	// Hold the queue so both calls are waiting when dispatch resumes
+	s.pause(0, 100*time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = s.Call(context.Background(), "deleteMessage", map[string]interface{}{"chat_id": int64(1)}, nil)
+	}()
+	assert.Eventually(t, func() bool { return s.QueueDepth(PriorityLow) == 1 }, time.Second, time.Millisecond)
+	go func() {
+		defer wg.Done()
+		_ = s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(1)}, nil)
+	}()
+	assert.Eventually(t, func() bool { return s.QueueDepth(PriorityHigh) == 1 }, time.Second, time.Millisecond)
+	wg.Wait()
+
+	assert.Equal(t, []string{"sendMessage", "deleteMessage"}, client.snapshot())
+}
+
+func TestScheduler_HonorsRetryAfter(t *testing.T) {
+	client := &fakeTelegramClient{replies: map[string][]error{
+		"sendMessage": {&TelegramError{Method: "sendMessage", ErrorCode: 429, Description: "Too Many Requests: retry after 1", RetryAfter: 1}},
+	}}
+	s := NewScheduler(client, testSchedulerConfig())
+	defer s.Close()
+
+	start := time.Now()
+	err := s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(7)}, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, client.snapshot(), 2)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestScheduler_Retries(t *testing.T) {
+	serverErr := &TelegramError{Method: "sendMessage", ErrorCode: 502, Description: "Bad Gateway"}
+	badRequest := &TelegramError{Method: "sendMessage", ErrorCode: 400, Description: "Bad Request: chat not found"}
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name      string
+		method    string
+		replies   []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "transient failures are retried", method: "editMessageText", replies: []error{serverErr, serverErr}, wantCalls: 3},
+		{name: "gives up after max retries", method: "editMessageText", replies: []error{serverErr, serverErr, serverErr}, wantErr: serverErr, wantCalls: 3},
+		{name: "client errors are not retried", method: "editMessageText", replies: []error{badRequest}, wantErr: badRequest, wantCalls: 1},
+		{name: "dropped connections are retried", method: "deleteMessage", replies: []error{io.ErrUnexpectedEOF}, wantCalls: 2},
+		{name: "a send that may have arrived is not repeated", method: "sendMessage", replies: []error{io.ErrUnexpectedEOF}, wantErr: io.ErrUnexpectedEOF, wantCalls: 1},
+		{name: "a send Telegram failed on is not repeated", method: "sendMessage", replies: []error{serverErr}, wantErr: serverErr, wantCalls: 1},
+		{name: "a topic that may exist is not created twice", method: "createForumTopic", replies: []error{io.EOF}, wantErr: io.EOF, wantCalls: 1},
+		{name: "a send that never left is retried", method: "copyMessage", replies: []error{refused}, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeTelegramClient{replies: map[string][]error{tt.method: tt.replies}}
+			s := NewScheduler(client, testSchedulerConfig())
+			defer s.Close()
+
+			err := s.Call(context.Background(), tt.method, map[string]interface{}{"chat_id": int64(7)}, nil)
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Len(t, client.snapshot(), tt.wantCalls)
+		})
+	}
+}
+
+func TestScheduler_PerChatLimit(t *testing.T) {
+	client := &fakeTelegramClient{}
+	cfg := testSchedulerConfig()
+	cfg.ChatRate, cfg.ChatBurst = 10, 1
+	s := NewScheduler(client, cfg)
+	defer s.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(-1)}, nil))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "third send into one group should wait for the bucket")
+
+	start = time.Now()
+	assert.NoError(t, s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(-2)}, nil))
+	for _, method := range []string{"editMessageText", "deleteMessage"} {
+		assert.NoError(t, s.Call(context.Background(), method, map[string]interface{}{"chat_id": int64(-1)}, nil))
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(1)}, nil))
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "other groups, other calls and private chats are not throttled")
+}
+
+func TestScheduler_PerChatLimitCountsCopies(t *testing.T) {
+	client := &fakeTelegramClient{}
+	cfg := testSchedulerConfig()
+	cfg.ChatRate, cfg.ChatBurst = 10, 1
+	s := NewScheduler(client, cfg)
+	defer s.Close()
+
+	start := time.Now()
+	for _, method := range []string{"copyMessage", "copyMessage", "forwardMessage"} {
+		assert.NoError(t, s.Call(context.Background(), method, map[string]interface{}{"chat_id": int64(-1)}, nil))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "copies into one group wait for its bucket like sends")
+}
+
+func TestScheduler_FloodRetriesAreCapped(t *testing.T) {
+	flood := &TelegramError{Method: "sendMessage", ErrorCode: 429, Description: "Too Many Requests: retry after 1", RetryAfter: 1}
+
+	t.Run("after MaxFloods", func(t *testing.T) {
+		client := &fakeTelegramClient{replies: map[string][]error{"sendMessage": {flood, flood}}}
+		cfg := testSchedulerConfig()
+		cfg.MaxFloods = 1
+		s := NewScheduler(client, cfg)
+		defer s.Close()
+
+		err := s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(-7)}, nil)
+		assert.Equal(t, flood, err)
+		assert.Len(t, client.snapshot(), 2)
+	})
+
+	t.Run("when the caller's deadline comes first", func(t *testing.T) {
+		client := &fakeTelegramClient{replies: map[string][]error{"sendMessage": {flood}}}
+		s := NewScheduler(client, testSchedulerConfig())
+		defer s.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := s.Call(ctx, "sendMessage", map[string]interface{}{"chat_id": int64(-7)}, nil)
+		assert.Equal(t, flood, err, "the caller learns about the flood instead of timing out")
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+		assert.Len(t, client.snapshot(), 1)
+	})
+}
+
+func TestScheduler_PrunesIdleChats(t *testing.T) {
+	s := NewScheduler(&fakeTelegramClient{}, testSchedulerConfig())
+	defer s.Close()
+
+	for _, chatID := range []int64{-1, -2} {
+		assert.NoError(t, s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": chatID}, nil))
+	}
+	s.pause(-3, time.Hour)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Len(t, s.chats, 3)
+	s.prune(time.Now().Add(time.Minute))
+	assert.Len(t, s.chats, 1, "full buckets are dropped")
+	assert.Contains(t, s.chats, int64(-3), "a paused chat is kept")
+}
+
+func TestScheduler_Close(t *testing.T) {
+	client := &fakeTelegramClient{}
+	s := NewScheduler(client, testSchedulerConfig())
+	s.pause(0, time.Hour)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": int64(1)}, nil)
+	}()
+	assert.Eventually(t, func() bool { return s.QueueDepth(PriorityHigh) == 1 }, time.Second, time.Millisecond)
+
+	s.Close()
+	assert.True(t, errors.Is(<-errCh, ErrSchedulerClosed))
+	assert.ErrorIs(t, s.Call(context.Background(), "sendMessage", nil, nil), ErrSchedulerClosed)
+	assert.Empty(t, client.snapshot())
+}
+
+func TestScheduler_CancelledCallIsDropped(t *testing.T) {
+	client := &fakeTelegramClient{}
+	s := NewScheduler(client, testSchedulerConfig())
+	defer s.Close()
+	s.pause(0, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Call(ctx, "sendMessage", map[string]interface{}{"chat_id": int64(1)}, nil)
+	}()
+	assert.Eventually(t, func() bool { return s.QueueDepth(PriorityHigh) == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+	assert.Equal(t, 0, s.QueueDepth(PriorityHigh))
+
+	assert.NoError(t, s.Call(context.Background(), "deleteMessage", map[string]interface{}{"chat_id": int64(1)}, nil))
+	assert.Equal(t, []string{"deleteMessage"}, client.snapshot())
+}
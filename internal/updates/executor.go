@@ -0,0 +1,266 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// ErrExecutorClosed is returned for updates handed to the executor after Close
+var ErrExecutorClosed = errors.New("update executor closed")
+
+// Executor handles updates on a pool of workers. Updates from one chat run one at a time,
+// in the order they arrived; different chats run in parallel. At most queueSize updates
+// wait at once: beyond that HandleUpdate blocks, holding back the poller or webhook
+// instead of buffering without bound.
+type Executor struct {
+	handler interfaces.UpdateHandlerInterface
+	workers int
+	slots   chan struct{} // one per queued update
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lanes  map[int64]*lane // chats with queued or running updates
+	ready  []*lane         // lanes waiting for a worker, longest waiting first
+	closed bool
+	stats  ExecutorStats
+	onDone func(update *gotgbot.Update)
+
+	// Optional: tracks the workers so shutdown drains the queue
+	Tracker *lifecycle.Tracker
+}
+
+var _ AsyncHandler = (*Executor)(nil)
+
+// AsyncHandler is an update handler whose HandleUpdate returns before the update is handled.
+// It reports each update it is done with, whether handling succeeded or not, to the function
+// given to OnHandled, so a source only moves past updates that are actually finished.
+type AsyncHandler interface {
+	interfaces.UpdateHandlerInterface
+	OnHandled(fn func(update *gotgbot.Update))
+}
+
+// lane holds one chat's updates. It is scheduled while it sits in ready or a worker
+// runs one of its updates, so no two workers ever run the same chat.
+type lane struct {
+	chatID    int64
+	pending   []*gotgbot.Update
+	scheduled bool
+}
+
+// ExecutorStats is a snapshot of the executor's queue
+type ExecutorStats struct {
+	Queued    int    // updates waiting for a worker
+	Running   int    // updates being handled
+	Chats     int    // chats with queued or running updates
+	Peak      int    // most updates ever queued at once
+	Handled   uint64 // updates handled since start
+	Throttled uint64 // updates that had to wait for queue space
+}
+
+// NewExecutor creates an executor handing updates to handler; Start launches its workers
+func NewExecutor(handler interfaces.UpdateHandlerInterface, workers, queueSize int) *Executor {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	e := &Executor{
+		handler: handler,
+		workers: workers,
+		slots:   make(chan struct{}, queueSize),
+		lanes:   make(map[int64]*lane),
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Start launches the workers. They run until Close and the queue is drained.
+func (e *Executor) Start() {
+	logutils.Info("Executor: starting", "workers", e.workers, "queueSize", cap(e.slots))
+	for i := 0; i < e.workers; i++ {
+		e.Tracker.Go(e.work)
+	}
+}
+
+// HandleUpdate queues update behind earlier updates from the same chat. It returns once
+// the update is queued, not handled; while the queue is full it waits for space or ctx.
+func (e *Executor) HandleUpdate(ctx context.Context, update *gotgbot.Update) error {
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		e.mu.Lock()
+		e.stats.Throttled++
+		e.mu.Unlock()
+		logutils.Warn("Executor: queue full, holding back updates", "updateID", update.UpdateId, "queueSize", cap(e.slots))
+		select {
+		case e.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		<-e.slots
+		return ErrExecutorClosed
+	}
+
+	chatID := updateChatID(update)
+	l := e.lanes[chatID]
+	if l == nil {
+		l = &lane{chatID: chatID}
+		e.lanes[chatID] = l
+	}
+	l.pending = append(l.pending, update)
+	e.stats.Queued++
+	if e.stats.Queued > e.stats.Peak {
+		e.stats.Peak = e.stats.Queued
+	}
+	if !l.scheduled {
+		l.scheduled = true
+		e.ready = append(e.ready, l)
+		e.cond.Signal()
+	}
+	return nil
+}
+
+// Close stops accepting updates. Workers finish everything already queued and exit;
+// Tracker.Shutdown waits for them.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	e.cond.Broadcast()
+	logutils.Info("Executor: closing", "queued", e.stats.Queued, "running", e.stats.Running)
+}
+
+// OnHandled makes the executor call fn on a worker after each update it handled
+func (e *Executor) OnHandled(fn func(update *gotgbot.Update)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onDone = fn
+}
+
+// QueueDepth returns the number of updates waiting for a worker
+func (e *Executor) QueueDepth() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats.Queued
+}
+
+// Stats returns a snapshot of the queue
+func (e *Executor) Stats() ExecutorStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	stats.Chats = len(e.lanes)
+	return stats
+}
+
+// ReportStats logs the queue's state every interval until ctx ends, skipping idle periods
+func (e *Executor) ReportStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastHandled uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats := e.Stats()
+		if stats.Handled == lastHandled && stats.Queued == 0 && stats.Running == 0 {
+			continue
+		}
+		lastHandled = stats.Handled
+		logutils.Info("Executor: stats", "queued", stats.Queued, "running", stats.Running, "chats", stats.Chats,
+			"peak", stats.Peak, "handled", stats.Handled, "throttled", stats.Throttled)
+	}
+}
+
+// work runs updates until the executor is closed and nothing is left to run
+func (e *Executor) work() {
+	for {
+		l, update, ok := e.next()
+		if !ok {
+			return
+		}
+		if err := e.handler.HandleUpdate(e.Tracker.Context(), update); err != nil {
+			logutils.Error("Executor: HandleUpdateError", err, "updateID", update.UpdateId, "chatID", l.chatID)
+		}
+		if onDone := e.done(l); onDone != nil {
+			onDone(update)
+		}
+	}
+}
+
+// next takes the first update of the lane that has waited longest
+func (e *Executor) next() (*lane, *gotgbot.Update, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.ready) == 0 && !e.closed {
+		e.cond.Wait()
+	}
+	if len(e.ready) == 0 {
+		return nil, nil, false
+	}
+
+	l := e.ready[0]
+	e.ready = e.ready[1:]
+	update := l.pending[0]
+	l.pending = l.pending[1:]
+	e.stats.Queued--
+	e.stats.Running++
+	<-e.slots
+	return l, update, true
+}
+
+// done releases l after one of its updates ran. A chat with more updates goes to the
+// back of the line, so one busy chat cannot keep a worker to itself. It returns the
+// OnHandled callback, for the worker to call outside the lock.
+func (e *Executor) done(l *lane) func(update *gotgbot.Update) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats.Running--
+	e.stats.Handled++
+	if len(l.pending) > 0 {
+		e.ready = append(e.ready, l)
+		e.cond.Signal()
+		return e.onDone
+	}
+	l.scheduled = false
+	delete(e.lanes, l.chatID)
+	return e.onDone
+}
+
+// updateChatID returns the chat an update belongs to. Updates without one share lane 0.
+func updateChatID(update *gotgbot.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.Id
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.Id
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.Id
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.Id
+	case update.ChatMember != nil:
+		return update.ChatMember.Chat.Id
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,185 @@
+package updates
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"save-message/internal/lifecycle"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedHandler records updates per chat and holds each one until its gate opens
+type gatedHandler struct {
+	mu      sync.Mutex
+	order   map[int64][]int64 // chat ID -> update IDs in the order handled
+	running map[int64]int     // chat ID -> updates running right now
+	overlap bool              // two updates of one chat ran at once
+	gates   map[int64]chan struct{}
+	started chan int64
+}
+
+func newGatedHandler() *gatedHandler {
+	return &gatedHandler{
+		order:   make(map[int64][]int64),
+		running: make(map[int64]int),
+		gates:   make(map[int64]chan struct{}),
+		started: make(chan int64, 100),
+	}
+}
+
+// hold makes updates with this ID wait until release
+func (h *gatedHandler) hold(updateID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gates[updateID] = make(chan struct{})
+}
+
+func (h *gatedHandler) release(updateID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	close(h.gates[updateID])
+}
+
+func (h *gatedHandler) HandleUpdate(ctx context.Context, update *gotgbot.Update) error {
+	chatID := update.Message.Chat.Id
+	h.mu.Lock()
+	h.running[chatID]++
+	if h.running[chatID] > 1 {
+		h.overlap = true
+	}
+	gate := h.gates[update.UpdateId]
+	h.mu.Unlock()
+
+	h.started <- update.UpdateId
+	if gate != nil {
+		<-gate
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running[chatID]--
+	h.order[chatID] = append(h.order[chatID], update.UpdateId)
+	return nil
+}
+
+func chatUpdate(updateID, chatID int64) *gotgbot.Update {
+	return &gotgbot.Update{UpdateId: updateID, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: chatID}}}
+}
+
+func waitStarted(t *testing.T, h *gatedHandler, updateID int64) {
+	t.Helper()
+	for {
+		select {
+		case id := <-h.started:
+			if id == updateID {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("update %d did not start", updateID)
+		}
+	}
+}
+
+func TestExecutor_OrdersPerChatAndRunsChatsInParallel(t *testing.T) {
+	handler := newGatedHandler()
+	tracker := lifecycle.NewTracker()
+	executor := NewExecutor(handler, 4, 100)
+	executor.Tracker = tracker
+	executor.Start()
+	ctx := context.Background()
+
+	// Chat 1's first update is slow; chat 2 must not wait for it
+	handler.hold(1)
+	require.NoError(t, executor.HandleUpdate(ctx, chatUpdate(1, -1)))
+	waitStarted(t, handler, 1)
+	for id := int64(2); id <= 20; id++ {
+		chatID := int64(-1)
+		if id%2 == 0 {
+			chatID = -2
+		}
+		require.NoError(t, executor.HandleUpdate(ctx, chatUpdate(id, chatID)))
+	}
+
+	assert.Eventually(t, func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.order[-2]) == 10
+	}, time.Second, time.Millisecond, "the other chat is handled meanwhile")
+	handler.mu.Lock()
+	assert.Empty(t, handler.order[-1], "the slow chat's later updates wait their turn")
+	handler.mu.Unlock()
+
+	handler.release(1)
+	executor.Close()
+	require.NoError(t, tracker.Shutdown(time.Second))
+
+	assert.False(t, handler.overlap, "a chat never has two updates running")
+	assert.Equal(t, []int64{1, 3, 5, 7, 9, 11, 13, 15, 17, 19}, handler.order[-1])
+	assert.Equal(t, []int64{2, 4, 6, 8, 10, 12, 14, 16, 18, 20}, handler.order[-2])
+	stats := executor.Stats()
+	assert.Equal(t, uint64(20), stats.Handled)
+	assert.Zero(t, stats.Queued)
+	assert.Zero(t, stats.Chats)
+}
+
+func TestExecutor_Backpressure(t *testing.T) {
+	handler := newGatedHandler()
+	tracker := lifecycle.NewTracker()
+	executor := NewExecutor(handler, 1, 2)
+	executor.Tracker = tracker
+	executor.Start()
+
+	handler.hold(1)
+	require.NoError(t, executor.HandleUpdate(context.Background(), chatUpdate(1, -1)))
+	waitStarted(t, handler, 1)
+	require.NoError(t, executor.HandleUpdate(context.Background(), chatUpdate(2, -2)))
+	require.NoError(t, executor.HandleUpdate(context.Background(), chatUpdate(3, -3)))
+	assert.Equal(t, 2, executor.QueueDepth())
+
+	// The queue is full: the next update waits for space
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, executor.HandleUpdate(ctx, chatUpdate(4, -4)), context.DeadlineExceeded)
+
+	accepted := make(chan error, 1)
+	go func() { accepted <- executor.HandleUpdate(context.Background(), chatUpdate(5, -5)) }()
+	select {
+	case <-accepted:
+		t.Fatal("update accepted while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	handler.release(1)
+	assert.NoError(t, <-accepted, "space frees up once a worker takes the next update")
+
+	executor.Close()
+	require.NoError(t, tracker.Shutdown(time.Second))
+	stats := executor.Stats()
+	assert.Equal(t, uint64(4), stats.Handled)
+	assert.Equal(t, 2, stats.Peak)
+	assert.Equal(t, uint64(2), stats.Throttled)
+}
+
+func TestExecutor_CloseDrainsQueue(t *testing.T) {
+	handler := newGatedHandler()
+	tracker := lifecycle.NewTracker()
+	executor := NewExecutor(handler, 1, 10)
+	executor.Tracker = tracker
+	executor.Start()
+
+	handler.hold(1)
+	for id := int64(1); id <= 3; id++ {
+		require.NoError(t, executor.HandleUpdate(context.Background(), chatUpdate(id, -1)))
+	}
+	waitStarted(t, handler, 1)
+	executor.Close()
+	assert.ErrorIs(t, executor.HandleUpdate(context.Background(), chatUpdate(4, -1)), ErrExecutorClosed)
+
+	handler.release(1)
+	require.NoError(t, tracker.Shutdown(time.Second))
+	assert.Equal(t, []int64{1, 2, 3}, handler.order[-1], "updates queued before Close are still handled")
+}
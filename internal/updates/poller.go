@@ -0,0 +1,187 @@
+package updates
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"save-message/internal/config"
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Source delivers updates to a handler until ctx ends
+type Source interface {
+	Run(ctx context.Context) error
+}
+
+// OffsetStore persists the getUpdates offset across restarts
+type OffsetStore interface {
+	GetUpdateOffset() (int64, error)
+	SaveUpdateOffset(offset int64) error
+}
+
+// Poller receives updates with getUpdates long polling
+type Poller struct {
+	client     interfaces.TelegramClientInterface
+	handler    interfaces.UpdateHandlerInterface
+	timeout    int           // long polling timeout in seconds
+	retryDelay time.Duration // pause after a failed getUpdates
+	offset     int64         // next update to fetch
+
+	// The saved offset trails offset until the handler has finished every update below it
+	mu        sync.Mutex
+	pending   map[int64]bool // update IDs handed to the handler and not finished yet
+	next      int64          // one past the highest update ID handed to the handler
+	committed int64          // offset last saved
+
+	// Optional: resume from a saved offset and let shutdown drain the update being handled
+	Offsets OffsetStore
+	Tracker *lifecycle.Tracker
+}
+
+var _ Source = (*Poller)(nil)
+
+// NewPoller creates a long polling update source
+func NewPoller(client interfaces.TelegramClientInterface, handler interfaces.UpdateHandlerInterface) *Poller {
+	return &Poller{
+		client:     client,
+		handler:    handler,
+		timeout:    config.DefaultPollingTimeout,
+		retryDelay: config.DefaultRetryDelay,
+	}
+}
+
+// Run removes any webhook (getUpdates is refused while one is set) and polls until ctx ends.
+// Cancelling ctx stops polling; the update being handled finishes under the tracker's context.
+// With an AsyncHandler the saved offset only moves past updates the handler reported finished.
+func (p *Poller) Run(ctx context.Context) error {
+	if p.Offsets != nil {
+		offset, err := p.Offsets.GetUpdateOffset()
+		if err != nil {
+			logutils.Error("Poller: GetUpdateOffsetError", err)
+		} else {
+			p.offset = offset
+		}
+	}
+	p.mu.Lock()
+	p.pending = make(map[int64]bool)
+	p.next = p.offset
+	p.committed = p.offset
+	p.mu.Unlock()
+	async, isAsync := p.handler.(AsyncHandler)
+	if isAsync {
+		async.OnHandled(p.finished)
+	}
+	logutils.Info("Poller: starting", "timeout", p.timeout, "offset", p.offset)
+	if err := DeleteWebhook(ctx, p.client, false); err != nil {
+		logutils.Warn("Poller: DeleteWebhookFailed", "error", err.Error())
+	}
+
+	for {
+		if ctx.Err() != nil {
+			logutils.Info("Poller: stopped", "offset", p.offset)
+			return nil
+		}
+
+		var batch []gotgbot.Update
+		err := p.client.Call(ctx, "getUpdates", map[string]interface{}{
+			"offset":  p.offset,
+			"timeout": p.timeout,
+		}, &batch)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			logutils.Error("Poller: GetUpdatesError", err, "offset", p.offset)
+			p.sleep(ctx)
+			continue
+		}
+
+		for i := range batch {
+			if ctx.Err() != nil {
+				// Updates not finished stay at or above the saved offset and are fetched again on restart
+				break
+			}
+			if !p.handle(&batch[i], isAsync) {
+				// Not queued: fetch it again instead of moving past it
+				p.offset = batch[i].UpdateId
+				p.sleep(ctx)
+				break
+			}
+		}
+	}
+}
+
+// handle hands update to the handler and reports whether it was taken. A synchronous handler
+// is done with the update when it returns, even if handling failed, so the update is never
+// redelivered forever. An async handler that fails has not queued the update at all.
+func (p *Poller) handle(update *gotgbot.Update, async bool) bool {
+	p.started(update.UpdateId)
+	if update.UpdateId >= p.offset {
+		p.offset = update.UpdateId + 1
+	}
+
+	var err error
+	p.Tracker.Do(func() {
+		err = p.handler.HandleUpdate(p.Tracker.Context(), update)
+	})
+	if err != nil && async {
+		// Left pending, so the saved offset stays at or below it
+		logutils.Error("Poller: UpdateNotQueued", err, "updateID", update.UpdateId)
+		return false
+	}
+	if err != nil {
+		logutils.Error("Poller: HandleUpdateError", err, "updateID", update.UpdateId)
+	}
+	if !async {
+		p.finished(update)
+	}
+	return true
+}
+
+// started records that updateID is being handed to the handler
+func (p *Poller) started(updateID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[updateID] = true
+	if updateID >= p.next {
+		p.next = updateID + 1
+	}
+}
+
+// finished records that the handler is done with update and saves the offset below which
+// every update has finished, if that moved
+func (p *Poller) finished(update *gotgbot.Update) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, update.UpdateId)
+
+	offset := p.next
+	for id := range p.pending {
+		if id < offset {
+			offset = id
+		}
+	}
+	if offset <= p.committed {
+		return
+	}
+	p.committed = offset
+	if p.Offsets != nil {
+		if err := p.Offsets.SaveUpdateOffset(offset); err != nil {
+			logutils.Error("Poller: SaveUpdateOffsetError", err, "offset", offset)
+		}
+	}
+}
+
+func (p *Poller) sleep(ctx context.Context) {
+	timer := time.NewTimer(p.retryDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
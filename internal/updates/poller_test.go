@@ -0,0 +1,166 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"save-message/internal/lifecycle"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoller_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeClient{
+		batches: [][]gotgbot.Update{
+			{{UpdateId: 5}, {UpdateId: 6}},
+			nil, // transient failure
+			{{UpdateId: 7}},
+		},
+		onEmpty: cancel,
+	}
+	handler := &recordingHandler{err: errors.New("handler failed")}
+	poller := NewPoller(client, handler)
+	poller.retryDelay = time.Millisecond
+
+	assert.NoError(t, poller.Run(ctx))
+
+	assert.Equal(t, []int64{5, 6, 7}, handler.handled(), "handler errors do not stop polling")
+	assert.Equal(t, "deleteWebhook", client.calls[0])
+	assert.Equal(t, int64(0), client.params[1]["offset"])
+	assert.Equal(t, int64(7), client.params[2]["offset"])
+	assert.Equal(t, int64(7), client.params[3]["offset"], "a failed poll keeps the offset")
+	assert.Equal(t, int64(8), poller.offset)
+}
+
+type memoryOffsets struct {
+	mu     sync.Mutex
+	offset int64
+	saved  []int64
+}
+
+func (m *memoryOffsets) GetUpdateOffset() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.offset, nil
+}
+
+func (m *memoryOffsets) SaveUpdateOffset(offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offset = offset
+	m.saved = append(m.saved, offset)
+	return nil
+}
+
+func (m *memoryOffsets) savedOffsets() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int64(nil), m.saved...)
+}
+
+func TestPoller_ResumesFromSavedOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeClient{batches: [][]gotgbot.Update{{{UpdateId: 41}, {UpdateId: 42}}}, onEmpty: cancel}
+	offsets := &memoryOffsets{offset: 41}
+	poller := NewPoller(client, &recordingHandler{})
+	poller.Offsets = offsets
+
+	assert.NoError(t, poller.Run(ctx))
+	assert.Equal(t, int64(41), client.params[1]["offset"])
+	assert.Equal(t, []int64{42, 43}, offsets.savedOffsets(), "the offset is saved after every update")
+}
+
+// cancellingHandler cancels the poll loop while handling its first update, as a signal would
+type cancellingHandler struct {
+	recordingHandler
+	cancel context.CancelFunc
+}
+
+func (h *cancellingHandler) HandleUpdate(ctx context.Context, update *gotgbot.Update) error {
+	h.cancel()
+	if ctx.Err() != nil {
+		return ctx.Err() // the handler must not see the signal
+	}
+	return h.recordingHandler.HandleUpdate(ctx, update)
+}
+
+func TestPoller_StopsBetweenUpdatesOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeClient{batches: [][]gotgbot.Update{{{UpdateId: 1}, {UpdateId: 2}}}}
+	handler := &cancellingHandler{cancel: cancel}
+	offsets := &memoryOffsets{}
+	poller := NewPoller(client, handler)
+	poller.Offsets = offsets
+	poller.Tracker = lifecycle.NewTracker()
+
+	assert.NoError(t, poller.Run(ctx))
+	assert.Equal(t, []int64{1}, handler.handled(), "the update in flight finishes, the rest wait for the next run")
+	assert.Equal(t, int64(2), poller.offset)
+	assert.Equal(t, int64(2), offsets.offset)
+}
+
+func TestPoller_SavesOffsetOnlyPastFinishedUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := newGatedHandler()
+	handler.hold(1)
+	tracker := lifecycle.NewTracker()
+	executor := NewExecutor(handler, 1, 10)
+	executor.Tracker = tracker
+	executor.Start()
+
+	client := &fakeClient{
+		batches: [][]gotgbot.Update{{*chatUpdate(1, -1), *chatUpdate(2, -2), *chatUpdate(3, -1)}},
+		onEmpty: cancel,
+	}
+	offsets := &memoryOffsets{offset: 1}
+	poller := NewPoller(client, executor)
+	poller.Offsets = offsets
+
+	require.NoError(t, poller.Run(ctx))
+	waitStarted(t, handler, 1)
+
+	// Shutdown gives up while update 1 runs and 2 and 3 are still queued
+	executor.Close()
+	assert.Error(t, tracker.Shutdown(10*time.Millisecond))
+	assert.Equal(t, int64(4), poller.offset, "all three were fetched")
+	assert.Empty(t, offsets.savedOffsets(), "a restart fetches the queued updates again")
+
+	handler.release(1)
+	assert.Eventually(t, func() bool {
+		saved := offsets.savedOffsets()
+		return len(saved) > 0 && saved[len(saved)-1] == 4
+	}, time.Second, time.Millisecond, "the offset moves on once everything before it finished")
+}
+
+func TestPoller_KeepsUpdatesTheExecutorRefused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	executor := NewExecutor(newGatedHandler(), 1, 10)
+	executor.Close()
+
+	client := &fakeClient{batches: [][]gotgbot.Update{{*chatUpdate(5, -1), *chatUpdate(6, -1)}}, onEmpty: cancel}
+	offsets := &memoryOffsets{offset: 5}
+	poller := NewPoller(client, executor)
+	poller.Offsets = offsets
+	poller.retryDelay = time.Millisecond
+
+	require.NoError(t, poller.Run(ctx))
+	assert.Equal(t, int64(5), client.params[2]["offset"], "the refused update is fetched again")
+	assert.Equal(t, int64(5), poller.offset)
+	assert.Empty(t, offsets.savedOffsets())
+}
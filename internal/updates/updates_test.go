@@ -0,0 +1,66 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// fakeClient answers Bot API calls from a script and records what was called
+type fakeClient struct {
+	mu      sync.Mutex
+	calls   []string
+	params  []map[string]interface{}
+	batches [][]gotgbot.Update // successive getUpdates results
+	onEmpty func()             // called once the script runs out
+}
+
+func (f *fakeClient) Call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	f.params = append(f.params, params)
+	if method != "getUpdates" {
+		f.mu.Unlock()
+		return nil
+	}
+	if len(f.batches) == 0 {
+		onEmpty := f.onEmpty
+		f.mu.Unlock()
+		if onEmpty != nil {
+			onEmpty()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	f.mu.Unlock()
+
+	if batch == nil {
+		return errors.New("network down")
+	}
+	*(result.(*[]gotgbot.Update)) = batch
+	return nil
+}
+
+// recordingHandler stands in for router.Dispatcher
+type recordingHandler struct {
+	mu      sync.Mutex
+	updates []int64
+	err     error
+}
+
+func (h *recordingHandler) HandleUpdate(ctx context.Context, update *gotgbot.Update) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.updates = append(h.updates, update.UpdateId)
+	return h.err
+}
+
+func (h *recordingHandler) handled() []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]int64(nil), h.updates...)
+}
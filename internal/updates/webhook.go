@@ -0,0 +1,177 @@
+package updates
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"save-message/internal/interfaces"
+	"save-message/internal/lifecycle"
+	"save-message/internal/logutils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// SecretTokenHeader carries the secret_token given to setWebhook on every webhook request
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize bounds a single webhook request body; real updates are a few KB
+const maxUpdateSize = 1 << 20
+
+// WebhookConfig describes where Telegram should deliver updates and where to listen for them
+type WebhookConfig struct {
+	URL        string // public HTTPS URL registered with setWebhook
+	ListenAddr string // local address, usually behind a reverse proxy
+	Path       string // request path served locally
+	Secret     string // secret_token Telegram echoes in SecretTokenHeader
+}
+
+// WebhookServer receives updates pushed by Telegram to an HTTP endpoint
+type WebhookServer struct {
+	client  interfaces.TelegramClientInterface
+	handler interfaces.UpdateHandlerInterface
+	cfg     WebhookConfig
+
+	shutdownTimeout time.Duration
+
+	// Optional: lets shutdown drain requests still being handled
+	Tracker *lifecycle.Tracker
+}
+
+var _ Source = (*WebhookServer)(nil)
+
+// NewWebhookServer creates a webhook update source
+func NewWebhookServer(client interfaces.TelegramClientInterface, handler interfaces.UpdateHandlerInterface, cfg WebhookConfig) *WebhookServer {
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	return &WebhookServer{
+		client:          client,
+		handler:         handler,
+		cfg:             cfg,
+		shutdownTimeout: 10 * time.Second,
+	}
+}
+
+// Run registers the webhook and serves it until ctx ends.
+// The webhook stays registered on exit so Telegram queues updates during a restart.
+func (ws *WebhookServer) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ws.cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+	return ws.serve(ctx, listener)
+}
+
+func (ws *WebhookServer) serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle(ws.cfg.Path, ws)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Requests run under the tracker's context so a signal does not cut them off mid-update
+		BaseContext: func(net.Listener) context.Context { return ws.Tracker.Context() },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(listener)
+	}()
+	logutils.Info("WebhookServer: listening", "addr", listener.Addr().String(), "path", ws.cfg.Path)
+
+	// Register only once the endpoint is up, so the first push is not refused
+	if err := SetWebhook(ctx, ws.client, ws.cfg.URL, ws.cfg.Secret); err != nil {
+		_ = server.Close()
+		return err
+	}
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ws.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logutils.Error("WebhookServer: ShutdownError", err)
+		return err
+	}
+	logutils.Info("WebhookServer: stopped")
+	return nil
+}
+
+// ServeHTTP accepts one update. Anything but a POST carrying the right secret is rejected.
+func (ws *WebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !ws.validSecret(r.Header.Get(SecretTokenHeader)) {
+		logutils.Warn("WebhookServer: rejected request with invalid secret token", "remote", r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var update gotgbot.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		logutils.Error("WebhookServer: DecodeUpdateError", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Handler errors are logged, not reported: a non-2xx reply makes Telegram redeliver the update.
+	// An AsyncHandler only queues the update, so its error means the update was not taken.
+	accepted := true
+	ws.Tracker.Do(func() {
+		if err := ws.handler.HandleUpdate(r.Context(), &update); err != nil {
+			logutils.Error("WebhookServer: HandleUpdateError", err, "updateID", update.UpdateId)
+			_, async := ws.handler.(AsyncHandler)
+			accepted = !async
+		}
+	})
+	if !accepted {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ws *WebhookServer) validSecret(got string) bool {
+	return ws.cfg.Secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(ws.cfg.Secret)) == 1
+}
+
+// SetWebhook registers url as the bot's webhook with the given secret token
+func SetWebhook(ctx context.Context, client interfaces.TelegramClientInterface, url, secret string) error {
+	err := client.Call(ctx, "setWebhook", map[string]interface{}{
+		"url":          url,
+		"secret_token": secret,
+	}, nil)
+	if err != nil {
+		logutils.Error("SetWebhook", err, "url", url)
+		return err
+	}
+	logutils.Success("SetWebhook", "url", url)
+	return nil
+}
+
+// DeleteWebhook removes the bot's webhook so updates can be fetched with getUpdates
+func DeleteWebhook(ctx context.Context, client interfaces.TelegramClientInterface, dropPendingUpdates bool) error {
+	err := client.Call(ctx, "deleteWebhook", map[string]interface{}{
+		"drop_pending_updates": dropPendingUpdates,
+	}, nil)
+	if err != nil {
+		logutils.Error("DeleteWebhook", err)
+		return err
+	}
+	logutils.Success("DeleteWebhook", "drop_pending_updates", dropPendingUpdates)
+	return nil
+}
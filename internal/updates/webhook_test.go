@@ -0,0 +1,121 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookServer_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		secret      string
+		body        string
+		wantStatus  int
+		wantHandled []int64
+	}{
+		{name: "valid update", method: http.MethodPost, secret: "s3cret", body: `{"update_id":42}`, wantStatus: http.StatusOK, wantHandled: []int64{42}},
+		{name: "missing secret", method: http.MethodPost, body: `{"update_id":42}`, wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", method: http.MethodPost, secret: "guess", body: `{"update_id":42}`, wantStatus: http.StatusUnauthorized},
+		{name: "wrong method", method: http.MethodGet, secret: "s3cret", wantStatus: http.StatusMethodNotAllowed},
+		{name: "malformed body", method: http.MethodPost, secret: "s3cret", body: `{"update_id":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &recordingHandler{}
+			server := NewWebhookServer(&fakeClient{}, handler, WebhookConfig{Path: "/hook", Secret: "s3cret"})
+
+			req := httptest.NewRequest(tt.method, "/hook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(SecretTokenHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantHandled, handler.handled())
+		})
+	}
+}
+
+func TestWebhookServer_EmptySecretRejectsEverything(t *testing.T) {
+	handler := &recordingHandler{}
+	server := NewWebhookServer(&fakeClient{}, handler, WebhookConfig{})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1}`)))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, handler.handled())
+}
+
+func TestWebhookServer_RedeliversUpdatesNotAccepted(t *testing.T) {
+	post := func(server *WebhookServer) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":1}`))
+		req.Header.Set(SecretTokenHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cfg := WebhookConfig{Secret: "s3cret"}
+
+	// A failed handler is not retried: the update was handled, just not well
+	handler := &recordingHandler{err: errors.New("boom")}
+	assert.Equal(t, http.StatusOK, post(NewWebhookServer(&fakeClient{}, handler, cfg)))
+	assert.Equal(t, []int64{1}, handler.handled())
+
+	// An executor that no longer takes updates leaves them to Telegram
+	executor := NewExecutor(&recordingHandler{}, 1, 1)
+	executor.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, post(NewWebhookServer(&fakeClient{}, executor, cfg)))
+}
+
+func TestWebhookServer_Run(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	client := &fakeClient{}
+	handler := &recordingHandler{}
+	server := NewWebhookServer(client, handler, WebhookConfig{
+		URL:    "https://bot.example.com/telegram",
+		Path:   "/telegram",
+		Secret: "s3cret",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.serve(ctx, listener) }()
+
+	// setWebhook is only called once the endpoint is serving
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.calls) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "setWebhook", client.calls[0])
+	assert.Equal(t, "https://bot.example.com/telegram", client.params[0]["url"])
+	assert.Equal(t, "s3cret", client.params[0]["secret_token"])
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/telegram", strings.NewReader(`{"update_id":9}`))
+	require.NoError(t, err)
+	req.Header.Set(SecretTokenHeader, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []int64{9}, handler.handled())
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"setWebhook"}, client.calls, "the webhook stays registered across restarts")
+}
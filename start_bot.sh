@@ -2,4 +2,4 @@
 # Usage: bash start_bot.sh
 # Starts the Go Telegram bot and logs output to bot.log
  
-go run cmd/modular/main.go > bot.log 2>&1 
\ No newline at end of file
+go run -tags sqlite_fts5 cmd/modular/main.go > bot.log 2>&1 
\ No newline at end of file